@@ -2,23 +2,62 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/edgejay/pify-player/api/internal/app"
+	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/database/migrations"
+	"github.com/edgejay/pify-player/api/internal/logging"
 	"github.com/edgejay/pify-player/api/internal/server"
 	"github.com/edgejay/pify-player/api/internal/utils"
 )
 
 func main() {
-	serverSettings := utils.GetServerSettings()
-	port := serverSettings.Port
-	corsOrigins := serverSettings.CorsOrigins
-	sslDomain := serverSettings.SslDomain
+	logging.Setup()
 
-	server := server.NewServer(port, corsOrigins, sslDomain)
+	// probes the server started with the same environment, for the healthcheck of the container
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		if err := server.Healthcheck(context.Background(), utils.GetServerSettings()); err != nil {
+			slog.Error("healthcheck failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	config := app.GetConfig()
+
+	db, err := database.NewDBFromEnv()
+	if err != nil {
+		slog.Error("database setup failed", "error", err)
+		os.Exit(1)
+	}
+
+	if config.AutoMigrate {
+		// waits for migrations started elsewhere, e.g. by the migrations command, to finish
+		migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), time.Minute)
+		group, err := database.Migrate(migrateCtx, db, migrations.Migrations)
+		cancelMigrate()
+		if err != nil {
+			slog.Error("auto migration failed", "error", err)
+			os.Exit(1)
+		}
+		if !group.IsZero() {
+			slog.Info("database migrated", "group", group.String())
+		}
+	}
+
+	// Wire up services, middlewares and handlers once for the whole process
+	application := app.NewApp(db, config)
+
+	server := server.NewServer(config.ServerSettings, application)
+
+	// Background jobs such as database backups stop once the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	application.Start(jobsCtx)
 
 	// Channel to listen for OS signals for graceful shutdown
 	stop := make(chan os.Signal, 1)
@@ -31,13 +70,18 @@ func main() {
 
 	// Wait for termination signal
 	<-stop
-	log.Println("\nShutting down server gracefully...")
+	slog.Info("shutting down server gracefully")
 
 	// Shutdown with timeout
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	stopJobs()
 	server.Shutdown(shutdownCtx)
 
-	log.Println("Server shutdown complete.")
+	if err := application.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
+	}
+
+	slog.Info("server shutdown complete")
 }
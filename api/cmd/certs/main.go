@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/edgejay/pify-player/api/internal/certs"
+)
+
+// renewBefore matches the renewal window used by the api server in local_ca TLS mode.
+const renewBefore = 30 * 24 * time.Hour
+
+func main() {
+	app := &cli.App{
+		Name:  "certs",
+		Usage: "issue SSL certs for the player and api using the built-in local CA",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "dir",
+				Value: "./certs",
+				Usage: "folder to write certs into, the CA is kept in its ca subfolder",
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "issue",
+				Usage: "issue a certificate for a domain, unless a valid one exists",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "domain",
+						Aliases:  []string{"d"},
+						Usage:    "domain name to issue the certificate for",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "issue a new certificate even if the existing one is still valid",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					dir := c.String("dir")
+					domain := c.String("domain")
+
+					ca, err := certs.LoadOrCreateCA(filepath.Join(dir, "ca"))
+					if err != nil {
+						return err
+					}
+
+					hosts := []string{domain, "localhost", "127.0.0.1", "::1"}
+					certFile := filepath.Join(dir, fmt.Sprintf("%s.pem", domain))
+					keyFile := filepath.Join(dir, fmt.Sprintf("%s.key.pem", domain))
+
+					if c.Bool("force") {
+						err = ca.Issue(hosts, certFile, keyFile)
+					} else {
+						var issued bool
+						issued, err = ca.EnsureCertificate(hosts, certFile, keyFile, renewBefore)
+						if err == nil && !issued {
+							log.Printf("certificate %s is still valid, use --force to issue a new one\n", certFile)
+							return nil
+						}
+					}
+					if err != nil {
+						return err
+					}
+
+					log.Printf("issued certificate %s for %v\n", certFile, hosts)
+					log.Printf("install %s on devices accessing the player to trust it\n", filepath.Join(dir, "ca", certs.CA_CERT_FILE))
+					return nil
+				},
+			},
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -3,9 +3,14 @@ package main
 // Based on migrator example from Bun: https://github.com/uptrace/bun/blob/master/example/migrate/main.go
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/uptrace/bun/migrate"
 
@@ -13,15 +18,20 @@ import (
 
 	"github.com/edgejay/pify-player/api/internal/database"
 	"github.com/edgejay/pify-player/api/internal/database/migrations"
+	"github.com/edgejay/pify-player/api/internal/utils"
 )
 
 func main() {
-	sqliteDB := database.GetSQLiteDB()
+	db, err := database.NewDBFromEnv()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
 
 	app := &cli.App{
 		Name: "bun",
 		Commands: []*cli.Command{
-			newDBCommand(migrate.NewMigrator(sqliteDB.Bun, migrations.Migrations)),
+			newDBCommand(db, migrate.NewMigrator(db.Bun, migrations.Migrations)),
 		},
 	}
 
@@ -30,7 +40,7 @@ func main() {
 	}
 }
 
-func newDBCommand(migrator *migrate.Migrator) *cli.Command {
+func newDBCommand(db *database.DB, migrator *migrate.Migrator) *cli.Command {
 	return &cli.Command{
 		Name:  "db",
 		Usage: "database migrations",
@@ -45,7 +55,24 @@ func newDBCommand(migrator *migrate.Migrator) *cli.Command {
 			{
 				Name:  "migrate",
 				Usage: "migrate database",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print the SQL of pending migrations, run against a scratch copy of the database",
+					},
+				},
 				Action: func(c *cli.Context) error {
+					if c.Bool("dry-run") {
+						queries, err := database.MigrateDryRun(c.Context, db, migrations.Migrations)
+						for _, query := range queries {
+							fmt.Printf("%s;\n", query)
+						}
+						if err == nil && len(queries) == 0 {
+							log.Println("there are no new migrations to run (database is up to date)")
+						}
+						return err
+					}
+
 					if err := migrator.Lock(c.Context); err != nil {
 						return err
 					}
@@ -153,18 +180,52 @@ func newDBCommand(migrator *migrate.Migrator) *cli.Command {
 			},
 			{
 				Name:  "status",
-				Usage: "print migrations status",
+				Usage: "print a table of applied and pending migrations",
 				Action: func(c *cli.Context) error {
 					ms, err := migrator.MigrationsWithStatus(c.Context)
 					if err != nil {
 						return err
 					}
-					log.Printf("migrations: %s\n", ms)
-					log.Printf("unapplied migrations: %s\n", ms.Unapplied())
-					log.Printf("last migration group: %s\n", ms.LastGroup())
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "MIGRATION\tCOMMENT\tGROUP\tMIGRATED AT\tSTATUS")
+					for _, m := range ms {
+						group, migratedAt, status := "-", "-", "pending"
+						if m.IsApplied() {
+							group = strconv.FormatInt(m.GroupID, 10)
+							migratedAt = m.MigratedAt.Local().Format(time.DateTime)
+							status = "applied"
+						}
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Name, m.Comment, group, migratedAt, status)
+					}
+					if err := w.Flush(); err != nil {
+						return err
+					}
+
+					fmt.Printf("\n%d applied, %d pending, last group: %s\n",
+						len(ms.Applied()), len(ms.Unapplied()), ms.LastGroup())
 					return nil
 				},
 			},
+			{
+				Name:  "verify",
+				Usage: "compare the database schema with the models and report drift",
+				Action: func(c *cli.Context) error {
+					drifts, err := db.Verify(c.Context)
+					if err != nil {
+						return err
+					}
+					if len(drifts) == 0 {
+						log.Println("database schema matches the models")
+						return nil
+					}
+
+					for _, drift := range drifts {
+						fmt.Println(drift)
+					}
+					return cli.Exit(fmt.Sprintf("found %d differences between database schema and models", len(drifts)), 1)
+				},
+			},
 			{
 				Name:  "mark_applied",
 				Usage: "mark migrations as applied without actually running them",
@@ -181,6 +242,121 @@ func newDBCommand(migrator *migrate.Migrator) *cli.Command {
 					return nil
 				},
 			},
+			{
+				Name:      "backup",
+				Usage:     "write a consistent copy of the database, safe while the api is running",
+				ArgsUsage: "<file>",
+				Action: func(c *cli.Context) error {
+					dest := c.Args().First()
+					if dest == "" {
+						return fmt.Errorf("backup file is required")
+					}
+					if err := db.Backup(c.Context, dest); err != nil {
+						return err
+					}
+					log.Printf("database backed up to %s\n", dest)
+					return nil
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "replace the database with a backup (stop the api first)",
+				ArgsUsage: "<file>",
+				Action: func(c *cli.Context) error {
+					src := c.Args().First()
+					if src == "" {
+						return fmt.Errorf("backup file is required")
+					}
+					// the restored file replaces the one opened by this command
+					db.Close()
+
+					status, err := database.Restore(c.Context, src, utils.GetDBFilename(), migrations.Migrations)
+					if err != nil {
+						return err
+					}
+					log.Printf("database restored from %s\n", src)
+					if len(status.Unapplied) > 0 {
+						log.Printf("backup is missing migrations %s, run `db migrate`\n", status.Unapplied)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "export",
+				Usage: "export users, sessions, track media and player states to a JSON bundle",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "bundle file, defaults to stdout",
+					},
+					&cli.BoolFlag{
+						Name:  "without-tokens",
+						Usage: "leave out spotify access and refresh tokens",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					bundle, err := db.Export(c.Context, database.ExportOptions{
+						WithoutTokens: c.Bool("without-tokens"),
+					})
+					if err != nil {
+						return err
+					}
+
+					data, err := json.MarshalIndent(bundle, "", "  ")
+					if err != nil {
+						return err
+					}
+
+					if output := c.String("output"); output != "" {
+						if err := os.WriteFile(output, data, 0o600); err != nil {
+							return err
+						}
+						log.Printf("exported %d users, %d sessions, %d track media to %s\n",
+							len(bundle.Users), len(bundle.UserSessions), len(bundle.TrackMedia), output)
+						return nil
+					}
+
+					_, err = fmt.Println(string(data))
+					return err
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "import a JSON bundle created by export",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "replace",
+						Usage: "delete existing rows before importing",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					src := c.Args().First()
+					if src == "" {
+						return fmt.Errorf("bundle file is required")
+					}
+
+					data, err := os.ReadFile(src)
+					if err != nil {
+						return err
+					}
+
+					var bundle database.Bundle
+					if err := json.Unmarshal(data, &bundle); err != nil {
+						return fmt.Errorf("parse bundle: %w", err)
+					}
+
+					if err := db.Import(c.Context, &bundle, database.ImportOptions{
+						Replace: c.Bool("replace"),
+					}); err != nil {
+						return err
+					}
+					log.Printf("imported %d users, %d sessions, %d track media from %s\n",
+						len(bundle.Users), len(bundle.UserSessions), len(bundle.TrackMedia), src)
+					return nil
+				},
+			},
 		},
 	}
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// apiClient runs the admin operations through the admin routes of a running api.
+type apiClient struct {
+	baseUrl    string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+var _ admin = (*apiClient)(nil)
+
+// newApiClient creates a client of the api at baseUrl. With insecure set, the certificate of the api
+// is not verified, e.g. for the self-signed certificates of a kiosk on the local network.
+func newApiClient(baseUrl, username, password string, insecure bool) *apiClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &apiClient{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/") + constants.API_V1_PREFIX + "/admin",
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+}
+
+// apiError is an error answered by the api, carrying its error code when there is one.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s (%d): %s", e.Code, e.Status, e.Message)
+	}
+	return fmt.Sprintf("api answered %d", e.Status)
+}
+
+// call sends a request to the admin route at path and decodes the data of the response into data, if not nil.
+func (c *apiClient) call(ctx context.Context, method, path string, body, data any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var errRes pifyHttp.ErrorResponse
+		if err := json.NewDecoder(res.Body).Decode(&errRes); err != nil || errRes.Error == nil {
+			return &apiError{Status: res.StatusCode}
+		}
+		return &apiError{res.StatusCode, errRes.Error.Code, errRes.Error.Message}
+	}
+
+	if data == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(&pifyHttp.ApiResponse{Data: data})
+}
+
+func (c *apiClient) ListUsers(ctx context.Context) ([]services.UserSummary, error) {
+	var users []services.UserSummary
+	err := c.call(ctx, http.MethodGet, "/users", nil, &users)
+	return users, err
+}
+
+func (c *apiClient) RevokeUser(ctx context.Context, username string) (int, error) {
+	var res pifyHttp.CountResponse
+	err := c.call(ctx, http.MethodDelete, "/users/"+url.PathEscape(username)+"/sessions", nil, &res)
+	return res.Count, err
+}
+
+func (c *apiClient) SetRole(ctx context.Context, username, role string) (*services.UserSummary, error) {
+	var user services.UserSummary
+	err := c.call(ctx, http.MethodPut, "/users/"+url.PathEscape(username)+"/role", pifyHttp.AdminUserRoleRequest{Role: role}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *apiClient) ListSessions(ctx context.Context) ([]services.SessionSummary, error) {
+	var sessions []services.SessionSummary
+	err := c.call(ctx, http.MethodGet, "/sessions", nil, &sessions)
+	return sessions, err
+}
+
+func (c *apiClient) RevokeSession(ctx context.Context, uuid string) error {
+	return c.call(ctx, http.MethodDelete, "/sessions/"+url.PathEscape(uuid), nil, nil)
+}
+
+func (c *apiClient) GetController(ctx context.Context) (*services.SessionSummary, error) {
+	var session services.SessionSummary
+	if err := c.call(ctx, http.MethodGet, "/controller", nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (c *apiClient) SetController(ctx context.Context, uuid string) (*services.SessionSummary, error) {
+	var session services.SessionSummary
+	if err := c.call(ctx, http.MethodPut, "/controller", pifyHttp.AdminControllerRequest{Uuid: uuid}, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (c *apiClient) ListTrackMedia(ctx context.Context, spotifyTrackId string) ([]services.TrackMediaSummary, error) {
+	var media []services.TrackMediaSummary
+	err := c.call(ctx, http.MethodGet, "/track-media?"+url.Values{"spotify_track_id": {spotifyTrackId}}.Encode(), nil, &media)
+	return media, err
+}
+
+func (c *apiClient) PurgeTrackMedia(ctx context.Context, spotifyTrackId string, all bool) (int, error) {
+	query := url.Values{"spotify_track_id": {spotifyTrackId}}
+	if all {
+		query.Set("all", "true")
+	}
+
+	var res pifyHttp.CountResponse
+	err := c.call(ctx, http.MethodDelete, "/track-media?"+query.Encode(), nil, &res)
+	return res.Count, err
+}
+
+func (c *apiClient) RefreshToken(ctx context.Context, uuid string) (*services.SessionSummary, error) {
+	path := "/controller/refresh"
+	if uuid != "" {
+		path = "/sessions/" + url.PathEscape(uuid) + "/refresh"
+	}
+
+	var session services.SessionSummary
+	if err := c.call(ctx, http.MethodPost, path, nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (c *apiClient) ListDevices(ctx context.Context) (*services.SpotifyDevices, error) {
+	var devices services.SpotifyDevices
+	if err := c.call(ctx, http.MethodGet, "/devices", nil, &devices); err != nil {
+		return nil, err
+	}
+	return &devices, nil
+}
+
+func (c *apiClient) TransferPlayback(ctx context.Context, deviceId string) error {
+	return c.call(ctx, http.MethodPost, "/playback/transfer", pifyHttp.AdminTransferPlaybackRequest{DeviceId: deviceId}, nil)
+}
+
+func (c *apiClient) ListAuditEvents(ctx context.Context, action string, limit int) ([]services.AuditEventSummary, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if action != "" {
+		query.Set("action", action)
+	}
+
+	var events []services.AuditEventSummary
+	err := c.call(ctx, http.MethodGet, "/audit?"+query.Encode(), nil, &events)
+	return events, err
+}
+
+func (c *apiClient) LoginURL(ctx context.Context) (string, error) {
+	var res pifyHttp.LoginUrlResponse
+	err := c.call(ctx, http.MethodGet, "/login-url", nil, &res)
+	return res.Url, err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/handlers"
+	"github.com/edgejay/pify-player/api/internal/middlewares"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// newTestClient serves the admin routes backed by an in-memory store and returns a client of them.
+func newTestClient(t *testing.T, password string) (*apiClient, *repositories.MemoryStore) {
+	t.Helper()
+	t.Setenv("ADMIN_USERNAME", "admin")
+	t.Setenv("ADMIN_PASSWORD", "secret")
+	t.Setenv("CALLBACK_DEST", "https://pify.local/")
+
+	store := repositories.NewMemoryStore()
+	spotifyService := services.NewSpotifyService(services.SpotifyCredentials{}, nil)
+	userService := services.NewUserService(store.Users(), store.Sessions())
+	adminService := services.NewAdminService(store.Users(), store.Sessions(), store.TrackMedia(), store.Audit(), spotifyService)
+	h := handlers.NewHandlers(
+		spotifyService,
+		userService,
+		services.NewPlayerService(store.Sessions(), store.TrackMedia()),
+		nil,
+		nil,
+		adminService,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		middlewares.NewMiddlewareFactory(constants.COOKIE_SESSION_ID, userService, spotifyService),
+	)
+
+	e := echo.New()
+	e.HTTPErrorHandler = h.HTTPErrorHandler
+	h.SetAdminRoutes(e.Group(constants.API_V1_PREFIX + "/admin"))
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	return newApiClient(server.URL+"/", "admin", password, false), store
+}
+
+func TestApiClient(t *testing.T) {
+	ctx := context.Background()
+	client, store := newTestClient(t, "secret")
+
+	user, err := store.Users().Upsert(ctx, &models.User{Username: "alice", DisplayName: "Alice"})
+	require.NoError(t, err)
+	for _, uuid := range []string{"kiosk", "phone"} {
+		_, err := store.Sessions().Upsert(ctx, &models.UserSession{
+			UserId:               user.Id,
+			Uuid:                 uuid,
+			UserAgent:            "test",
+			AccessToken:          "token",
+			AccessTokenExpiresAt: time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.TrackMedia().Upsert(ctx, &models.TrackMedia{SpotifyTrackId: "track", MediaType: "youtube", MediaId: "video"}))
+	require.NoError(t, store.Audit().Add(ctx, &models.AuditEvent{Action: models.AUDIT_ACTION_LOCKOUT, Actor: "ip:192.168.1.20", Subject: "admin_auth"}))
+
+	users, err := client.ListUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, 2, users[0].ActiveSessions)
+	assert.Equal(t, models.USER_ROLE_MEMBER, users[0].Role)
+
+	owner, err := client.SetRole(ctx, "alice", models.USER_ROLE_OWNER)
+	require.NoError(t, err)
+	assert.Equal(t, models.USER_ROLE_OWNER, owner.Role)
+	_, err = client.SetRole(ctx, "alice", "admin")
+	var roleErr *apiError
+	require.ErrorAs(t, err, &roleErr)
+	assert.Equal(t, pifyErrors.INVALID_USER_ROLE, roleErr.Code)
+
+	_, err = client.GetController(ctx)
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, pifyErrors.CONTROLLER_NOT_FOUND, apiErr.Code)
+	assert.Equal(t, http.StatusNotFound, apiErr.Status)
+
+	controller, err := client.SetController(ctx, "kiosk")
+	require.NoError(t, err)
+	assert.Equal(t, "kiosk", controller.Uuid)
+	assert.True(t, controller.IsController)
+
+	require.NoError(t, client.RevokeSession(ctx, "phone"))
+	sessions, err := client.ListSessions(ctx)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "alice", sessions[0].Username)
+
+	media, err := client.ListTrackMedia(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, media, 1)
+	assert.Equal(t, "video", media[0].MediaId)
+
+	count, err := client.PurgeTrackMedia(ctx, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = client.RevokeUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	loginUrl, err := client.LoginURL(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "https://pify.local/", loginUrl)
+
+	events, err := client.ListAuditEvents(ctx, models.AUDIT_ACTION_LOCKOUT, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "ip:192.168.1.20", events[0].Actor)
+}
+
+func TestApiClientInvalidCredentials(t *testing.T) {
+	client, _ := newTestClient(t, "wrong")
+
+	_, err := client.ListUsers(context.Background())
+	assert.ErrorContains(t, err, "invalid_credentials (401)")
+}
+
+func TestWriteQR(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeQR(&buf, "https://pify.local/"))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	// square, including the quiet zone
+	assert.Equal(t, len(lines), strings.Count(lines[0], "  "))
+	for _, line := range lines {
+		assert.True(t, strings.HasSuffix(line, ansiReset))
+	}
+	assert.Contains(t, buf.String(), ansiBlack)
+	assert.Contains(t, buf.String(), ansiWhite)
+}
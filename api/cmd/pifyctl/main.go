@@ -0,0 +1,492 @@
+// Command pifyctl administers a pify player: users, sessions, the controller, cached track media, playback
+// and the audit log.
+// It talks to a running api through its admin routes, or operates directly on the database with --offline.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+const DEFAULT_API_URL = "https://localhost"
+
+// admin lists the operations of pifyctl, implemented by the api client and by the admin service for offline use.
+type admin interface {
+	ListUsers(ctx context.Context) ([]services.UserSummary, error)
+	RevokeUser(ctx context.Context, username string) (int, error)
+	SetRole(ctx context.Context, username, role string) (*services.UserSummary, error)
+	ListSessions(ctx context.Context) ([]services.SessionSummary, error)
+	RevokeSession(ctx context.Context, uuid string) error
+	GetController(ctx context.Context) (*services.SessionSummary, error)
+	SetController(ctx context.Context, uuid string) (*services.SessionSummary, error)
+	ListTrackMedia(ctx context.Context, spotifyTrackId string) ([]services.TrackMediaSummary, error)
+	PurgeTrackMedia(ctx context.Context, spotifyTrackId string, all bool) (int, error)
+	RefreshToken(ctx context.Context, uuid string) (*services.SessionSummary, error)
+	ListDevices(ctx context.Context) (*services.SpotifyDevices, error)
+	TransferPlayback(ctx context.Context, deviceId string) error
+	LoginURL(ctx context.Context) (string, error)
+	ListAuditEvents(ctx context.Context, action string, limit int) ([]services.AuditEventSummary, error)
+}
+
+var _ admin = (*services.AdminService)(nil)
+
+func main() {
+	// database and service logs are only interesting when something goes wrong
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	var backend admin
+	closeBackend := func() {}
+
+	app := &cli.App{
+		Name:  "pifyctl",
+		Usage: "administer a pify player",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "api-url",
+				Usage:   "base url of the api",
+				Value:   DEFAULT_API_URL,
+				EnvVars: []string{"PIFY_API_URL"},
+			},
+			&cli.StringFlag{
+				Name:    "username",
+				Usage:   "admin username",
+				EnvVars: []string{"ADMIN_USERNAME"},
+			},
+			&cli.StringFlag{
+				Name:    "password",
+				Usage:   "admin password",
+				EnvVars: []string{"ADMIN_PASSWORD"},
+			},
+			&cli.BoolFlag{
+				Name:    "insecure",
+				Usage:   "skip verification of the api certificate",
+				EnvVars: []string{"PIFY_INSECURE"},
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "operate directly on the database (DB_DRIVER, DB_FILE, DATABASE_URL) instead of the api",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.Bool("offline") {
+				db, err := database.NewDBFromEnv()
+				if err != nil {
+					return err
+				}
+				closeBackend = func() { db.Close() }
+				backend = newOfflineAdmin(db)
+				return nil
+			}
+
+			if c.String("username") == "" || c.String("password") == "" {
+				return fmt.Errorf("admin credentials are required, set ADMIN_USERNAME and ADMIN_PASSWORD or use --offline")
+			}
+			backend = newApiClient(c.String("api-url"), c.String("username"), c.String("password"), c.Bool("insecure"))
+			return nil
+		},
+		After: func(c *cli.Context) error {
+			closeBackend()
+			return nil
+		},
+		Commands: []*cli.Command{
+			newUsersCommand(&backend),
+			newSessionsCommand(&backend),
+			newControllerCommand(&backend),
+			newMediaCommand(&backend),
+			newTokenCommand(&backend),
+			newPlaybackCommand(&backend),
+			newQRCommand(&backend),
+			newAuditCommand(&backend),
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		// not log.Fatalln, the default slog handler would drop it below the warn level
+		fmt.Fprintln(os.Stderr, "pifyctl:", err)
+		os.Exit(1)
+	}
+}
+
+// newOfflineAdmin runs the admin operations on db, like the api would.
+func newOfflineAdmin(db *database.DB) *services.AdminService {
+	return services.NewAdminService(
+		repositories.NewBunUserRepository(db),
+		repositories.NewBunSessionRepository(db),
+		repositories.NewBunTrackMediaRepository(db),
+		repositories.NewBunAuditRepository(db),
+		services.NewSpotifyService(services.GetSpotifyCredentials(), nil),
+	)
+}
+
+func newUsersCommand(backend *admin) *cli.Command {
+	return &cli.Command{
+		Name:  "users",
+		Usage: "list users, revoke their sessions and set their role",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "list users with their number of active sessions",
+				Action: func(c *cli.Context) error {
+					users, err := (*backend).ListUsers(c.Context)
+					if err != nil {
+						return err
+					}
+
+					w := newTable("ID", "USERNAME", "DISPLAY NAME", "ROLE", "SESSIONS", "CREATED")
+					for _, user := range users {
+						fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n",
+							user.Id, user.Username, user.DisplayName, user.Role, user.ActiveSessions, formatTime(user.CreatedAt))
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "revoke",
+				Usage:     "log the user out of all sessions",
+				ArgsUsage: "<username>",
+				Action: func(c *cli.Context) error {
+					username, err := requireArg(c, "username")
+					if err != nil {
+						return err
+					}
+
+					count, err := (*backend).RevokeUser(c.Context, username)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("revoked %d sessions of %s\n", count, username)
+					return nil
+				},
+			},
+			{
+				Name:      "role",
+				Usage:     "set the role of the user, owners edit the content policies",
+				ArgsUsage: "<username> <member|owner>",
+				Action: func(c *cli.Context) error {
+					username, err := requireArg(c, "username")
+					if err != nil {
+						return err
+					}
+					role := c.Args().Get(1)
+					if role == "" {
+						return fmt.Errorf("role is required")
+					}
+
+					user, err := (*backend).SetRole(c.Context, username, role)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("%s is now %s\n", user.Username, user.Role)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func newSessionsCommand(backend *admin) *cli.Command {
+	return &cli.Command{
+		Name:  "sessions",
+		Usage: "list and revoke sessions",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "list active sessions",
+				Action: func(c *cli.Context) error {
+					sessions, err := (*backend).ListSessions(c.Context)
+					if err != nil {
+						return err
+					}
+
+					w := newTable("UUID", "USER", "CONTROLLER", "TOKEN EXPIRES", "CREATED", "USER AGENT")
+					for _, session := range sessions {
+						writeSession(w, session)
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "revoke",
+				Usage:     "log the session out",
+				ArgsUsage: "<uuid>",
+				Action: func(c *cli.Context) error {
+					uuid, err := requireArg(c, "session uuid")
+					if err != nil {
+						return err
+					}
+
+					if err := (*backend).RevokeSession(c.Context, uuid); err != nil {
+						return err
+					}
+					fmt.Printf("revoked session %s\n", uuid)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func newControllerCommand(backend *admin) *cli.Command {
+	return &cli.Command{
+		Name:  "controller",
+		Usage: "show and set the session controlling the player",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "show",
+				Usage: "show the controller session",
+				Action: func(c *cli.Context) error {
+					session, err := (*backend).GetController(c.Context)
+					if err != nil {
+						return err
+					}
+					return printSession(*session)
+				},
+			},
+			{
+				Name:      "set",
+				Usage:     "make the session the only controller",
+				ArgsUsage: "<uuid>",
+				Action: func(c *cli.Context) error {
+					uuid, err := requireArg(c, "session uuid")
+					if err != nil {
+						return err
+					}
+
+					session, err := (*backend).SetController(c.Context, uuid)
+					if err != nil {
+						return err
+					}
+					return printSession(*session)
+				},
+			},
+		},
+	}
+}
+
+func newMediaCommand(backend *admin) *cli.Command {
+	return &cli.Command{
+		Name:  "media",
+		Usage: "inspect and purge the media cached for tracks",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "inspect",
+				Usage:     "list the media cached for a track, or for all tracks",
+				ArgsUsage: "[spotify track id]",
+				Action: func(c *cli.Context) error {
+					media, err := (*backend).ListTrackMedia(c.Context, c.Args().First())
+					if err != nil {
+						return err
+					}
+
+					w := newTable("SPOTIFY TRACK", "TYPE", "MEDIA ID", "CREATED")
+					for _, m := range media {
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.SpotifyTrackId, m.MediaType, m.MediaId, formatTime(m.CreatedAt))
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "purge",
+				Usage:     "delete the media cached for a track, searched again on the next play",
+				ArgsUsage: "<spotify track id>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "delete the media of all tracks",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					trackId := c.Args().First()
+					if trackId == "" && !c.Bool("all") {
+						return fmt.Errorf("spotify track id or --all is required")
+					}
+
+					count, err := (*backend).PurgeTrackMedia(c.Context, trackId, c.Bool("all"))
+					if err != nil {
+						return err
+					}
+					fmt.Printf("purged %d cached media\n", count)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func newTokenCommand(backend *admin) *cli.Command {
+	return &cli.Command{
+		Name:  "token",
+		Usage: "manage spotify access tokens",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "refresh",
+				Usage:     "refresh the access token of the session, or of the controller",
+				ArgsUsage: "[uuid]",
+				Action: func(c *cli.Context) error {
+					session, err := (*backend).RefreshToken(c.Context, c.Args().First())
+					if err != nil {
+						return err
+					}
+					fmt.Printf("access token of %s refreshed, expires %s\n", session.Uuid, formatTime(session.AccessTokenExpiresAt))
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func newPlaybackCommand(backend *admin) *cli.Command {
+	return &cli.Command{
+		Name:  "playback",
+		Usage: "control the playback of the controller",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "devices",
+				Usage: "list the spotify devices of the controller",
+				Action: func(c *cli.Context) error {
+					devices, err := (*backend).ListDevices(c.Context)
+					if err != nil {
+						return err
+					}
+
+					w := newTable("ID", "NAME", "TYPE", "ACTIVE")
+					for _, device := range devices.Devices {
+						fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", device.ID, device.Name, device.Type, device.IsActive)
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "transfer",
+				Usage:     "transfer playback to the device",
+				ArgsUsage: "<device id>",
+				Action: func(c *cli.Context) error {
+					deviceId, err := requireArg(c, "device id")
+					if err != nil {
+						return err
+					}
+
+					if err := (*backend).TransferPlayback(c.Context, deviceId); err != nil {
+						return err
+					}
+					fmt.Printf("playback transferred to %s\n", deviceId)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func newQRCommand(backend *admin) *cli.Command {
+	return &cli.Command{
+		Name:  "qr",
+		Usage: "render the login QR code of the player in the terminal",
+		Action: func(c *cli.Context) error {
+			loginUrl, err := (*backend).LoginURL(c.Context)
+			if err != nil {
+				return err
+			}
+			if loginUrl == "" {
+				return fmt.Errorf("login url is not configured, set CALLBACK_DEST")
+			}
+
+			if err := writeQR(os.Stdout, loginUrl); err != nil {
+				return err
+			}
+			fmt.Println(loginUrl)
+			return nil
+		},
+	}
+}
+
+func newAuditCommand(backend *admin) *cli.Command {
+	return &cli.Command{
+		Name:  "audit",
+		Usage: "list the audit log, such as lockouts after repeated failed logins",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "action",
+				Usage: "only list events of the action, e.g. lockout",
+			},
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "number of events to list, newest first",
+				Value: 50,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			events, err := (*backend).ListAuditEvents(c.Context, c.String("action"), c.Int("limit"))
+			if err != nil {
+				return err
+			}
+
+			w := newTable("TIME", "ACTION", "ACTOR", "SUBJECT", "DETAILS")
+			for _, event := range events {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", formatTime(event.CreatedAt), event.Action, event.Actor, event.Subject, event.Details)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func requireArg(c *cli.Context, name string) (string, error) {
+	arg := c.Args().First()
+	if arg == "" {
+		return "", fmt.Errorf("%s is required", name)
+	}
+	return arg, nil
+}
+
+func newTable(headers ...string) *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, header := range headers {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, header)
+	}
+	fmt.Fprintln(w)
+	return w
+}
+
+func writeSession(w *tabwriter.Writer, session services.SessionSummary) {
+	fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\n",
+		session.Uuid,
+		session.Username,
+		session.IsController,
+		formatTime(session.AccessTokenExpiresAt),
+		formatTime(session.CreatedAt),
+		truncate(session.UserAgent, 40),
+	)
+}
+
+func printSession(session services.SessionSummary) error {
+	w := newTable("UUID", "USER", "CONTROLLER", "TOKEN EXPIRES", "CREATED", "USER AGENT")
+	writeSession(w, session)
+	return w.Flush()
+}
+
+// truncate shortens s to max runes, e.g. for long user agents.
+func truncate(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	}
+	return s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
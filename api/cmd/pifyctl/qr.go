@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	ansiBlack = "\x1b[40m"
+	ansiWhite = "\x1b[47m"
+	ansiReset = "\x1b[0m"
+)
+
+// writeQR renders content as a QR code of ANSI background colored blocks, two columns per module
+// so that modules are roughly square in a terminal.
+func writeQR(w io.Writer, content string) error {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	for _, row := range qr.Bitmap() {
+		for _, set := range row {
+			if set {
+				b.WriteString(ansiBlack + "  ")
+			} else {
+				b.WriteString(ansiWhite + "  ")
+			}
+		}
+		b.WriteString(ansiReset + "\n")
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
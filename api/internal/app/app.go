@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/database/migrations"
+	"github.com/edgejay/pify-player/api/internal/handlers"
+	"github.com/edgejay/pify-player/api/internal/metrics"
+	"github.com/edgejay/pify-player/api/internal/middlewares"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+	"github.com/edgejay/pify-player/api/internal/services"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+// Config holds the settings needed to build the application container.
+type Config struct {
+	SpotifyCredentials services.SpotifyCredentials
+	ServerSettings     utils.ServerSettings
+	YoutubeApiKey      string
+	PlayerName         string
+	// interval of the playback poller while a track plays, zero disables the poller
+	PlaybackPollInterval time.Duration
+	// interval of the device watchdog, zero disables the watchdog
+	WatchdogInterval  time.Duration
+	BackupSettings    utils.BackupSettings
+	RateLimitSettings utils.RateLimitSettings
+	ScrobbleSettings  utils.ScrobbleSettings
+	AutoMigrate       bool
+}
+
+// GetConfig reads the application config from env variables.
+func GetConfig() Config {
+	return Config{
+		SpotifyCredentials:   services.GetSpotifyCredentials(),
+		ServerSettings:       utils.GetServerSettings(),
+		YoutubeApiKey:        utils.GetYoutubeApiKey(),
+		PlayerName:           utils.GetPlayerName(),
+		PlaybackPollInterval: utils.GetPlaybackPollInterval(),
+		WatchdogInterval:     utils.GetWatchdogInterval(),
+		BackupSettings:       utils.GetBackupSettings(),
+		RateLimitSettings:    utils.GetRateLimitSettings(),
+		ScrobbleSettings:     utils.GetScrobbleSettings(),
+		AutoMigrate:          utils.AutoMigrateEnabled(),
+	}
+}
+
+// App owns the long-lived dependencies of the api (database, services, middlewares and handlers)
+// and wires them together. It is built once in cmd/api/main.go and passed to the server.
+type App struct {
+	Config               Config
+	DB                   *database.DB
+	Metrics              *metrics.Metrics
+	SpotifyService       *services.SpotifyService
+	UserService          *services.UserService
+	PlayerService        *services.PlayerService
+	HealthService        *services.HealthService
+	YoutubeService       *services.YoutubeService
+	BackupService        *services.BackupService
+	AdminService         *services.AdminService
+	SearchService        *services.SearchService
+	LibraryService       *services.LibraryService
+	PlaybackService      *services.PlaybackService
+	PlaybackPoller       *services.PlaybackPoller
+	HistoryService       *services.HistoryService
+	StatsService         *services.StatsService
+	ScrobbleService      *services.ScrobbleService
+	AutoDjService        *services.AutoDjService
+	ContentPolicyService *services.ContentPolicyService
+	DeviceWatchdog       *services.DeviceWatchdog
+	EventStream          *services.EventStream
+	MiddlewareFactory    *middlewares.MiddlewareFactory
+	Handlers             *handlers.Handlers
+}
+
+// NewApp builds the application container around an already opened database.
+func NewApp(db *database.DB, config Config) *App {
+	appMetrics := metrics.NewMetrics()
+
+	// outbound calls, token refreshes and cache lookups are recorded through instrumented clients and observers
+	spotifyService := services.NewSpotifyService(
+		config.SpotifyCredentials,
+		appMetrics.InstrumentClient(nil, "spotify"),
+	).WithObserver(appMetrics)
+	youtubeService := services.NewYoutubeService(
+		config.YoutubeApiKey,
+		"https://"+config.ServerSettings.SslDomain,
+		appMetrics.InstrumentClient(nil, "youtube"),
+	)
+	users := repositories.NewBunUserRepository(db)
+	sessions := repositories.NewBunSessionRepository(db)
+	trackMedia := repositories.NewBunTrackMediaRepository(db)
+	audit := repositories.NewBunAuditRepository(db)
+	plays := repositories.NewBunPlayEventRepository(db)
+	scrobbles := repositories.NewBunScrobbleRepository(db)
+	autoDj := repositories.NewBunAutoDjRepository(db)
+	policies := repositories.NewBunContentPolicyRepository(db)
+	household := repositories.NewBunHouseholdRepository(db)
+	userService := services.NewUserService(users, sessions)
+	playerService := services.NewPlayerService(sessions, trackMedia).WithObserver(appMetrics)
+	adminService := services.NewAdminService(users, sessions, trackMedia, audit, spotifyService)
+	auditService := services.NewAuditService(audit)
+	searchService := services.NewSearchService(spotifyService, services.DEFAULT_SEARCH_DEBOUNCE)
+	libraryService := services.NewLibraryService(spotifyService)
+	contentPolicyService := services.NewContentPolicyService(policies, users, sessions, spotifyService, auditService)
+	playbackService := services.NewPlaybackService(sessions, spotifyService, config.PlayerName).WithPolicies(contentPolicyService)
+	playbackPoller := services.NewPlaybackPoller(sessions, spotifyService, services.NewPollIntervals(config.PlaybackPollInterval))
+	historyService := services.NewHistoryService(sessions, plays, spotifyService)
+	historyService.Listen(playbackPoller)
+	statsService := services.NewStatsService(users, sessions, plays, spotifyService)
+	scrobbleService := services.NewScrobbleService(
+		config.ScrobbleSettings,
+		sessions,
+		scrobbles,
+		appMetrics.InstrumentClient(nil, "scrobble"),
+	)
+	scrobbleService.Listen(playbackPoller, historyService)
+	autoDjService := services.NewAutoDjService(sessions, autoDj, plays, spotifyService, playbackService).WithPolicies(contentPolicyService)
+	autoDjService.Listen(playbackPoller)
+	contentPolicyService.Listen(playbackPoller)
+	eventStream := services.NewEventStream()
+	eventStream.Listen(playbackPoller)
+	deviceWatchdog := services.NewDeviceWatchdog(sessions, household, spotifyService, playbackService, auditService, eventStream)
+	deviceWatchdog.Listen(playbackPoller)
+
+	appMetrics.RegisterGaugeFunc(
+		"active_sessions",
+		"Number of active user sessions.",
+		userService.CountActiveSessions,
+	)
+	appMetrics.RegisterGaugeFunc(
+		"controller_sessions",
+		"Number of user sessions with controller privileges.",
+		userService.CountControllerSessions,
+	)
+
+	certFile, keyFile := utils.GetSSLCertFiles(config.ServerSettings.SslDomain)
+	if config.ServerSettings.TlsMode == constants.TLS_MODE_PLAIN {
+		certFile, keyFile = "", ""
+	}
+	healthService := services.NewHealthService(
+		db,
+		migrations.Migrations,
+		spotifyService,
+		certFile,
+		keyFile,
+	)
+
+	backupService := services.NewBackupService(
+		db,
+		config.BackupSettings.Dir,
+		config.BackupSettings.Retention,
+	)
+
+	middlewareFactory := middlewares.NewMiddlewareFactory(
+		constants.COOKIE_SESSION_ID,
+		userService,
+		spotifyService,
+	).WithRateLimits(config.RateLimitSettings, auditService)
+
+	return &App{
+		Config:               config,
+		DB:                   db,
+		Metrics:              appMetrics,
+		SpotifyService:       spotifyService,
+		UserService:          userService,
+		PlayerService:        playerService,
+		HealthService:        healthService,
+		YoutubeService:       youtubeService,
+		BackupService:        backupService,
+		AdminService:         adminService,
+		SearchService:        searchService,
+		LibraryService:       libraryService,
+		PlaybackService:      playbackService,
+		PlaybackPoller:       playbackPoller,
+		HistoryService:       historyService,
+		StatsService:         statsService,
+		ScrobbleService:      scrobbleService,
+		AutoDjService:        autoDjService,
+		ContentPolicyService: contentPolicyService,
+		DeviceWatchdog:       deviceWatchdog,
+		EventStream:          eventStream,
+		MiddlewareFactory:    middlewareFactory,
+		Handlers: handlers.NewHandlers(
+			spotifyService,
+			userService,
+			playerService,
+			healthService,
+			youtubeService,
+			adminService,
+			searchService,
+			libraryService,
+			playbackService,
+			playbackPoller,
+			historyService,
+			statsService,
+			scrobbleService,
+			autoDjService,
+			contentPolicyService,
+			deviceWatchdog,
+			eventStream,
+			middlewareFactory,
+		),
+	}
+}
+
+// Start runs the background jobs of the application until ctx is cancelled.
+func (a *App) Start(ctx context.Context) {
+	if a.Config.BackupSettings.Interval > 0 {
+		if a.DB.IsSQLite() {
+			go a.BackupService.Run(ctx, a.Config.BackupSettings.Interval)
+		} else {
+			slog.WarnContext(ctx, "BACKUP_INTERVAL is ignored, back up postgres with pg_dump")
+		}
+	}
+	if a.Config.PlaybackPollInterval > 0 {
+		go a.PlaybackPoller.Run(ctx)
+		// the auto-DJ relies on the poller to see the queue run dry
+		go a.AutoDjService.Run(ctx)
+	}
+	if a.Config.WatchdogInterval > 0 {
+		go a.DeviceWatchdog.Run(ctx, a.Config.WatchdogInterval)
+	}
+	if a.ScrobbleService.Enabled() {
+		go a.ScrobbleService.Run(ctx)
+	}
+}
+
+// Close releases resources held by the application, such as the database connection pool.
+func (a *App) Close() error {
+	return a.DB.Close()
+}
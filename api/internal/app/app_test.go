@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+
+	db, err := database.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for _, model := range []interface{}{
+		(*models.User)(nil),
+		(*models.UserSession)(nil),
+		(*models.PlayerState)(nil),
+		(*models.TrackMedia)(nil),
+	} {
+		_, err := db.Bun.NewCreateTable().Model(model).IfNotExists().Exec(ctx)
+		require.NoError(t, err)
+	}
+
+	a := NewApp(db, Config{
+		SpotifyCredentials: services.SpotifyCredentials{
+			ClientID:     "test-client-id",
+			ClientSecret: "test-client-secret",
+			RedirectURI:  "http://localhost:8080/callback",
+		},
+	})
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	return a
+}
+
+func TestNewAppSharesDatabase(t *testing.T) {
+	a := newTestApp(t)
+
+	require.NotNil(t, a.Handlers)
+	require.NotNil(t, a.MiddlewareFactory)
+	assert.NoError(t, a.DB.Ping())
+
+	// services built by the app write to the same connection pool
+	ctx := context.Background()
+	user, err := a.UserService.SaveUser(ctx, &services.SpotifyUser{Id: "test-user", DisplayName: "Test User"})
+	require.NoError(t, err)
+
+	_, err = a.UserService.SaveSession(ctx, user.Id, "test-session", "test-agent", "access", "refresh", user.CreatedAt)
+	require.NoError(t, err)
+	_, err = a.UserService.SetSessionAsController(ctx, "test-session")
+	require.NoError(t, err)
+
+	session, err := a.PlayerService.GetControllerSession(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "test-session", session.Uuid)
+	assert.Equal(t, "Test User", session.User.DisplayName)
+}
+
+func TestConnectStatusWithoutController(t *testing.T) {
+	os.Setenv("BASIC_AUTH_USERNAME", "test-user")
+	os.Setenv("BASIC_AUTH_PASSWORD", "test-password")
+	defer os.Unsetenv("BASIC_AUTH_USERNAME")
+	defer os.Unsetenv("BASIC_AUTH_PASSWORD")
+
+	a := newTestApp(t)
+
+	e := echo.New()
+	e.HTTPErrorHandler = a.Handlers.HTTPErrorHandler
+	a.Handlers.SetPlayerRoutes(e.Group("/api/player"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/player/connect", nil)
+	req.SetBasicAuth("test-user", "test-password")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"error_code":"invalid_session"`)
+}
+
+func TestHealthRoutes(t *testing.T) {
+	a := newTestApp(t)
+
+	e := echo.New()
+	a.Handlers.SetHealthRoutes(e.Group(""))
+
+	tests := []struct {
+		path     string
+		code     int
+		contains string
+	}{
+		{path: "/healthz", code: http.StatusOK, contains: `"status":"ok"`},
+		// certs are not configured in tests, so the api is never ready
+		{path: "/readyz", code: http.StatusServiceUnavailable, contains: `"ready":false`},
+		{path: "/version", code: http.StatusOK, contains: `"go_version"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.code, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.contains)
+		})
+	}
+}
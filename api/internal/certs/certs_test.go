@@ -0,0 +1,91 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "pi.local.pem")
+	keyFile := filepath.Join(dir, "pi.local.key.pem")
+	hosts := []string{"pi.local", "localhost", "127.0.0.1"}
+
+	ca, err := LoadOrCreateCA(filepath.Join(dir, "ca"))
+	require.NoError(t, err)
+	assert.True(t, ca.Certificate().IsCA)
+
+	issued, err := ca.EnsureCertificate(hosts, certFile, keyFile, 24*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, issued)
+
+	// certificate chains up to the CA and is valid for all hosts
+	reloader, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	for _, host := range hosts {
+		_, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots})
+		assert.NoError(t, err, host)
+	}
+
+	// valid certificate is kept
+	issued, err = ca.EnsureCertificate(hosts, certFile, keyFile, 24*time.Hour)
+	require.NoError(t, err)
+	assert.False(t, issued)
+
+	// certificate is renewed when it expires within the renewal window
+	issued, err = ca.EnsureCertificate(hosts, certFile, keyFile, 365*24*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, issued)
+
+	// certificate is reissued when hosts change
+	issued, err = ca.EnsureCertificate(append(hosts, "pify.lan"), certFile, keyFile, 24*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, issued)
+
+	// CA is loaded from disk instead of being recreated
+	loaded, err := LoadOrCreateCA(filepath.Join(dir, "ca"))
+	require.NoError(t, err)
+	assert.Equal(t, ca.Certificate().SerialNumber, loaded.Certificate().SerialNumber)
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "pi.local.pem")
+	keyFile := filepath.Join(dir, "pi.local.key.pem")
+
+	ca, err := LoadOrCreateCA(filepath.Join(dir, "ca"))
+	require.NoError(t, err)
+	require.NoError(t, ca.Issue([]string{"pi.local"}, certFile, keyFile))
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	before, _ := reloader.GetCertificate(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+
+	require.NoError(t, ca.Issue([]string{"pi.local"}, certFile, keyFile))
+	// make sure the modification time moves forward on filesystems with coarse timestamps
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	assert.Eventually(t, func() bool {
+		after, _ := reloader.GetCertificate(nil)
+		return after != before
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,225 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CA_CERT_FILE = "pify-ca.pem"
+	CA_KEY_FILE  = "pify-ca.key.pem"
+
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 90 * 24 * time.Hour
+)
+
+// LocalCA is a certificate authority stored on disk, used to issue certificates for the LAN domain
+// of the player. Its certificate has to be trusted once by every device accessing the player.
+type LocalCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// LoadOrCreateCA loads the CA stored in dir, creating a new one if it does not exist yet.
+func LoadOrCreateCA(dir string) (*LocalCA, error) {
+	certFile := filepath.Join(dir, CA_CERT_FILE)
+	keyFile := filepath.Join(dir, CA_KEY_FILE)
+
+	if _, err := os.Stat(certFile); errors.Is(err, os.ErrNotExist) {
+		return createCA(certFile, keyFile)
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("local CA key is not an ECDSA key")
+	}
+
+	return &LocalCA{cert, key}, nil
+}
+
+func createCA(certFile, keyFile string) (*LocalCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Pify Player"}, CommonName: "Pify Player Local CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeKeyPair(certFile, keyFile, der, key); err != nil {
+		return nil, err
+	}
+
+	return &LocalCA{cert, key}, nil
+}
+
+// Certificate returns the certificate of the CA, which clients need to trust.
+func (ca *LocalCA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// Issue creates a server certificate for hosts (domain names or IP addresses) signed by the CA,
+// and writes it together with its private key to certFile and keyFile.
+func (ca *LocalCA) Issue(hosts []string, certFile, keyFile string) error {
+	if len(hosts) == 0 {
+		return errors.New("no hosts to issue certificate for")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := newSerialNumber()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"Pify Player"}, CommonName: hosts[0]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return err
+	}
+
+	return writeKeyPair(certFile, keyFile, der, key)
+}
+
+// EnsureCertificate issues a certificate for hosts unless a valid one signed by the CA already exists
+// in certFile and does not expire within renewBefore. It reports whether a certificate was issued.
+func (ca *LocalCA) EnsureCertificate(hosts []string, certFile, keyFile string, renewBefore time.Duration) (bool, error) {
+	if ca.isValid(hosts, certFile, keyFile, renewBefore) {
+		return false, nil
+	}
+
+	if err := ca.Issue(hosts, certFile, keyFile); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (ca *LocalCA) isValid(hosts []string, certFile, keyFile string, renewBefore time.Duration) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+
+	if time.Now().Add(renewBefore).After(cert.NotAfter) {
+		return false
+	}
+
+	if err := cert.CheckSignatureFrom(ca.cert); err != nil {
+		return false
+	}
+
+	for _, host := range hosts {
+		if err := cert.VerifyHostname(host); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// writeKeyPair writes the certificate and key as PEM files. The key is written first,
+// so that a reloader watching both files never pairs a new certificate with an old key for long.
+func writeKeyPair(certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+	if err := writeFileAtomic(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("write certificate: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it, so readers never see a partial file.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -3,3 +3,34 @@ package constants
 const (
 	COOKIE_SESSION_ID = "pify_user_sess_id"
 )
+
+// path prefixes of the api routes, the unversioned routes are kept for existing clients
+const (
+	API_PREFIX    = "/api"
+	API_V1_PREFIX = "/api/v1"
+)
+
+// route groups of the api, each with a rate limit of its own
+const (
+	ROUTE_GROUP_AUTH     = "auth"
+	ROUTE_GROUP_PLAYER   = "player"
+	ROUTE_GROUP_DEVICE   = "device"
+	ROUTE_GROUP_ADMIN    = "admin"
+	ROUTE_GROUP_SEARCH   = "search"
+	ROUTE_GROUP_LIBRARY  = "library"
+	ROUTE_GROUP_HISTORY  = "history"
+	ROUTE_GROUP_STATS    = "stats"
+	ROUTE_GROUP_SCROBBLE = "scrobble"
+	ROUTE_GROUP_AUTODJ   = "autodj"
+	ROUTE_GROUP_POLICY   = "policy"
+)
+
+// TLS modes of the api server
+const (
+	// TLS is terminated by a reverse proxy (e.g. nginx), server listens on plain HTTP
+	TLS_MODE_PLAIN = "plain"
+	// certificate files under ./certs, reloaded when they change
+	TLS_MODE_FILE = "file"
+	// certificate issued and renewed by the built-in local CA
+	TLS_MODE_LOCAL_CA = "local_ca"
+)
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/uptrace/bun/migrate"
+)
+
+// Backup writes a consistent copy of the database to dest using VACUUM INTO.
+// It is safe to run while the api is serving requests. dest must not exist yet.
+func (db *DB) Backup(ctx context.Context, dest string) error {
+	if !db.IsSQLite() {
+		return ErrSQLiteOnly
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("backup file %s already exists", dest)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	_, err := db.Bun.ExecContext(ctx, "VACUUM INTO ?", dest)
+	return err
+}
+
+// SchemaStatus describes how the schema of a database compares to the migrations known by this build.
+type SchemaStatus struct {
+	// Unapplied migrations have to be run with `db migrate` after restoring.
+	Unapplied migrate.MigrationSlice
+	// Unknown migrations were applied by a newer build; restoring such a database is refused.
+	Unknown migrate.MigrationSlice
+}
+
+// CheckSchema compares the migrations applied to db with the ones registered in migrations.
+func CheckSchema(ctx context.Context, db *DB, migrations *migrate.Migrations) (*SchemaStatus, error) {
+	migrator := migrate.NewMigrator(db.Bun, migrations)
+
+	if db.IsSQLite() {
+		var integrity string
+		if err := db.Bun.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&integrity); err != nil {
+			return nil, err
+		}
+		if integrity != "ok" {
+			return nil, fmt.Errorf("integrity check failed: %s", integrity)
+		}
+	}
+
+	unknown, err := migrator.MissingMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read applied migrations: %w", err)
+	}
+
+	ms, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SchemaStatus{Unapplied: ms.Unapplied(), Unknown: unknown}, nil
+}
+
+// Restore replaces the database file dest with the backup in src after checking the backup's schema.
+// The api must be stopped while restoring. The previous database is kept next to dest with a ".bak" suffix.
+func Restore(ctx context.Context, src, dest string, migrations *migrate.Migrations) (*SchemaStatus, error) {
+	if dest == "" {
+		dest = DEFAULT_DB_FILE
+	}
+
+	// opening a missing file would create an empty database
+	if _, err := os.Stat(src); err != nil {
+		return nil, err
+	}
+
+	backup, err := NewSQLiteDB(src)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := CheckSchema(ctx, backup, migrations)
+	backup.Close()
+	if err != nil {
+		return nil, fmt.Errorf("check backup %s: %w", src, err)
+	}
+	if len(status.Unknown) > 0 {
+		return status, fmt.Errorf("backup was made by a newer version, unknown migrations: %s", status.Unknown)
+	}
+
+	// copy next to dest first so the final rename is atomic
+	tmp := dest + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		if err := os.Rename(dest, dest+".bak"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		return nil, err
+	}
+
+	// journal files of the replaced database must not be applied to the restored one
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(dest + suffix); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// newTestDB creates a database file in a temp folder with the tables of the exported models.
+func newTestDB(t *testing.T, file string) *DB {
+	t.Helper()
+
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), file))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	for _, model := range Models {
+		_, err := db.Bun.NewCreateTable().Model(model).IfNotExists().Exec(context.Background())
+		require.NoError(t, err)
+	}
+
+	return db
+}
+
+func seed(t *testing.T, db *DB) {
+	t.Helper()
+	ctx := context.Background()
+	isController := true
+
+	_, err := db.Bun.NewInsert().Model(&models.User{Id: 1, Username: "alice", DisplayName: "Alice"}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.Bun.NewInsert().Model(&models.UserSession{
+		Id:                   1,
+		UserId:               1,
+		Uuid:                 "session-uuid",
+		UserAgent:            "test",
+		AccessToken:          "access-token",
+		AccessTokenExpiresAt: time.Now().Add(time.Hour),
+		RefreshToken:         "refresh-token",
+		IsController:         &isController,
+	}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.Bun.NewInsert().Model(&models.TrackMedia{
+		SpotifyTrackId: "track",
+		MediaType:      "youtube",
+		MediaId:        "video",
+	}).Exec(ctx)
+	require.NoError(t, err)
+}
+
+func testMigrations(t *testing.T, names ...string) *migrate.Migrations {
+	t.Helper()
+
+	ms := migrate.NewMigrations()
+	for _, name := range names {
+		ms.Add(migrate.Migration{Name: name, Comment: name})
+	}
+	return ms
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, "db.sqlite3")
+	seed(t, db)
+
+	// backup database with the first migration applied
+	migrator := migrate.NewMigrator(db.Bun, testMigrations(t, "20250101000000"))
+	require.NoError(t, migrator.Init(ctx))
+	_, err := migrator.Migrate(ctx, migrate.WithNopMigration())
+	require.NoError(t, err)
+
+	backupFile := filepath.Join(t.TempDir(), "backups", "backup.sqlite3")
+	require.NoError(t, db.Backup(ctx, backupFile))
+	assert.Error(t, db.Backup(ctx, backupFile), "existing backup must not be overwritten")
+
+	t.Run("restore reports unapplied migrations", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "restored.sqlite3")
+		status, err := Restore(ctx, backupFile, dest, testMigrations(t, "20250101000000", "20250201000000"))
+		require.NoError(t, err)
+		assert.Len(t, status.Unapplied, 1)
+		assert.Empty(t, status.Unknown)
+
+		restored, err := NewSQLiteDB(dest)
+		require.NoError(t, err)
+		defer restored.Close()
+
+		count, err := restored.Bun.NewSelect().Model((*models.UserSession)(nil)).Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("restore refuses backup from newer version", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "restored.sqlite3")
+		_, err := Restore(ctx, backupFile, dest, testMigrations(t))
+		assert.ErrorContains(t, err, "newer version")
+		assert.NoFileExists(t, dest)
+	})
+
+	t.Run("restore missing backup", func(t *testing.T) {
+		_, err := Restore(ctx, filepath.Join(t.TempDir(), "missing.sqlite3"), "", testMigrations(t))
+		assert.Error(t, err)
+	})
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := newTestDB(t, "src.sqlite3")
+	seed(t, src)
+
+	bundle, err := src.Export(ctx, ExportOptions{WithoutTokens: true})
+	require.NoError(t, err)
+	require.Len(t, bundle.Users, 1)
+	require.Len(t, bundle.UserSessions, 1)
+	require.Len(t, bundle.TrackMedia, 1)
+	assert.Empty(t, bundle.UserSessions[0].AccessToken)
+	assert.Empty(t, bundle.UserSessions[0].RefreshToken)
+
+	dest := newTestDB(t, "dest.sqlite3")
+	require.NoError(t, dest.Import(ctx, bundle, ImportOptions{}))
+	assert.ErrorContains(t, dest.Import(ctx, bundle, ImportOptions{}), "not empty")
+	require.NoError(t, dest.Import(ctx, bundle, ImportOptions{Replace: true}))
+
+	session := &models.UserSession{}
+	require.NoError(t, dest.Bun.NewSelect().Model(session).Relation("User").Where("uuid = ?", "session-uuid").Scan(ctx))
+	assert.Equal(t, "Alice", session.User.DisplayName)
+	assert.True(t, *session.IsController)
+	assert.Empty(t, session.AccessToken)
+
+	bundle.Version = BUNDLE_VERSION + 1
+	assert.ErrorContains(t, dest.Import(ctx, bundle, ImportOptions{Replace: true}), "unsupported bundle version")
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// BUNDLE_VERSION is bumped whenever the layout of Bundle changes in an incompatible way.
+const BUNDLE_VERSION = 1
+
+// Bundle is a portable JSON snapshot of the household state, independent of the database engine.
+// Soft deleted rows are included so that an import reproduces the exported database.
+type Bundle struct {
+	Version      int                   `json:"version"`
+	ExportedAt   time.Time             `json:"exported_at"`
+	Users        []*models.User        `json:"users"`
+	UserSessions []*models.UserSession `json:"user_sessions"`
+	TrackMedia   []*models.TrackMedia  `json:"track_media"`
+	PlayerStates []*models.PlayerState `json:"player_states"`
+	AuditEvents  []*models.AuditEvent  `json:"audit_events"`
+	PlayEvents   []*models.PlayEvent   `json:"play_events"`
+	// ScrobbleAccounts hold the session keys of the accounts linked by users, left out without tokens
+	ScrobbleAccounts  []*models.ScrobbleAccount   `json:"scrobble_accounts"`
+	PendingScrobbles  []*models.PendingScrobble   `json:"pending_scrobbles"`
+	AutoDjSettings    []*models.AutoDjSettings    `json:"auto_dj_settings"`
+	ContentPolicies   []*models.ContentPolicy     `json:"content_policies"`
+	HouseholdSettings []*models.HouseholdSettings `json:"household_settings"`
+}
+
+type ExportOptions struct {
+	// WithoutTokens clears access and refresh tokens of the exported sessions and leaves out the linked
+	// scrobbling accounts. Such sessions have to log in again after import, and accounts be linked again.
+	WithoutTokens bool
+}
+
+type ImportOptions struct {
+	// Replace deletes existing rows before importing. Without it, importing into a non-empty database fails.
+	Replace bool
+}
+
+// Export reads users, sessions, track media, player states, audit events, play events, scrobbles,
+// auto-DJ settings, content policies and household settings into a bundle.
+func (db *DB) Export(ctx context.Context, opts ExportOptions) (*Bundle, error) {
+	bundle := &Bundle{
+		Version:    BUNDLE_VERSION,
+		ExportedAt: time.Now().UTC(),
+	}
+
+	for i, dest := range bundle.tables() {
+		query := db.Bun.NewSelect().Model(dest).Order("id ASC")
+		if softDeletes(db.Bun, Models[i]) {
+			query = query.WhereAllWithDeleted()
+		}
+		if err := query.Scan(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.WithoutTokens {
+		for _, session := range bundle.UserSessions {
+			session.AccessToken = ""
+			session.AccessTokenExpiresAt = time.Time{}
+			session.RefreshToken = ""
+			session.RefreshTokenExpiresAt = nil
+		}
+		bundle.ScrobbleAccounts = nil
+	}
+
+	return bundle, nil
+}
+
+// Import writes the bundle into the database in a single transaction, keeping the exported ids.
+func (db *DB) Import(ctx context.Context, bundle *Bundle, opts ImportOptions) error {
+	if bundle.Version != BUNDLE_VERSION {
+		return fmt.Errorf("unsupported bundle version %d, expected %d", bundle.Version, BUNDLE_VERSION)
+	}
+
+	return db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// children first when deleting, parents first when inserting
+		for i := len(Models) - 1; i >= 0; i-- {
+			query := tx.NewSelect().Model(Models[i])
+			if softDeletes(tx, Models[i]) {
+				query = query.WhereAllWithDeleted()
+			}
+			count, err := query.Count(ctx)
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				continue
+			}
+			if !opts.Replace {
+				return fmt.Errorf("database is not empty, use replace to overwrite existing rows")
+			}
+			if _, err := tx.NewDelete().Model(Models[i]).Where("1 = 1").ForceDelete().Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		for _, rows := range bundle.tables() {
+			if reflect.ValueOf(rows).Elem().Len() == 0 {
+				continue
+			}
+			if _, err := tx.NewInsert().Model(rows).Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		if db.IsSQLite() {
+			return nil
+		}
+		// postgres sequences do not move past explicitly inserted ids
+		for _, model := range Models {
+			table := tx.Dialect().Tables().Get(reflect.TypeOf(model))
+			if _, err := tx.ExecContext(ctx,
+				"SELECT setval(pg_get_serial_sequence(?, 'id'), COALESCE(MAX(id), 0) + 1, false) FROM ?",
+				table.Name, table.SQLName,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// softDeletes reports whether the rows of model are soft deleted. Bundles include deleted rows.
+func softDeletes(db bun.IDB, model any) bool {
+	return db.Dialect().Tables().Get(reflect.TypeOf(model)).SoftDeleteField != nil
+}
+
+// tables returns pointers to the bundle slices, in the same order as Models.
+func (b *Bundle) tables() []any {
+	return []any{&b.Users, &b.UserSessions, &b.TrackMedia, &b.PlayerStates, &b.AuditEvents, &b.PlayEvents, &b.ScrobbleAccounts, &b.PendingScrobbles, &b.AutoDjSettings, &b.ContentPolicies, &b.HouseholdSettings}
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+const (
+	DRIVER_SQLITE   = "sqlite"
+	DRIVER_POSTGRES = "postgres"
+)
+
+// ErrSQLiteOnly is returned by the file based operations, e.g. backups, when the database is not sqlite.
+// Postgres databases should be managed with its own tools, e.g. pg_dump.
+var ErrSQLiteOnly = errors.New("only supported with the sqlite driver")
+
+// DB holds the connection pools of the database.
+//
+// Writes go through Bun and read-only queries should use Reader. With SQLite, which allows a single
+// writer at a time, Bun is limited to one connection and starts transactions with BEGIN IMMEDIATE,
+// while Reader is a pool of read-only connections which, thanks to WAL mode, are not blocked by the
+// writer. With Postgres both share the same pool.
+type DB struct {
+	SQL    *sql.DB
+	Bun    *bun.DB
+	Reader *bun.DB
+}
+
+// NewDB opens the database of driver, a file path for sqlite or a connection string for postgres.
+func NewDB(driver, source string) (*DB, error) {
+	switch driver {
+	case "", DRIVER_SQLITE:
+		return NewSQLiteDB(source)
+	case DRIVER_POSTGRES:
+		return NewPostgresDB(source)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// NewDBFromEnv opens the database picked by the DB_DRIVER env variable, the file specified by DB_FILE
+// for sqlite (the default) or the server at DATABASE_URL for postgres.
+func NewDBFromEnv() (*DB, error) {
+	if utils.GetDBDriver() == DRIVER_POSTGRES {
+		return NewDB(DRIVER_POSTGRES, utils.GetDatabaseURL())
+	}
+	return NewDB(utils.GetDBDriver(), utils.GetDBFilename())
+}
+
+// IsSQLite reports whether db uses the sqlite dialect, for the features only available there.
+func (db *DB) IsSQLite() bool {
+	return db.Bun.Dialect().Name() == dialect.SQLite
+}
+
+func (db *DB) Ping() error {
+	if err := db.Bun.Ping(); err != nil {
+		return err
+	}
+	return db.Reader.Ping()
+}
+
+func (db *DB) Close() error {
+	err := db.Bun.Close()
+	if db.Reader != db.Bun {
+		if readerErr := db.Reader.Close(); err == nil {
+			err = readerErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+// how often a locked migration table is checked again while waiting for the lock
+const migrationLockRetryInterval = time.Second
+
+// Migrate runs pending migrations while holding the migration lock, so that the api and the
+// migrations command never migrate at the same time. It waits for the lock until ctx is done.
+func Migrate(ctx context.Context, db *DB, migrations *migrate.Migrations) (*migrate.MigrationGroup, error) {
+	migrator := migrate.NewMigrator(db.Bun, migrations)
+	if err := migrator.Init(ctx); err != nil {
+		return nil, err
+	}
+
+	for {
+		err := migrator.Lock(ctx)
+		if err == nil {
+			break
+		}
+
+		slog.WarnContext(ctx, "waiting for migration lock, run `db unlock` if no migration is running", "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("migration lock not acquired: %w", err)
+		case <-time.After(migrationLockRetryInterval):
+		}
+	}
+	defer migrator.Unlock(context.WithoutCancel(ctx)) //nolint:errcheck
+
+	group, err := migrator.Migrate(ctx)
+	if err != nil && strings.Contains(err.Error(), "no migrations") {
+		return &migrate.MigrationGroup{}, nil
+	}
+	return group, err
+}
+
+// MigrateDryRun runs pending migrations on a scratch copy of the database and returns the SQL they executed.
+// The database itself is left untouched. The scratch copy is a backup, so this is only available with sqlite.
+func MigrateDryRun(ctx context.Context, db *DB, migrations *migrate.Migrations) ([]string, error) {
+	if !db.IsSQLite() {
+		return nil, ErrSQLiteOnly
+	}
+
+	dir, err := os.MkdirTemp("", "pify-dry-run-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "db.sqlite3")
+	if err := db.Backup(ctx, file); err != nil {
+		return nil, err
+	}
+
+	scratch, err := NewSQLiteDB(file)
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+
+	recorder := &queryRecorder{}
+	scratch.Bun.AddQueryHook(recorder)
+
+	migrator := migrate.NewMigrator(scratch.Bun, migrations)
+	if err := migrator.Init(ctx); err != nil {
+		return nil, err
+	}
+	// bookkeeping queries of the migrator are not part of the output
+	recorder.queries = nil
+
+	if _, err := migrator.Migrate(ctx); err != nil && !strings.Contains(err.Error(), "no migrations") {
+		return recorder.queries, err
+	}
+
+	return recorder.queries, nil
+}
+
+// queryRecorder collects executed queries, except for the ones on the migrator's own tables.
+type queryRecorder struct {
+	queries []string
+}
+
+func (r *queryRecorder) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (r *queryRecorder) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	if strings.Contains(event.Query, "bun_migration") {
+		return
+	}
+	r.queries = append(r.queries, event.Query)
+}
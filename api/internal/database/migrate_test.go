@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/edgejay/pify-player/api/internal/database/migrations"
+)
+
+func newEmptyTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "db.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	ctx := context.Background()
+	db := newEmptyTestDB(t)
+
+	group, err := Migrate(ctx, db, migrations.Migrations)
+	require.NoError(t, err)
+	assert.False(t, group.IsZero())
+
+	drifts, err := db.Verify(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, drifts)
+
+	// running again is a no-op
+	group, err = Migrate(ctx, db, migrations.Migrations)
+	require.NoError(t, err)
+	assert.True(t, group.IsZero())
+}
+
+func TestMigrateWaitsForLock(t *testing.T) {
+	db := newEmptyTestDB(t)
+
+	migrator := migrate.NewMigrator(db.Bun, migrations.Migrations)
+	require.NoError(t, migrator.Init(context.Background()))
+	require.NoError(t, migrator.Lock(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := Migrate(ctx, db, migrations.Migrations)
+	assert.ErrorContains(t, err, "migration lock not acquired")
+
+	require.NoError(t, migrator.Unlock(context.Background()))
+	_, err = Migrate(context.Background(), db, migrations.Migrations)
+	assert.NoError(t, err)
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	ctx := context.Background()
+	db := newEmptyTestDB(t)
+
+	queries, err := MigrateDryRun(ctx, db, migrations.Migrations)
+	require.NoError(t, err)
+	assert.NotEmpty(t, queries)
+
+	// the database itself is not migrated
+	drifts, err := db.Verify(ctx)
+	require.NoError(t, err)
+	assert.Len(t, drifts, len(Models))
+}
+
+func TestVerifyReportsDrift(t *testing.T) {
+	ctx := context.Background()
+	db := newEmptyTestDB(t)
+	_, err := Migrate(ctx, db, migrations.Migrations)
+	require.NoError(t, err)
+
+	for _, query := range []string{
+		`ALTER TABLE users DROP COLUMN profile_image_url`,
+		`ALTER TABLE users ADD COLUMN nickname VARCHAR`,
+		`CREATE TABLE track_media_copy AS SELECT * FROM track_media`,
+		`DROP TABLE track_media`,
+		`ALTER TABLE track_media_copy RENAME TO track_media`,
+	} {
+		_, err := db.Bun.ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+
+	drifts, err := db.Verify(ctx)
+	require.NoError(t, err)
+
+	var problems []string
+	for _, drift := range drifts {
+		problems = append(problems, drift.String())
+	}
+	assert.Contains(t, problems, "users.profile_image_url: column is missing")
+	assert.Contains(t, problems, "users.nickname: column is not in the model")
+	assert.Contains(t, problems, "track_media.media_type, spotify_track_id: unique constraint is missing")
+}
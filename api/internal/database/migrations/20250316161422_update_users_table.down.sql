@@ -1,3 +0,0 @@
-ALTER TABLE users 
-    DROP COLUMN display_name,
-    DROP COLUMN profile_image_url;
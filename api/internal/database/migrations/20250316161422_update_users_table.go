@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// Columns are only added if missing, since create_user builds the table from the current model.
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if err := addColumn(ctx, db, "users", "display_name", "VARCHAR"); err != nil {
+			return err
+		}
+		return addColumn(ctx, db, "users", "profile_image_url", "VARCHAR")
+	}, func(ctx context.Context, db *bun.DB) error {
+		if err := dropColumn(ctx, db, "users", "display_name"); err != nil {
+			return err
+		}
+		return dropColumn(ctx, db, "users", "profile_image_url")
+	})
+}
@@ -1,2 +0,0 @@
-ALTER TABLE users ADD COLUMN display_name VARCHAR;
-ALTER TABLE users ADD COLUMN profile_image_url VARCHAR;
@@ -1 +0,0 @@
-ALTER TABLE user_sessions DROP COLUMN is_controller;
\ No newline at end of file
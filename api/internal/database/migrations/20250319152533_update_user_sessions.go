@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// The column is only added if missing, since create_user_session builds the table from the current model.
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		return addColumn(ctx, db, "user_sessions", "is_controller", "BOOLEAN")
+	}, func(ctx context.Context, db *bun.DB) error {
+		return dropColumn(ctx, db, "user_sessions", "is_controller")
+	})
+}
@@ -1 +0,0 @@
-ALTER TABLE user_sessions ADD COLUMN is_controller BOOLEAN;
\ No newline at end of file
@@ -0,0 +1,192 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// Adds unique constraints on user_sessions.uuid and track_media (spotify_track_id, media_type),
+// foreign keys from user_id columns to users and indexes on them.
+// Orphaned and duplicated rows are removed first, keeping the latest active row of every duplicate.
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			cleanup := []string{
+				`DELETE FROM user_sessions WHERE user_id NOT IN (SELECT id FROM users)`,
+				`DELETE FROM player_states WHERE user_id NOT IN (SELECT id FROM users)`,
+				dedupe("user_sessions", "uuid"),
+				dedupe("track_media", "spotify_track_id, media_type"),
+			}
+			for _, query := range cleanup {
+				if _, err := tx.ExecContext(ctx, query); err != nil {
+					return err
+				}
+			}
+
+			if tx.Dialect().Name() != dialect.SQLite {
+				// the tables were created from models which already have the unique constraints
+				for _, table := range userTables {
+					if err := addUserFK(ctx, tx, table); err != nil {
+						return err
+					}
+				}
+				return createUserIdIndexes(ctx, tx)
+			}
+
+			// SQLite cannot add constraints to existing tables, so the tables are rebuilt
+			if err := rebuildTable(ctx, tx, (*hardenedUserSession)(nil), userFK); err != nil {
+				return err
+			}
+			if err := rebuildTable(ctx, tx, (*hardenedPlayerState)(nil), userFK); err != nil {
+				return err
+			}
+			if err := rebuildTable(ctx, tx, (*hardenedTrackMedia)(nil)); err != nil {
+				return err
+			}
+
+			return createUserIdIndexes(ctx, tx)
+		})
+	}, func(ctx context.Context, db *bun.DB) error {
+		// unique constraints stay, only foreign keys are removed
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if tx.Dialect().Name() != dialect.SQLite {
+				for _, table := range userTables {
+					if _, err := tx.ExecContext(ctx, "ALTER TABLE ? DROP CONSTRAINT IF EXISTS ?", bun.Ident(table), bun.Ident(table+"_user_id_fkey")); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			if err := rebuildTable(ctx, tx, (*hardenedUserSession)(nil)); err != nil {
+				return err
+			}
+			if err := rebuildTable(ctx, tx, (*hardenedPlayerState)(nil)); err != nil {
+				return err
+			}
+			return createUserIdIndexes(ctx, tx)
+		})
+	})
+}
+
+// The tables rebuilt on SQLite, as this migration leaves them. They are copies of the models at the time
+// of the migration, so that later changes of the models do not change what it creates.
+type hardenedUserSession struct {
+	bun.BaseModel `bun:"table:user_sessions"`
+
+	Id                    int64  `bun:",pk,autoincrement"`
+	UserId                int64  `bun:",notnull"`
+	Uuid                  string `bun:",notnull,unique"`
+	UserAgent             string `bun:",notnull"`
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt *time.Time
+	CreatedAt             time.Time  `bun:",notnull,default:current_timestamp"`
+	DeletedAt             *time.Time `bun:",soft_delete"`
+	IsController          *bool
+}
+
+type hardenedPlayerState struct {
+	bun.BaseModel `bun:"table:player_states"`
+
+	Id        int64 `bun:",pk,autoincrement"`
+	UserId    int64
+	IsWaiting bool       `bun:",default:false"`
+	IsActive  bool       `bun:",default:false"`
+	CreatedAt time.Time  `bun:",notnull,default:current_timestamp"`
+	DeletedAt *time.Time `bun:",soft_delete"`
+}
+
+type hardenedTrackMedia struct {
+	bun.BaseModel `bun:"table:track_media"`
+
+	Id             int64  `bun:",pk,autoincrement"`
+	SpotifyTrackId string `bun:",unique:spotify_track_id_media_type"`
+	MediaType      string `bun:",unique:spotify_track_id_media_type"`
+	MediaId        string
+	CreatedAt      time.Time  `bun:",notnull,default:current_timestamp"`
+	DeletedAt      *time.Time `bun:",soft_delete"`
+}
+
+// userTables reference users through their user_id column.
+var userTables = []string{"user_sessions", "player_states"}
+
+// addUserFK adds the foreign key from the user_id column of table to users, for dialects
+// able to alter constraints of existing tables.
+func addUserFK(ctx context.Context, tx bun.Tx, table string) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE ? ADD CONSTRAINT ? FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`,
+		bun.Ident(table), bun.Ident(table+"_user_id_fkey"),
+	)
+	return err
+}
+
+// dedupe returns a query deleting all but one row per value of columns, preferring
+// rows that are not soft deleted, then the most recent ones.
+func dedupe(table, columns string) string {
+	return fmt.Sprintf(`DELETE FROM %[1]s WHERE id NOT IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (
+				PARTITION BY %[2]s ORDER BY deleted_at IS NULL DESC, id DESC
+			) AS rn FROM %[1]s
+		) AS ranked WHERE rn = 1
+	)`, table, columns)
+}
+
+// rebuildTable recreates the table of model with the given foreign keys, copying all rows. model is a
+// copy of the model frozen by the migration, not the current model.
+func rebuildTable(ctx context.Context, tx bun.Tx, model any, foreignKeys ...string) error {
+	table := tx.Dialect().Tables().Get(reflect.TypeOf(model))
+	tmp := table.Name + "_new"
+
+	query := tx.NewCreateTable().Model(model).ModelTableExpr("?", bun.Ident(tmp))
+	for _, fk := range foreignKeys {
+		query = query.ForeignKey(fk)
+	}
+	if _, err := query.Exec(ctx); err != nil {
+		return err
+	}
+
+	columns := make([]string, len(table.Fields))
+	for i, field := range table.Fields {
+		columns[i] = string(field.SQLName)
+	}
+
+	queries := []string{
+		fmt.Sprintf(
+			`INSERT INTO %[1]q (%[3]s) SELECT %[3]s FROM %[2]q`,
+			tmp, table.Name, strings.Join(columns, ", "),
+		),
+		fmt.Sprintf(`DROP TABLE %q`, table.Name),
+		fmt.Sprintf(`ALTER TABLE %q RENAME TO %q`, tmp, table.Name),
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createUserIdIndexes indexes user_id columns, which are dropped with the tables when rebuilding them.
+func createUserIdIndexes(ctx context.Context, tx bun.Tx) error {
+	for _, model := range []any{(*hardenedUserSession)(nil), (*hardenedPlayerState)(nil)} {
+		if _, err := tx.NewCreateIndex().
+			Model(model).
+			Index(tx.Dialect().Tables().Get(reflect.TypeOf(model)).Name + "_user_id_idx").
+			Column("user_id").
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
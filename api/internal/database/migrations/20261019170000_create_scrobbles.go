@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewCreateTable().
+			Model((*models.ScrobbleAccount)(nil)).
+			ForeignKey(userFK).
+			IfNotExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		_, err := db.NewCreateTable().
+			Model((*models.PendingScrobble)(nil)).
+			ForeignKey(userFK).
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewDropTable().
+			Model((*models.PendingScrobble)(nil)).
+			IfExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		_, err := db.NewDropTable().
+			Model((*models.ScrobbleAccount)(nil)).
+			IfExists().
+			Exec(ctx)
+		return err
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// The role column is only added if missing, since create_user builds the table from the current model.
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		if err := addColumn(ctx, db, "users", "role", "VARCHAR NOT NULL DEFAULT 'member'"); err != nil {
+			return err
+		}
+		_, err := db.NewCreateTable().
+			Model((*models.ContentPolicy)(nil)).
+			IfNotExists().
+			Exec(ctx)
+		return err
+	}, func(ctx context.Context, db *bun.DB) error {
+		if _, err := db.NewDropTable().
+			Model((*models.ContentPolicy)(nil)).
+			IfExists().
+			Exec(ctx); err != nil {
+			return err
+		}
+		return dropColumn(ctx, db, "users", "role")
+	})
+}
@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"context"
+
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// Adds the foreign key from play_events.user_id to users, removing the plays of users that no longer
+// exist first. Plays of a user are looked up through the unique (user_id, played_at) index.
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, db *bun.DB) error {
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM play_events WHERE user_id NOT IN (SELECT id FROM users)`); err != nil {
+				return err
+			}
+			if tx.Dialect().Name() != dialect.SQLite {
+				return addUserFK(ctx, tx, "play_events")
+			}
+
+			if err := rebuildTable(ctx, tx, (*referencedPlayEvent)(nil), userFK); err != nil {
+				return err
+			}
+			return createPlayedAtIndex(ctx, tx)
+		})
+	}, func(ctx context.Context, db *bun.DB) error {
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if tx.Dialect().Name() != dialect.SQLite {
+				_, err := tx.ExecContext(ctx, "ALTER TABLE ? DROP CONSTRAINT IF EXISTS ?", bun.Ident("play_events"), bun.Ident("play_events_user_id_fkey"))
+				return err
+			}
+
+			if err := rebuildTable(ctx, tx, (*referencedPlayEvent)(nil)); err != nil {
+				return err
+			}
+			return createPlayedAtIndex(ctx, tx)
+		})
+	})
+}
+
+// referencedPlayEvent is the play_events table rebuilt on SQLite, a copy of the model at the time of
+// the migration, so that later changes of the model do not change what it creates.
+type referencedPlayEvent struct {
+	bun.BaseModel `bun:"table:play_events"`
+
+	Id             int64  `bun:",pk,autoincrement"`
+	UserId         int64  `bun:",notnull,unique:user_id_played_at"`
+	SpotifyTrackId string `bun:",notnull"`
+	TrackName      string
+	ArtistIds      string
+	ArtistNames    string
+	DurationMs     int
+	StartedAt      time.Time `bun:",notnull"`
+	PlayedAt       time.Time `bun:",notnull,unique:user_id_played_at"`
+	PlayedPercent  int       `bun:",notnull,default:0"`
+	Skipped        bool      `bun:",notnull,default:false"`
+	Source         string    `bun:",notnull"`
+	CreatedAt      time.Time `bun:",notnull,default:current_timestamp"`
+}
+
+// createPlayedAtIndex indexes the plays of all users by time, dropped with the table when rebuilding it.
+func createPlayedAtIndex(ctx context.Context, tx bun.Tx) error {
+	_, err := tx.NewCreateIndex().
+		Model((*referencedPlayEvent)(nil)).
+		Index("play_events_played_at_idx").
+		Column("played_at").
+		IfNotExists().
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,128 @@
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// schema before the hardening migration, without unique constraints or foreign keys
+var legacySchema = []string{
+	`CREATE TABLE "users" ("id" INTEGER NOT NULL, "username" VARCHAR UNIQUE, "display_name" VARCHAR NOT NULL,
+		"profile_image_url" VARCHAR, "created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp,
+		"deleted_at" TIMESTAMP, PRIMARY KEY ("id"))`,
+	`CREATE TABLE "user_sessions" ("id" INTEGER NOT NULL, "user_id" INTEGER NOT NULL, "uuid" VARCHAR NOT NULL,
+		"user_agent" VARCHAR NOT NULL, "access_token" VARCHAR, "access_token_expires_at" TIMESTAMP,
+		"refresh_token" VARCHAR, "refresh_token_expires_at" TIMESTAMP,
+		"created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "deleted_at" TIMESTAMP,
+		"is_controller" BOOLEAN, PRIMARY KEY ("id"))`,
+	`CREATE TABLE "player_states" ("id" INTEGER NOT NULL, "user_id" INTEGER, "is_waiting" BOOLEAN DEFAULT false,
+		"is_active" BOOLEAN DEFAULT false, "created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp,
+		"deleted_at" TIMESTAMP, PRIMARY KEY ("id"))`,
+	`CREATE TABLE "track_media" ("id" INTEGER NOT NULL, "spotify_track_id" VARCHAR, "media_type" VARCHAR,
+		"media_id" VARCHAR, "created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "deleted_at" TIMESTAMP,
+		PRIMARY KEY ("id"))`,
+}
+
+var legacyRows = []string{
+	`INSERT INTO users (id, username, display_name) VALUES (1, 'alice', 'Alice')`,
+	// duplicated session uuid, the deleted copy is dropped
+	`INSERT INTO user_sessions (id, user_id, uuid, user_agent, access_token) VALUES (1, 1, 'a', 'ua', 'first')`,
+	`INSERT INTO user_sessions (id, user_id, uuid, user_agent, access_token, deleted_at)
+		VALUES (2, 1, 'a', 'ua', 'deleted', current_timestamp)`,
+	// session of a user that no longer exists
+	`INSERT INTO user_sessions (id, user_id, uuid, user_agent) VALUES (3, 2, 'b', 'ua')`,
+	// duplicated track media, the latest is kept
+	`INSERT INTO track_media (id, spotify_track_id, media_type, media_id) VALUES (1, 'track', 'youtube', 'old')`,
+	`INSERT INTO track_media (id, spotify_track_id, media_type, media_id) VALUES (2, 'track', 'youtube', 'new')`,
+	`INSERT INTO player_states (id, user_id) VALUES (1, 1)`,
+}
+
+func TestHardenSchemaMigration(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "db.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	for _, query := range append(legacySchema, legacyRows...) {
+		_, err := db.Bun.ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+
+	// mark earlier migrations as applied, as they created the legacy schema
+	migrator := migrate.NewMigrator(db.Bun, Migrations)
+	require.NoError(t, migrator.Init(ctx))
+	ms, err := migrator.MigrationsWithStatus(ctx)
+	require.NoError(t, err)
+	for i := range ms {
+		if ms[i].Name < "20261019143000" {
+			require.NoError(t, migrator.MarkApplied(ctx, &ms[i]))
+		}
+	}
+
+	group, err := migrator.Migrate(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, group.Migrations)
+	require.Equal(t, "20261019143000", group.Migrations[0].Name)
+
+	var sessions []models.UserSession
+	require.NoError(t, db.Bun.NewSelect().Model(&sessions).WhereAllWithDeleted().Scan(ctx))
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "first", sessions[0].AccessToken)
+
+	var media []models.TrackMedia
+	require.NoError(t, db.Bun.NewSelect().Model(&media).Scan(ctx))
+	require.Len(t, media, 1)
+	assert.Equal(t, "new", media[0].MediaId)
+
+	// constraints are enforced after the migration
+	_, err = db.Bun.NewInsert().Model(&models.UserSession{UserId: 1, Uuid: "a", UserAgent: "ua"}).Exec(ctx)
+	assert.ErrorContains(t, err, "UNIQUE")
+	_, err = db.Bun.NewInsert().Model(&models.UserSession{UserId: 2, Uuid: "c", UserAgent: "ua"}).Exec(ctx)
+	assert.ErrorContains(t, err, "FOREIGN KEY")
+	_, err = db.Bun.NewInsert().Model(&models.TrackMedia{SpotifyTrackId: "track", MediaType: "youtube"}).Exec(ctx)
+	assert.ErrorContains(t, err, "UNIQUE")
+
+	_, err = db.Bun.NewInsert().Model(&models.PlayEvent{UserId: 1, SpotifyTrackId: "t1", Source: models.PLAY_SOURCE_POLLER}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.Bun.NewInsert().Model(&models.PlayEvent{UserId: 2, SpotifyTrackId: "t1", Source: models.PLAY_SOURCE_POLLER}).Exec(ctx)
+	assert.ErrorContains(t, err, "FOREIGN KEY")
+	_, err = db.Bun.NewInsert().Model(&models.AutoDjSettings{UserId: 1, QueueAhead: 3}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.Bun.NewInsert().Model(&models.AutoDjSettings{UserId: 2, QueueAhead: 3}).Exec(ctx)
+	assert.ErrorContains(t, err, "FOREIGN KEY")
+	_, err = db.Bun.NewInsert().Model(&models.ScrobbleAccount{UserId: 1, Username: "alice-fm", SessionKey: "key"}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.Bun.NewInsert().Model(&models.ScrobbleAccount{UserId: 2, Username: "bob-fm", SessionKey: "key"}).Exec(ctx)
+	assert.ErrorContains(t, err, "FOREIGN KEY")
+	_, err = db.Bun.NewInsert().Model(&models.PendingScrobble{UserId: 1, Artist: "a", Track: "t"}).Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.Bun.NewInsert().Model(&models.PendingScrobble{UserId: 2, Artist: "a", Track: "t"}).Exec(ctx)
+	assert.ErrorContains(t, err, "FOREIGN KEY")
+
+	// deleting a user removes their sessions, player states, plays, auto-DJ settings and scrobbling data
+	_, err = db.Bun.NewDelete().Model((*models.User)(nil)).Where("id = 1").ForceDelete().Exec(ctx)
+	require.NoError(t, err)
+	count, err := db.Bun.NewSelect().Model((*models.PlayerState)(nil)).WhereAllWithDeleted().Count(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	count, err = db.Bun.NewSelect().Model((*models.PlayEvent)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	for _, model := range []any{(*models.AutoDjSettings)(nil), (*models.ScrobbleAccount)(nil), (*models.PendingScrobble)(nil)} {
+		count, err = db.Bun.NewSelect().Model(model).Count(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	}
+
+	_, err = migrator.Rollback(ctx)
+	require.NoError(t, err)
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"context"
+	"slices"
+
+	"github.com/uptrace/bun"
+)
+
+// userFK references users from the user_id column of a table, deleting the rows of a user with them.
+const userFK = `("user_id") REFERENCES "users" ("id") ON DELETE CASCADE`
+
+// hasColumn reports whether table has the given column.
+// The columns are read from an empty result set, which works the same with every dialect.
+func hasColumn(ctx context.Context, db bun.IDB, table, column string) (bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT * FROM ? LIMIT 0", bun.Ident(table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(columns, column), rows.Err()
+}
+
+// addColumn adds a column unless it exists already, e.g. because the table was created
+// from a model that has the column since.
+func addColumn(ctx context.Context, db bun.IDB, table, column, definition string) error {
+	exists, err := hasColumn(ctx, db, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "ALTER TABLE ? ADD COLUMN ? "+definition, bun.Ident(table), bun.Ident(column))
+	return err
+}
+
+// dropColumn drops a column if it exists.
+func dropColumn(ctx context.Context, db bun.IDB, table, column string) error {
+	exists, err := hasColumn(ctx, db, table, column)
+	if err != nil || !exists {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "ALTER TABLE ? DROP COLUMN ?", bun.Ident(table), bun.Ident(column))
+	return err
+}
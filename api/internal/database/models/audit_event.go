@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// actions of audit events
+const (
+	AUDIT_ACTION_LOCKOUT           = "lockout"
+	AUDIT_ACTION_ROLE_CHANGED      = "role_changed"
+	AUDIT_ACTION_POLICY_CHANGED    = "policy_changed"
+	AUDIT_ACTION_POLICY_DELETED    = "policy_deleted"
+	AUDIT_ACTION_HOUSEHOLD_CHANGED = "household_changed"
+)
+
+// AuditEvent records an action that matters to the security of the household, such as a client
+// locked out after repeated failed logins. Audit events are never updated or deleted.
+type AuditEvent struct {
+	bun.BaseModel
+
+	Id     int64  `bun:",pk,autoincrement"`
+	Action string `bun:",notnull"`
+	// Actor caused the event, e.g. the IP of a client or a username
+	Actor string `bun:",notnull"`
+	// Subject is what the event is about, e.g. the route group or the credential used
+	Subject   string `bun:",notnull"`
+	Details   string
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp"`
+}
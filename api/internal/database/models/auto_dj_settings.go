@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// AutoDjSettings are the auto-DJ settings of a user, used while a session of the user is the controller.
+// They are deleted with the user.
+type AutoDjSettings struct {
+	bun.BaseModel `bun:"table:auto_dj_settings"`
+
+	Id      int64 `bun:",pk,autoincrement"`
+	UserId  int64 `bun:",notnull,unique"`
+	Enabled bool  `bun:",notnull,default:false"`
+	// QueueAhead is how many tracks the auto-DJ keeps queued after the playing track
+	QueueAhead int `bun:",notnull,default:3"`
+	// TargetEnergy, MinEnergy and MaxEnergy constrain the energy of the recommended tracks, from 0 to 1
+	TargetEnergy  *float64
+	MinEnergy     *float64
+	MaxEnergy     *float64
+	AllowExplicit bool `bun:",notnull,default:false"`
+	// BlockedTrackIds are the comma separated Spotify ids of tracks never to queue
+	BlockedTrackIds string
+	UpdatedAt       time.Time `bun:",notnull,default:current_timestamp"`
+}
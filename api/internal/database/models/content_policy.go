@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ContentPolicy restricts what plays on the player: the policy of the household applies to everyone,
+// the policy of a user only while the user is the controller.
+type ContentPolicy struct {
+	bun.BaseModel `bun:"table:content_policies"`
+
+	Id int64 `bun:",pk,autoincrement"`
+	// UserId is the user the policy applies to, 0 for the policy of the household
+	UserId        int64 `bun:",notnull,unique"`
+	BlockExplicit bool  `bun:",notnull,default:false"`
+	// BlockedArtistIds and BlockedTrackIds are comma separated Spotify ids
+	BlockedArtistIds string
+	BlockedTrackIds  string
+	// AllowedFrom and AllowedUntil are the "HH:MM" local times between which music may play,
+	// any time when both are empty
+	AllowedFrom  string
+	AllowedUntil string
+	// UpdatedBy is the username of the owner who last changed the policy
+	UpdatedBy string
+	UpdatedAt time.Time `bun:",notnull,default:current_timestamp"`
+}
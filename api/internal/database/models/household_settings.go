@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// HOUSEHOLD_SETTINGS_ID is the id of the single row of the household settings.
+const HOUSEHOLD_SETTINGS_ID = 1
+
+// HouseholdSettings are the preferences of the household, kept in a single row.
+type HouseholdSettings struct {
+	bun.BaseModel `bun:"table:household_settings"`
+
+	Id int64 `bun:",pk,autoincrement"`
+	// KeepPlaybackOnKiosk has the device watchdog move playback back to the kiosk when its device
+	// reappears under a new id
+	KeepPlaybackOnKiosk bool `bun:",notnull,default:false"`
+	// UpdatedBy is the username of the owner who last changed the settings
+	UpdatedBy string
+	UpdatedAt time.Time `bun:",notnull,default:current_timestamp"`
+}
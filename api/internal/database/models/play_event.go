@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// sources of play events
+const (
+	PLAY_SOURCE_POLLER          = "poller"
+	PLAY_SOURCE_KIOSK           = "kiosk"
+	PLAY_SOURCE_RECENTLY_PLAYED = "recently_played"
+)
+
+// PlayEvent records a track played by a user. A user has at most one play per PlayedAt, which is
+// when the play ended, to the second, as in the recently played tracks of Spotify. The unique
+// (user_id, played_at) index also serves the history of a user, ordered by time. Plays are deleted
+// with their user.
+type PlayEvent struct {
+	bun.BaseModel
+
+	Id             int64  `bun:",pk,autoincrement"`
+	UserId         int64  `bun:",notnull,unique:user_id_played_at"`
+	SpotifyTrackId string `bun:",notnull"`
+	TrackName      string
+	// ArtistIds are the ids of the artists of the track joined by commas, the main artist first
+	ArtistIds   string
+	ArtistNames string
+	DurationMs  int
+	StartedAt   time.Time `bun:",notnull"`
+	PlayedAt    time.Time `bun:",notnull,unique:user_id_played_at"`
+	// PlayedPercent is how far into the track the play got
+	PlayedPercent int       `bun:",notnull,default:0"`
+	Skipped       bool      `bun:",notnull,default:false"`
+	Source        string    `bun:",notnull"`
+	CreatedAt     time.Time `bun:",notnull,default:current_timestamp"`
+}
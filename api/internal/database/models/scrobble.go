@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// ScrobbleAccount is the account of a scrobbling service, such as Last.fm, linked by a user.
+// A user links at most one account, deleted with the user.
+type ScrobbleAccount struct {
+	bun.BaseModel
+
+	Id     int64 `bun:",pk,autoincrement"`
+	UserId int64 `bun:",notnull,unique"`
+	// Username is the name of the account on the scrobbling service
+	Username   string    `bun:",notnull"`
+	SessionKey string    `bun:",notnull"`
+	CreatedAt  time.Time `bun:",notnull,default:current_timestamp"`
+	UpdatedAt  time.Time `bun:",notnull,default:current_timestamp"`
+}
+
+// PendingScrobble is a play waiting to be scrobbled. A user has at most one pending scrobble per
+// Timestamp, which is when the play started, as scrobbling services expect. Pending scrobbles are deleted
+// with their user.
+type PendingScrobble struct {
+	bun.BaseModel
+
+	Id         int64  `bun:",pk,autoincrement"`
+	UserId     int64  `bun:",notnull,unique:user_id_timestamp"`
+	Artist     string `bun:",notnull"`
+	Track      string `bun:",notnull"`
+	DurationMs int
+	Timestamp  time.Time `bun:",notnull,unique:user_id_timestamp"`
+	// Attempts counts the failed attempts to scrobble the play, LastError is the error of the latest
+	Attempts  int `bun:",notnull,default:0"`
+	LastError string
+	CreatedAt time.Time `bun:",notnull,default:current_timestamp"`
+}
@@ -10,9 +10,9 @@ import (
 type TrackMedia struct {
 	bun.BaseModel
 
-	Id             int64 `bun:",pk,autoincrement"`
-	SpotifyTrackId string
-	MediaType      string
+	Id             int64  `bun:",pk,autoincrement"`
+	SpotifyTrackId string `bun:",unique:spotify_track_id_media_type"`
+	MediaType      string `bun:",unique:spotify_track_id_media_type"`
 	MediaId        string
 	CreatedAt      time.Time  `bun:",notnull,default:current_timestamp"`
 	DeletedAt      *time.Time `bun:",soft_delete"`
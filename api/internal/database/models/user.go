@@ -6,6 +6,13 @@ import (
 	"github.com/uptrace/bun"
 )
 
+// roles of users
+const (
+	USER_ROLE_MEMBER = "member"
+	// owners edit the content policies of the household
+	USER_ROLE_OWNER = "owner"
+)
+
 type User struct {
 	bun.BaseModel
 
@@ -13,7 +20,8 @@ type User struct {
 	Username        string `bun:"type:,unique"`
 	DisplayName     string `bun:",notnull"`
 	ProfileImageUrl string
-	Sessions        []*UserSession `bun:"rel:has-many,join:id=user_id"`
+	Role            string         `bun:",notnull,default:'member'"`
+	Sessions        []*UserSession `bun:"rel:has-many,join:id=user_id" json:"-"`
 	CreatedAt       time.Time      `bun:",notnull,default:current_timestamp"`
 	DeletedAt       *time.Time     `bun:",soft_delete"`
 }
@@ -11,8 +11,8 @@ type UserSession struct {
 
 	Id                    int64  `bun:",pk,autoincrement"`
 	UserId                int64  `bun:",notnull"`
-	User                  *User  `bun:"rel:has-one,join:user_id=id"`
-	Uuid                  string `bun:",notnull"`
+	User                  *User  `bun:"rel:has-one,join:user_id=id" json:"-"`
+	Uuid                  string `bun:",notnull,unique"`
 	UserAgent             string `bun:",notnull"`
 	AccessToken           string
 	AccessTokenExpiresAt  time.Time
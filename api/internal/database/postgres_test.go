@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/edgejay/pify-player/api/internal/database/migrations"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// newPostgresTestDB connects to the server at TEST_DATABASE_URL using a schema of its own, dropped after the test.
+// Tests are skipped when no server is configured.
+func newPostgresTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := NewPostgresDB(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("pify_test_%d", time.Now().UnixNano())
+	_, err = admin.Bun.ExecContext(context.Background(), "CREATE SCHEMA ?", bun.Ident(schema))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		admin.Bun.ExecContext(context.Background(), "DROP SCHEMA ? CASCADE", bun.Ident(schema))
+	})
+
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	db, err := NewPostgresDB(u.String())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestNewDBUnsupportedDriver(t *testing.T) {
+	_, err := NewDB("mysql", "")
+	assert.ErrorContains(t, err, "unsupported database driver")
+
+	_, err = NewDB(DRIVER_POSTGRES, "mysql://localhost")
+	assert.ErrorContains(t, err, "invalid DATABASE_URL scheme")
+}
+
+func TestPostgresMigrate(t *testing.T) {
+	ctx := context.Background()
+	db := newPostgresTestDB(t)
+	assert.False(t, db.IsSQLite())
+
+	_, err := Migrate(ctx, db, migrations.Migrations)
+	require.NoError(t, err)
+
+	drifts, err := db.Verify(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, drifts)
+
+	// sessions of deleted users are removed with them
+	seed(t, db)
+	_, err = db.Bun.NewDelete().Model((*models.User)(nil)).Where("id = 1").ForceDelete().Exec(ctx)
+	require.NoError(t, err)
+	count, err := db.Bun.NewSelect().Model((*models.UserSession)(nil)).WhereAllWithDeleted().Count(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	migrator := migrate.NewMigrator(db.Bun, migrations.Migrations)
+	_, err = migrator.Rollback(ctx)
+	require.NoError(t, err)
+	drifts, err = db.Verify(ctx)
+	require.NoError(t, err)
+	assert.Len(t, drifts, len(Models))
+
+	_, err = Migrate(ctx, db, migrations.Migrations)
+	require.NoError(t, err)
+}
+
+func TestPostgresImport(t *testing.T) {
+	ctx := context.Background()
+	src := newTestDB(t, "src.sqlite3")
+	seed(t, src)
+	bundle, err := src.Export(ctx, ExportOptions{})
+	require.NoError(t, err)
+
+	dest := newPostgresTestDB(t)
+	_, err = Migrate(ctx, dest, migrations.Migrations)
+	require.NoError(t, err)
+	require.NoError(t, dest.Import(ctx, bundle, ImportOptions{}))
+
+	// ids keep increasing after the imported ones
+	user := &models.User{Username: "bob"}
+	_, err = dest.Bun.NewInsert().Model(user).Exec(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), user.Id)
+}
+
+func TestPostgresBackupUnsupported(t *testing.T) {
+	db := newPostgresTestDB(t)
+
+	assert.ErrorIs(t, db.Backup(context.Background(), filepath.Join(t.TempDir(), "backup.sqlite3")), ErrSQLiteOnly)
+	_, err := MigrateDryRun(context.Background(), db, migrations.Migrations)
+	assert.ErrorIs(t, err, ErrSQLiteOnly)
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/uptrace/bun/schema"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// Models lists the tables owned by the api, parents before children.
+var Models = []any{
+	(*models.User)(nil),
+	(*models.UserSession)(nil),
+	(*models.TrackMedia)(nil),
+	(*models.PlayerState)(nil),
+	(*models.AuditEvent)(nil),
+	(*models.PlayEvent)(nil),
+	(*models.ScrobbleAccount)(nil),
+	(*models.PendingScrobble)(nil),
+	(*models.AutoDjSettings)(nil),
+	(*models.ContentPolicy)(nil),
+	(*models.HouseholdSettings)(nil),
+}
+
+// Drift is a difference between the live schema and the bun models.
+type Drift struct {
+	Table   string
+	Column  string
+	Problem string
+}
+
+func (d Drift) String() string {
+	if d.Column == "" {
+		return fmt.Sprintf("%s: %s", d.Table, d.Problem)
+	}
+	return fmt.Sprintf("%s.%s: %s", d.Table, d.Column, d.Problem)
+}
+
+type liveColumn struct {
+	Name    string `bun:"name"`
+	Type    string `bun:"type"`
+	NotNull bool   `bun:"not_null"`
+}
+
+type liveIndex struct {
+	Name   string `bun:"name"`
+	Unique bool   `bun:"is_unique"`
+}
+
+// Verify compares the tables, columns, types, nullability and unique constraints of the live schema
+// with the bun models and returns the differences found.
+func (db *DB) Verify(ctx context.Context) ([]Drift, error) {
+	var drifts []Drift
+
+	for _, model := range Models {
+		table := db.Bun.Table(reflect.TypeOf(model))
+
+		modelDrifts, err := db.verifyTable(ctx, table)
+		if err != nil {
+			return nil, fmt.Errorf("verify %s: %w", table.Name, err)
+		}
+		drifts = append(drifts, modelDrifts...)
+	}
+
+	return drifts, nil
+}
+
+func (db *DB) verifyTable(ctx context.Context, table *schema.Table) ([]Drift, error) {
+	columns, err := db.liveColumns(ctx, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(columns) == 0 {
+		return []Drift{{Table: table.Name, Problem: "table is missing"}}, nil
+	}
+
+	var drifts []Drift
+	live := make(map[string]liveColumn, len(columns))
+	for _, column := range columns {
+		live[column.Name] = column
+
+		if _, ok := table.FieldMap[column.Name]; !ok {
+			drifts = append(drifts, Drift{table.Name, column.Name, "column is not in the model"})
+		}
+	}
+
+	for _, field := range table.Fields {
+		column, ok := live[field.Name]
+		if !ok {
+			drifts = append(drifts, Drift{table.Name, field.Name, "column is missing"})
+			continue
+		}
+
+		if !strings.EqualFold(column.Type, db.liveType(field.CreateTableSQLType)) {
+			drifts = append(drifts, Drift{
+				table.Name,
+				field.Name,
+				fmt.Sprintf("type is %s, model expects %s", column.Type, field.CreateTableSQLType),
+			})
+		}
+
+		if notNull := field.NotNull || field.IsPK; column.NotNull != notNull {
+			drifts = append(drifts, Drift{
+				table.Name,
+				field.Name,
+				fmt.Sprintf("not null is %t, model expects %t", column.NotNull, notNull),
+			})
+		}
+	}
+
+	uniqueDrifts, err := db.verifyUnique(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(drifts, uniqueDrifts...), nil
+}
+
+// verifyUnique checks that every unique field or group of the model is backed by a unique index.
+func (db *DB) verifyUnique(ctx context.Context, table *schema.Table) ([]Drift, error) {
+	uniqueColumns, err := db.uniqueIndexes(ctx, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for _, fields := range table.Unique {
+		names := make([]string, len(fields))
+		for i, field := range fields {
+			names[i] = field.Name
+		}
+		sort.Strings(names)
+
+		if columns := strings.Join(names, ", "); !slices.Contains(uniqueColumns, columns) {
+			drifts = append(drifts, Drift{table.Name, columns, "unique constraint is missing"})
+		}
+	}
+
+	return drifts, nil
+}
+
+// liveColumns reads the columns of table from the catalog of the dialect.
+func (db *DB) liveColumns(ctx context.Context, table string) ([]liveColumn, error) {
+	query := `SELECT name, type, "notnull" AS not_null FROM pragma_table_info(?)`
+	if !db.IsSQLite() {
+		query = `SELECT column_name AS name, udt_name AS type, is_nullable = 'NO' AS not_null
+			FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ?`
+	}
+
+	var columns []liveColumn
+	err := db.Reader.NewRaw(query, table).Scan(ctx, &columns)
+	return columns, err
+}
+
+// uniqueIndexes returns the columns of every unique index of table, sorted and joined by ", ".
+func (db *DB) uniqueIndexes(ctx context.Context, table string) ([]string, error) {
+	var uniqueColumns []string
+
+	if !db.IsSQLite() {
+		err := db.Reader.NewRaw(
+			`SELECT string_agg(a.attname, ', ' ORDER BY a.attname)
+			FROM pg_index i
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+			WHERE i.indrelid = to_regclass(?) AND i.indisunique
+			GROUP BY i.indexrelid`, table,
+		).Scan(ctx, &uniqueColumns)
+		return uniqueColumns, err
+	}
+
+	var indexes []liveIndex
+	if err := db.Reader.NewRaw(
+		`SELECT name, "unique" AS is_unique FROM pragma_index_list(?)`, table,
+	).Scan(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	for _, index := range indexes {
+		if !index.Unique {
+			continue
+		}
+
+		var columns []string
+		if err := db.Reader.NewRaw(
+			`SELECT name FROM pragma_index_info(?) ORDER BY name`, index.Name,
+		).Scan(ctx, &columns); err != nil {
+			return nil, err
+		}
+		uniqueColumns = append(uniqueColumns, strings.Join(columns, ", "))
+	}
+
+	return uniqueColumns, nil
+}
+
+// pgTypes maps the types used by pgdialect to create tables to their names in the postgres catalog.
+var pgTypes = map[string]string{
+	"BIGSERIAL":        "int8",
+	"BIGINT":           "int8",
+	"SERIAL":           "int4",
+	"INTEGER":          "int4",
+	"SMALLINT":         "int2",
+	"VARCHAR":          "varchar",
+	"TEXT":             "text",
+	"BOOLEAN":          "bool",
+	"TIMESTAMPTZ":      "timestamptz",
+	"DOUBLE PRECISION": "float8",
+	"REAL":             "float4",
+	"JSONB":            "jsonb",
+	"BYTEA":            "bytea",
+}
+
+// liveType returns the type the catalog reports for a column created with sqlType.
+func (db *DB) liveType(sqlType string) string {
+	if db.IsSQLite() {
+		return sqlType
+	}
+	if name, ok := pgTypes[strings.ToUpper(sqlType)]; ok {
+		return name
+	}
+	return sqlType
+}
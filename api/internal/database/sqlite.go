@@ -3,62 +3,109 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"runtime"
 
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/sqlitedialect"
 	"github.com/uptrace/bun/driver/sqliteshim"
-	"github.com/uptrace/bun/extra/bundebug"
 
-	"github.com/edgejay/pify-player/api/internal/utils"
+	"github.com/edgejay/pify-player/api/internal/logging"
 )
 
-type SQLiteDB struct {
-	SQL *sql.DB
-	Bun *bun.DB
-}
-
-var db *SQLiteDB = nil
-
-func initSQLiteDB() {
-	if db != nil {
-		log.Println("Database already initialised, skipping setup")
-	}
+const (
+	DEFAULT_DB_FILE = "./database/db.sqlite3"
+	MEMORY_DB_FILE  = ":memory:"
 
-	db = &SQLiteDB{}
+	// how long a connection waits for a lock held by another connection before failing with SQLITE_BUSY
+	BUSY_TIMEOUT_MS = 5000
+)
 
-	dbFile := utils.GetDBFilename()
+// NewSQLiteDB opens the writer connection and reader pool of the SQLite database stored in dbFile.
+// Pass ":memory:" to create an in-memory database, which is useful for tests. In that case reads share
+// the writer connection, as every connection to an in-memory database would see a different database.
+// The returned database should be shared across the application and closed on shutdown.
+func NewSQLiteDB(dbFile string) (*DB, error) {
 	if dbFile == "" {
-		dbFile = "./database/db.sqlite3"
+		dbFile = DEFAULT_DB_FILE
 	}
 
-	log.Printf("Initiailising database at %s\n", dbFile)
+	slog.Info("initialising database", "driver", DRIVER_SQLITE, "file", dbFile)
 
-	// Creates a SQLite database in file (determined by DB_FILE env variable)
-	sqldb, err := sql.Open(
-		sqliteshim.DriverName(),
-		fmt.Sprintf("file:%s?cache=shared", dbFile),
-	)
+	hook := logging.NewQueryHook(nil, os.Getenv("BUNDEBUG"))
 
+	sqldb, err := sql.Open(sqliteshim.DriverName(), dsn(dbFile, false))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	sqldb.SetMaxOpenConns(1)
+	sqldb.SetMaxIdleConns(1)
+	sqldb.SetConnMaxLifetime(0)
+	sqldb.SetConnMaxIdleTime(0)
 
-	db.SQL = sqldb
+	db := &DB{SQL: sqldb}
 	db.Bun = bun.NewDB(db.SQL, sqlitedialect.New())
-	db.Bun.AddQueryHook(bundebug.NewQueryHook(
-		bundebug.WithEnabled(true),
-		bundebug.FromEnv(),
-	))
+	db.Bun.AddQueryHook(hook)
 
-	log.Printf("Database setup complete. file created in %s\n", dbFile)
-}
+	if dbFile == MEMORY_DB_FILE {
+		db.Reader = db.Bun
+	} else {
+		// the writer creates the file and switches it to WAL mode before readers connect
+		if err := db.Bun.Ping(); err != nil {
+			db.Bun.Close()
+			return nil, err
+		}
+
+		readerdb, err := sql.Open(sqliteshim.DriverName(), dsn(dbFile, true))
+		if err != nil {
+			db.Bun.Close()
+			return nil, err
+		}
+		readerdb.SetMaxOpenConns(max(4, runtime.NumCPU()))
+
+		db.Reader = bun.NewDB(readerdb, sqlitedialect.New())
+		db.Reader.AddQueryHook(hook)
+	}
+
+	slog.Info("database setup complete", "driver", DRIVER_SQLITE, "file", dbFile)
 
-func GetSQLiteDB() *SQLiteDB {
-	initSQLiteDB()
-	return db
+	return db, nil
 }
 
-func (db *SQLiteDB) Ping() error {
-	return db.Bun.Ping()
+// dsn builds the connection string of dbFile with the pragmas applied to every new connection.
+// Pragmas are passed in the format of the driver picked by sqliteshim for the build target.
+// In-memory databases enforce foreign keys too, but have no journal to tune.
+func dsn(dbFile string, readOnly bool) string {
+	pragmas := [][2]string{
+		{"busy_timeout", fmt.Sprint(BUSY_TIMEOUT_MS)},
+		{"foreign_keys", "1"},
+	}
+	if dbFile != MEMORY_DB_FILE {
+		// NORMAL is durable in WAL mode except for the last transactions on power loss
+		pragmas = append(pragmas, [2]string{"synchronous", "NORMAL"})
+		if readOnly {
+			pragmas = append(pragmas, [2]string{"query_only", "1"})
+		} else {
+			pragmas = append(pragmas, [2]string{"journal_mode", "WAL"})
+		}
+	}
+
+	params := url.Values{}
+	for _, pragma := range pragmas {
+		if sqliteshim.DriverName() == "sqlite3" {
+			// github.com/mattn/go-sqlite3
+			params.Add("_"+pragma[0], pragma[1])
+		} else {
+			// modernc.org/sqlite
+			params.Add("_pragma", fmt.Sprintf("%s(%s)", pragma[0], pragma[1]))
+		}
+	}
+	if !readOnly {
+		// take the write lock when the transaction starts instead of failing to upgrade a read lock later
+		params.Set("_txlock", "immediate")
+	}
+
+	return fmt.Sprintf("file:%s?%s", dbFile, params.Encode())
 }
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+func TestSQLitePragmas(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, "db.sqlite3")
+
+	var journalMode string
+	require.NoError(t, db.Bun.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+
+	for _, conn := range []*bun.DB{db.Bun, db.Reader} {
+		var foreignKeys, busyTimeout int
+		require.NoError(t, conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys))
+		require.NoError(t, conn.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&busyTimeout))
+		assert.Equal(t, 1, foreignKeys)
+		assert.Equal(t, BUSY_TIMEOUT_MS, busyTimeout)
+	}
+
+	_, err := db.Reader.NewInsert().Model(&models.TrackMedia{SpotifyTrackId: "track"}).Exec(ctx)
+	assert.Error(t, err, "reader connections must be read-only")
+}
+
+func TestSQLiteMemoryPragmas(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewSQLiteDB(MEMORY_DB_FILE)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var foreignKeys int
+	require.NoError(t, db.Bun.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys))
+	assert.Equal(t, 1, foreignKeys)
+
+	// tests on in-memory databases see foreign keys enforced, as in production
+	_, err = db.Bun.ExecContext(ctx, `CREATE TABLE parents (id INTEGER PRIMARY KEY)`)
+	require.NoError(t, err)
+	_, err = db.Bun.ExecContext(ctx, `CREATE TABLE children (id INTEGER PRIMARY KEY, parent_id INTEGER REFERENCES parents (id))`)
+	require.NoError(t, err)
+	_, err = db.Bun.ExecContext(ctx, `INSERT INTO children (parent_id) VALUES (1)`)
+	assert.ErrorContains(t, err, "FOREIGN KEY")
+}
+
+func TestSQLiteConcurrentAccess(t *testing.T) {
+	const (
+		writers = 8
+		readers = 8
+		rows    = 50
+	)
+
+	ctx := context.Background()
+	db := newTestDB(t, "db.sqlite3")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, (writers+readers)*rows)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rows; i++ {
+				media := &models.TrackMedia{
+					SpotifyTrackId: fmt.Sprintf("track-%d-%d", w, i),
+					MediaType:      "youtube",
+					MediaId:        "video",
+				}
+
+				// mix plain writes with read-modify-write transactions
+				var err error
+				if i%2 == 0 {
+					_, err = db.Bun.NewInsert().Model(media).Exec(ctx)
+				} else {
+					err = db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+						if _, err := tx.NewSelect().Model((*models.TrackMedia)(nil)).Count(ctx); err != nil {
+							return err
+						}
+						_, err := tx.NewInsert().Model(media).Exec(ctx)
+						return err
+					})
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rows; i++ {
+				var media []models.TrackMedia
+				if err := db.Reader.NewSelect().Model(&media).Limit(10).Scan(ctx); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	count, err := db.Reader.NewSelect().Model((*models.TrackMedia)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, writers*rows, count)
+}
+
+func TestSQLiteMemoryDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := NewSQLiteDB(MEMORY_DB_FILE)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Bun.NewCreateTable().Model((*models.TrackMedia)(nil)).Exec(ctx)
+	require.NoError(t, err)
+
+	// reads must see the tables created through the writer
+	count, err := db.Reader.NewSelect().Model((*models.TrackMedia)(nil)).Count(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// every in-memory database is private to its owner
+	other, err := NewSQLiteDB(MEMORY_DB_FILE)
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.Reader.NewSelect().Model((*models.TrackMedia)(nil)).Count(ctx)
+	assert.Error(t, err)
+}
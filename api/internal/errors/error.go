@@ -0,0 +1,177 @@
+package errors
+
+import (
+	goerrors "errors"
+	"net/http"
+)
+
+// Error is the error answered by the api. Its code is one of the codes of this package,
+// the message is meant for humans and may change, clients should switch on the code.
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Status    int    `json:"status"`
+	Retryable bool   `json:"retryable"`
+	// cause is logged, but never sent to clients
+	cause error
+}
+
+// Error returns the code, so that errors can still be compared with err.Error() == CODE.
+func (e *Error) Error() string {
+	return e.Code
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// WithMessage returns a copy of e with a more specific message.
+func (e *Error) WithMessage(message string) *Error {
+	copy := *e
+	copy.Message = message
+	return &copy
+}
+
+type definition struct {
+	status    int
+	retryable bool
+	message   string
+}
+
+// definitions maps every error code to its HTTP status. Upstream failures of Spotify, YouTube
+// or the host handler answer 502, and are retryable unless retrying can't change the outcome.
+var definitions = map[string]definition{
+	// auth
+	MISSING_CODE_OR_STATE:      {http.StatusBadRequest, false, "The callback is missing the code or state of the Spotify login."},
+	GET_ACCESS_TOKEN_FAILED:    {http.StatusBadGateway, false, "Spotify did not issue an access token, log in again."},
+	GET_USER_INFO_FAILED:       {http.StatusBadGateway, false, "Spotify did not return the profile of the user, log in again."},
+	SAVE_USER_INFO_FAILED:      {http.StatusInternalServerError, false, "The user could not be saved, log in again."},
+	GENERATE_SESSION_ID_FAILED: {http.StatusInternalServerError, false, "The session id could not be generated, log in again."},
+	GET_SESSION_FAILED:         {http.StatusInternalServerError, true, "The session could not be loaded."},
+	SAVE_SESSION_FAILED:        {http.StatusInternalServerError, false, "The session could not be saved, log in again."},
+
+	// api
+	UNKNOWN_ERROR:                {http.StatusInternalServerError, false, "Something went wrong."},
+	GET_DEVICES_FAILED:           {http.StatusBadGateway, true, "Spotify did not return the devices."},
+	INVALID_REQUEST_BODY:         {http.StatusBadRequest, false, "The request body is not valid JSON of the expected shape."},
+	INVALID_SESSION:              {http.StatusUnauthorized, false, "No session is connected as controller of the player."},
+	LOGIN_QR_UNAVAILABLE:         {http.StatusInternalServerError, false, "The login QR code could not be generated."},
+	BAD_OR_EXPIRED_TOKEN:         {http.StatusUnauthorized, false, "The Spotify access token is invalid or expired."},
+	BAD_OAUTH_REQUEST:            {http.StatusForbidden, false, "Spotify rejected the OAuth request."},
+	RATE_LIMIT_EXCEEDED:          {http.StatusTooManyRequests, true, "Spotify is rate limiting the api, try again later."},
+	GET_TRACK_FAILED:             {http.StatusBadGateway, true, "Spotify did not return the track."},
+	PARSE_TRACK_RESPONSE_FAILED:  {http.StatusBadGateway, false, "Spotify returned a track that could not be parsed."},
+	NO_YOUTUBE_VIDEO_FOUND:       {http.StatusNotFound, false, "No YouTube video was found for the track."},
+	SEARCH_YOUTUBE_FAILED:        {http.StatusBadGateway, true, "YouTube did not return search results."},
+	UNABLE_TO_SET_CONTROLLER:     {http.StatusInternalServerError, true, "The session could not be made the controller."},
+	INVALID_PLAYER_COMMAND:       {http.StatusBadRequest, false, "The command is not supported by the player."},
+	COMMAND_EXECUTION_FAILED:     {http.StatusBadGateway, true, "The host handler did not run the command."},
+	REQUEST_VALIDATION_FAILED:    {http.StatusBadRequest, false, "The request does not match the api specification."},
+	SEARCH_FAILED:                {http.StatusBadGateway, true, "Spotify did not return search results."},
+	INVALID_SEARCH_TYPE:          {http.StatusBadRequest, false, "Search types are track, album, artist, playlist and show."},
+	LIBRARY_FAILED:               {http.StatusBadGateway, true, "Spotify did not return the library."},
+	PLAYLIST_NOT_FOUND:           {http.StatusNotFound, false, "The playlist does not exist."},
+	INVALID_CURSOR:               {http.StatusBadRequest, false, "The cursor is not valid, list from the start again."},
+	PLAYBACK_FAILED:              {http.StatusBadGateway, true, "Spotify did not start the playback."},
+	INVALID_PLAY_REQUEST:         {http.StatusBadRequest, false, "Play either a context_uri or uris, optionally from an offset and position."},
+	KIOSK_DEVICE_NOT_FOUND:       {http.StatusNotFound, true, "The player is not connected to Spotify, open it on the kiosk."},
+	GET_PLAYBACK_STATE_FAILED:    {http.StatusBadGateway, true, "Spotify did not return the playback state."},
+	RECENTLY_PLAYED_FAILED:       {http.StatusBadGateway, true, "Spotify did not return the recently played tracks."},
+	HISTORY_FAILED:               {http.StatusInternalServerError, true, "The play history could not be read or saved."},
+	INVALID_PLAY_REPORT:          {http.StatusBadRequest, false, "Report the track_id, when the play started and ended, and how far into the track it got."},
+	INVALID_HISTORY_RANGE:        {http.StatusBadRequest, false, "from and to are dates or RFC 3339 times, from before to."},
+	GET_ARTISTS_FAILED:           {http.StatusBadGateway, true, "Spotify did not return the artists."},
+	GET_TOP_ITEMS_FAILED:         {http.StatusBadGateway, true, "Spotify did not return the top tracks and artists of the user."},
+	SCROBBLING_DISABLED:          {http.StatusForbidden, false, "Scrobbling is disabled, set SCROBBLE_API_KEY and SCROBBLE_API_SECRET."},
+	MISSING_SCROBBLE_TOKEN:       {http.StatusBadRequest, false, "The callback is missing the token of the scrobbling service."},
+	LINK_SCROBBLE_ACCOUNT_FAILED: {http.StatusBadGateway, false, "The scrobbling service did not issue a session, link the account again."},
+	SCROBBLE_ACCOUNT_NOT_FOUND:   {http.StatusNotFound, false, "No scrobbling account is linked."},
+	SCROBBLE_FAILED:              {http.StatusBadGateway, true, "The scrobbling service did not accept the request."},
+	SCROBBLE_QUEUE_FAILED:        {http.StatusInternalServerError, true, "The scrobbling accounts or queue could not be read or saved."},
+	GET_RECOMMENDATIONS_FAILED:   {http.StatusBadGateway, true, "Spotify did not return recommendations."},
+	GET_QUEUE_FAILED:             {http.StatusBadGateway, true, "Spotify did not return the queue."},
+	ADD_TO_QUEUE_FAILED:          {http.StatusBadGateway, true, "Spotify did not add the track to the queue."},
+	INVALID_AUTO_DJ_SETTINGS:     {http.StatusBadRequest, false, "queue_ahead is 1 to 10, energies are 0 to 1 with min_energy at most max_energy, and blocked tracks are Spotify track ids."},
+	AUTO_DJ_FAILED:               {http.StatusInternalServerError, true, "The auto-DJ settings could not be read or saved."},
+	INVALID_CONTENT_POLICY:       {http.StatusBadRequest, false, "Blocked artists and tracks are Spotify ids, and allowed_from and allowed_until are both empty or both HH:MM times."},
+	CONTENT_POLICY_FAILED:        {http.StatusInternalServerError, true, "The content policies could not be read or saved."},
+	CONTENT_BLOCKED:              {http.StatusForbidden, false, "The content policy of the household does not allow this content, or not at this time."},
+	GET_TRACKS_FAILED:            {http.StatusBadGateway, true, "Spotify did not return the tracks."},
+	SKIP_TRACK_FAILED:            {http.StatusBadGateway, true, "Spotify did not skip to the next track."},
+	PAUSE_FAILED:                 {http.StatusBadGateway, true, "Spotify did not pause playback."},
+	HOUSEHOLD_SETTINGS_FAILED:    {http.StatusInternalServerError, true, "The household settings could not be read or saved."},
+
+	// admin
+	USER_NOT_FOUND:       {http.StatusNotFound, false, "The user does not exist."},
+	SESSION_NOT_FOUND:    {http.StatusNotFound, false, "The session does not exist."},
+	REFRESH_TOKEN_FAILED: {http.StatusBadGateway, true, "Spotify did not refresh the access token."},
+	MISSING_PURGE_TARGET: {http.StatusBadRequest, false, "Pass a Spotify track id, or all=true to purge all track media."},
+	CONTROLLER_NOT_FOUND: {http.StatusNotFound, false, "No session is connected as controller of the player."},
+	ADMIN_AUTH_DISABLED:  {http.StatusForbidden, false, "Admin routes are disabled, set ADMIN_USERNAME and ADMIN_PASSWORD."},
+	INVALID_USER_ROLE:    {http.StatusBadRequest, false, "The role is member or owner."},
+
+	// http
+	LOGIN_REQUIRED:      {http.StatusUnauthorized, false, "Log in with Spotify first."},
+	INVALID_CREDENTIALS: {http.StatusUnauthorized, false, "Please provide valid credentials."},
+	BAD_REQUEST:         {http.StatusBadRequest, false, "The request is invalid."},
+	FORBIDDEN:           {http.StatusForbidden, false, "The request is not allowed."},
+	OWNER_REQUIRED:      {http.StatusForbidden, false, "Only owners of the household can do this."},
+	NOT_FOUND:           {http.StatusNotFound, false, "The route does not exist."},
+	METHOD_NOT_ALLOWED:  {http.StatusMethodNotAllowed, false, "The route does not support the method."},
+
+	TOO_MANY_REQUESTS:        {http.StatusTooManyRequests, true, "Too many requests, try again after the Retry-After delay."},
+	TOO_MANY_FAILED_ATTEMPTS: {http.StatusTooManyRequests, true, "Too many failed logins, try again after the Retry-After delay."},
+}
+
+// FromCode returns the Error of code. Unknown codes are answered as internal errors.
+func FromCode(code string) *Error {
+	def, ok := definitions[code]
+	if !ok {
+		def = definitions[UNKNOWN_ERROR]
+	}
+	return &Error{Code: code, Message: def.message, Status: def.status, Retryable: def.retryable}
+}
+
+// Wrap returns the Error of code, caused by cause.
+func Wrap(code string, cause error) *Error {
+	e := FromCode(code)
+	e.cause = cause
+	return e
+}
+
+// From converts err into an Error. Errors created from a code, as the services do with
+// errors.New(CODE), keep their code. Any other error is an UNKNOWN_ERROR caused by err.
+func From(err error) *Error {
+	var e *Error
+	if goerrors.As(err, &e) {
+		return e
+	}
+	if _, ok := definitions[err.Error()]; ok {
+		return Wrap(err.Error(), err)
+	}
+	return Wrap(UNKNOWN_ERROR, err)
+}
+
+// FromStatus returns the Error of a request rejected with status, such as unknown routes.
+func FromStatus(status int) *Error {
+	switch status {
+	case http.StatusUnauthorized:
+		return FromCode(INVALID_CREDENTIALS)
+	case http.StatusForbidden:
+		return FromCode(FORBIDDEN)
+	case http.StatusNotFound:
+		return FromCode(NOT_FOUND)
+	case http.StatusMethodNotAllowed:
+		return FromCode(METHOD_NOT_ALLOWED)
+	case http.StatusTooManyRequests:
+		return FromCode(TOO_MANY_REQUESTS)
+	}
+
+	if status >= http.StatusInternalServerError {
+		return FromCode(UNKNOWN_ERROR)
+	}
+	e := FromCode(BAD_REQUEST)
+	e.Status = status
+	e.Message = http.StatusText(status)
+	return e
+}
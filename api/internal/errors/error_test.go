@@ -0,0 +1,56 @@
+package errors
+
+import (
+	goerrors "errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrom(t *testing.T) {
+	// services create errors from a code
+	err := From(goerrors.New(NO_YOUTUBE_VIDEO_FOUND))
+	assert.Equal(t, NO_YOUTUBE_VIDEO_FOUND, err.Code)
+	assert.Equal(t, http.StatusNotFound, err.Status)
+	assert.NotEmpty(t, err.Message)
+
+	apiErr := Wrap(RATE_LIMIT_EXCEEDED, nil)
+	assert.Same(t, apiErr, From(apiErr))
+	assert.True(t, apiErr.Retryable)
+
+	cause := goerrors.New("connection refused")
+	err = From(cause)
+	assert.Equal(t, UNKNOWN_ERROR, err.Code)
+	assert.Equal(t, http.StatusInternalServerError, err.Status)
+	assert.ErrorIs(t, err, cause)
+}
+
+func TestErrorComparesByCode(t *testing.T) {
+	var err error = Wrap(INVALID_SESSION, goerrors.New("no rows"))
+	assert.Equal(t, INVALID_SESSION, err.Error())
+}
+
+func TestWithMessage(t *testing.T) {
+	err := FromCode(REQUEST_VALIDATION_FAILED)
+	withMessage := err.WithMessage("request body at /command: value is not one of the allowed values")
+
+	assert.Equal(t, REQUEST_VALIDATION_FAILED, withMessage.Code)
+	assert.NotEqual(t, err.Message, withMessage.Message)
+}
+
+func TestFromStatus(t *testing.T) {
+	assert.Equal(t, NOT_FOUND, FromStatus(http.StatusNotFound).Code)
+	assert.Equal(t, METHOD_NOT_ALLOWED, FromStatus(http.StatusMethodNotAllowed).Code)
+	assert.Equal(t, UNKNOWN_ERROR, FromStatus(http.StatusServiceUnavailable).Code)
+
+	err := FromStatus(http.StatusRequestEntityTooLarge)
+	assert.Equal(t, BAD_REQUEST, err.Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, err.Status)
+}
+
+func TestUnknownCode(t *testing.T) {
+	err := FromCode("not_a_code")
+	assert.Equal(t, "not_a_code", err.Code)
+	assert.Equal(t, http.StatusInternalServerError, err.Status)
+}
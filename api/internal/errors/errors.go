@@ -1,3 +1,5 @@
+// Package errors defines the error codes of the api and the Error returned by its routes,
+// which maps every code to a message, HTTP status and whether the request can be retried.
 package errors
 
 // auth related error codes
@@ -13,18 +15,81 @@ const (
 
 // api related error codes
 const (
-	UNKNOWN_ERROR               = "unknown_error"
-	GET_DEVICES_FAILED          = "get_devices_failed"
-	INVALID_REQUEST_BODY        = "invalid_request_body"
-	INVALID_SESSION             = "invalid_session"
-	LOGIN_QR_UNAVAILABLE        = "login_qr_unavailable"
-	BAD_OR_EXPIRED_TOKEN        = "bad_or_expired_token"
-	BAD_OAUTH_REQUEST           = "bad_oauth_request"
-	RATE_LIMIT_EXCEEDED         = "rate_limit_exceeded"
-	GET_TRACK_FAILED            = "get_track_failed"
-	PARSE_TRACK_RESPONSE_FAILED = "parse_track_response_failed"
-	NO_YOUTUBE_VIDEO_FOUND      = "no_youtube_video_found"
-	UNABLE_TO_SET_CONTROLLER    = "unable_to_set_controller"
-	INVALID_PLAYER_COMMAND      = "invalid_player_command"
-	COMMAND_EXECUTION_FAILED    = "command_execution_failed"
+	UNKNOWN_ERROR                = "unknown_error"
+	GET_DEVICES_FAILED           = "get_devices_failed"
+	INVALID_REQUEST_BODY         = "invalid_request_body"
+	INVALID_SESSION              = "invalid_session"
+	LOGIN_QR_UNAVAILABLE         = "login_qr_unavailable"
+	BAD_OR_EXPIRED_TOKEN         = "bad_or_expired_token"
+	BAD_OAUTH_REQUEST            = "bad_oauth_request"
+	RATE_LIMIT_EXCEEDED          = "rate_limit_exceeded"
+	GET_TRACK_FAILED             = "get_track_failed"
+	PARSE_TRACK_RESPONSE_FAILED  = "parse_track_response_failed"
+	NO_YOUTUBE_VIDEO_FOUND       = "no_youtube_video_found"
+	SEARCH_YOUTUBE_FAILED        = "search_youtube_failed"
+	UNABLE_TO_SET_CONTROLLER     = "unable_to_set_controller"
+	INVALID_PLAYER_COMMAND       = "invalid_player_command"
+	COMMAND_EXECUTION_FAILED     = "command_execution_failed"
+	REQUEST_VALIDATION_FAILED    = "request_validation_failed"
+	SEARCH_FAILED                = "search_failed"
+	INVALID_SEARCH_TYPE          = "invalid_search_type"
+	LIBRARY_FAILED               = "library_failed"
+	PLAYLIST_NOT_FOUND           = "playlist_not_found"
+	INVALID_CURSOR               = "invalid_cursor"
+	PLAYBACK_FAILED              = "playback_failed"
+	INVALID_PLAY_REQUEST         = "invalid_play_request"
+	KIOSK_DEVICE_NOT_FOUND       = "kiosk_device_not_found"
+	GET_PLAYBACK_STATE_FAILED    = "get_playback_state_failed"
+	RECENTLY_PLAYED_FAILED       = "recently_played_failed"
+	HISTORY_FAILED               = "history_failed"
+	INVALID_PLAY_REPORT          = "invalid_play_report"
+	INVALID_HISTORY_RANGE        = "invalid_history_range"
+	GET_ARTISTS_FAILED           = "get_artists_failed"
+	GET_TOP_ITEMS_FAILED         = "get_top_items_failed"
+	SCROBBLING_DISABLED          = "scrobbling_disabled"
+	MISSING_SCROBBLE_TOKEN       = "missing_scrobble_token"
+	LINK_SCROBBLE_ACCOUNT_FAILED = "link_scrobble_account_failed"
+	SCROBBLE_ACCOUNT_NOT_FOUND   = "scrobble_account_not_found"
+	SCROBBLE_FAILED              = "scrobble_failed"
+	SCROBBLE_QUEUE_FAILED        = "scrobble_queue_failed"
+	GET_RECOMMENDATIONS_FAILED   = "get_recommendations_failed"
+	GET_QUEUE_FAILED             = "get_queue_failed"
+	ADD_TO_QUEUE_FAILED          = "add_to_queue_failed"
+	INVALID_AUTO_DJ_SETTINGS     = "invalid_auto_dj_settings"
+	AUTO_DJ_FAILED               = "auto_dj_failed"
+	INVALID_CONTENT_POLICY       = "invalid_content_policy"
+	CONTENT_POLICY_FAILED        = "content_policy_failed"
+	// the track, artist or time of day is not allowed by a content policy
+	CONTENT_BLOCKED           = "content_blocked"
+	GET_TRACKS_FAILED         = "get_tracks_failed"
+	SKIP_TRACK_FAILED         = "skip_track_failed"
+	PAUSE_FAILED              = "pause_failed"
+	HOUSEHOLD_SETTINGS_FAILED = "household_settings_failed"
+)
+
+// admin related error codes
+const (
+	USER_NOT_FOUND       = "user_not_found"
+	SESSION_NOT_FOUND    = "session_not_found"
+	REFRESH_TOKEN_FAILED = "refresh_token_failed"
+	MISSING_PURGE_TARGET = "missing_purge_target"
+	CONTROLLER_NOT_FOUND = "controller_not_found"
+	ADMIN_AUTH_DISABLED  = "admin_auth_disabled"
+	INVALID_USER_ROLE    = "invalid_user_role"
+)
+
+// http related error codes, used for requests rejected before they reach a route
+const (
+	LOGIN_REQUIRED      = "login_required"
+	INVALID_CREDENTIALS = "invalid_credentials"
+	BAD_REQUEST         = "bad_request"
+	FORBIDDEN           = "forbidden"
+	// the route is reserved to users with the owner role
+	OWNER_REQUIRED     = "owner_required"
+	NOT_FOUND          = "not_found"
+	METHOD_NOT_ALLOWED = "method_not_allowed"
+	// the client exceeded the rate limit of the route group
+	TOO_MANY_REQUESTS = "too_many_requests"
+	// the client or credential is locked out after repeated failed logins
+	TOO_MANY_FAILED_ATTEMPTS = "too_many_failed_attempts"
 )
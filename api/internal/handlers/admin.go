@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+)
+
+// DEFAULT_AUDIT_LIMIT is the number of audit events listed when the request does not set a limit.
+const DEFAULT_AUDIT_LIMIT = 100
+
+// SetAdminRoutes registers the routes used by pifyctl, guarded by the admin credentials.
+func (h *Handlers) SetAdminRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_ADMIN))
+	group.Use(h.middlewareFactory.AdminAuth())
+	group.GET("/users", h.listUsers)
+	group.DELETE("/users/:username/sessions", h.revokeUser)
+	group.PUT("/users/:username/role", h.setUserRole)
+	group.GET("/sessions", h.listSessions)
+	group.DELETE("/sessions/:uuid", h.revokeSession)
+	group.POST("/sessions/:uuid/refresh", h.refreshSessionToken)
+	group.GET("/controller", h.getController)
+	group.PUT("/controller", h.setController)
+	group.POST("/controller/refresh", h.refreshSessionToken)
+	group.GET("/track-media", h.listTrackMedia)
+	group.DELETE("/track-media", h.purgeTrackMedia)
+	group.GET("/devices", h.listControllerDevices)
+	group.POST("/playback/transfer", h.transferControllerPlayback)
+	group.GET("/login-url", h.getLoginUrl)
+	group.GET("/audit", h.listAuditEvents)
+}
+
+func (h *Handlers) listUsers(c echo.Context) error {
+	users, err := h.adminService.ListUsers(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: users})
+}
+
+func (h *Handlers) revokeUser(c echo.Context) error {
+	count, err := h.adminService.RevokeUser(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: pifyHttp.CountResponse{Count: count}})
+}
+
+func (h *Handlers) setUserRole(c echo.Context) error {
+	var req pifyHttp.AdminUserRoleRequest
+	if err := c.Bind(&req); err != nil || req.Role == "" {
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
+	}
+
+	user, err := h.adminService.SetRole(c.Request().Context(), c.Param("username"), req.Role)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: user})
+}
+
+func (h *Handlers) listSessions(c echo.Context) error {
+	sessions, err := h.adminService.ListSessions(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: sessions})
+}
+
+func (h *Handlers) revokeSession(c echo.Context) error {
+	if err := h.adminService.RevokeSession(c.Request().Context(), c.Param("uuid")); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// refreshSessionToken refreshes the token of the session in the path, or of the controller.
+func (h *Handlers) refreshSessionToken(c echo.Context) error {
+	session, err := h.adminService.RefreshToken(c.Request().Context(), c.Param("uuid"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: session})
+}
+
+func (h *Handlers) getController(c echo.Context) error {
+	session, err := h.adminService.GetController(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: session})
+}
+
+func (h *Handlers) setController(c echo.Context) error {
+	var req pifyHttp.AdminControllerRequest
+	if err := c.Bind(&req); err != nil || req.Uuid == "" {
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
+	}
+
+	session, err := h.adminService.SetController(c.Request().Context(), req.Uuid)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: session})
+}
+
+func (h *Handlers) listTrackMedia(c echo.Context) error {
+	media, err := h.adminService.ListTrackMedia(c.Request().Context(), c.QueryParam("spotify_track_id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: media})
+}
+
+// purgeTrackMedia deletes the media of the track in spotify_track_id, or of all tracks with all=true.
+func (h *Handlers) purgeTrackMedia(c echo.Context) error {
+	count, err := h.adminService.PurgeTrackMedia(
+		c.Request().Context(),
+		c.QueryParam("spotify_track_id"),
+		c.QueryParam("all") == "true",
+	)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: pifyHttp.CountResponse{Count: count}})
+}
+
+func (h *Handlers) listControllerDevices(c echo.Context) error {
+	devices, err := h.adminService.ListDevices(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: devices})
+}
+
+func (h *Handlers) transferControllerPlayback(c echo.Context) error {
+	var req pifyHttp.AdminTransferPlaybackRequest
+	if err := c.Bind(&req); err != nil || req.DeviceId == "" {
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
+	}
+
+	if err := h.adminService.TransferPlayback(c.Request().Context(), req.DeviceId); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handlers) getLoginUrl(c echo.Context) error {
+	url, err := h.adminService.LoginURL(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: pifyHttp.LoginUrlResponse{Url: url}})
+}
+
+// listAuditEvents lists the latest audit events, of the action in the query if any.
+func (h *Handlers) listAuditEvents(c echo.Context) error {
+	limit, err := queryInt(c, "limit", DEFAULT_AUDIT_LIMIT, 1)
+	if err != nil {
+		return err
+	}
+
+	events, err := h.adminService.ListAuditEvents(c.Request().Context(), c.QueryParam("action"), limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: events})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/middlewares"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+func TestAdminRoutesRequireAdminAuth(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/admin/users", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// the kiosk credentials are not admin credentials
+	rec = env.do(http.MethodGet, "/api/admin/users", "", withBasicAuth())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAdminRoutesDisabledWithoutCredentials(t *testing.T) {
+	t.Setenv("ADMIN_USERNAME", testAdminUsername)
+	t.Setenv("ADMIN_PASSWORD", "")
+
+	e := echo.New()
+	h := &Handlers{middlewareFactory: middlewares.NewMiddlewareFactory(constants.COOKIE_SESSION_ID, nil, nil)}
+	e.HTTPErrorHandler = h.HTTPErrorHandler
+	h.SetAdminRoutes(e.Group("/api/admin"))
+	env := &testEnv{e: e}
+
+	rec := env.do(http.MethodGet, "/api/admin/users", "", withAdminAuth())
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, errors.ADMIN_AUTH_DISABLED, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
+
+func TestAdminListAndRevokeUsers(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+	env.saveSession(t, "laptop", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/admin/users", "", withAdminAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	users := decode[struct {
+		Data []services.UserSummary `json:"data"`
+	}](t, rec).Data
+	require.Len(t, users, 1)
+	assert.Equal(t, "alice", users[0].Username)
+	assert.Equal(t, 2, users[0].ActiveSessions)
+
+	rec = env.do(http.MethodDelete, "/api/admin/users/alice/sessions", "", withAdminAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, decode[struct {
+		Data pifyHttp.CountResponse `json:"data"`
+	}](t, rec).Data.Count)
+
+	count, err := env.store.Sessions().CountActive(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	rec = env.do(http.MethodDelete, "/api/admin/users/nobody/sessions", "", withAdminAuth())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, errors.USER_NOT_FOUND, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
+
+func TestAdminSetUserRole(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+
+	rec := env.do(http.MethodPut, "/api/v1/admin/users/alice/role", `{"role": "owner"}`, withAdminAuth())
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, models.USER_ROLE_OWNER, decode[struct{ Data services.UserSummary }](t, rec).Data.Role)
+
+	rec = env.do(http.MethodPut, "/api/v1/admin/users/alice/role", `{"role": "root"}`, withAdminAuth())
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_USER_ROLE, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	rec = env.do(http.MethodPut, "/api/v1/admin/users/bob/role", `{"role": "owner"}`, withAdminAuth())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	events, err := env.store.Audit().List(context.Background(), models.AUDIT_ACTION_ROLE_CHANGED, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "alice", events[0].Subject)
+}
+
+func TestAdminListAndRevokeSessions(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/admin/sessions", "", withAdminAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "access-token")
+	sessions := decode[struct {
+		Data []services.SessionSummary `json:"data"`
+	}](t, rec).Data
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "phone", sessions[0].Uuid)
+	assert.Equal(t, "alice", sessions[0].Username)
+
+	rec = env.do(http.MethodDelete, "/api/admin/sessions/phone", "", withAdminAuth())
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	_, err := env.store.Sessions().Get(context.Background(), "phone")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	rec = env.do(http.MethodDelete, "/api/admin/sessions/phone", "", withAdminAuth())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, errors.SESSION_NOT_FOUND, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
+
+func TestAdminController(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+	env.saveSession(t, "tv", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/admin/controller", "", withAdminAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "kiosk", decode[struct {
+		Data services.SessionSummary `json:"data"`
+	}](t, rec).Data.Uuid)
+
+	rec = env.do(http.MethodPut, "/api/admin/controller", `{"uuid": "tv"}`, withAdminAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, decode[struct {
+		Data services.SessionSummary `json:"data"`
+	}](t, rec).Data.IsController)
+
+	// the previous controller loses its privileges
+	count, err := env.store.Sessions().CountControllers(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	rec = env.do(http.MethodPut, "/api/admin/controller", `{"uuid": "unknown"}`, withAdminAuth())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminRefreshControllerToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodPost, "/api/admin/controller/refresh", "", withAdminAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, env.apis.called("POST /api/token"))
+
+	session, err := env.store.Sessions().Get(context.Background(), "kiosk")
+	require.NoError(t, err)
+	assert.Equal(t, "refreshed-token", session.AccessToken)
+}
+
+func TestAdminTrackMedia(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	for _, trackId := range []string{"first", "second"} {
+		require.NoError(t, env.store.TrackMedia().Upsert(ctx, &models.TrackMedia{
+			SpotifyTrackId: trackId,
+			MediaType:      string(services.TRACK_MEDIA_TYPE_YOUTUBE),
+			MediaId:        trackId + "-video",
+		}))
+	}
+
+	rec := env.do(http.MethodGet, "/api/admin/track-media?spotify_track_id=first", "", withAdminAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	media := decode[struct {
+		Data []services.TrackMediaSummary `json:"data"`
+	}](t, rec).Data
+	require.Len(t, media, 1)
+	assert.Equal(t, "first-video", media[0].MediaId)
+
+	rec = env.do(http.MethodDelete, "/api/admin/track-media", "", withAdminAuth())
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.MISSING_PURGE_TARGET, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+
+	rec = env.do(http.MethodDelete, "/api/admin/track-media?spotify_track_id=first", "", withAdminAuth())
+	assert.Equal(t, 1, decode[struct {
+		Data pifyHttp.CountResponse `json:"data"`
+	}](t, rec).Data.Count)
+
+	rec = env.do(http.MethodDelete, "/api/admin/track-media?all=true", "", withAdminAuth())
+	assert.Equal(t, 1, decode[struct {
+		Data pifyHttp.CountResponse `json:"data"`
+	}](t, rec).Data.Count)
+}
+
+func TestAdminTransferPlayback(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodPost, "/api/admin/playback/transfer", `{"device_id": "kiosk"}`, withAdminAuth())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, errors.CONTROLLER_NOT_FOUND, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+
+	env.saveController(t, "kiosk", time.Hour)
+	rec = env.do(http.MethodPost, "/api/admin/playback/transfer", `{"device_id": "kiosk"}`, withAdminAuth())
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.True(t, env.apis.called("PUT /v1/me/player"))
+
+	env.apis.transferStatus = http.StatusBadRequest
+	rec = env.do(http.MethodPost, "/api/admin/playback/transfer", `{"device_id": "kiosk"}`, withAdminAuth())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, errors.BAD_OR_EXPIRED_TOKEN, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -12,19 +12,19 @@ import (
 	"github.com/edgejay/pify-player/api/internal/database/models"
 	"github.com/edgejay/pify-player/api/internal/errors"
 	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
-	"github.com/edgejay/pify-player/api/internal/services"
 	"github.com/edgejay/pify-player/api/internal/utils"
 )
 
-func SetAuthRoutes(group *echo.Group) {
-	group.GET("/login", login, middlewareFactory.Auth())
-	group.GET("/callback", getCallback)
-	group.GET("/logout", logout, middlewareFactory.GetCookie(), middlewareFactory.GetUserService())
+func (h *Handlers) SetAuthRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_AUTH))
+	group.GET("/login", h.login, h.loginStatus, h.middlewareFactory.Auth())
+	group.GET("/callback", h.getCallback)
+	group.GET("/logout", h.logout, h.middlewareFactory.GetCookie())
 }
 
-func login(c echo.Context) error {
+func (h *Handlers) login(c echo.Context) error {
 	session := c.Get("session").(*models.UserSession)
-	log.Printf("existing session %s found \n", session.Uuid)
+	slog.DebugContext(c.Request().Context(), "existing session found", "session_id", session.Id, "user_id", session.UserId)
 	return c.JSON(http.StatusOK, pifyHttp.LoginResponse{
 		LoggedIn: true,
 		User: &pifyHttp.UserDetails{
@@ -35,39 +35,41 @@ func login(c echo.Context) error {
 	})
 }
 
-func getCallback(c echo.Context) error {
+func (h *Handlers) getCallback(c echo.Context) error {
+	ctx := c.Request().Context()
 	code := c.QueryParam("code")
 	state := c.QueryParam("state")
 
 	if code == "" || state == "" {
-		return c.JSON(http.StatusBadRequest, pifyHttp.LoginResponse{LoggedIn: false, ErrorCode: errors.MISSING_CODE_OR_STATE})
+		return errors.FromCode(errors.MISSING_CODE_OR_STATE)
 	}
 
-	tokenRes, err := spotifyService.GetApiToken(code)
+	tokenRes, err := h.spotifyService.GetApiToken(ctx, code)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.LoginResponse{LoggedIn: false, ErrorCode: errors.GET_ACCESS_TOKEN_FAILED})
+		return errors.Wrap(errors.GET_ACCESS_TOKEN_FAILED, err)
 	}
 
 	// get user info
-	spotifyUser, err := spotifyService.GetUser(tokenRes.AccessToken)
+	spotifyUser, err := h.spotifyService.GetUser(ctx, tokenRes.AccessToken)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.LoginResponse{LoggedIn: false, ErrorCode: errors.GET_USER_INFO_FAILED})
+		return errors.Wrap(errors.GET_USER_INFO_FAILED, err)
 	}
 
 	// save user info into DB
-	dbUser, err := userService.SaveUser(spotifyUser)
+	dbUser, err := h.userService.SaveUser(ctx, spotifyUser)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.LoginResponse{LoggedIn: false, ErrorCode: errors.SAVE_USER_INFO_FAILED})
+		return errors.Wrap(errors.SAVE_USER_INFO_FAILED, err)
 	}
 
 	// generate UUIDv7 for session ID
 	sessionId, err := uuid.NewV7()
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.LoginResponse{LoggedIn: false, ErrorCode: errors.GENERATE_SESSION_ID_FAILED})
+		return errors.Wrap(errors.GENERATE_SESSION_ID_FAILED, err)
 	}
 
 	// save session into DB
-	session, err := userService.SaveSession(
+	session, err := h.userService.SaveSession(
+		ctx,
 		dbUser.Id,
 		sessionId.String(),
 		c.Request().UserAgent(),
@@ -76,10 +78,10 @@ func getCallback(c echo.Context) error {
 		time.Now().Add(time.Duration(tokenRes.ExpiresIn)*time.Second),
 	)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.LoginResponse{LoggedIn: false, ErrorCode: errors.SAVE_SESSION_FAILED})
+		return errors.Wrap(errors.SAVE_SESSION_FAILED, err)
 	}
 
-	log.Println("user session created:", session.Uuid)
+	slog.InfoContext(ctx, "user session created", "session_id", session.Id, "user_id", session.UserId)
 
 	// set cookies
 	c.SetCookie(utils.CreateCookie(
@@ -91,11 +93,12 @@ func getCallback(c echo.Context) error {
 	return c.Redirect(http.StatusTemporaryRedirect, utils.GetCallbackDestination())
 }
 
-func logout(c echo.Context) error {
-	cookie := c.Get("cookie").(*http.Cookie)
-	userService := c.Get("userService").(*services.UserService)
+func (h *Handlers) logout(c echo.Context) error {
+	ctx := c.Request().Context()
 	// delete session in database
-	userService.DeleteSession(cookie.Value)
+	if cookie := c.Get("cookie").(*http.Cookie); cookie != nil {
+		h.userService.DeleteSession(ctx, cookie.Value)
+	}
 	// delete cookie
 	c.SetCookie(utils.CreateCookie(constants.COOKIE_SESSION_ID, "", time.Now().Add(-1*time.Hour)))
 	return c.JSON(http.StatusOK, pifyHttp.LoginResponse{LoggedIn: false})
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+func TestLoginWithoutSession(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/auth/login", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[pifyHttp.LoginResponse](t, rec)
+	assert.False(t, res.LoggedIn)
+	assert.Contains(t, res.RedirectUrl, "https://accounts.spotify.com/authorize")
+}
+
+func TestLoginWithSession(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "session", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/auth/login", "", withSession("session"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[pifyHttp.LoginResponse](t, rec)
+	assert.True(t, res.LoggedIn)
+	require.NotNil(t, res.User)
+	assert.Equal(t, "Alice", res.User.DisplayName)
+	assert.False(t, env.apis.called("POST /api/token"), "valid token must not be refreshed")
+}
+
+func TestLoginRefreshesExpiredToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "session", -time.Minute)
+
+	rec := env.do(http.MethodGet, "/api/auth/login", "", withSession("session"))
+	assert.True(t, decode[pifyHttp.LoginResponse](t, rec).LoggedIn)
+
+	session, err := env.store.Sessions().Get(context.Background(), "session")
+	require.NoError(t, err)
+	assert.Equal(t, "refreshed-token", session.AccessToken)
+	assert.True(t, session.AccessTokenExpiresAt.After(time.Now()))
+}
+
+func TestCallbackMissingCode(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/auth/callback?code=abc", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.MISSING_CODE_OR_STATE, decode[pifyHttp.LoginResponse](t, rec).ErrorCode)
+}
+
+func TestCallbackCreatesSession(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/auth/callback?code=abc&state=xyz", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.Equal(t, "https://localhost:5173/", rec.Header().Get("Location"))
+
+	var sessionId string
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == constants.COOKIE_SESSION_ID {
+			sessionId = cookie.Value
+		}
+	}
+	require.NotEmpty(t, sessionId)
+
+	session, err := env.store.Sessions().Get(context.Background(), sessionId)
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", session.AccessToken)
+	assert.Equal(t, "refresh-token", session.RefreshToken)
+	assert.Equal(t, "Alice", session.User.DisplayName)
+	assert.Equal(t, "https://example.com/alice.png", session.User.ProfileImageUrl)
+}
+
+func TestLogout(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "session", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/auth/logout", "", withSession("session"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, decode[pifyHttp.LoginResponse](t, rec).LoggedIn)
+
+	_, err := env.store.Sessions().Get(context.Background(), "session")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Empty(t, cookies[0].Value)
+	assert.True(t, cookies[0].Expires.Before(time.Now()))
+}
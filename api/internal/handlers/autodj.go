@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// SetAutoDjRoutes registers the auto-DJ settings of the logged in user, used while one of their sessions
+// is the controller.
+func (h *Handlers) SetAutoDjRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_AUTODJ))
+	group.GET("/settings", h.getAutoDjSettings, h.middlewareFactory.Auth())
+	group.PUT("/settings", h.putAutoDjSettings, h.middlewareFactory.Auth())
+}
+
+func (h *Handlers) getAutoDjSettings(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	settings, err := h.autoDjService.GetSettings(c.Request().Context(), session.UserId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: settings})
+}
+
+func (h *Handlers) putAutoDjSettings(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	var req pifyHttp.AutoDjSettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
+	}
+
+	settings, err := h.autoDjService.SaveSettings(c.Request().Context(), session.UserId, services.AutoDjSettings{
+		Enabled:         req.Enabled,
+		QueueAhead:      req.QueueAhead,
+		TargetEnergy:    req.TargetEnergy,
+		MinEnergy:       req.MinEnergy,
+		MaxEnergy:       req.MaxEnergy,
+		AllowExplicit:   req.AllowExplicit,
+		BlockedTrackIds: req.BlockedTrackIds,
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: settings})
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+func TestAutoDjSettings(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.saveController(t, "kiosk", time.Hour)
+	env.saveSession(t, "phone", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/autodj/settings", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/autodj/settings", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	settings := decode[struct{ Data services.AutoDjSettings }](t, rec).Data
+	assert.False(t, settings.Enabled)
+	assert.Equal(t, services.DEFAULT_AUTO_DJ_QUEUE_AHEAD, settings.QueueAhead)
+
+	rec = env.do(http.MethodPut, "/api/v1/autodj/settings", `{"enabled": true, "queue_ahead": 5, "target_energy": 0.4, "blocked_track_ids": ["t1"]}`, withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	settings = decode[struct{ Data services.AutoDjSettings }](t, rec).Data
+	assert.True(t, settings.Enabled)
+	assert.Equal(t, 5, settings.QueueAhead)
+	assert.Equal(t, 0.4, *settings.TargetEnergy)
+	assert.Nil(t, settings.MaxEnergy)
+	assert.Equal(t, []string{"t1"}, settings.BlockedTrackIds)
+
+	rec = env.do(http.MethodGet, "/api/autodj/settings", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, decode[struct{ Data services.AutoDjSettings }](t, rec).Data.Enabled)
+
+	// settings belong to the user, whichever session they log in with
+	rec = env.do(http.MethodGet, "/api/v1/autodj/settings", "", withSession("phone"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, decode[struct{ Data services.AutoDjSettings }](t, rec).Data.Enabled)
+
+	bob, err := env.store.Users().Upsert(ctx, &models.User{Username: "bob", DisplayName: "Bob"})
+	require.NoError(t, err)
+	_, err = env.store.Sessions().Upsert(ctx, &models.UserSession{UserId: bob.Id, Uuid: "bob", AccessToken: "access-token", AccessTokenExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	rec = env.do(http.MethodGet, "/api/v1/autodj/settings", "", withSession("bob"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, decode[struct{ Data services.AutoDjSettings }](t, rec).Data.Enabled)
+
+	rec = env.do(http.MethodPut, "/api/v1/autodj/settings", `{"min_energy": 0.9, "max_energy": 0.1}`, withSession("kiosk"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_AUTO_DJ_SETTINGS, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+}
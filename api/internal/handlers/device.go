@@ -5,10 +5,10 @@ import (
 
 	"github.com/labstack/echo/v4"
 
+	"github.com/edgejay/pify-player/api/internal/constants"
 	"github.com/edgejay/pify-player/api/internal/database/models"
 	"github.com/edgejay/pify-player/api/internal/errors"
 	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
-	"github.com/edgejay/pify-player/api/internal/services"
 )
 
 type ControlPlaybackRequest struct {
@@ -16,47 +16,66 @@ type ControlPlaybackRequest struct {
 	DeviceId    string `json:"device_id"`
 }
 
-func SetDeviceRoutes(group *echo.Group) {
-	group.GET("/all", allDevices, middlewareFactory.Auth(), middlewareFactory.GetSpotifyService())
+func (h *Handlers) SetDeviceRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_DEVICE))
+	group.GET("/all", h.allDevices, h.middlewareFactory.Auth())
 	// following endpoint is only meant to be called from player page only
-	group.POST("/control-playback", controlPlayback, middlewareFactory.GetSpotifyService())
+	group.POST("/control-playback", h.controlPlayback)
+	group.GET("/watchdog", h.getWatchdog, h.middlewareFactory.Auth())
+	group.PUT("/watchdog", h.putWatchdog, h.middlewareFactory.Auth(), h.middlewareFactory.Owner())
 }
 
-func allDevices(c echo.Context) error {
+func (h *Handlers) allDevices(c echo.Context) error {
+	ctx := c.Request().Context()
 	session := c.Get("session").(*models.UserSession)
 
 	// retrieve all devices
-	spotifyService := c.Get("spotifyService").(*services.SpotifyService)
-	devicesRes, err := spotifyService.GetUserDevices(session.AccessToken)
+	devicesRes, err := h.spotifyService.GetUserDevices(ctx, session.AccessToken)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			Data:      nil,
-			ErrorCode: errors.GET_DEVICES_FAILED,
-		})
+		return errors.Wrap(errors.GET_DEVICES_FAILED, err)
 	}
 	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{
-		Data:      devicesRes,
-		ErrorCode: "",
+		Data: devicesRes,
 	})
 }
 
-func controlPlayback(c echo.Context) error {
+func (h *Handlers) controlPlayback(c echo.Context) error {
+	ctx := c.Request().Context()
 	var req ControlPlaybackRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			Data:      nil,
-			ErrorCode: errors.INVALID_REQUEST_BODY,
-		})
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
 	}
 
-	spotifyService := c.Get("spotifyService").(*services.SpotifyService)
-	success, err := spotifyService.TransferPlayback(req.AccessToken, req.DeviceId)
-	if success {
-		return c.JSON(http.StatusNoContent, nil)
-	} else {
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			Data:      nil,
-			ErrorCode: err.Error(),
-		})
+	success, err := h.spotifyService.TransferPlayback(ctx, req.AccessToken, req.DeviceId)
+	if !success {
+		return errors.From(err)
 	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getWatchdog answers whether playback is kept on the kiosk, and the kiosk as last seen by the watchdog.
+func (h *Handlers) getWatchdog(c echo.Context) error {
+	status, err := h.deviceWatchdog.Status(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: status})
+}
+
+func (h *Handlers) putWatchdog(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	var req pifyHttp.WatchdogRequest
+	if err := c.Bind(&req); err != nil {
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
+	}
+	if req.KeepPlaybackOnKiosk == nil {
+		return errors.FromCode(errors.INVALID_REQUEST_BODY)
+	}
+
+	status, err := h.deviceWatchdog.SetKeepPlaybackOnKiosk(c.Request().Context(), session.User.Username, *req.KeepPlaybackOnKiosk)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: status})
 }
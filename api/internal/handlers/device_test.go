@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+func TestAllDevices(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "session", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/device/all", "", withSession("session"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[struct {
+		Data services.SpotifyDevices `json:"data"`
+	}](t, rec)
+	require.Len(t, res.Data.Devices, 1)
+	assert.Equal(t, "Pify Player", res.Data.Devices[0].Name)
+}
+
+func TestAllDevicesWithoutSession(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/device/all", "")
+	assert.False(t, decode[pifyHttp.LoginResponse](t, rec).LoggedIn)
+	assert.False(t, env.apis.called("GET /v1/me/player/devices"))
+}
+
+func TestControlPlayback(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodPost, "/api/device/control-playback", `{"access_token": "token", "device_id": "kiosk"}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.True(t, env.apis.called("PUT /v1/me/player"))
+}
+
+func TestControlPlaybackRejected(t *testing.T) {
+	env := newTestEnv(t)
+	env.apis.transferStatus = http.StatusBadRequest
+
+	rec := env.do(http.MethodPost, "/api/device/control-playback", `{"access_token": "expired", "device_id": "kiosk"}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, errors.BAD_OR_EXPIRED_TOKEN, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
+
+func TestWatchdog(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/device/watchdog", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	require.NoError(t, env.watchdog.Check(ctx))
+	rec = env.do(http.MethodGet, "/api/v1/device/watchdog", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	status := decode[struct{ Data services.WatchdogStatus }](t, rec).Data
+	assert.False(t, status.KeepPlaybackOnKiosk)
+	assert.Equal(t, "kiosk", status.KioskDeviceId)
+
+	// members see the preference but do not change it
+	rec = env.do(http.MethodPut, "/api/v1/device/watchdog", `{"keep_playback_on_kiosk": true}`, withSession("kiosk"))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, errors.OWNER_REQUIRED, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	require.NoError(t, env.store.Users().SetRole(ctx, "alice", models.USER_ROLE_OWNER))
+	rec = env.do(http.MethodPut, "/api/device/watchdog", `{"keep_playback_on_kiosk": true}`, withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	status = decode[struct{ Data services.WatchdogStatus }](t, rec).Data
+	assert.True(t, status.KeepPlaybackOnKiosk)
+	assert.Equal(t, "alice", status.UpdatedBy)
+
+	rec = env.do(http.MethodPut, "/api/v1/device/watchdog", `{}`, withSession("kiosk"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	events, err := env.store.Audit().List(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.AUDIT_ACTION_HOUSEHOLD_CHANGED, events[0].Action)
+}
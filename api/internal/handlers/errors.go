@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	goerrors "errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+)
+
+// HTTPErrorHandler answers the errors returned by routes and middlewares, with the status of their code.
+//
+// Errors are answered with an ErrorResponse, except on the unversioned routes under /api. Those keep
+// the bodies existing clients expect: an ApiResponse, or a LoginResponse on the auth routes, and
+// they ask to log in instead of failing when a route requires a session.
+func (h *Handlers) HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	ctx := c.Request().Context()
+	apiErr := toApiError(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(ctx, "request failed", "path", c.Path(), "code", apiErr.Code, "error", apiErr.Unwrap())
+	}
+
+	var resErr error
+	switch path := c.Request().URL.Path; {
+	case c.Request().Method == http.MethodHead:
+		resErr = c.NoContent(apiErr.Status)
+	case isLegacyPath(path) && apiErr.Code == errors.LOGIN_REQUIRED:
+		resErr = h.promptLogin(c)
+	case isLegacyPath(path) && strings.HasPrefix(path, constants.API_PREFIX+"/auth/"):
+		resErr = c.JSON(apiErr.Status, pifyHttp.LoginResponse{LoggedIn: false, ErrorCode: apiErr.Code})
+	case isLegacyPath(path):
+		resErr = c.JSON(apiErr.Status, pifyHttp.ApiResponse{ErrorCode: apiErr.Code})
+	default:
+		resErr = c.JSON(apiErr.Status, pifyHttp.ErrorResponse{Error: apiErr})
+	}
+
+	if resErr != nil {
+		slog.ErrorContext(ctx, "write error response failed", "path", c.Path(), "error", resErr)
+	}
+}
+
+// toApiError converts the errors of echo, such as unknown routes, and of the services into an Error.
+func toApiError(err error) *errors.Error {
+	var apiErr *errors.Error
+	if goerrors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var httpErr *echo.HTTPError
+	if goerrors.As(err, &httpErr) {
+		apiErr = errors.FromStatus(httpErr.Code)
+		if message, ok := httpErr.Message.(string); ok && apiErr.Code == errors.BAD_REQUEST {
+			apiErr = apiErr.WithMessage(message)
+		}
+		return apiErr
+	}
+
+	return errors.From(err)
+}
+
+// isLegacyPath reports whether path belongs to the unversioned routes under /api.
+func isLegacyPath(path string) bool {
+	return strings.HasPrefix(path, constants.API_PREFIX+"/") && !strings.HasPrefix(path, constants.API_V1_PREFIX+"/")
+}
+
+// promptLogin answers that the user is not logged in, with the Spotify url to log in at.
+func (h *Handlers) promptLogin(c echo.Context) error {
+	authUrl, err := h.spotifyService.GetAuthUrl()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.LoginResponse{LoggedIn: false, RedirectUrl: authUrl})
+}
+
+// loginStatus lets the login route answer with the url to log in at when the user has no session,
+// as it reports the login status rather than requiring a session.
+func (h *Handlers) loginStatus(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		if err != nil && err.Error() == errors.LOGIN_REQUIRED {
+			return h.promptLogin(c)
+		}
+		return err
+	}
+}
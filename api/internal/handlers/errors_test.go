@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+)
+
+func TestV1Errors(t *testing.T) {
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		opts   []requestOption
+		status int
+		code   string
+	}{
+		{
+			name:   "missing credentials",
+			method: http.MethodGet,
+			target: "/api/v1/player/login-qr",
+			status: http.StatusUnauthorized,
+			code:   errors.INVALID_CREDENTIALS,
+		},
+		{
+			name:   "session required",
+			method: http.MethodGet,
+			target: "/api/v1/device/all",
+			status: http.StatusUnauthorized,
+			code:   errors.LOGIN_REQUIRED,
+		},
+		{
+			name:   "no controller",
+			method: http.MethodGet,
+			target: "/api/v1/player/connect",
+			opts:   []requestOption{withBasicAuth()},
+			status: http.StatusUnauthorized,
+			code:   errors.INVALID_SESSION,
+		},
+		{
+			name:   "invalid command",
+			method: http.MethodPost,
+			target: "/api/v1/player/command",
+			body:   `{"command": "reboot"}`,
+			opts:   []requestOption{withBasicAuth()},
+			status: http.StatusBadRequest,
+			code:   errors.INVALID_PLAYER_COMMAND,
+		},
+		{
+			name:   "unknown route",
+			method: http.MethodGet,
+			target: "/api/v1/unknown",
+			status: http.StatusNotFound,
+			code:   errors.NOT_FOUND,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := env.do(test.method, test.target, test.body, test.opts...)
+			require.Equal(t, test.status, rec.Code, rec.Body.String())
+
+			res := decode[pifyHttp.ErrorResponse](t, rec)
+			require.NotNil(t, res.Error)
+			assert.Equal(t, test.code, res.Error.Code)
+			assert.Equal(t, test.status, res.Error.Status)
+			assert.NotEmpty(t, res.Error.Message)
+		})
+	}
+}
+
+func TestV1ErrorIsRetryable(t *testing.T) {
+	env := newTestEnv(t)
+	env.apis.transferStatus = http.StatusTooManyRequests
+
+	rec := env.do(http.MethodPost, "/api/v1/device/control-playback", `{"access_token": "access-token", "device_id": "kiosk"}`)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	res := decode[pifyHttp.ErrorResponse](t, rec)
+	assert.Equal(t, errors.RATE_LIMIT_EXCEEDED, res.Error.Code)
+	assert.True(t, res.Error.Retryable)
+}
+
+func TestV1LoginWithoutSession(t *testing.T) {
+	env := newTestEnv(t)
+
+	// the login route reports the login status instead of failing
+	rec := env.do(http.MethodGet, "/api/v1/auth/login", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[pifyHttp.LoginResponse](t, rec)
+	assert.False(t, res.LoggedIn)
+	assert.Contains(t, res.RedirectUrl, "https://accounts.spotify.com/authorize")
+}
+
+func TestLegacyErrors(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/player/login-qr", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.JSONEq(t, `{"data": null, "error_code": "invalid_credentials"}`, rec.Body.String())
+
+	rec = env.do(http.MethodGet, "/api/auth/callback", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	res := decode[pifyHttp.LoginResponse](t, rec)
+	assert.False(t, res.LoggedIn)
+	assert.Equal(t, errors.MISSING_CODE_OR_STATE, res.ErrorCode)
+
+	// routes requiring a session ask to log in
+	rec = env.do(http.MethodPost, "/api/player/connect", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, decode[pifyHttp.LoginResponse](t, rec).RedirectUrl, "https://accounts.spotify.com/authorize")
+}
@@ -1,18 +1,92 @@
 package handlers
 
 import (
-	"github.com/edgejay/pify-player/api/internal/constants"
-	"github.com/edgejay/pify-player/api/internal/database"
+	"fmt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/errors"
 	"github.com/edgejay/pify-player/api/internal/middlewares"
 	"github.com/edgejay/pify-player/api/internal/services"
 )
 
-var spotifyService *services.SpotifyService = services.NewSpotifyService(services.GetSpotifyCredentials(), nil)
+// Handlers groups the route handlers of the api together with the services they depend on.
+// All dependencies are passed in explicitly via NewHandlers.
+type Handlers struct {
+	spotifyService       *services.SpotifyService
+	userService          *services.UserService
+	playerService        *services.PlayerService
+	healthService        *services.HealthService
+	youtubeService       *services.YoutubeService
+	adminService         *services.AdminService
+	searchService        *services.SearchService
+	libraryService       *services.LibraryService
+	playbackService      *services.PlaybackService
+	playbackPoller       *services.PlaybackPoller
+	historyService       *services.HistoryService
+	statsService         *services.StatsService
+	scrobbleService      *services.ScrobbleService
+	autoDjService        *services.AutoDjService
+	contentPolicyService *services.ContentPolicyService
+	deviceWatchdog       *services.DeviceWatchdog
+	eventStream          *services.EventStream
+	middlewareFactory    *middlewares.MiddlewareFactory
+}
 
-var userService *services.UserService = services.NewUserService(database.GetSQLiteDB())
+func NewHandlers(
+	spotifyService *services.SpotifyService,
+	userService *services.UserService,
+	playerService *services.PlayerService,
+	healthService *services.HealthService,
+	youtubeService *services.YoutubeService,
+	adminService *services.AdminService,
+	searchService *services.SearchService,
+	libraryService *services.LibraryService,
+	playbackService *services.PlaybackService,
+	playbackPoller *services.PlaybackPoller,
+	historyService *services.HistoryService,
+	statsService *services.StatsService,
+	scrobbleService *services.ScrobbleService,
+	autoDjService *services.AutoDjService,
+	contentPolicyService *services.ContentPolicyService,
+	deviceWatchdog *services.DeviceWatchdog,
+	eventStream *services.EventStream,
+	middlewareFactory *middlewares.MiddlewareFactory,
+) *Handlers {
+	return &Handlers{
+		spotifyService,
+		userService,
+		playerService,
+		healthService,
+		youtubeService,
+		adminService,
+		searchService,
+		libraryService,
+		playbackService,
+		playbackPoller,
+		historyService,
+		statsService,
+		scrobbleService,
+		autoDjService,
+		contentPolicyService,
+		deviceWatchdog,
+		eventStream,
+		middlewareFactory,
+	}
+}
 
-var middlewareFactory *middlewares.MiddlewareFactory = middlewares.NewMiddlewareFactory(
-	constants.COOKIE_SESSION_ID,
-	userService,
-	spotifyService,
-)
+// queryInt returns the integer query parameter name, or def if it is not set.
+// Values below minimum fail with BAD_REQUEST.
+func queryInt(c echo.Context, name string, def, minimum int) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < minimum {
+		return 0, errors.FromCode(errors.BAD_REQUEST).WithMessage(fmt.Sprintf("%s must be an integer of at least %d", name, minimum))
+	}
+	return i, nil
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/middlewares"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+	"github.com/edgejay/pify-player/api/internal/services"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+const (
+	testBasicAuthUsername = "player"
+	testBasicAuthPassword = "secret"
+	testAdminUsername     = "admin"
+	testAdminPassword     = "admin-secret"
+)
+
+// fakeApis answers the Spotify, YouTube and scrobbling requests made by the services and records them.
+type fakeApis struct {
+	mu       sync.Mutex
+	requests []string
+	// status returned by the transfer playback endpoint
+	transferStatus int
+	// query and body of the last play request
+	playQuery string
+	playBody  string
+}
+
+func (f *fakeApis) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.URL.Path == "/api/token":
+		r.ParseForm()
+		token := "access-token"
+		if r.Form.Get("grant_type") == "refresh_token" {
+			token = "refreshed-token"
+		}
+		json.NewEncoder(w).Encode(services.SpotifyTokenResponse{AccessToken: token, ExpiresIn: 3600, RefreshToken: "refresh-token"})
+	case r.URL.Path == "/v1/me":
+		io.WriteString(w, `{"id": "alice", "display_name": "Alice", "images": [{"url": "https://example.com/alice.png"}]}`)
+	case r.URL.Path == "/v1/me/player/devices":
+		io.WriteString(w, `{"devices": [{"id": "kiosk", "name": "Pify Player", "type": "Computer", "is_active": true}]}`)
+	case r.URL.Path == "/v1/me/player" && r.Method == http.MethodGet:
+		io.WriteString(w, `{"device": {"id": "kiosk", "name": "Pify Player", "volume_percent": 40}, "is_playing": false,
+			"progress_ms": 30000, "repeat_state": "off", "item": {"id": "t1", "name": "Song", "duration_ms": 200000}}`)
+	case r.URL.Path == "/v1/me/player" && r.Method == http.MethodPut:
+		w.WriteHeader(f.transferStatus)
+	case r.URL.Path == "/v1/me/player/play" && r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.playQuery, f.playBody = r.URL.RawQuery, string(body)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(r.URL.Path, "/v1/tracks/"):
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"id": "`+strings.TrimPrefix(r.URL.Path, "/v1/tracks/")+`", "name": "Song"}`)
+	case r.URL.Path == "/v1/search":
+		io.WriteString(w, fakeSearchResults)
+	case r.URL.Path == "/v1/me/playlists":
+		io.WriteString(w, fakePlaylists(r.URL.Query().Get("offset")))
+	case r.URL.Path == "/v1/playlists/p1/tracks":
+		io.WriteString(w, `{"items": [{"added_at": "2026-01-02T03:04:05Z", "track": {"id": "t1", "name": "Song"}}], "total": 1}`)
+	case r.URL.Path == "/v1/me/tracks":
+		io.WriteString(w, `{"items": [{"added_at": "2026-01-02T03:04:05Z", "track": {"id": "t2", "name": "Liked"}}], "total": 1}`)
+	case r.URL.Path == "/v1/me/albums":
+		io.WriteString(w, `{"items": [{"added_at": "2026-01-02T03:04:05Z", "album": {"id": "a1", "name": "Album"}}], "total": 1}`)
+	case r.URL.Path == "/v1/me/player/recently-played":
+		io.WriteString(w, `{"items": [{"played_at": "2026-10-18T20:00:00Z", "track": {"id": "t3", "name": "Recent", "duration_ms": 180000}}]}`)
+	case r.URL.Path == "/v1/me/top/tracks":
+		io.WriteString(w, `{"items": [{"id": "t1", "name": "Song"}]}`)
+	case r.URL.Path == "/v1/me/top/artists":
+		io.WriteString(w, `{"items": [{"id": "a1", "name": "Band", "genres": ["indie"]}]}`)
+	case r.URL.Path == "/2.0/":
+		r.ParseForm()
+		switch {
+		case r.Form.Get("method") == "auth.getSession" && r.Form.Get("token") == "token":
+			io.WriteString(w, `{"session": {"name": "alice-fm", "key": "session-key"}}`)
+		case r.Form.Get("method") == "auth.getSession":
+			io.WriteString(w, `{"error": 4, "message": "Invalid authentication token supplied"}`)
+		default:
+			io.WriteString(w, `{}`)
+		}
+	case r.URL.Path == "/youtube/v3/search":
+		if r.URL.Query().Get("q") == "unknown" {
+			io.WriteString(w, `{"items": []}`)
+			return
+		}
+		io.WriteString(w, `{"items": [{"id": {"kind": "youtube#video", "videoId": "video-id"}}]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeApis) called(request string) bool {
+	return f.count(request) > 0
+}
+
+// count returns how many times request was made.
+func (f *fakeApis) count(request string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, r := range f.requests {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+// redirectTransport sends every request to the fake apis server, keeping the path and query.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+type testEnv struct {
+	e        *echo.Echo
+	store    *repositories.MemoryStore
+	apis     *fakeApis
+	poller   *services.PlaybackPoller
+	events   *services.EventStream
+	watchdog *services.DeviceWatchdog
+}
+
+// newTestEnv sets up the auth, player, device, admin, search, library, history, stats, scrobble, auto-DJ and policy routes, versioned and unversioned, backed by in-memory repositories and fake apis.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	return newRateLimitedTestEnv(t, utils.RateLimitSettings{})
+}
+
+// newRateLimitedTestEnv is newTestEnv with the route groups and failed logins limited by settings.
+func newRateLimitedTestEnv(t *testing.T, settings utils.RateLimitSettings) *testEnv {
+	t.Helper()
+	t.Setenv("BASIC_AUTH_USERNAME", testBasicAuthUsername)
+	t.Setenv("BASIC_AUTH_PASSWORD", testBasicAuthPassword)
+	t.Setenv("ADMIN_USERNAME", testAdminUsername)
+	t.Setenv("ADMIN_PASSWORD", testAdminPassword)
+	t.Setenv("CALLBACK_DEST", "https://localhost:5173/")
+
+	apis := &fakeApis{transferStatus: http.StatusNoContent}
+	server := httptest.NewServer(apis)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client := &http.Client{Transport: redirectTransport{target}}
+
+	store := repositories.NewMemoryStore()
+	spotifyService := services.NewSpotifyService(services.SpotifyCredentials{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURI:  "https://localhost/api/auth/callback",
+	}, client)
+	userService := services.NewUserService(store.Users(), store.Sessions())
+	playerService := services.NewPlayerService(store.Sessions(), store.TrackMedia())
+	youtubeService := services.NewYoutubeService("api-key", "https://localhost", client)
+	middlewareFactory := middlewares.NewMiddlewareFactory(constants.COOKIE_SESSION_ID, userService, spotifyService).
+		WithRateLimits(settings, services.NewAuditService(store.Audit()))
+
+	adminService := services.NewAdminService(store.Users(), store.Sessions(), store.TrackMedia(), store.Audit(), spotifyService)
+	searchService := services.NewSearchService(spotifyService, time.Minute)
+	libraryService := services.NewLibraryService(spotifyService)
+	contentPolicyService := services.NewContentPolicyService(store.Policies(), store.Users(), store.Sessions(), spotifyService, services.NewAuditService(store.Audit()))
+	playbackService := services.NewPlaybackService(store.Sessions(), spotifyService, "Pify Player").WithPolicies(contentPolicyService)
+	playbackPoller := services.NewPlaybackPoller(store.Sessions(), spotifyService, services.NewPollIntervals(time.Second))
+	historyService := services.NewHistoryService(store.Sessions(), store.Plays(), spotifyService)
+	statsService := services.NewStatsService(store.Users(), store.Sessions(), store.Plays(), spotifyService)
+	scrobbleService := services.NewScrobbleService(utils.ScrobbleSettings{
+		ApiUrl:    "https://scrobbler.example.com/2.0/",
+		AuthUrl:   "https://scrobbler.example.com/api/auth/",
+		ApiKey:    "scrobble-key",
+		ApiSecret: "scrobble-secret",
+	}, store.Sessions(), store.Scrobbles(), client)
+	scrobbleService.Listen(playbackPoller, historyService)
+	autoDjService := services.NewAutoDjService(store.Sessions(), store.AutoDj(), store.Plays(), spotifyService, playbackService)
+	eventStream := services.NewEventStream()
+	eventStream.Listen(playbackPoller)
+	deviceWatchdog := services.NewDeviceWatchdog(store.Sessions(), store.Household(), spotifyService, playbackService, services.NewAuditService(store.Audit()), eventStream)
+	h := NewHandlers(
+		spotifyService,
+		userService,
+		playerService,
+		nil,
+		youtubeService,
+		adminService,
+		searchService,
+		libraryService,
+		playbackService,
+		playbackPoller,
+		historyService,
+		statsService,
+		scrobbleService,
+		autoDjService,
+		contentPolicyService,
+		deviceWatchdog,
+		eventStream,
+		middlewareFactory,
+	)
+
+	e := echo.New()
+	e.HTTPErrorHandler = h.HTTPErrorHandler
+	for _, prefix := range []string{constants.API_V1_PREFIX, constants.API_PREFIX} {
+		h.SetAuthRoutes(e.Group(prefix + "/auth"))
+		h.SetPlayerRoutes(e.Group(prefix + "/player"))
+		h.SetDeviceRoutes(e.Group(prefix + "/device"))
+		h.SetAdminRoutes(e.Group(prefix + "/admin"))
+		h.SetSearchRoutes(e.Group(prefix + "/search"))
+		h.SetLibraryRoutes(e.Group(prefix + "/library"))
+		h.SetHistoryRoutes(e.Group(prefix + "/history"))
+		h.SetStatsRoutes(e.Group(prefix + "/stats"))
+		h.SetScrobbleRoutes(e.Group(prefix + "/scrobble"))
+		h.SetAutoDjRoutes(e.Group(prefix + "/autodj"))
+		h.SetPolicyRoutes(e.Group(prefix + "/policy"))
+	}
+
+	return &testEnv{e, store, apis, playbackPoller, eventStream, deviceWatchdog}
+}
+
+// saveSession stores a session of alice, expiring after expiresIn.
+func (env *testEnv) saveSession(t *testing.T, uuid string, expiresIn time.Duration) *models.UserSession {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := env.store.Users().Upsert(ctx, &models.User{Username: "alice", DisplayName: "Alice"})
+	require.NoError(t, err)
+
+	session, err := env.store.Sessions().Upsert(ctx, &models.UserSession{
+		UserId:               user.Id,
+		Uuid:                 uuid,
+		UserAgent:            "test",
+		AccessToken:          "access-token",
+		AccessTokenExpiresAt: time.Now().Add(expiresIn),
+		RefreshToken:         "refresh-token",
+	})
+	require.NoError(t, err)
+	return session
+}
+
+// saveController stores a session of alice with controller privileges.
+func (env *testEnv) saveController(t *testing.T, uuid string, expiresIn time.Duration) *models.UserSession {
+	t.Helper()
+
+	env.saveSession(t, uuid, expiresIn)
+	require.NoError(t, env.store.Sessions().SetController(context.Background(), uuid))
+
+	session, err := env.store.Sessions().Get(context.Background(), uuid)
+	require.NoError(t, err)
+	return session
+}
+
+type requestOption func(*http.Request)
+
+func withSession(uuid string) requestOption {
+	return func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: constants.COOKIE_SESSION_ID, Value: uuid})
+	}
+}
+
+func withBasicAuth() requestOption {
+	return func(req *http.Request) {
+		req.SetBasicAuth(testBasicAuthUsername, testBasicAuthPassword)
+	}
+}
+
+// fromIP sends the request from ip.
+func fromIP(ip string) requestOption {
+	return func(req *http.Request) {
+		req.RemoteAddr = ip + ":1234"
+	}
+}
+
+func withAdminAuth() requestOption {
+	return func(req *http.Request) {
+		req.SetBasicAuth(testAdminUsername, testAdminPassword)
+	}
+}
+
+func (env *testEnv) do(method, target, body string, opts ...requestOption) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	rec := httptest.NewRecorder()
+	env.e.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &v))
+	return v
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/version"
+)
+
+// SetHealthRoutes registers unauthenticated endpoints meant for boot scripts and container healthchecks.
+func (h *Handlers) SetHealthRoutes(group *echo.Group) {
+	group.GET("/healthz", h.getHealth)
+	group.GET("/readyz", h.getReadiness)
+	group.GET("/version", h.getVersion)
+}
+
+// getHealth reports liveness, i.e. the process is up and able to serve requests.
+func (h *Handlers) getHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, pifyHttp.HealthResponse{Status: "ok"})
+}
+
+// getReadiness reports whether all dependencies of the api are available.
+func (h *Handlers) getReadiness(c echo.Context) error {
+	report := h.healthService.CheckReadiness(c.Request().Context())
+	if !report.Ready {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h *Handlers) getVersion(c echo.Context) error {
+	return c.JSON(http.StatusOK, version.GetBuildInfo())
+}
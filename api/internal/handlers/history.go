@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// DEFAULT_HISTORY_LIMIT is the number of plays of a page when the request does not set a limit.
+const DEFAULT_HISTORY_LIMIT = 50
+
+// SetHistoryRoutes registers the play history of logged in users, and the route the kiosk reports
+// its plays to.
+func (h *Handlers) SetHistoryRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_HISTORY))
+	group.GET("", h.listHistory, h.middlewareFactory.Auth())
+	group.POST("/backfill", h.backfillHistory, h.middlewareFactory.Auth())
+	group.POST("/plays", h.reportPlay, h.middlewareFactory.BasicAuth())
+}
+
+// listHistory lists the plays of the user of the session, latest first, between the from and to of
+// the query. Dates include the whole day, in the time zone of the server.
+func (h *Handlers) listHistory(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	limit, err := queryInt(c, "limit", DEFAULT_HISTORY_LIMIT, 1)
+	if err != nil {
+		return err
+	}
+	from, err := queryTime(c, "from", false)
+	if err != nil {
+		return err
+	}
+	to, err := queryTime(c, "to", true)
+	if err != nil {
+		return err
+	}
+
+	plays, err := h.historyService.History(c.Request().Context(), session.UserId, from, to, limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: plays})
+}
+
+// backfillHistory adds the tracks recently played by the user of the session to the history.
+func (h *Handlers) backfillHistory(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	count, err := h.historyService.Backfill(c.Request().Context(), session.UserId, session.AccessToken)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: pifyHttp.CountResponse{Count: count}})
+}
+
+func (h *Handlers) reportPlay(c echo.Context) error {
+	var req pifyHttp.PlayReportRequest
+	if err := c.Bind(&req); err != nil {
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
+	}
+
+	err := h.historyService.Report(c.Request().Context(), services.PlayReport{
+		TrackId:     req.TrackId,
+		TrackName:   req.TrackName,
+		ArtistIds:   req.ArtistIds,
+		ArtistNames: req.ArtistNames,
+		DurationMs:  req.DurationMs,
+		StartedAt:   req.StartedAt,
+		EndedAt:     req.EndedAt,
+		PositionMs:  req.PositionMs,
+	})
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// queryTime returns the time of the query parameter name, an RFC 3339 time or a date, or the zero
+// time if it is not set. A date is its start, or its end if end is set.
+func queryTime(c echo.Context, name string, end bool) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.FromCode(errors.INVALID_HISTORY_RANGE)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+type playsResponse struct {
+	Data []services.Play `json:"data"`
+}
+
+func TestHistory(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	report := `{"track_id": "t1", "track_name": "Song", "artist_ids": ["a1"], "artist_names": "Band", "duration_ms": 200000,
+		"started_at": "2026-10-19T08:00:00Z", "ended_at": "2026-10-19T08:01:00Z", "position_ms": 60000}`
+	rec := env.do(http.MethodPost, "/api/v1/history/plays", report)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = env.do(http.MethodPost, "/api/v1/history/plays", report, withBasicAuth())
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/v1/history/backfill", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, decode[struct{ Data pifyHttp.CountResponse }](t, rec).Data.Count)
+	assert.True(t, env.apis.called("GET /v1/me/player/recently-played"))
+
+	rec = env.do(http.MethodGet, "/api/v1/history", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	plays := decode[playsResponse](t, rec).Data
+	require.Len(t, plays, 2)
+	assert.Equal(t, "t1", plays[0].TrackId)
+	assert.Equal(t, 30, plays[0].PlayedPercent)
+	assert.True(t, plays[0].Skipped)
+	assert.Equal(t, models.PLAY_SOURCE_KIOSK, plays[0].Source)
+	assert.Equal(t, "t3", plays[1].TrackId)
+
+	rec = env.do(http.MethodGet, "/api/history?from=2026-10-19T00:00:00Z&limit=10", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	plays = decode[playsResponse](t, rec).Data
+	require.Len(t, plays, 1)
+	assert.Equal(t, "t1", plays[0].TrackId)
+
+	rec = env.do(http.MethodGet, "/api/v1/history?to=2026-10-18T23:00:00Z", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	plays = decode[playsResponse](t, rec).Data
+	require.Len(t, plays, 1)
+	assert.Equal(t, "t3", plays[0].TrackId)
+}
+
+func TestHistoryInvalidRequests(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/history?from=yesterday", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_HISTORY_RANGE, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/history?from=2026-10-19&to=2026-10-18", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodPost, "/api/v1/history/plays", `{"track_id": "t1"}`, withBasicAuth())
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_PLAY_REPORT, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/history", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// DEFAULT_LIBRARY_LIMIT is the number of items of a page when the request does not set a limit.
+const DEFAULT_LIBRARY_LIMIT = 20
+
+// SetLibraryRoutes registers the playlists and saved tracks and albums of logged in users.
+// Lists are paged with the next_cursor of the previous page.
+func (h *Handlers) SetLibraryRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_LIBRARY))
+	group.GET("/playlists", h.listLibrary(h.libraryService.Playlists), h.middlewareFactory.Auth())
+	group.GET("/playlists/:id/tracks", h.listPlaylistTracks, h.middlewareFactory.Auth())
+	group.GET("/tracks", h.listLibrary(h.libraryService.SavedTracks), h.middlewareFactory.Auth())
+	group.GET("/albums", h.listLibrary(h.libraryService.SavedAlbums), h.middlewareFactory.Auth())
+}
+
+type libraryList func(ctx context.Context, accessToken, cursor string, limit int) (*services.LibraryPage, error)
+
+// listLibrary answers a page of list, at the cursor and limit of the query.
+func (h *Handlers) listLibrary(list libraryList) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		session := c.Get("session").(*models.UserSession)
+
+		limit, err := queryInt(c, "limit", DEFAULT_LIBRARY_LIMIT, 1)
+		if err != nil {
+			return err
+		}
+
+		page, err := list(c.Request().Context(), session.AccessToken, c.QueryParam("cursor"), limit)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: page})
+	}
+}
+
+func (h *Handlers) listPlaylistTracks(c echo.Context) error {
+	return h.listLibrary(func(ctx context.Context, accessToken, cursor string, limit int) (*services.LibraryPage, error) {
+		return h.libraryService.PlaylistTracks(ctx, accessToken, c.Param("id"), cursor, limit)
+	})(c)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// fakePlaylists answers two pages of playlists of two items.
+func fakePlaylists(offset string) string {
+	if offset == "2" {
+		return `{"items": [{"id": "p3", "name": "Three"}], "limit": 2, "offset": 2, "next": null, "total": 3}`
+	}
+	return `{"items": [{"id": "p1", "name": "One"}, {"id": "p2", "name": "Two"}], "limit": 2, "offset": 0,
+		"next": "https://api.spotify.com/v1/me/playlists?offset=2&limit=2", "total": 3}`
+}
+
+type libraryPageResponse struct {
+	Data services.LibraryPage `json:"data"`
+}
+
+func TestLibraryPlaylistsPaging(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/library/playlists?limit=2", "", withSession("phone"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	page := decode[libraryPageResponse](t, rec).Data
+	assert.Equal(t, 3, page.Total)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, services.CATALOG_TYPE_PLAYLIST, page.Items[0].Type)
+	require.NotEmpty(t, page.NextCursor)
+
+	rec = env.do(http.MethodGet, "/api/v1/library/playlists?limit=2&cursor="+page.NextCursor, "", withSession("phone"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	page = decode[libraryPageResponse](t, rec).Data
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "p3", page.Items[0].Id)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestLibraryLists(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+
+	for target, id := range map[string]string{
+		"/api/v1/library/playlists/p1/tracks": "t1",
+		"/api/v1/library/tracks":              "t2",
+		"/api/library/albums":                 "a1",
+	} {
+		rec := env.do(http.MethodGet, target, "", withSession("phone"))
+		require.Equal(t, http.StatusOK, rec.Code, target)
+		page := decode[libraryPageResponse](t, rec).Data
+		require.Len(t, page.Items, 1, target)
+		assert.Equal(t, id, page.Items[0].Id, target)
+		assert.NotNil(t, page.Items[0].AddedAt, target)
+	}
+}
+
+func TestLibraryErrors(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/library/tracks", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/library/tracks?cursor=bogus", "", withSession("phone"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_CURSOR, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+
+	rec = env.do(http.MethodGet, "/api/library/playlists/unknown/tracks", "", withSession("phone"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, errors.PLAYLIST_NOT_FOUND, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
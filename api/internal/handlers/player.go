@@ -2,15 +2,15 @@ package handlers
 
 import (
 	"bytes"
-	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/constants"
 	"github.com/edgejay/pify-player/api/internal/database/models"
 	"github.com/edgejay/pify-player/api/internal/errors"
 	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
@@ -18,48 +18,40 @@ import (
 	"github.com/edgejay/pify-player/api/internal/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/skip2/go-qrcode"
-
-	"google.golang.org/api/option"
-	"google.golang.org/api/youtube/v3"
 )
 
-var playerService *services.PlayerService = services.NewPlayerService(database.GetSQLiteDB())
-
-func SetPlayerRoutes(group *echo.Group) {
-	group.GET("/connect", getConnectStatus, middlewareFactory.GetUserService(), middlewareFactory.GetSpotifyService(), middlewareFactory.BasicAuth())
-	group.POST("/connect", postConnect, middlewareFactory.Auth(), middlewareFactory.GetUserService())
-	group.GET("/track/:id", getTrack, middlewareFactory.GetSpotifyService(), middlewareFactory.BasicAuth())
-	group.POST("/youtube", getAndSaveYoutubeVideo, middlewareFactory.GetSpotifyService(), middlewareFactory.BasicAuth())
-	group.GET("/login-qr", getLoginQR, middlewareFactory.BasicAuth())
-	group.POST("/command", postCommand, middlewareFactory.BasicAuth())
+func (h *Handlers) SetPlayerRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_PLAYER))
+	group.GET("/connect", h.getConnectStatus, h.middlewareFactory.BasicAuth())
+	group.POST("/connect", h.postConnect, h.middlewareFactory.Auth())
+	group.GET("/track/:id", h.getTrack, h.middlewareFactory.BasicAuth())
+	group.POST("/youtube", h.getAndSaveYoutubeVideo, h.middlewareFactory.BasicAuth())
+	group.GET("/login-qr", h.getLoginQR, h.middlewareFactory.BasicAuth())
+	group.POST("/command", h.postCommand, h.middlewareFactory.BasicAuth())
+	group.POST("/play", h.postPlay, h.middlewareFactory.Auth())
+	group.GET("/now-playing", h.getNowPlaying, h.middlewareFactory.Auth())
+	group.GET("/events", h.getEvents, h.middlewareFactory.Auth())
 }
 
-func getConnectStatus(c echo.Context) error {
+func (h *Handlers) getConnectStatus(c echo.Context) error {
+	ctx := c.Request().Context()
 	accessToken := ""
 	var expiresAt time.Time
 
-	spotifyService := c.Get("spotifyService").(*services.SpotifyService)
-	userService := c.Get("userService").(*services.UserService)
-
-	session, err := playerService.GetControllerSession()
+	session, err := h.playerService.GetControllerSession(ctx)
 	if err != nil {
-		if err.Error() == errors.INVALID_SESSION {
-			return c.JSON(http.StatusUnauthorized, pifyHttp.ApiResponse{
-				ErrorCode: errors.INVALID_SESSION,
-			})
-		}
-		log.Println("playerService connect error:", err)
 		return err
 	}
 
 	accessToken = session.AccessToken
 	expiresAt = session.AccessTokenExpiresAt
 	// check if access token is still valid
-	if res, err := spotifyService.CheckAndRefreshApiToken(session.AccessTokenExpiresAt, session.RefreshToken); err != nil {
+	if res, err := h.spotifyService.CheckAndRefreshApiToken(ctx, session.AccessTokenExpiresAt, session.RefreshToken); err != nil {
 		return err
 	} else if res != nil {
 		// save access token into DB
-		if _, err := userService.UpdateSessionAccessToken(
+		if _, err := h.userService.UpdateSessionAccessToken(
+			ctx,
 			session.Uuid,
 			res.AccessToken,
 			time.Now().Add(time.Duration(res.ExpiresIn)*time.Second),
@@ -80,25 +72,19 @@ func getConnectStatus(c echo.Context) error {
 	})
 }
 
-func postConnect(c echo.Context) error {
+func (h *Handlers) postConnect(c echo.Context) error {
+	ctx := c.Request().Context()
 	session := c.Get("session").(*models.UserSession)
-	userService := c.Get("userService").(*services.UserService)
 
 	// set user session as controller
-	if _, err := userService.SetSessionAsController(session.Uuid); err != nil {
-		log.Println("set session as controller error:", err)
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.UNABLE_TO_SET_CONTROLLER,
-		})
+	if _, err := h.userService.SetSessionAsController(ctx, session.Uuid); err != nil {
+		return errors.Wrap(errors.UNABLE_TO_SET_CONTROLLER, err)
 	}
 
 	// get session
-	session, err := userService.GetSession(session.Uuid)
+	session, err := h.userService.GetSession(ctx, session.Uuid)
 	if err != nil {
-		log.Println("set session as controller error:", err)
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.GET_SESSION_FAILED,
-		})
+		return errors.Wrap(errors.GET_SESSION_FAILED, err)
 	}
 
 	return c.JSON(http.StatusOK, pifyHttp.ConnectResponse{
@@ -114,40 +100,26 @@ func postConnect(c echo.Context) error {
 	})
 }
 
-func getTrack(c echo.Context) error {
+func (h *Handlers) getTrack(c echo.Context) error {
+	ctx := c.Request().Context()
 	trackId := c.Param("id")
-	spotifyService := c.Get("spotifyService").(*services.SpotifyService)
-	session, err := playerService.GetControllerSession()
+	session, err := h.playerService.GetControllerSession(ctx)
 	if err != nil {
-		log.Println("playerService connect error:", err)
 		return err
 	}
 
-	// check if access token is still valid
-	if spotifyService.IsApiTokenExpired(session.AccessTokenExpiresAt); err != nil {
-		return c.JSON(http.StatusUnauthorized, pifyHttp.ApiResponse{
-			ErrorCode: errors.BAD_OR_EXPIRED_TOKEN,
-		})
-	}
-
-	track, err := spotifyService.GetTrackBytes(session.AccessToken, trackId)
-	if err != nil || track == nil {
+	// an expired access token is answered by Spotify with BAD_OR_EXPIRED_TOKEN
+	track, err := h.spotifyService.GetTrackBytes(ctx, session.AccessToken, trackId)
+	if err != nil {
 		if err.Error() == errors.BAD_OR_EXPIRED_TOKEN {
-			return c.JSON(http.StatusUnauthorized, pifyHttp.ApiResponse{
-				ErrorCode: errors.BAD_OR_EXPIRED_TOKEN,
-			})
+			return err
 		}
-
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.GET_TRACK_FAILED,
-		})
+		return errors.Wrap(errors.GET_TRACK_FAILED, err)
 	}
 
 	data := make(map[string]interface{})
 	if err := json.Unmarshal(track, &data); err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.PARSE_TRACK_RESPONSE_FAILED,
-		})
+		return errors.Wrap(errors.PARSE_TRACK_RESPONSE_FAILED, err)
 	}
 
 	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{
@@ -155,33 +127,23 @@ func getTrack(c echo.Context) error {
 	})
 }
 
-func getAndSaveYoutubeVideo(c echo.Context) error {
-	spotifyService := c.Get("spotifyService").(*services.SpotifyService)
-	session, err := playerService.GetControllerSession()
-	if err != nil {
-		log.Println("playerService connect error:", err)
+func (h *Handlers) getAndSaveYoutubeVideo(c echo.Context) error {
+	ctx := c.Request().Context()
+	// videos are only looked up while a controller is connected
+	if _, err := h.playerService.GetControllerSession(ctx); err != nil {
 		return err
 	}
 
-	// check if access token is still valid
-	if spotifyService.IsApiTokenExpired(session.AccessTokenExpiresAt); err != nil {
-		return c.JSON(http.StatusUnauthorized, pifyHttp.ApiResponse{
-			ErrorCode: errors.BAD_OR_EXPIRED_TOKEN,
-		})
-	}
-
 	var vidReq pifyHttp.YoutubeVideoRequest
 	if err := c.Bind(&vidReq); err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.INVALID_REQUEST_BODY,
-		})
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
 	}
 
 	// check if cached result for youtube video exists
-	trackMedia := playerService.GetTrackMedia(vidReq.SpotifyTrackId, services.TRACK_MEDIA_TYPE_YOUTUBE)
+	trackMedia := h.playerService.GetTrackMedia(ctx, vidReq.SpotifyTrackId, services.TRACK_MEDIA_TYPE_YOUTUBE)
 	if trackMedia != nil {
 		// return cached result
-		log.Println("Found cached youtube video id:", trackMedia.MediaId)
+		slog.DebugContext(ctx, "found cached youtube video", "video_id", trackMedia.MediaId)
 		return c.JSON(http.StatusOK, pifyHttp.ApiResponse{
 			Data: pifyHttp.YoutubeVideoResponse{
 				VideoId: trackMedia.MediaId,
@@ -189,37 +151,16 @@ func getAndSaveYoutubeVideo(c echo.Context) error {
 		})
 	}
 
-	ctx := context.Background()
-	service, err := youtube.NewService(ctx, option.WithAPIKey(utils.GetYoutubeApiKey()))
-	if err != nil {
-		log.Println("Error creating YouTube client: %v", err)
-		return err
-	}
-
-	call := service.Search.List([]string{"snippet"}).
-		Q(vidReq.Query).
-		Type("video").
-		MaxResults(1)
-
-	serverSettings := utils.GetServerSettings()
-	call.Header().Set("Referer", "https://"+serverSettings.SslDomain)
-
-	response, err := call.Do()
+	videoId, err := h.youtubeService.SearchVideoId(c.Request().Context(), vidReq.Query)
 	if err != nil {
-		log.Println("Error making search API call: %v", err)
-		return err
-	}
-
-	if len(response.Items) == 0 {
-		return c.JSON(http.StatusNotFound, pifyHttp.ApiResponse{
-			ErrorCode: errors.NO_YOUTUBE_VIDEO_FOUND,
-		})
+		if err.Error() == errors.NO_YOUTUBE_VIDEO_FOUND {
+			return err
+		}
+		return errors.Wrap(errors.SEARCH_YOUTUBE_FAILED, err)
 	}
 
-	videoId := response.Items[0].Id.VideoId
-
 	// save youtube video id to DB
-	playerService.SaveTrackMedia(vidReq.SpotifyTrackId, videoId, services.TRACK_MEDIA_TYPE_YOUTUBE)
+	h.playerService.SaveTrackMedia(ctx, vidReq.SpotifyTrackId, videoId, services.TRACK_MEDIA_TYPE_YOUTUBE)
 
 	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{
 		Data: pifyHttp.YoutubeVideoResponse{
@@ -228,22 +169,18 @@ func getAndSaveYoutubeVideo(c echo.Context) error {
 	})
 }
 
-func getLoginQR(c echo.Context) error {
+func (h *Handlers) getLoginQR(c echo.Context) error {
 	loginUrl := utils.GetCallbackDestination()
 
 	qrCode, err := qrcode.New(loginUrl, qrcode.Medium)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.LOGIN_QR_UNAVAILABLE,
-		})
+		return errors.Wrap(errors.LOGIN_QR_UNAVAILABLE, err)
 	}
 
 	var buf bytes.Buffer
 	err = qrCode.Write(256, &buf)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.LOGIN_QR_UNAVAILABLE,
-		})
+		return errors.Wrap(errors.LOGIN_QR_UNAVAILABLE, err)
 	}
 
 	base64Data := base64.StdEncoding.EncodeToString(buf.Bytes())
@@ -256,12 +193,11 @@ func getLoginQR(c echo.Context) error {
 	})
 }
 
-func postCommand(c echo.Context) error {
+func (h *Handlers) postCommand(c echo.Context) error {
+	ctx := c.Request().Context()
 	var cmdReq pifyHttp.PlayerCommandRequest
 	if err := c.Bind(&cmdReq); err != nil {
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.INVALID_REQUEST_BODY,
-		})
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
 	}
 
 	var res *http.Response
@@ -273,24 +209,85 @@ func postCommand(c echo.Context) error {
 	case "restart":
 		res, err = http.Post("http://host.docker.internal:8081/reboot", "application/json", nil)
 	default:
-		return c.JSON(http.StatusBadRequest, pifyHttp.ApiResponse{
-			ErrorCode: errors.INVALID_PLAYER_COMMAND,
-		})
+		return errors.FromCode(errors.INVALID_PLAYER_COMMAND)
 	}
 
 	if err != nil {
-		log.Println("Error executing command:", err)
-		return c.JSON(http.StatusInternalServerError, pifyHttp.ApiResponse{
-			ErrorCode: errors.COMMAND_EXECUTION_FAILED,
-		})
+		return errors.Wrap(errors.COMMAND_EXECUTION_FAILED, err)
 	}
 
 	defer res.Body.Close()
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		log.Println("Error reading host handler response body:", err)
+		slog.ErrorContext(ctx, "read host handler response failed", "error", err)
 	}
-	log.Println("Host handler response:", string(body))
+	slog.InfoContext(ctx, "host handler responded", "command", cmdReq.Command, "response", string(body))
+
+	return c.NoContent(http.StatusNoContent)
+}
 
-	return c.JSON(http.StatusNoContent, nil)
+// postPlay plays a context or tracks on the kiosk, for users controlling it from their phone.
+func (h *Handlers) postPlay(c echo.Context) error {
+	var req pifyHttp.PlayRequest
+	if err := c.Bind(&req); err != nil {
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
+	}
+
+	playReq := services.PlayContextRequest{
+		ContextUri: req.ContextUri,
+		Uris:       req.Uris,
+		PositionMs: req.PositionMs,
+	}
+	if req.Offset != nil {
+		playReq.Offset = &services.PlayOffset{Position: req.Offset.Position, Uri: req.Offset.Uri}
+	}
+
+	if err := h.playbackService.Play(c.Request().Context(), playReq); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getNowPlaying answers the latest playback of the controller seen by the poller.
+func (h *Handlers) getNowPlaying(c echo.Context) error {
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: h.playbackPoller.NowPlaying()})
+}
+
+// EVENTS_KEEPALIVE is how often a comment is sent on an idle event stream, so proxies keep it open.
+const EVENTS_KEEPALIVE = 15 * time.Second
+
+// getEvents streams the events of the event stream as server-sent events, until the client goes away.
+func (h *Handlers) getEvents(c echo.Context) error {
+	events, unsubscribe := h.eventStream.Subscribe()
+	defer unsubscribe()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	keepalive := time.NewTicker(EVENTS_KEEPALIVE)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepalive.C:
+			if _, err := io.WriteString(res, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.ErrorContext(c.Request().Context(), "event not sent", "type", event.Type, "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
 }
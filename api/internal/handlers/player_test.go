@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+func TestPlayerRoutesRequireBasicAuth(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/player/connect", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestGetConnectStatusWithoutController(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/player/connect", "", withBasicAuth())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, errors.INVALID_SESSION, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
+
+func TestGetConnectStatusRefreshesExpiredToken(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", -time.Minute)
+
+	rec := env.do(http.MethodGet, "/api/player/connect", "", withBasicAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[struct {
+		Data map[string]string `json:"data"`
+	}](t, rec)
+	assert.Equal(t, "refreshed-token", res.Data["access_token"])
+
+	session, err := env.store.Sessions().Get(context.Background(), "kiosk")
+	require.NoError(t, err)
+	assert.Equal(t, "refreshed-token", session.AccessToken)
+}
+
+func TestPostConnect(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "session", time.Hour)
+
+	rec := env.do(http.MethodPost, "/api/player/connect", "", withSession("session"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[pifyHttp.ConnectResponse](t, rec)
+	assert.True(t, res.Connected)
+	require.NotNil(t, res.User.IsController)
+	assert.True(t, *res.User.IsController)
+
+	controller, err := env.store.Sessions().GetController(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "session", controller.Uuid)
+}
+
+func TestGetTrack(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/player/track/track-id", "", withBasicAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[struct {
+		Data map[string]any `json:"data"`
+	}](t, rec)
+	assert.Equal(t, "track-id", res.Data["id"])
+}
+
+func TestGetAndSaveYoutubeVideo(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+	body := `{"query": "artist song", "spotify_track_id": "track-id"}`
+
+	rec := env.do(http.MethodPost, "/api/player/youtube", body, withBasicAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	media, err := env.store.TrackMedia().Get(context.Background(), "track-id", string(services.TRACK_MEDIA_TYPE_YOUTUBE))
+	require.NoError(t, err)
+	assert.Equal(t, "video-id", media.MediaId)
+}
+
+func TestGetAndSaveYoutubeVideoCached(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+	require.NoError(t, env.store.TrackMedia().Upsert(context.Background(), &models.TrackMedia{
+		SpotifyTrackId: "track-id",
+		MediaType:      string(services.TRACK_MEDIA_TYPE_YOUTUBE),
+		MediaId:        "cached-video-id",
+	}))
+
+	rec := env.do(http.MethodPost, "/api/player/youtube", `{"query": "artist song", "spotify_track_id": "track-id"}`, withBasicAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[struct {
+		Data pifyHttp.YoutubeVideoResponse `json:"data"`
+	}](t, rec)
+	assert.Equal(t, "cached-video-id", res.Data.VideoId)
+	assert.False(t, env.apis.called("GET /youtube/v3/search"))
+}
+
+func TestGetAndSaveYoutubeVideoNotFound(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodPost, "/api/player/youtube", `{"query": "unknown", "spotify_track_id": "track-id"}`, withBasicAuth())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, errors.NO_YOUTUBE_VIDEO_FOUND, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
+
+func TestGetLoginQR(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/player/login-qr", "", withBasicAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[struct {
+		Data map[string]string `json:"data"`
+	}](t, rec)
+	assert.Contains(t, res.Data["qr"], "data:image/png;base64,")
+}
+
+func TestPostCommandInvalid(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodPost, "/api/player/command", `{"command": "format"}`, withBasicAuth())
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_PLAYER_COMMAND, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+}
+
+func TestPlayOnKiosk(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodPost, "/api/v1/player/play", `{"context_uri": "spotify:playlist:p1", "offset": {"position": 4}, "position_ms": 1000}`, withSession("kiosk"))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	// the kiosk is found by its name, "Pify Player" answers with the id "kiosk"
+	assert.Equal(t, "device_id=kiosk", env.apis.playQuery)
+	assert.JSONEq(t, `{"context_uri": "spotify:playlist:p1", "offset": {"position": 4}, "position_ms": 1000}`, env.apis.playBody)
+}
+
+func TestPlayOnKioskRejectsBadRequests(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodPost, "/api/player/play", `{"context_uri": "spotify:album:a1", "uris": ["spotify:track:t1"]}`, withSession("kiosk"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_PLAY_REQUEST, decode[pifyHttp.ApiResponse](t, rec).ErrorCode)
+
+	rec = env.do(http.MethodPost, "/api/v1/player/play", `{"context_uri": "spotify:album:a1"}`, withBasicAuth())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.False(t, env.apis.called("PUT /v1/me/player/play"))
+}
+
+func TestNowPlaying(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/player/now-playing", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	res := decode[struct {
+		Data services.NowPlaying `json:"data"`
+	}](t, rec)
+	assert.False(t, res.Data.Active)
+
+	env.poller.Poll(context.Background())
+	rec = env.do(http.MethodGet, "/api/v1/player/now-playing", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	res = decode[struct {
+		Data services.NowPlaying `json:"data"`
+	}](t, rec)
+	assert.True(t, res.Data.Active)
+	assert.Equal(t, "t1", res.Data.Track.Id)
+	assert.Equal(t, "Pify Player", res.Data.DeviceName)
+	assert.Equal(t, 30000, res.Data.ProgressMs)
+}
+
+func TestEvents(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/player/events", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// the stream only ends with the client, it is read from a real server
+	server := httptest.NewServer(env.e)
+	t.Cleanup(server.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/player/events", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: constants.COOKIE_SESSION_ID, Value: "kiosk"})
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	require.Eventually(t, func() bool { return env.events.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+
+	env.poller.Poll(context.Background())
+	env.events.Publish(services.EVENT_WATCHDOG, services.WatchdogEvent{Action: services.WATCHDOG_KIOSK_LOST})
+
+	reader := bufio.NewReader(res.Body)
+	next := func() (string, map[string]any) {
+		t.Helper()
+		eventLine, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		dataLine, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		blank, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "\n", blank)
+
+		var event struct {
+			Data map[string]any `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(dataLine, "data: ")), &event))
+		return strings.TrimSpace(strings.TrimPrefix(eventLine, "event: ")), event.Data
+	}
+
+	eventType, data := next()
+	assert.Equal(t, services.EVENT_PLAYBACK, eventType)
+	assert.Equal(t, services.PLAYBACK_EVENT_TRACK, data["type"])
+	eventType, data = next()
+	assert.Equal(t, services.EVENT_WATCHDOG, eventType)
+	assert.Equal(t, services.WATCHDOG_KIOSK_LOST, data["action"])
+
+	// the subscription ends with the request
+	cancel()
+	assert.Eventually(t, func() bool { return env.events.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+}
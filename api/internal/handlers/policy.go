@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// SetPolicyRoutes registers the content policies of the household, listed to logged in users and
+// edited by owners only.
+func (h *Handlers) SetPolicyRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_POLICY))
+	group.GET("", h.listContentPolicies, h.middlewareFactory.Auth())
+	group.PUT("/household", h.putContentPolicy, h.middlewareFactory.Auth(), h.middlewareFactory.Owner())
+	group.PUT("/users/:username", h.putContentPolicy, h.middlewareFactory.Auth(), h.middlewareFactory.Owner())
+	group.DELETE("/users/:username", h.deleteContentPolicy, h.middlewareFactory.Auth(), h.middlewareFactory.Owner())
+}
+
+func (h *Handlers) listContentPolicies(c echo.Context) error {
+	policies, err := h.contentPolicyService.List(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: policies})
+}
+
+// putContentPolicy replaces the policy of the user in the path, of the household without one.
+func (h *Handlers) putContentPolicy(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	var req pifyHttp.ContentPolicyRequest
+	if err := c.Bind(&req); err != nil {
+		return errors.Wrap(errors.INVALID_REQUEST_BODY, err)
+	}
+
+	policy, err := h.contentPolicyService.Save(c.Request().Context(), session.User.Username, c.Param("username"), services.ContentPolicy{
+		BlockExplicit:    req.BlockExplicit,
+		BlockedArtistIds: req.BlockedArtistIds,
+		BlockedTrackIds:  req.BlockedTrackIds,
+		AllowedFrom:      req.AllowedFrom,
+		AllowedUntil:     req.AllowedUntil,
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: policy})
+}
+
+func (h *Handlers) deleteContentPolicy(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	if err := h.contentPolicyService.Delete(c.Request().Context(), session.User.Username, c.Param("username")); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
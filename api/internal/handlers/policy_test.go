@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+func TestContentPolicies(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.saveController(t, "kiosk", time.Hour)
+	_, err := env.store.Users().Upsert(ctx, &models.User{Username: "bob", DisplayName: "Bob"})
+	require.NoError(t, err)
+
+	rec := env.do(http.MethodGet, "/api/v1/policy", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// members see the policies but do not edit them
+	rec = env.do(http.MethodGet, "/api/v1/policy", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, decode[struct{ Data []services.ContentPolicy }](t, rec).Data, 1)
+
+	body := `{"block_explicit": true, "blocked_artist_ids": ["a1"]}`
+	rec = env.do(http.MethodPut, "/api/v1/policy/household", body, withSession("kiosk"))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, errors.OWNER_REQUIRED, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	require.NoError(t, env.store.Users().SetRole(ctx, "alice", models.USER_ROLE_OWNER))
+	rec = env.do(http.MethodPut, "/api/v1/policy/household", body, withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	policy := decode[struct{ Data services.ContentPolicy }](t, rec).Data
+	assert.True(t, policy.BlockExplicit)
+	assert.Equal(t, []string{"a1"}, policy.BlockedArtistIds)
+	assert.Equal(t, "alice", policy.UpdatedBy)
+
+	rec = env.do(http.MethodPut, "/api/policy/users/bob", `{"blocked_track_ids": ["t1"]}`, withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "bob", decode[struct{ Data services.ContentPolicy }](t, rec).Data.Username)
+
+	rec = env.do(http.MethodPut, "/api/v1/policy/users/carol", `{}`, withSession("kiosk"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = env.do(http.MethodPut, "/api/v1/policy/household", `{"allowed_from": "07:00"}`, withSession("kiosk"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_CONTENT_POLICY, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/policy", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, decode[struct{ Data []services.ContentPolicy }](t, rec).Data, 2)
+
+	// the household policy is enforced on what the api plays
+	rec = env.do(http.MethodPost, "/api/v1/player/play", `{"context_uri": "spotify:artist:a1"}`, withSession("kiosk"))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, errors.CONTENT_BLOCKED, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	rec = env.do(http.MethodDelete, "/api/v1/policy/users/bob", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	events, err := env.store.Audit().List(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, models.AUDIT_ACTION_POLICY_DELETED, events[0].Action)
+	assert.Equal(t, "alice", events[0].Actor)
+}
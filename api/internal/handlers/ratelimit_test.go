@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/ratelimit"
+	"github.com/edgejay/pify-player/api/internal/services"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+// lockoutSettings do not limit the rate of requests, and lock out after three failed logins.
+var lockoutSettings = utils.RateLimitSettings{
+	Lockout: ratelimit.LockoutPolicy{Threshold: 3, Duration: time.Minute, MaxDuration: time.Hour},
+}
+
+func withCredentials(username, password string) requestOption {
+	return func(req *http.Request) {
+		req.SetBasicAuth(username, password)
+	}
+}
+
+func assertRetryAfter(t *testing.T, rec *httptest.ResponseRecorder, min, max int) {
+	t.Helper()
+
+	seconds, err := strconv.Atoi(rec.Header().Get(echo.HeaderRetryAfter))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, seconds, min)
+	assert.LessOrEqual(t, seconds, max)
+}
+
+func TestRateLimit(t *testing.T) {
+	env := newRateLimitedTestEnv(t, utils.RateLimitSettings{
+		Groups: map[string]ratelimit.Policy{constants.ROUTE_GROUP_AUTH: {Rate: 1.0 / 60, Burst: 2}},
+	})
+
+	// versioned and unversioned routes share the limit of their group
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v1/auth/login", "").Code)
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/auth/login", "").Code)
+
+	rec := env.do(http.MethodGet, "/api/v1/auth/login", "")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	res := decode[pifyHttp.ErrorResponse](t, rec)
+	assert.Equal(t, errors.TOO_MANY_REQUESTS, res.Error.Code)
+	assert.True(t, res.Error.Retryable)
+	assertRetryAfter(t, rec, 59, 60)
+
+	rec = env.do(http.MethodGet, "/api/auth/callback", "")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, errors.TOO_MANY_REQUESTS, decode[pifyHttp.LoginResponse](t, rec).ErrorCode)
+
+	// other clients and route groups have limits of their own
+	assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v1/auth/login", "", fromIP("192.0.2.2")).Code)
+	assert.NotEqual(t, http.StatusTooManyRequests, env.do(http.MethodGet, "/api/v1/player/login-qr", "", withBasicAuth()).Code)
+}
+
+func TestRateLimitByCredential(t *testing.T) {
+	env := newRateLimitedTestEnv(t, utils.RateLimitSettings{
+		Groups: map[string]ratelimit.Policy{constants.ROUTE_GROUP_PLAYER: {Rate: 1.0 / 60, Burst: 2}},
+	})
+
+	// a credential can't spread its requests over clients
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v1/player/login-qr", "", withBasicAuth(), fromIP(ip)).Code)
+	}
+	rec := env.do(http.MethodGet, "/api/v1/player/login-qr", "", withBasicAuth(), fromIP("192.0.2.3"))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+}
+
+func TestRateLimitIgnoresWrongCredentials(t *testing.T) {
+	env := newRateLimitedTestEnv(t, utils.RateLimitSettings{
+		Groups: map[string]ratelimit.Policy{constants.ROUTE_GROUP_PLAYER: {Rate: 1.0 / 60, Burst: 2}},
+	})
+
+	// another client of the network sends the kiosk's username with a wrong password
+	for _, ip := range []string{"192.0.2.66", "192.0.2.67", "192.0.2.68"} {
+		rec := env.do(http.MethodGet, "/api/v1/player/login-qr", "", withCredentials(testBasicAuthUsername, "guess"), fromIP(ip))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	// the kiosk still has all of its requests
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, env.do(http.MethodGet, "/api/v1/player/login-qr", "", withBasicAuth()).Code)
+	}
+}
+
+func TestBasicAuthLockout(t *testing.T) {
+	env := newRateLimitedTestEnv(t, lockoutSettings)
+
+	for i := 0; i < 3; i++ {
+		rec := env.do(http.MethodGet, "/api/v1/player/login-qr", "", withCredentials(testBasicAuthUsername, "guess"))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	// locked out, even with the right password
+	rec := env.do(http.MethodGet, "/api/v1/player/login-qr", "", withBasicAuth())
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, errors.TOO_MANY_FAILED_ATTEMPTS, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+	assertRetryAfter(t, rec, 59, 60)
+
+	events, err := env.store.Audit().List(context.Background(), models.AUDIT_ACTION_LOCKOUT, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "ip:192.0.2.1", events[0].Actor)
+	assert.Equal(t, "basic_auth", events[0].Subject)
+	assert.Contains(t, events[0].Details, "after 3 failed logins")
+}
+
+func TestBasicAuthLockoutIsPerClient(t *testing.T) {
+	env := newRateLimitedTestEnv(t, lockoutSettings)
+
+	// wrong passwords for the kiosk's username from another client of the network
+	for i := 0; i < 5; i++ {
+		env.do(http.MethodGet, "/api/v1/player/login-qr", "", withCredentials(testBasicAuthUsername, "guess"), fromIP("192.0.2.66"))
+	}
+	rec := env.do(http.MethodGet, "/api/v1/player/login-qr", "", withBasicAuth(), fromIP("192.0.2.66"))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// do not lock the kiosk out of its credentials
+	rec = env.do(http.MethodGet, "/api/v1/player/login-qr", "", withBasicAuth())
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestBasicAuthSuccessResetsFailures(t *testing.T) {
+	env := newRateLimitedTestEnv(t, lockoutSettings)
+
+	for i := 0; i < 5; i++ {
+		env.do(http.MethodGet, "/api/v1/player/login-qr", "", withCredentials(testBasicAuthUsername, "typo"))
+		env.do(http.MethodGet, "/api/v1/player/login-qr", "", withCredentials(testBasicAuthUsername, "typo"))
+		rec := env.do(http.MethodGet, "/api/v1/player/login-qr", "", withBasicAuth())
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestSessionLockout(t *testing.T) {
+	env := newRateLimitedTestEnv(t, lockoutSettings)
+	env.saveSession(t, "session", time.Hour)
+
+	for i := 0; i < 3; i++ {
+		rec := env.do(http.MethodGet, "/api/v1/device/all", "", withSession("guessed"))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	rec := env.do(http.MethodGet, "/api/v1/device/all", "", withSession("session"))
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, errors.TOO_MANY_FAILED_ATTEMPTS, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	// the legacy login route reports the lockout instead of asking to log in
+	rec = env.do(http.MethodGet, "/api/auth/login", "", withSession("session"))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, errors.TOO_MANY_FAILED_ATTEMPTS, decode[pifyHttp.LoginResponse](t, rec).ErrorCode)
+
+	// other clients are not locked out
+	rec = env.do(http.MethodGet, "/api/v1/device/all", "", withSession("session"), fromIP("192.0.2.2"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAdminAuditEvents(t *testing.T) {
+	env := newRateLimitedTestEnv(t, lockoutSettings)
+
+	for i := 0; i < 3; i++ {
+		env.do(http.MethodGet, "/api/v1/admin/users", "", withCredentials("root", "guess"), fromIP("192.0.2.9"))
+	}
+
+	rec := env.do(http.MethodGet, "/api/v1/admin/audit?action=lockout&limit=1", "", withAdminAuth())
+	require.Equal(t, http.StatusOK, rec.Code)
+	res := decode[struct {
+		Data []services.AuditEventSummary `json:"data"`
+	}](t, rec)
+	require.Len(t, res.Data, 1)
+	assert.Equal(t, models.AUDIT_ACTION_LOCKOUT, res.Data[0].Action)
+	assert.Equal(t, "admin_auth", res.Data[0].Subject)
+
+	rec = env.do(http.MethodGet, "/api/v1/admin/audit?limit=0", "", withAdminAuth())
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
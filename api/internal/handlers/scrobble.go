@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+// SetScrobbleRoutes registers the linking of the scrobbling accounts of logged in users.
+func (h *Handlers) SetScrobbleRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_SCROBBLE))
+	group.GET("/account", h.getScrobbleAccount, h.middlewareFactory.Auth())
+	group.DELETE("/account", h.unlinkScrobbleAccount, h.middlewareFactory.Auth())
+	group.GET("/link", h.linkScrobbleAccount, h.middlewareFactory.Auth())
+	group.GET("/callback", h.getScrobbleCallback, h.middlewareFactory.Auth())
+}
+
+func (h *Handlers) getScrobbleAccount(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	account, err := h.scrobbleService.GetAccount(c.Request().Context(), session.UserId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: account})
+}
+
+func (h *Handlers) unlinkScrobbleAccount(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	if err := h.scrobbleService.Unlink(c.Request().Context(), session.UserId); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// linkScrobbleAccount redirects to the scrobbling service, which redirects back to the callback
+// next to this route once the user authorized the api.
+func (h *Handlers) linkScrobbleAccount(c echo.Context) error {
+	callbackUrl := c.Scheme() + "://" + c.Request().Host + strings.TrimSuffix(c.Path(), "/link") + "/callback"
+
+	authUrl, err := h.scrobbleService.GetAuthUrl(callbackUrl)
+	if err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusTemporaryRedirect, authUrl)
+}
+
+// getScrobbleCallback links the account the user authorized, and redirects to the player like the
+// Spotify login does.
+func (h *Handlers) getScrobbleCallback(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	if _, err := h.scrobbleService.Link(c.Request().Context(), session.UserId, c.QueryParam("token")); err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusTemporaryRedirect, utils.GetCallbackDestination())
+}
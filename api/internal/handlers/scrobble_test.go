@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+func TestScrobbleLink(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/scrobble/link", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/scrobble/account", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, errors.SCROBBLE_ACCOUNT_NOT_FOUND, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+
+	// the scrobbling service redirects back to the callback next to the link route
+	rec = env.do(http.MethodGet, "/api/v1/scrobble/link", "", withSession("kiosk"))
+	require.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "scrobbler.example.com", location.Host)
+	assert.Equal(t, "scrobble-key", location.Query().Get("api_key"))
+	assert.Equal(t, "http://example.com/api/v1/scrobble/callback", location.Query().Get("cb"))
+
+	rec = env.do(http.MethodGet, "/api/v1/scrobble/callback?token=expired", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, errors.LINK_SCROBBLE_ACCOUNT_FAILED, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+	rec = env.do(http.MethodGet, "/api/v1/scrobble/callback", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/scrobble/callback?token=token", "", withSession("kiosk"))
+	require.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.Equal(t, "https://localhost:5173/", rec.Header().Get("Location"))
+
+	rec = env.do(http.MethodGet, "/api/scrobble/account", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	account := decode[struct{ Data services.ScrobbleAccount }](t, rec).Data
+	assert.Equal(t, "alice-fm", account.Username)
+	assert.Zero(t, account.Pending)
+
+	rec = env.do(http.MethodDelete, "/api/v1/scrobble/account", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = env.do(http.MethodDelete, "/api/v1/scrobble/account", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestScrobbleQueuesReportedPlays(t *testing.T) {
+	env := newTestEnv(t)
+	session := env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/scrobble/callback?token=token", "", withSession("kiosk"))
+	require.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+
+	report := `{"track_id": "t1", "track_name": "Song", "artist_ids": ["a1"], "artist_names": "Band", "duration_ms": 200000,
+		"started_at": "2026-10-19T08:00:00Z", "ended_at": "2026-10-19T08:03:20Z", "position_ms": 200000}`
+	rec = env.do(http.MethodPost, "/api/v1/history/plays", report, withBasicAuth())
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	pending, err := env.store.Scrobbles().Pending(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, session.UserId, pending[0].UserId)
+	assert.Equal(t, "Band", pending[0].Artist)
+	assert.Equal(t, "Song", pending[0].Track)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// DEFAULT_SEARCH_LIMIT is the number of results of every type when the request does not set a limit.
+const DEFAULT_SEARCH_LIMIT = 20
+
+// SetSearchRoutes registers the catalog search of logged in users.
+func (h *Handlers) SetSearchRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_SEARCH))
+	group.GET("", h.search, h.middlewareFactory.Auth())
+}
+
+// search searches the catalog for q, in the comma-separated types of type, or all types.
+func (h *Handlers) search(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	limit, err := queryInt(c, "limit", DEFAULT_SEARCH_LIMIT, 1)
+	if err != nil {
+		return err
+	}
+	offset, err := queryInt(c, "offset", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	query := services.SearchQuery{
+		Query:  c.QueryParam("q"),
+		Limit:  limit,
+		Offset: offset,
+		Market: c.QueryParam("market"),
+	}
+	if types := c.QueryParam("type"); types != "" {
+		query.Types = strings.Split(types, ",")
+	}
+
+	res, err := h.searchService.Search(c.Request().Context(), session.UserId, session.AccessToken, query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: res})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// fakeSearchResults has one result of every type, and an unavailable playlist.
+const fakeSearchResults = `{
+	"tracks": {"items": [{"id": "t1", "name": "Song", "uri": "spotify:track:t1", "duration_ms": 180000, "explicit": true,
+		"album": {"id": "a1", "name": "Album", "images": [{"url": "https://i.scdn.co/album.jpg"}]},
+		"artists": [{"name": "Band"}, {"name": "Singer"}]}], "limit": 20, "offset": 0, "total": 40},
+	"albums": {"items": [{"id": "a1", "name": "Album", "uri": "spotify:album:a1", "artists": [{"name": "Band"}]}], "total": 1},
+	"artists": {"items": [{"id": "b1", "name": "Band", "uri": "spotify:artist:b1", "genres": ["rock", "indie"]}], "total": 1},
+	"playlists": {"items": [null, {"id": "p1", "name": "Mix", "uri": "spotify:playlist:p1", "owner": {"display_name": "Spotify"}}], "total": 2},
+	"shows": {"items": [{"id": "s1", "name": "Podcast", "uri": "spotify:show:s1", "publisher": "Studio"}], "total": 1}
+}`
+
+func TestSearch(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/search?q=song", "", withSession("phone"))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	res := decode[struct {
+		Data services.SearchResponse `json:"data"`
+	}](t, rec).Data
+	assert.Equal(t, services.SEARCH_TYPES, res.Types)
+	assert.True(t, res.HasMore)
+	assert.Equal(t, 40, res.Totals[services.CATALOG_TYPE_TRACK])
+
+	require.Len(t, res.Items, 5)
+	assert.Equal(t, services.CatalogItem{
+		Type:       services.CATALOG_TYPE_TRACK,
+		Id:         "t1",
+		Uri:        "spotify:track:t1",
+		Name:       "Song",
+		Subtitle:   "Band, Singer",
+		ImageUrl:   "https://i.scdn.co/album.jpg",
+		DurationMs: 180000,
+		Explicit:   true,
+	}, res.Items[0])
+	assert.Equal(t, "rock, indie", res.Items[2].Subtitle)
+	assert.Equal(t, "p1", res.Items[3].Id)
+	assert.Equal(t, "Studio", res.Items[4].Subtitle)
+}
+
+func TestSearchDebouncesDuplicateQueries(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+
+	for _, target := range []string{
+		"/api/v1/search?q=song&type=track,album",
+		"/api/v1/search?q=%20Song%20&type=album,track",
+		"/api/search?q=SONG&type=track,album",
+	} {
+		rec := env.do(http.MethodGet, target, "", withSession("phone"))
+		assert.Equal(t, http.StatusOK, rec.Code, target)
+	}
+	assert.Equal(t, 1, env.apis.count("GET /v1/search"))
+
+	rec := env.do(http.MethodGet, "/api/v1/search?q=song&type=track", "", withSession("phone"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, env.apis.count("GET /v1/search"))
+}
+
+func TestSearchRequiresSession(t *testing.T) {
+	env := newTestEnv(t)
+
+	rec := env.do(http.MethodGet, "/api/v1/search?q=song", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.False(t, env.apis.called("GET /v1/search"))
+}
+
+func TestSearchRejectsBadQueries(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveSession(t, "phone", time.Hour)
+
+	for target, code := range map[string]string{
+		"/api/search?q=song&type=episode": errors.INVALID_SEARCH_TYPE,
+		"/api/search?q=song&limit=none":   errors.BAD_REQUEST,
+		"/api/search?q=song&offset=-1":    errors.BAD_REQUEST,
+	} {
+		rec := env.do(http.MethodGet, target, "", withSession("phone"))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		assert.Equal(t, code, decode[pifyHttp.ApiResponse](t, rec).ErrorCode, target)
+	}
+	assert.False(t, env.apis.called("GET /v1/search"))
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+// SetStatsRoutes registers the listening stats of logged in users and of the household, and the
+// weekly digest the kiosk shows while idle.
+func (h *Handlers) SetStatsRoutes(group *echo.Group) {
+	group.Use(h.middlewareFactory.RateLimit(constants.ROUTE_GROUP_STATS))
+	group.GET("", h.getUserStats, h.middlewareFactory.Auth())
+	group.GET("/household", h.getHouseholdStats, h.middlewareFactory.Auth())
+	group.GET("/digest", h.getDigest, h.middlewareFactory.BasicAuth())
+	group.GET("/digest/card", h.getDigestCard, h.middlewareFactory.BasicAuth())
+}
+
+// getUserStats answers the stats of the user of the session, between the from and to of the query.
+func (h *Handlers) getUserStats(c echo.Context) error {
+	session := c.Get("session").(*models.UserSession)
+
+	limit, err := queryInt(c, "limit", services.DEFAULT_STATS_LIMIT, 1)
+	if err != nil {
+		return err
+	}
+	from, err := queryTime(c, "from", false)
+	if err != nil {
+		return err
+	}
+	to, err := queryTime(c, "to", true)
+	if err != nil {
+		return err
+	}
+
+	stats, err := h.statsService.UserStats(c.Request().Context(), session.UserId, session.AccessToken, from, to, limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: stats})
+}
+
+func (h *Handlers) getHouseholdStats(c echo.Context) error {
+	limit, err := queryInt(c, "limit", services.DEFAULT_STATS_LIMIT, 1)
+	if err != nil {
+		return err
+	}
+	from, err := queryTime(c, "from", false)
+	if err != nil {
+		return err
+	}
+	to, err := queryTime(c, "to", true)
+	if err != nil {
+		return err
+	}
+
+	stats, err := h.statsService.HouseholdStats(c.Request().Context(), from, to, limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: stats})
+}
+
+func (h *Handlers) getDigest(c echo.Context) error {
+	digest, err := h.statsService.WeeklyDigest(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, pifyHttp.ApiResponse{Data: digest})
+}
+
+// getDigestCard answers the weekly digest as an HTML page.
+func (h *Handlers) getDigestCard(c echo.Context) error {
+	digest, err := h.statsService.WeeklyDigest(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	var card bytes.Buffer
+	if err := services.RenderDigestCard(&card, digest); err != nil {
+		return errors.Wrap(errors.UNKNOWN_ERROR, err)
+	}
+	return c.HTMLBlob(http.StatusOK, card.Bytes())
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/services"
+)
+
+func TestStats(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	endedAt := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	report := `{"track_id": "t1", "track_name": "Song", "artist_names": "Band", "duration_ms": 200000,
+		"started_at": "` + endedAt.Add(-200*time.Second).Format(time.RFC3339) + `", "ended_at": "` + endedAt.Format(time.RFC3339) + `",
+		"position_ms": 200000}`
+	rec := env.do(http.MethodPost, "/api/v1/history/plays", report, withBasicAuth())
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/stats", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/stats?limit=5", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	stats := decode[struct{ Data services.UserStats }](t, rec).Data
+	assert.Equal(t, 1, stats.Plays)
+	assert.Equal(t, int64(200000), stats.ListenedMs)
+	require.Len(t, stats.TopTracks, 1)
+	assert.Equal(t, "t1", stats.TopTracks[0].Id)
+	require.Len(t, stats.SpotifyTopTracks, 1)
+	require.Len(t, stats.SpotifyTopArtists, 1)
+	assert.Equal(t, "a1", stats.SpotifyTopArtists[0].Id)
+
+	rec = env.do(http.MethodGet, "/api/v1/stats/household", "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	household := decode[struct{ Data services.HouseholdStats }](t, rec).Data
+	assert.Equal(t, 1, household.Plays)
+	require.Len(t, household.Listeners, 1)
+	assert.Equal(t, "Alice", household.Listeners[0].DisplayName)
+
+	rec = env.do(http.MethodGet, "/api/v1/stats?from="+endedAt.Format(time.RFC3339), "", withSession("kiosk"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, decode[struct{ Data services.UserStats }](t, rec).Data.Plays)
+	rec = env.do(http.MethodGet, "/api/v1/stats?from=2026-10-19&to=2026-10-18", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, errors.INVALID_HISTORY_RANGE, decode[pifyHttp.ErrorResponse](t, rec).Error.Code)
+}
+
+func TestDigest(t *testing.T) {
+	env := newTestEnv(t)
+	env.saveController(t, "kiosk", time.Hour)
+
+	rec := env.do(http.MethodGet, "/api/v1/stats/digest", "", withSession("kiosk"))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = env.do(http.MethodGet, "/api/v1/stats/digest", "", withBasicAuth())
+	require.Equal(t, http.StatusOK, rec.Code)
+	digest := decode[struct{ Data services.WeeklyDigest }](t, rec).Data
+	assert.Zero(t, digest.Plays)
+	assert.Equal(t, 7*24*time.Hour, digest.To.Sub(digest.From))
+
+	rec = env.do(http.MethodGet, "/api/stats/digest/card", "", withBasicAuth())
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rec.Body.String(), "Nothing was played this week.")
+}
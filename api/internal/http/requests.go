@@ -1,11 +1,77 @@
 package http
 
+import "time"
+
 type YoutubeVideoRequest struct {
 	Query          string `json:"query"`
 	SpotifyTrackId string `json:"spotify_track_id"`
 	CacheResults   bool   `json:"cache_results"`
 }
 
+// PlayRequest plays a context (album, playlist or artist) or a list of track uris on the kiosk,
+// from the track at offset and position_ms into it.
+type PlayRequest struct {
+	ContextUri string   `json:"context_uri"`
+	Uris       []string `json:"uris"`
+	Offset     *struct {
+		Position *int   `json:"position"`
+		Uri      string `json:"uri"`
+	} `json:"offset"`
+	PositionMs int `json:"position_ms"`
+}
+
+// PlayReportRequest reports a play the kiosk saw end: from started_at to ended_at, position_ms into the track.
+type PlayReportRequest struct {
+	TrackId     string    `json:"track_id"`
+	TrackName   string    `json:"track_name"`
+	ArtistIds   []string  `json:"artist_ids"`
+	ArtistNames string    `json:"artist_names"`
+	DurationMs  int       `json:"duration_ms"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	PositionMs  int       `json:"position_ms"`
+}
+
+// AutoDjSettingsRequest replaces the auto-DJ settings of the user. A queue_ahead of zero is the
+// default, energies left out are left to Spotify.
+type AutoDjSettingsRequest struct {
+	Enabled         bool     `json:"enabled"`
+	QueueAhead      int      `json:"queue_ahead"`
+	TargetEnergy    *float64 `json:"target_energy"`
+	MinEnergy       *float64 `json:"min_energy"`
+	MaxEnergy       *float64 `json:"max_energy"`
+	AllowExplicit   bool     `json:"allow_explicit"`
+	BlockedTrackIds []string `json:"blocked_track_ids"`
+}
+
+// ContentPolicyRequest replaces a content policy. allowed_from and allowed_until are "HH:MM" local
+// times, both left empty to allow any time.
+type ContentPolicyRequest struct {
+	BlockExplicit    bool     `json:"block_explicit"`
+	BlockedArtistIds []string `json:"blocked_artist_ids"`
+	BlockedTrackIds  []string `json:"blocked_track_ids"`
+	AllowedFrom      string   `json:"allowed_from"`
+	AllowedUntil     string   `json:"allowed_until"`
+}
+
+// WatchdogRequest sets whether the device watchdog moves playback back to the kiosk. The field is
+// required, so that an empty body does not turn the preference off.
+type WatchdogRequest struct {
+	KeepPlaybackOnKiosk *bool `json:"keep_playback_on_kiosk"`
+}
+
 type PlayerCommandRequest struct {
 	Command string `json:"command"`
 }
+
+type AdminControllerRequest struct {
+	Uuid string `json:"uuid"`
+}
+
+type AdminUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type AdminTransferPlaybackRequest struct {
+	DeviceId string `json:"device_id"`
+}
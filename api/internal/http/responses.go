@@ -1,5 +1,7 @@
 package http
 
+import "github.com/edgejay/pify-player/api/internal/errors"
+
 type UserDetails struct {
 	DisplayName     string `json:"display_name"`
 	ProfileImageUrl string `json:"profile_image_url"`
@@ -22,7 +24,27 @@ type YoutubeVideoResponse struct {
 	VideoId string `json:"video_id"`
 }
 
+// ApiResponse wraps the data of a route. The unversioned routes also answer errors with it,
+// /api/v1 answers them with an ErrorResponse.
 type ApiResponse struct {
 	Data      interface{} `json:"data"`
-	ErrorCode string      `json:"error_code"`
+	ErrorCode string      `json:"error_code,omitempty"`
+}
+
+// ErrorResponse is the body of every error answered by /api/v1.
+type ErrorResponse struct {
+	Error *errors.Error `json:"error"`
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// CountResponse holds the number of rows affected by an admin operation or a history backfill.
+type CountResponse struct {
+	Count int `json:"count"`
+}
+
+type LoginUrlResponse struct {
+	Url string `json:"url"`
 }
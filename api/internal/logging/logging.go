@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey string
+
+const requestIdKey contextKey = "request_id"
+
+// ParseLevel converts a LOG_LEVEL value (debug, info, warn or error) into a slog level.
+// Unknown values default to info.
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// NewLogger creates a JSON logger writing to w. Request ids found in the context are added to every record,
+// and tokens, secrets and credentials are masked before they are written.
+func NewLogger(w io.Writer, level slog.Level) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})
+	return slog.New(&contextHandler{handler})
+}
+
+// Setup creates the logger configured by the LOG_LEVEL env variable and makes it the default logger,
+// so that both slog and the standard log package write structured output.
+func Setup() *slog.Logger {
+	logger := NewLogger(os.Stdout, ParseLevel(os.Getenv("LOG_LEVEL")))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// WithRequestId returns a copy of ctx carrying the request id.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+// RequestId returns the request id stored in ctx, or an empty string if there is none.
+func RequestId(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
+
+// contextHandler adds the request id stored in the context to each log record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestId := RequestId(ctx); requestId != "" {
+		record.AddAttrs(slog.String(string(requestIdKey), requestId))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
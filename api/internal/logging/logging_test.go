@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "bearer header",
+			input:    "Authorization: Bearer BQDx-abc.123",
+			expected: "Authorization: Bearer [REDACTED]",
+		},
+		{
+			name:     "basic auth header",
+			input:    "Basic cGlmeTpzZWNyZXQ=",
+			expected: "Basic [REDACTED]",
+		},
+		{
+			name:     "json token",
+			input:    `{"access_token":"abc","expires_in":3600}`,
+			expected: `{"access_token":"[REDACTED]","expires_in":3600}`,
+		},
+		{
+			name:     "query string",
+			input:    "/api/auth/callback?code=AQBx123&state=xyz",
+			expected: "/api/auth/callback?code=[REDACTED]&state=xyz",
+		},
+		{
+			name:     "sql update",
+			input:    `UPDATE "user_sessions" SET access_token = 'abc', access_token_expires_at = '2025-01-01'`,
+			expected: `UPDATE "user_sessions" SET access_token = '[REDACTED]', access_token_expires_at = '2025-01-01'`,
+		},
+		{
+			name:     "json session key",
+			input:    `{"session":{"name":"alice-fm","session_key":"abc"}}`,
+			expected: `{"session":{"name":"alice-fm","session_key":"[REDACTED]"}}`,
+		},
+		{
+			name:     "error code is kept",
+			input:    `{"error_code":"invalid_session"}`,
+			expected: `{"error_code":"invalid_session"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Redact(tt.input))
+		})
+	}
+}
+
+func TestRedactSQL(t *testing.T) {
+	query := `INSERT INTO "user_sessions" ("uuid", "access_token", "refresh_token") VALUES ('uuid-1', 'secret-access', 'secret-refresh')`
+	redacted := RedactSQL(query)
+
+	assert.NotContains(t, redacted, "secret-access")
+	assert.NotContains(t, redacted, "secret-refresh")
+	assert.Contains(t, redacted, `"access_token"`)
+
+	query = `INSERT INTO "scrobble_accounts" ("user_id", "username", "session_key") VALUES (1, 'alice-fm', 'secret-key')`
+	assert.NotContains(t, RedactSQL(query), "secret-key")
+	query = `UPDATE "scrobble_accounts" SET session_key = 'secret-key' WHERE user_id = 1`
+	assert.NotContains(t, RedactSQL(query), "secret-key")
+
+	query = `SELECT * FROM "track_media" WHERE spotify_track_id = 'abc'`
+	assert.Equal(t, query, RedactSQL(query))
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, slog.LevelInfo)
+
+	ctx := WithRequestId(context.Background(), "req-123")
+	logger.InfoContext(ctx, "token refreshed with Bearer abc",
+		"access_token", "abc",
+		"authorization", "Basic cGlmeTpzZWNyZXQ=",
+		"session", "uuid-1",
+		"session_id", 7,
+		"error", errors.New(`refresh_token="abc" rejected`),
+	)
+	logger.DebugContext(ctx, "not logged")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+
+	assert.Equal(t, "req-123", record["request_id"])
+	assert.Equal(t, "token refreshed with Bearer [REDACTED]", record["msg"])
+	assert.Equal(t, REDACTED, record["access_token"])
+	assert.Equal(t, REDACTED, record["authorization"])
+	assert.Equal(t, REDACTED, record["session"])
+	assert.Equal(t, float64(7), record["session_id"])
+	assert.Equal(t, `refresh_token="[REDACTED]" rejected`, record["error"])
+	assert.NotContains(t, buf.String(), "not logged")
+	assert.NotContains(t, buf.String(), "uuid-1")
+}
+
+func TestIsSensitiveKey(t *testing.T) {
+	for _, key := range []string{"session", "uuid", "Cookie", "access_token", "client_secret"} {
+		assert.True(t, IsSensitiveKey(key), key)
+	}
+	for _, key := range []string{"session_id", "user_id", "error_code"} {
+		assert.False(t, IsSensitiveKey(key), key)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLevel("DEBUG"))
+	assert.Equal(t, slog.LevelWarn, ParseLevel("warn"))
+	assert.Equal(t, slog.LevelError, ParseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel(""))
+}
+
+func TestQueryHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, slog.LevelDebug)
+	ctx := WithRequestId(context.Background(), "req-456")
+
+	event := &bun.QueryEvent{
+		Query:     `UPDATE "user_sessions" SET access_token = 'abc'`,
+		StartTime: time.Now(),
+	}
+
+	NewQueryHook(logger, "0").AfterQuery(ctx, event)
+	NewQueryHook(logger, "").AfterQuery(ctx, event)
+	assert.Empty(t, buf.String(), "successful queries are only logged in verbose mode")
+
+	NewQueryHook(logger, "2").AfterQuery(ctx, event)
+	assert.Contains(t, buf.String(), `"request_id":"req-456"`)
+	assert.Contains(t, buf.String(), REDACTED)
+	assert.NotContains(t, buf.String(), "'abc'")
+
+	buf.Reset()
+	event.Err = errors.New("database is locked")
+	NewQueryHook(logger, "").AfterQuery(ctx, event)
+	assert.Contains(t, buf.String(), `"level":"ERROR"`)
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// QueryHook logs bun queries through slog with tokens masked. Failed queries are logged as errors
+// and, when verbose is enabled, every query is logged at debug level.
+type QueryHook struct {
+	logger  *slog.Logger
+	enabled bool
+	verbose bool
+}
+
+var _ bun.QueryHook = (*QueryHook)(nil)
+
+// NewQueryHook creates a query hook configured like bundebug from the BUNDEBUG env variable value:
+// "0" disables logging, "1" or empty logs failed queries only, and "2" logs all queries.
+func NewQueryHook(logger *slog.Logger, bundebug string) *QueryHook {
+	hook := &QueryHook{logger: logger, enabled: true}
+	switch bundebug {
+	case "0":
+		hook.enabled = false
+	case "2":
+		hook.verbose = true
+	}
+	return hook
+}
+
+func (h *QueryHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if !h.enabled {
+		return
+	}
+
+	failed := event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows)
+	if !failed && !h.verbose {
+		return
+	}
+
+	logger := h.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	attrs := []slog.Attr{
+		slog.String("operation", event.Operation()),
+		slog.Duration("duration", time.Since(event.StartTime)),
+		slog.String("query", RedactSQL(event.Query)),
+	}
+
+	if failed {
+		attrs = append(attrs, slog.String("error", Redact(event.Err.Error())))
+		logger.LogAttrs(ctx, slog.LevelError, "sql query failed", attrs...)
+		return
+	}
+
+	logger.LogAttrs(ctx, slog.LevelDebug, "sql query", attrs...)
+}
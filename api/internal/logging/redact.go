@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const REDACTED = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are never logged. The session uuid is the session
+// cookie, log the id of the session instead.
+var sensitiveKeys = map[string]bool{
+	"code":          true,
+	"session":       true,
+	"uuid":          true,
+	"token":         true,
+	"secret":        true,
+	"password":      true,
+	"authorization": true,
+	"cookie":        true,
+	"set-cookie":    true,
+}
+
+// sensitiveKeySuffixes catch keys such as access_token or client_secret.
+var sensitiveKeySuffixes = []string{
+	"_token",
+	"_secret",
+	"_password",
+}
+
+// sensitiveColumns are columns whose presence in a SQL query causes all its string literals to be masked.
+var sensitiveColumns = []string{
+	"access_token",
+	"refresh_token",
+	// the session key of a linked scrobbling account
+	"session_key",
+}
+
+var sqlStringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+var sensitivePatterns = []*regexp.Regexp{
+	// Authorization header values, e.g. "Bearer abc" or "Basic dXNlcjpwYXNz"
+	regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`),
+	// key/value pairs in JSON, query strings and SQL, e.g. "access_token":"abc", refresh_token=abc, access_token = 'abc'
+	regexp.MustCompile(`(?i)("?\b(?:access_token|refresh_token|session_key|client_secret|password|code)"?\s*[:=]\s*)("[^"]*"|'[^']*'|[^\s&,;)"']+)`),
+}
+
+// IsSensitiveKey reports whether values stored under key must be redacted.
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, suffix := range sensitiveKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact masks tokens, secrets and credentials found in s.
+func Redact(s string) string {
+	s = sensitivePatterns[0].ReplaceAllString(s, "$1 "+REDACTED)
+	s = sensitivePatterns[1].ReplaceAllStringFunc(s, func(match string) string {
+		groups := sensitivePatterns[1].FindStringSubmatch(match)
+		value := groups[2]
+		switch {
+		case strings.HasPrefix(value, `"`):
+			return groups[1] + `"` + REDACTED + `"`
+		case strings.HasPrefix(value, `'`):
+			return groups[1] + `'` + REDACTED + `'`
+		default:
+			return groups[1] + REDACTED
+		}
+	})
+	return s
+}
+
+// redactAttr is used as slog.HandlerOptions.ReplaceAttr to mask sensitive attributes.
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindGroup {
+		return attr
+	}
+
+	if IsSensitiveKey(attr.Key) {
+		return slog.String(attr.Key, REDACTED)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, Redact(err.Error()))
+		}
+	}
+
+	return attr
+}
+
+// RedactSQL masks tokens in a formatted SQL query. Since values of INSERT statements cannot be matched
+// to their columns reliably, all string literals are masked in queries referencing token columns.
+func RedactSQL(query string) string {
+	lower := strings.ToLower(query)
+	for _, column := range sensitiveColumns {
+		if strings.Contains(lower, column) {
+			return sqlStringLiteral.ReplaceAllString(query, "'"+REDACTED+"'")
+		}
+	}
+	return Redact(query)
+}
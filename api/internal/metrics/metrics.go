@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	goerrors "errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/edgejay/pify-player/api/internal/errors"
+)
+
+const namespace = "pify"
+
+// gaugeTimeout limits how long a scrape may wait on gauges backed by database queries.
+const gaugeTimeout = 2 * time.Second
+
+// Metrics holds the Prometheus collectors of the api, registered against its own registry.
+type Metrics struct {
+	registry             *prometheus.Registry
+	httpRequestDuration  *prometheus.HistogramVec
+	outboundRequests     *prometheus.CounterVec
+	outboundDuration     *prometheus.HistogramVec
+	tokenRefreshes       *prometheus.CounterVec
+	trackMediaCacheTotal *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests handled by the api, per route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		outboundRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "outbound_requests_total",
+			Help:      "Number of requests made to external services, per endpoint and status.",
+		}, []string{"service", "endpoint", "status"}),
+		outboundDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "outbound_request_duration_seconds",
+			Help:      "Duration of requests made to external services, per endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service", "endpoint"}),
+		tokenRefreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refreshes_total",
+			Help:      "Number of Spotify access token refreshes, per outcome.",
+		}, []string{"outcome"}),
+		trackMediaCacheTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "track_media_cache_total",
+			Help:      "Number of track media cache lookups, per result (hit or miss).",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequestDuration,
+		m.outboundRequests,
+		m.outboundDuration,
+		m.tokenRefreshes,
+		m.trackMediaCacheTotal,
+	)
+
+	return m
+}
+
+// Handler returns the http handler serving the metrics in Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records the duration of every request handled by Echo, labelled by route pattern
+// rather than the raw path so that ids in urls do not blow up the number of series.
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				status = errorStatus(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			m.httpRequestDuration.
+				WithLabelValues(c.Request().Method, route, strconv.Itoa(status)).
+				Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
+
+// errorStatus returns the status the error handler answers err with: the status of the api error,
+// or the code of an echo error such as an unknown route.
+func errorStatus(err error) int {
+	var httpErr *echo.HTTPError
+	if goerrors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return errors.From(err).Status
+}
+
+// ObserveTokenRefresh records the outcome of an access token refresh.
+func (m *Metrics) ObserveTokenRefresh(outcome string) {
+	m.tokenRefreshes.WithLabelValues(outcome).Inc()
+}
+
+// ObserveTrackMediaLookup records a track media cache hit or miss.
+func (m *Metrics) ObserveTrackMediaLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.trackMediaCacheTotal.WithLabelValues(result).Inc()
+}
+
+// RegisterGaugeFunc registers a gauge whose value is computed on every scrape,
+// e.g. by counting rows in the database.
+func (m *Metrics) RegisterGaugeFunc(name, help string, fn func(ctx context.Context) (int, error)) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), gaugeTimeout)
+		defer cancel()
+
+		value, err := fn(ctx)
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(value)
+	}))
+}
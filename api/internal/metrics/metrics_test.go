@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	goerrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/errors"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/v1/me", "GET /v1/me"},
+		{"GET", "/v1/me/player/devices", "GET /v1/me/player/devices"},
+		{"GET", "/v1/tracks/11dFghVXANMlKmJXsNCbNl", "GET /v1/tracks/:id"},
+		{"POST", "/api/token", "POST /api/token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NormalizeEndpoint(tt.method, tt.path))
+		})
+	}
+}
+
+func TestInstrumentClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	m := NewMetrics()
+	client := m.InstrumentClient(server.Client(), "spotify")
+
+	res, err := client.Get(server.URL + "/v1/tracks/11dFghVXANMlKmJXsNCbNl")
+	require.NoError(t, err)
+	res.Body.Close()
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `pify_outbound_requests_total{endpoint="GET /v1/tracks/:id",service="spotify",status="429"} 1`)
+	assert.Contains(t, body, `pify_outbound_request_duration_seconds_count{endpoint="GET /v1/tracks/:id",service="spotify"} 1`)
+}
+
+func TestMiddleware(t *testing.T) {
+	m := NewMetrics()
+
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/api/player/track/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/player/track/abc", nil))
+
+	assert.Contains(t, scrape(t, m), `pify_http_request_duration_seconds_count{method="GET",route="/api/player/track/:id",status="200"} 1`)
+}
+
+func TestMiddlewareErrorStatus(t *testing.T) {
+	m := NewMetrics()
+
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/api/player/now-playing", func(c echo.Context) error {
+		return errors.FromCode(errors.LOGIN_REQUIRED)
+	})
+	e.GET("/api/admin/users/:username", func(c echo.Context) error {
+		return goerrors.New(errors.USER_NOT_FOUND)
+	})
+	e.GET("/api/player/connect", func(c echo.Context) error {
+		return goerrors.New("database is locked")
+	})
+
+	for _, target := range []string{"/api/player/now-playing", "/api/admin/users/bob", "/api/player/connect", "/unknown"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `pify_http_request_duration_seconds_count{method="GET",route="/api/player/now-playing",status="401"} 1`)
+	assert.Contains(t, body, `pify_http_request_duration_seconds_count{method="GET",route="/api/admin/users/:username",status="404"} 1`)
+	assert.Contains(t, body, `pify_http_request_duration_seconds_count{method="GET",route="/api/player/connect",status="500"} 1`)
+	assert.Contains(t, body, `pify_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`)
+}
+
+func TestObservers(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveTokenRefresh("success")
+	m.ObserveTrackMediaLookup(true)
+	m.ObserveTrackMediaLookup(false)
+	m.ObserveTrackMediaLookup(false)
+	m.RegisterGaugeFunc("active_sessions", "Number of active sessions.", func(ctx context.Context) (int, error) {
+		return 3, nil
+	})
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `pify_token_refreshes_total{outcome="success"} 1`)
+	assert.Contains(t, body, `pify_track_media_cache_total{result="hit"} 1`)
+	assert.Contains(t, body, `pify_track_media_cache_total{result="miss"} 2`)
+	assert.Contains(t, body, `pify_active_sessions 3`)
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minIdLength is the length from which a path segment is considered an id (Spotify ids are 22 characters).
+const minIdLength = 16
+
+// instrumentedTransport wraps a http.RoundTripper and records the count and latency
+// of every outbound request made through it.
+type instrumentedTransport struct {
+	service string
+	base    http.RoundTripper
+	metrics *Metrics
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := NormalizeEndpoint(req.Method, req.URL.Path)
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	t.metrics.outboundDuration.WithLabelValues(t.service, endpoint).Observe(time.Since(start).Seconds())
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	t.metrics.outboundRequests.WithLabelValues(t.service, endpoint, status).Inc()
+
+	return res, err
+}
+
+// InstrumentClient returns a copy of client whose requests are recorded under the given service name.
+// If client is nil, a client with a 30 seconds timeout is used.
+func (m *Metrics) InstrumentClient(client *http.Client, service string) *http.Client {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	instrumented := *client
+	instrumented.Transport = &instrumentedTransport{service, base, m}
+	return &instrumented
+}
+
+// NormalizeEndpoint builds the endpoint label for a request, replacing ids in the path with ":id".
+func NormalizeEndpoint(method, path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if len(segment) >= minIdLength {
+			segments[i] = ":id"
+		}
+	}
+	return method + " " + strings.Join(segments, "/")
+}
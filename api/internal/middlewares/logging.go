@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/edgejay/pify-player/api/internal/logging"
+)
+
+// RequestId assigns an id to every request, reusing the X-Request-Id header if a proxy already set one.
+// The id is stored in the request context so that services log it along with their own records.
+func (mw *MiddlewareFactory) RequestId() func(echo.HandlerFunc) echo.HandlerFunc {
+	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, requestId string) {
+			ctx := logging.WithRequestId(c.Request().Context(), requestId)
+			c.SetRequest(c.Request().WithContext(ctx))
+		},
+	})
+}
+
+// RequestLogger logs every request handled by the server as a structured record.
+// Query strings are redacted, as the Spotify OAuth callback carries the authorization code.
+func (mw *MiddlewareFactory) RequestLogger() func(echo.HandlerFunc) echo.HandlerFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:   true,
+		LogURI:      true,
+		LogStatus:   true,
+		LogLatency:  true,
+		LogRemoteIP: true,
+		LogError:    true,
+		HandleError: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", logging.Redact(v.URI)),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+
+			level := slog.LevelInfo
+			if v.Error != nil {
+				level = slog.LevelError
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+
+			slog.LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
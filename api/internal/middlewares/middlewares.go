@@ -1,7 +1,11 @@
 package middlewares
 
 import (
+	"sync"
+
+	"github.com/edgejay/pify-player/api/internal/ratelimit"
 	"github.com/edgejay/pify-player/api/internal/services"
+	"github.com/edgejay/pify-player/api/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
@@ -9,6 +13,13 @@ type MiddlewareFactory struct {
 	cookieSessionId string
 	userService     *services.UserService
 	spotifyService  *services.SpotifyService
+
+	// set by WithRateLimits
+	rateLimits   utils.RateLimitSettings
+	auditService *services.AuditService
+	lockouts     *ratelimit.Lockouts
+	mu           sync.Mutex
+	limiters     map[string]*ratelimit.Limiter
 }
 
 func NewMiddlewareFactory(
@@ -17,9 +28,9 @@ func NewMiddlewareFactory(
 	spotifyService *services.SpotifyService,
 ) *MiddlewareFactory {
 	return &MiddlewareFactory{
-		cookieSessionId,
-		userService,
-		spotifyService,
+		cookieSessionId: cookieSessionId,
+		userService:     userService,
+		spotifyService:  spotifyService,
 	}
 }
 
@@ -32,21 +43,3 @@ func (mw *MiddlewareFactory) GetCookie() func(echo.HandlerFunc) echo.HandlerFunc
 		}
 	}
 }
-
-func (mw *MiddlewareFactory) GetUserService() func(echo.HandlerFunc) echo.HandlerFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			c.Set("userService", mw.userService)
-			return next(c)
-		}
-	}
-}
-
-func (mw *MiddlewareFactory) GetSpotifyService() func(echo.HandlerFunc) echo.HandlerFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			c.Set("spotifyService", mw.spotifyService)
-			return next(c)
-		}
-	}
-}
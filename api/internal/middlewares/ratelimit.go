@@ -0,0 +1,137 @@
+package middlewares
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/ratelimit"
+	"github.com/edgejay/pify-player/api/internal/services"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+// WithRateLimits limits the requests to the route groups and locks clients out after repeated failed logins,
+// recording lockouts with auditService. Without it, requests are not limited.
+func (mw *MiddlewareFactory) WithRateLimits(settings utils.RateLimitSettings, auditService *services.AuditService) *MiddlewareFactory {
+	mw.rateLimits = settings
+	mw.limiters = make(map[string]*ratelimit.Limiter)
+	mw.lockouts = ratelimit.NewLockouts(settings.Lockout)
+	mw.auditService = auditService
+	return mw
+}
+
+/*
+RateLimit limits the requests of every client to the routes of group. Requests are counted by IP,
+and by credential (the basic auth username or the session cookie), so that a client can't spread
+its requests over credentials, nor a credential over clients. Requests count against a basic auth
+username only with its password, so that another client of the network can't use up the requests
+of the kiosk by sending its username.
+
+Requests over the limit fail with TOO_MANY_REQUESTS and a Retry-After header.
+
+Usage:
+
+	group.Use(RateLimit(constants.ROUTE_GROUP_AUTH))
+*/
+func (mw *MiddlewareFactory) RateLimit(group string) func(echo.HandlerFunc) echo.HandlerFunc {
+	limiter := mw.limiter(group)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			keys := []string{ipKey(c)}
+			if username, password, ok := c.Request().BasicAuth(); ok {
+				if knownCredentials(username, password) {
+					keys = append(keys, "user:"+username)
+				}
+			} else if cookie, err := c.Cookie(mw.cookieSessionId); err == nil {
+				keys = append(keys, "session:"+cookie.Value)
+			}
+
+			for _, key := range keys {
+				if ok, wait := limiter.Allow(key); !ok {
+					return retryAfter(c, errors.TOO_MANY_REQUESTS, wait)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// limiter returns the limiter of group, shared by the versioned and unversioned routes.
+func (mw *MiddlewareFactory) limiter(group string) *ratelimit.Limiter {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if mw.limiters == nil {
+		return ratelimit.NewLimiter(ratelimit.Policy{})
+	}
+	if _, ok := mw.limiters[group]; !ok {
+		mw.limiters[group] = ratelimit.NewLimiter(mw.rateLimits.Groups[group])
+	}
+	return mw.limiters[group]
+}
+
+// checkLockout fails with TOO_MANY_FAILED_ATTEMPTS while any of keys is locked out.
+func (mw *MiddlewareFactory) checkLockout(c echo.Context, keys ...string) error {
+	if mw.lockouts == nil {
+		return nil
+	}
+
+	var locked time.Duration
+	for _, key := range keys {
+		locked = max(locked, mw.lockouts.Locked(key))
+	}
+	if locked > 0 {
+		return retryAfter(c, errors.TOO_MANY_FAILED_ATTEMPTS, locked)
+	}
+	return nil
+}
+
+// loginFailed counts a failed login of keys, and records an audit event for every key it locks out.
+// subject names what the client failed to log in to.
+func (mw *MiddlewareFactory) loginFailed(c echo.Context, subject string, keys ...string) {
+	if mw.lockouts == nil {
+		return
+	}
+
+	ctx := c.Request().Context()
+	for _, key := range keys {
+		locked, failures := mw.lockouts.Fail(key)
+		if locked == 0 {
+			continue
+		}
+
+		details := fmt.Sprintf("locked out for %s after %d failed logins, last from %s to %s", locked, failures, c.RealIP(), c.Path())
+		if err := mw.auditService.Record(ctx, models.AUDIT_ACTION_LOCKOUT, key, subject, details); err != nil {
+			slog.ErrorContext(ctx, "record lockout failed", "key", key, "error", err)
+		}
+	}
+}
+
+// loginSucceeded resets the failed logins of keys.
+func (mw *MiddlewareFactory) loginSucceeded(keys ...string) {
+	if mw.lockouts == nil {
+		return
+	}
+
+	for _, key := range keys {
+		mw.lockouts.Succeed(key)
+	}
+}
+
+func ipKey(c echo.Context) string {
+	return "ip:" + c.RealIP()
+}
+
+// retryAfter fails with the error of code, telling the client to retry after wait.
+func retryAfter(c echo.Context, code string, wait time.Duration) error {
+	seconds := max(1, int(math.Ceil(wait.Seconds())))
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+	return errors.FromCode(code)
+}
@@ -2,26 +2,32 @@ package middlewares
 
 import (
 	"crypto/subtle"
-	"log"
-	"net/http"
+	goerrors "errors"
+	"log/slog"
 	"time"
 
 	"github.com/labstack/echo/v4"
 
-	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
 	"github.com/edgejay/pify-player/api/internal/utils"
 )
 
 /*
-RequireAuth middleware checks if the user is authenticated by:
+Auth middleware checks if the user is authenticated by:
 
 1. Looking for a session cookie in the request
 
 2. Validating the session ID from the cookie against the database
 
-3. If session is valid, adds user context to the request
+3. Refreshing the Spotify access token of the session if it expired
 
-4. If session is invalid/missing, returns 401 Unauthorized
+4. If session is valid, adds user context to the request
+
+5. If session is invalid/missing, or its token can't be refreshed, fails with LOGIN_REQUIRED
+
+Unknown session IDs count as failed logins of the client, which is locked out after too many of them.
 
 Usage:
 
@@ -30,34 +36,37 @@ Usage:
 func (mw *MiddlewareFactory) Auth() func(echo.HandlerFunc) echo.HandlerFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// get auth url if needed to redirect user to login page
-			authUrl, err := mw.spotifyService.GetAuthUrl()
-			if err != nil {
-				return err
-			}
+			ctx := c.Request().Context()
 
 			cookie, err := c.Cookie(mw.cookieSessionId)
 
 			// error in fetching cookie or it does not present
 			if err != nil || cookie == nil {
-				// Instruct client to goto Spotify login page
-				return c.JSON(http.StatusOK, pifyHttp.LoginResponse{LoggedIn: false, RedirectUrl: authUrl})
+				return errors.FromCode(errors.LOGIN_REQUIRED)
 			}
 
-			session, err := mw.userService.GetSession(cookie.Value)
+			if err := mw.checkLockout(c, ipKey(c)); err != nil {
+				return err
+			}
+
+			session, err := mw.userService.GetSession(ctx, cookie.Value)
+			if goerrors.Is(err, repositories.ErrNotFound) {
+				mw.loginFailed(c, "session", ipKey(c))
+				return errors.FromCode(errors.LOGIN_REQUIRED)
+			}
 			if err != nil || session == nil {
-				// Instruct client to goto Spotify login page
-				return c.JSON(http.StatusOK, pifyHttp.LoginResponse{LoggedIn: false, RedirectUrl: authUrl})
+				return errors.FromCode(errors.LOGIN_REQUIRED)
 			}
+			mw.loginSucceeded(ipKey(c))
 
-			if res, err := mw.spotifyService.CheckAndRefreshApiToken(session.AccessTokenExpiresAt, session.RefreshToken); err != nil {
-				// If token can't be refreshhed, instruct client to goto Spotify login page
-				return c.JSON(http.StatusOK, pifyHttp.LoginResponse{LoggedIn: false, RedirectUrl: authUrl})
+			if res, err := mw.spotifyService.CheckAndRefreshApiToken(ctx, session.AccessTokenExpiresAt, session.RefreshToken); err != nil {
+				// If token can't be refreshed, the user has to log in again
+				return errors.Wrap(errors.LOGIN_REQUIRED, err)
 			} else if res != nil {
-				log.Println("got new access token:", res.AccessToken)
-				log.Println(session.Uuid)
+				slog.InfoContext(ctx, "access token refreshed", "session_id", session.Id, "user_id", session.UserId)
 				// save access token into DB
 				if _, err := mw.userService.UpdateSessionAccessToken(
+					ctx,
 					session.Uuid,
 					res.AccessToken,
 					time.Now().Add(time.Duration(res.ExpiresIn)*time.Second),
@@ -69,10 +78,9 @@ func (mw *MiddlewareFactory) Auth() func(echo.HandlerFunc) echo.HandlerFunc {
 			}
 
 			// Get session again
-			session, err = mw.userService.GetSession(cookie.Value)
+			session, err = mw.userService.GetSession(ctx, cookie.Value)
 			if err != nil || session == nil {
-				// Instruct client to goto Spotify login page
-				return c.JSON(http.StatusOK, pifyHttp.LoginResponse{LoggedIn: false, RedirectUrl: authUrl})
+				return errors.FromCode(errors.LOGIN_REQUIRED)
 			}
 
 			// Add session to context for downstream handlers
@@ -83,26 +91,86 @@ func (mw *MiddlewareFactory) Auth() func(echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// Owner restricts a route to users with the owner role, failing with OWNER_REQUIRED otherwise. It
+// relies on the session set by Auth, which must run first.
+//
+// Usage:
+//
+//	router.PUT("/owners-only", handler, Auth(), Owner())
+func (mw *MiddlewareFactory) Owner() func(echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			session, ok := c.Get("session").(*models.UserSession)
+			if !ok || session.User == nil || session.User.Role != models.USER_ROLE_OWNER {
+				return errors.FromCode(errors.OWNER_REQUIRED)
+			}
+			return next(c)
+		}
+	}
+}
+
 // BasicAuth creates a middleware that performs basic authentication
 func (mw *MiddlewareFactory) BasicAuth() func(echo.HandlerFunc) echo.HandlerFunc {
-	username := utils.GetBasicAuthUsername()
-	password := utils.GetBasicAuthPassword()
+	return mw.basicAuth("basic_auth", utils.GetBasicAuthUsername(), utils.GetBasicAuthPassword())
+}
+
+// AdminAuth creates a middleware that performs basic authentication with the admin credentials.
+// Admin routes are disabled unless both ADMIN_USERNAME and ADMIN_PASSWORD are set.
+func (mw *MiddlewareFactory) AdminAuth() func(echo.HandlerFunc) echo.HandlerFunc {
+	username := utils.GetAdminUsername()
+	password := utils.GetAdminPassword()
+
+	if username == "" || password == "" {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				return errors.FromCode(errors.ADMIN_AUTH_DISABLED)
+			}
+		}
+	}
+
+	return mw.basicAuth("admin_auth", username, password)
+}
 
+// basicAuth checks the credentials of the request against username and password. Wrong credentials
+// count as failed logins of the client IP, which is locked out after too many of them. The username is
+// not locked out, so that another client of the network can't lock the kiosk out of its credentials.
+// subject names the credentials in audit events.
+func (mw *MiddlewareFactory) basicAuth(subject, username, password string) func(echo.HandlerFunc) echo.HandlerFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if err := mw.checkLockout(c, ipKey(c)); err != nil {
+				return err
+			}
+
 			// Extract credentials from the request header
 			reqUsername, reqPassword, ok := c.Request().BasicAuth()
 			if !ok {
-				return echo.NewHTTPError(http.StatusUnauthorized, "Please provide valid credentials")
+				return errors.FromCode(errors.INVALID_CREDENTIALS)
 			}
 
-			// Timing attack safe comparison
-			if subtle.ConstantTimeCompare([]byte(username), []byte(reqUsername)) == 1 &&
-				subtle.ConstantTimeCompare([]byte(password), []byte(reqPassword)) == 1 {
+			if credentialsMatch(username, password, reqUsername, reqPassword) {
+				mw.loginSucceeded(ipKey(c))
 				return next(c)
 			}
 
-			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid credentials")
+			mw.loginFailed(c, subject, ipKey(c))
+			return errors.FromCode(errors.INVALID_CREDENTIALS)
 		}
 	}
 }
+
+// knownCredentials reports whether username and password are the basic auth or the admin credentials.
+func knownCredentials(username, password string) bool {
+	if credentialsMatch(utils.GetBasicAuthUsername(), utils.GetBasicAuthPassword(), username, password) {
+		return true
+	}
+	adminUsername, adminPassword := utils.GetAdminUsername(), utils.GetAdminPassword()
+	return adminUsername != "" && adminPassword != "" && credentialsMatch(adminUsername, adminPassword, username, password)
+}
+
+// credentialsMatch compares the credentials of a request to username and password, in constant time.
+func credentialsMatch(username, password, reqUsername, reqPassword string) bool {
+	// Timing attack safe comparison
+	return subtle.ConstantTimeCompare([]byte(username), []byte(reqUsername)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(reqPassword)) == 1
+}
@@ -0,0 +1,128 @@
+// Package openapi embeds the OpenAPI 3 specification of the api, serves it as JSON and validates
+// requests against it.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/labstack/echo/v4"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+// Load parses the embedded specification and checks that it is a valid OpenAPI 3 document.
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(specYAML)
+	if err != nil {
+		return nil, fmt.Errorf("load openapi spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+	return doc, nil
+}
+
+// Validator serves the specification and checks the parameters and bodies of requests against it.
+type Validator struct {
+	spec   *openapi3.T
+	router routers.Router
+	json   []byte
+}
+
+func NewValidator() (*Validator, error) {
+	spec, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, fmt.Errorf("build openapi router: %w", err)
+	}
+
+	json, err := spec.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("encode openapi spec: %w", err)
+	}
+
+	return &Validator{spec, router, json}, nil
+}
+
+func (v *Validator) Spec() *openapi3.T {
+	return v.spec
+}
+
+// Handler serves the specification as JSON.
+func (v *Validator) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSONBlob(http.StatusOK, v.json)
+	}
+}
+
+// Middleware rejects requests whose parameters or body do not match the operation of the specification
+// with a REQUEST_VALIDATION_FAILED error, explaining the mismatch in its message. Requests to paths
+// or methods that are not in the specification are passed through to echo.
+//
+// Security requirements are not checked here, the routes enforce them with their own middlewares.
+func (v *Validator) Middleware() echo.MiddlewareFunc {
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			route, pathParams, err := v.router.FindRoute(req)
+			if err != nil {
+				return next(c)
+			}
+
+			if err := openapi3filter.ValidateRequest(req.Context(), &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			}); err != nil {
+				return pifyErrors.Wrap(pifyErrors.REQUEST_VALIDATION_FAILED, err).WithMessage(reason(err))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// reason returns a short description of why the request failed validation, without the dump of the
+// schema included in the error message.
+func reason(err error) string {
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return err.Error()
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(requestErr.Err, &schemaErr) {
+		field := ""
+		if path := schemaErr.JSONPointer(); len(path) > 0 {
+			field = " at /" + strings.Join(path, "/")
+		}
+		if requestErr.Parameter != nil {
+			return fmt.Sprintf("parameter %q%s: %s", requestErr.Parameter.Name, field, schemaErr.Reason)
+		}
+		return fmt.Sprintf("request body%s: %s", field, schemaErr.Reason)
+	}
+
+	return requestErr.Error()
+}
@@ -0,0 +1,187 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+// newTestServer registers a few routes of the spec answering 204, behind the validation middleware.
+// Errors are answered with the Error they carry.
+func newTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+
+	validator, err := NewValidator()
+	require.NoError(t, err)
+
+	noContent := func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		var apiErr *pifyErrors.Error
+		if errors.As(err, &apiErr) {
+			c.JSON(apiErr.Status, apiErr)
+			return
+		}
+		e.DefaultHTTPErrorHandler(err, c)
+	}
+
+	api := e.Group("/api", validator.Middleware())
+	api.GET("/openapi.json", validator.Handler())
+	api.POST("/player/youtube", noContent)
+	api.POST("/v1/player/command", noContent)
+	api.GET("/player/track/:id", noContent)
+	api.DELETE("/admin/track-media", noContent)
+	api.GET("/unspecified", noContent)
+	return e
+}
+
+func do(e *echo.Echo, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoad(t *testing.T) {
+	spec, err := Load()
+	require.NoError(t, err)
+	assert.NotNil(t, spec.Paths.Value("/player/youtube").Post)
+}
+
+func TestServeSpec(t *testing.T) {
+	e := newTestServer(t)
+
+	rec := do(e, http.MethodGet, "/api/openapi.json", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var spec map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+	assert.Contains(t, spec["paths"], "/device/control-playback")
+}
+
+func TestMiddleware(t *testing.T) {
+	e := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		reason string
+	}{
+		{
+			name:   "valid body",
+			method: http.MethodPost,
+			target: "/api/player/youtube",
+			body:   `{"query": "artist song", "spotify_track_id": "track-id"}`,
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "missing required property",
+			method: http.MethodPost,
+			target: "/api/player/youtube",
+			body:   `{"query": "artist song"}`,
+			status: http.StatusBadRequest,
+			reason: `property "spotify_track_id" is missing`,
+		},
+		{
+			name:   "wrong property type",
+			method: http.MethodPost,
+			target: "/api/player/youtube",
+			body:   `{"query": "artist song", "spotify_track_id": "track-id", "cache_results": "yes"}`,
+			status: http.StatusBadRequest,
+			reason: "request body at /cache_results: value must be a boolean",
+		},
+		{
+			name:   "missing body",
+			method: http.MethodPost,
+			target: "/api/player/youtube",
+			status: http.StatusBadRequest,
+			reason: "value is required but missing",
+		},
+		{
+			name:   "value not in enum",
+			method: http.MethodPost,
+			target: "/api/v1/player/command",
+			body:   `{"command": "reboot"}`,
+			status: http.StatusBadRequest,
+			reason: "request body at /command: value is not one of the allowed values",
+		},
+		{
+			name:   "valid path parameter",
+			method: http.MethodGet,
+			target: "/api/player/track/track-id",
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "invalid query parameter",
+			method: http.MethodDelete,
+			target: "/api/admin/track-media?all=sure",
+			status: http.StatusBadRequest,
+			reason: `parameter "all"`,
+		},
+		{
+			name:   "path not in spec",
+			method: http.MethodGet,
+			target: "/api/unspecified",
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "method not in spec",
+			method: http.MethodPut,
+			target: "/api/player/youtube",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := do(e, test.method, test.target, test.body)
+			require.Equal(t, test.status, rec.Code, rec.Body.String())
+
+			if test.status != http.StatusBadRequest {
+				return
+			}
+
+			var res pifyErrors.Error
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, pifyErrors.REQUEST_VALIDATION_FAILED, res.Code)
+			assert.Contains(t, res.Message, test.reason)
+		})
+	}
+}
+
+func TestMiddlewareKeepsBody(t *testing.T) {
+	validator, err := NewValidator()
+	require.NoError(t, err)
+
+	var received map[string]any
+	e := echo.New()
+	e.POST("/api/v1/player/command", func(c echo.Context) error {
+		if err := c.Bind(&received); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	}, validator.Middleware())
+
+	rec := do(e, http.MethodPost, "/api/v1/player/command", `{"command": "restart"}`)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, map[string]any{"command": "restart"}, received)
+}
@@ -0,0 +1,207 @@
+// Package ratelimit provides token bucket rate limiting and lockouts after repeated failures, keyed by
+// strings such as client IPs or credentials. State is kept in memory, per process.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets and expired lockouts are dropped.
+const sweepInterval = time.Minute
+
+// Policy configures a token bucket: Rate tokens are added per second, up to Burst tokens.
+// The zero Policy disables limiting.
+type Policy struct {
+	Rate  float64
+	Burst int
+}
+
+func (p Policy) Enabled() bool {
+	return p.Rate > 0 && p.Burst > 0
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps a token bucket per key.
+type Limiter struct {
+	policy    Policy
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewLimiter(policy Policy) *Limiter {
+	return &Limiter{
+		policy:  policy,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty, it returns false and how long
+// until the next token is added.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.policy.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.policy.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.policy.Rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	return math.Min(float64(l.policy.Burst), b.tokens+now.Sub(b.updated).Seconds()*l.policy.Rate)
+}
+
+// sweep drops buckets that have refilled completely, they are the same as new buckets.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.policy.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// LockoutPolicy locks a key out after Threshold consecutive failures, for Duration. Every further
+// failure doubles the duration of the lockout, up to MaxDuration. A zero Threshold disables lockouts.
+type LockoutPolicy struct {
+	Threshold   int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+func (p LockoutPolicy) Enabled() bool {
+	return p.Threshold > 0 && p.Duration > 0
+}
+
+type lockout struct {
+	failures    int
+	lastFailure time.Time
+	until       time.Time
+}
+
+// Lockouts counts the consecutive failures of keys and locks them out.
+type Lockouts struct {
+	policy    LockoutPolicy
+	now       func() time.Time
+	mu        sync.Mutex
+	entries   map[string]*lockout
+	lastSweep time.Time
+}
+
+func NewLockouts(policy LockoutPolicy) *Lockouts {
+	if policy.MaxDuration < policy.Duration {
+		policy.MaxDuration = policy.Duration
+	}
+	return &Lockouts{
+		policy:  policy,
+		now:     time.Now,
+		entries: make(map[string]*lockout),
+	}
+}
+
+// Locked returns how long key is still locked out, zero if it is not.
+func (l *Lockouts) Locked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry, ok := l.entries[key]; ok {
+		if remaining := entry.until.Sub(l.now()); remaining > 0 {
+			return remaining
+		}
+	}
+	return 0
+}
+
+// Fail records a failure of key. When the failure locks key out, it returns the duration of the
+// lockout and the number of consecutive failures, otherwise zero.
+func (l *Lockouts) Fail(key string) (time.Duration, int) {
+	if !l.policy.Enabled() {
+		return 0, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	entry, ok := l.entries[key]
+	if !ok || l.forgotten(entry, now) {
+		entry = &lockout{}
+		l.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+
+	if entry.failures < l.policy.Threshold {
+		return 0, entry.failures
+	}
+
+	// doubles with every failure past the threshold
+	duration := l.policy.Duration
+	for i := l.policy.Threshold; i < entry.failures && duration < l.policy.MaxDuration; i++ {
+		duration *= 2
+	}
+	duration = min(duration, l.policy.MaxDuration)
+
+	entry.until = now.Add(duration)
+	return duration, entry.failures
+}
+
+// Succeed resets the failures of key.
+func (l *Lockouts) Succeed(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+// forgotten reports whether the failures of entry are old enough to start counting again,
+// i.e. no failure happened for the longest lockout since it was unlocked.
+func (l *Lockouts) forgotten(entry *lockout, now time.Time) bool {
+	return now.After(entry.until) && now.Sub(entry.lastFailure) > l.policy.MaxDuration
+}
+
+func (l *Lockouts) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, entry := range l.entries {
+		if l.forgotten(entry, now) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a fake time source, advanced by the tests.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestLimiter(t *testing.T) {
+	c := &clock{time.Unix(0, 0)}
+	limiter := NewLimiter(Policy{Rate: 1, Burst: 3})
+	limiter.now = c.now
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("a")
+		assert.True(t, ok, "request %d is within the burst", i)
+	}
+
+	ok, wait := limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// other keys have buckets of their own
+	ok, _ = limiter.Allow("b")
+	assert.True(t, ok)
+
+	c.advance(500 * time.Millisecond)
+	ok, wait = limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	c.advance(500 * time.Millisecond)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	limiter := NewLimiter(Policy{})
+	for i := 0; i < 100; i++ {
+		ok, _ := limiter.Allow("a")
+		assert.True(t, ok)
+	}
+}
+
+func TestLimiterSweepsFullBuckets(t *testing.T) {
+	c := &clock{time.Unix(0, 0)}
+	limiter := NewLimiter(Policy{Rate: 1, Burst: 2})
+	limiter.now = c.now
+
+	limiter.Allow("a")
+	limiter.Allow("b")
+	assert.Len(t, limiter.buckets, 2)
+
+	c.advance(2 * sweepInterval)
+	limiter.Allow("c")
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestLockouts(t *testing.T) {
+	c := &clock{time.Unix(0, 0)}
+	lockouts := NewLockouts(LockoutPolicy{Threshold: 3, Duration: time.Minute, MaxDuration: 5 * time.Minute})
+	lockouts.now = c.now
+
+	for i := 1; i < 3; i++ {
+		locked, failures := lockouts.Fail("ip")
+		assert.Zero(t, locked)
+		assert.Equal(t, i, failures)
+	}
+	assert.Zero(t, lockouts.Locked("ip"))
+
+	locked, failures := lockouts.Fail("ip")
+	assert.Equal(t, time.Minute, locked)
+	assert.Equal(t, 3, failures)
+	assert.Equal(t, time.Minute, lockouts.Locked("ip"))
+
+	// lockouts double with every further failure, up to the max
+	c.advance(time.Minute)
+	assert.Zero(t, lockouts.Locked("ip"))
+	locked, _ = lockouts.Fail("ip")
+	assert.Equal(t, 2*time.Minute, locked)
+	locked, _ = lockouts.Fail("ip")
+	assert.Equal(t, 4*time.Minute, locked)
+	locked, _ = lockouts.Fail("ip")
+	assert.Equal(t, 5*time.Minute, locked)
+
+	lockouts.Succeed("ip")
+	assert.Zero(t, lockouts.Locked("ip"))
+	_, failures = lockouts.Fail("ip")
+	assert.Equal(t, 1, failures)
+}
+
+func TestLockoutsForgetOldFailures(t *testing.T) {
+	c := &clock{time.Unix(0, 0)}
+	lockouts := NewLockouts(LockoutPolicy{Threshold: 2, Duration: time.Minute, MaxDuration: time.Hour})
+	lockouts.now = c.now
+
+	lockouts.Fail("ip")
+	c.advance(2 * time.Hour)
+	locked, failures := lockouts.Fail("ip")
+	assert.Zero(t, locked)
+	assert.Equal(t, 1, failures)
+}
+
+func TestLockoutsDisabled(t *testing.T) {
+	lockouts := NewLockouts(LockoutPolicy{})
+	for i := 0; i < 10; i++ {
+		locked, _ := lockouts.Fail("ip")
+		assert.Zero(t, locked)
+	}
+}
@@ -0,0 +1,614 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// notFound maps sql.ErrNoRows to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type BunUserRepository struct {
+	db *database.DB
+}
+
+var _ UserRepository = (*BunUserRepository)(nil)
+
+func NewBunUserRepository(db *database.DB) *BunUserRepository {
+	return &BunUserRepository{db}
+}
+
+func (r *BunUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	user := &models.User{}
+	err := r.db.Reader.NewSelect().
+		Model(user).
+		Where("username = ?", username).
+		Scan(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return user, nil
+}
+
+func (r *BunUserRepository) Upsert(ctx context.Context, user *models.User) (*models.User, error) {
+	_, err := r.db.Bun.NewInsert().
+		Model(&models.User{
+			Username:        user.Username,
+			DisplayName:     user.DisplayName,
+			ProfileImageUrl: user.ProfileImageUrl,
+			Role:            models.USER_ROLE_MEMBER,
+		}).
+		On("CONFLICT (username) DO UPDATE").
+		Set("display_name = EXCLUDED.display_name").
+		Set("profile_image_url = EXCLUDED.profile_image_url").
+		Set("deleted_at = NULL").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetByUsername(ctx, user.Username)
+}
+
+func (r *BunUserRepository) List(ctx context.Context) ([]*models.User, error) {
+	var users []*models.User
+	err := r.db.Reader.NewSelect().
+		Model(&users).
+		Order("id").
+		Scan(ctx)
+	return users, err
+}
+
+func (r *BunUserRepository) SetRole(ctx context.Context, username, role string) error {
+	res, err := r.db.Bun.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("role = ?", role).
+		Where("username = ?", username).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type BunSessionRepository struct {
+	db *database.DB
+}
+
+var _ SessionRepository = (*BunSessionRepository)(nil)
+
+func NewBunSessionRepository(db *database.DB) *BunSessionRepository {
+	return &BunSessionRepository{db}
+}
+
+// selectWithUser selects sessions together with the profile of their user.
+func (r *BunSessionRepository) selectWithUser(model any) *bun.SelectQuery {
+	return r.db.Reader.NewSelect().
+		Model(model).
+		Relation("User", func(sq *bun.SelectQuery) *bun.SelectQuery {
+			return sq.Column("username", "display_name", "profile_image_url", "role")
+		})
+}
+
+func (r *BunSessionRepository) Get(ctx context.Context, uuid string) (*models.UserSession, error) {
+	session := &models.UserSession{}
+	if err := r.selectWithUser(session).
+		Where("user_session.uuid = ?", uuid).
+		Scan(ctx); err != nil {
+		return nil, notFound(err)
+	}
+	return session, nil
+}
+
+func (r *BunSessionRepository) GetController(ctx context.Context) (*models.UserSession, error) {
+	session := &models.UserSession{}
+	if err := r.selectWithUser(session).
+		Where("user_session.is_controller = TRUE").
+		Limit(1).
+		Scan(ctx); err != nil {
+		return nil, notFound(err)
+	}
+	return session, nil
+}
+
+func (r *BunSessionRepository) Upsert(ctx context.Context, session *models.UserSession) (*models.UserSession, error) {
+	_, err := r.db.Bun.NewInsert().
+		Model(&models.UserSession{
+			UserId:                session.UserId,
+			Uuid:                  session.Uuid,
+			UserAgent:             session.UserAgent,
+			AccessToken:           session.AccessToken,
+			RefreshToken:          session.RefreshToken,
+			AccessTokenExpiresAt:  session.AccessTokenExpiresAt,
+			RefreshTokenExpiresAt: session.RefreshTokenExpiresAt,
+		}).
+		On("CONFLICT (uuid) DO UPDATE").
+		Set("user_id = EXCLUDED.user_id").
+		Set("user_agent = EXCLUDED.user_agent").
+		Set("access_token = EXCLUDED.access_token").
+		Set("refresh_token = EXCLUDED.refresh_token").
+		Set("access_token_expires_at = EXCLUDED.access_token_expires_at").
+		Set("deleted_at = NULL").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(ctx, session.Uuid)
+}
+
+func (r *BunSessionRepository) UpdateAccessToken(ctx context.Context, uuid, accessToken string, expiresAt time.Time) error {
+	_, err := r.db.Bun.NewUpdate().
+		Model((*models.UserSession)(nil)).
+		Set("access_token = ?", accessToken).
+		Set("access_token_expires_at = ?", expiresAt).
+		Where("uuid = ?", uuid).
+		Exec(ctx)
+	return err
+}
+
+func (r *BunSessionRepository) SetController(ctx context.Context, uuid string) error {
+	_, err := r.db.Bun.NewUpdate().
+		Model((*models.UserSession)(nil)).
+		Set("is_controller = TRUE").
+		Where("uuid = ?", uuid).
+		Exec(ctx)
+	return err
+}
+
+func (r *BunSessionRepository) UnsetController(ctx context.Context, uuid string) error {
+	_, err := r.db.Bun.NewUpdate().
+		Model((*models.UserSession)(nil)).
+		Set("is_controller = FALSE").
+		Where("uuid = ?", uuid).
+		Exec(ctx)
+	return err
+}
+
+func (r *BunSessionRepository) Delete(ctx context.Context, uuid string) error {
+	_, err := r.db.Bun.NewDelete().
+		Model((*models.UserSession)(nil)).
+		Where("uuid = ?", uuid).
+		Exec(ctx)
+	return err
+}
+
+func (r *BunSessionRepository) DeleteByUser(ctx context.Context, userId int64) (int, error) {
+	res, err := r.db.Bun.NewDelete().
+		Model((*models.UserSession)(nil)).
+		Where("user_id = ?", userId).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+func (r *BunSessionRepository) List(ctx context.Context) ([]*models.UserSession, error) {
+	var sessions []*models.UserSession
+	err := r.selectWithUser(&sessions).
+		Order("user_session.id").
+		Scan(ctx)
+	return sessions, err
+}
+
+func (r *BunSessionRepository) CountActive(ctx context.Context) (int, error) {
+	return r.db.Reader.NewSelect().
+		Model((*models.UserSession)(nil)).
+		Count(ctx)
+}
+
+func (r *BunSessionRepository) CountControllers(ctx context.Context) (int, error) {
+	return r.db.Reader.NewSelect().
+		Model((*models.UserSession)(nil)).
+		Where("is_controller = TRUE").
+		Count(ctx)
+}
+
+type BunTrackMediaRepository struct {
+	db *database.DB
+}
+
+var _ TrackMediaRepository = (*BunTrackMediaRepository)(nil)
+
+func NewBunTrackMediaRepository(db *database.DB) *BunTrackMediaRepository {
+	return &BunTrackMediaRepository{db}
+}
+
+func (r *BunTrackMediaRepository) Get(ctx context.Context, spotifyTrackId, mediaType string) (*models.TrackMedia, error) {
+	media := &models.TrackMedia{}
+	if err := r.db.Reader.NewSelect().
+		Model(media).
+		Where("spotify_track_id = ? AND media_type = ?", spotifyTrackId, mediaType).
+		Scan(ctx); err != nil {
+		return nil, notFound(err)
+	}
+	return media, nil
+}
+
+func (r *BunTrackMediaRepository) Upsert(ctx context.Context, media *models.TrackMedia) error {
+	_, err := r.db.Bun.NewInsert().
+		Model(&models.TrackMedia{
+			SpotifyTrackId: media.SpotifyTrackId,
+			MediaType:      media.MediaType,
+			MediaId:        media.MediaId,
+		}).
+		On("CONFLICT (spotify_track_id, media_type) DO UPDATE").
+		Set("media_id = EXCLUDED.media_id").
+		Set("deleted_at = NULL").
+		Exec(ctx)
+	return err
+}
+
+func (r *BunTrackMediaRepository) List(ctx context.Context, spotifyTrackId string) ([]*models.TrackMedia, error) {
+	var media []*models.TrackMedia
+	query := r.db.Reader.NewSelect().Model(&media).Order("id")
+	if spotifyTrackId != "" {
+		query = query.Where("spotify_track_id = ?", spotifyTrackId)
+	}
+	err := query.Scan(ctx)
+	return media, err
+}
+
+func (r *BunTrackMediaRepository) Purge(ctx context.Context, spotifyTrackId string) (int, error) {
+	query := r.db.Bun.NewDelete().Model((*models.TrackMedia)(nil)).ForceDelete()
+	if spotifyTrackId != "" {
+		query = query.Where("spotify_track_id = ?", spotifyTrackId)
+	} else {
+		query = query.Where("1 = 1")
+	}
+
+	res, err := query.Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
+type BunAuditRepository struct {
+	db *database.DB
+}
+
+var _ AuditRepository = (*BunAuditRepository)(nil)
+
+func NewBunAuditRepository(db *database.DB) *BunAuditRepository {
+	return &BunAuditRepository{db}
+}
+
+func (r *BunAuditRepository) Add(ctx context.Context, event *models.AuditEvent) error {
+	_, err := r.db.Bun.NewInsert().Model(event).Exec(ctx)
+	return err
+}
+
+func (r *BunAuditRepository) List(ctx context.Context, action string, limit int) ([]*models.AuditEvent, error) {
+	var events []*models.AuditEvent
+	query := r.db.Reader.NewSelect().Model(&events).Order("id DESC")
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Scan(ctx)
+	return events, err
+}
+
+type BunPlayEventRepository struct {
+	db *database.DB
+}
+
+var _ PlayEventRepository = (*BunPlayEventRepository)(nil)
+
+func NewBunPlayEventRepository(db *database.DB) *BunPlayEventRepository {
+	return &BunPlayEventRepository{db}
+}
+
+func (r *BunPlayEventRepository) Add(ctx context.Context, event *models.PlayEvent) (bool, error) {
+	res, err := r.db.Bun.NewInsert().
+		Model(event).
+		On("CONFLICT (user_id, played_at) DO NOTHING").
+		Exec(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		// postgres returns no id for the skipped row
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+func (r *BunPlayEventRepository) List(ctx context.Context, filter PlayFilter) ([]*models.PlayEvent, error) {
+	var events []*models.PlayEvent
+	query := r.db.Reader.NewSelect().Model(&events).Order("played_at DESC", "id DESC")
+	if filter.UserId != 0 {
+		query = query.Where("user_id = ?", filter.UserId)
+	}
+	if filter.SpotifyTrackId != "" {
+		query = query.Where("spotify_track_id = ?", filter.SpotifyTrackId)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("played_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("played_at < ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	err := query.Scan(ctx)
+	return events, err
+}
+
+type BunScrobbleRepository struct {
+	db *database.DB
+}
+
+var _ ScrobbleRepository = (*BunScrobbleRepository)(nil)
+
+func NewBunScrobbleRepository(db *database.DB) *BunScrobbleRepository {
+	return &BunScrobbleRepository{db}
+}
+
+func (r *BunScrobbleRepository) GetAccount(ctx context.Context, userId int64) (*models.ScrobbleAccount, error) {
+	account := &models.ScrobbleAccount{}
+	err := r.db.Reader.NewSelect().
+		Model(account).
+		Where("user_id = ?", userId).
+		Scan(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return account, nil
+}
+
+func (r *BunScrobbleRepository) SaveAccount(ctx context.Context, account *models.ScrobbleAccount) error {
+	_, err := r.db.Bun.NewInsert().
+		Model(&models.ScrobbleAccount{
+			UserId:     account.UserId,
+			Username:   account.Username,
+			SessionKey: account.SessionKey,
+		}).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("username = EXCLUDED.username").
+		Set("session_key = EXCLUDED.session_key").
+		Set("updated_at = current_timestamp").
+		Exec(ctx)
+	return err
+}
+
+func (r *BunScrobbleRepository) DeleteAccount(ctx context.Context, userId int64) error {
+	return r.db.Bun.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().
+			Model((*models.PendingScrobble)(nil)).
+			Where("user_id = ?", userId).
+			Exec(ctx); err != nil {
+			return err
+		}
+		res, err := tx.NewDelete().
+			Model((*models.ScrobbleAccount)(nil)).
+			Where("user_id = ?", userId).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if count, err := res.RowsAffected(); err == nil && count == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (r *BunScrobbleRepository) Enqueue(ctx context.Context, scrobble *models.PendingScrobble) (bool, error) {
+	res, err := r.db.Bun.NewInsert().
+		Model(scrobble).
+		On("CONFLICT (user_id, timestamp) DO NOTHING").
+		Exec(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		// postgres returns no id for the skipped row
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+func (r *BunScrobbleRepository) Pending(ctx context.Context, limit int) ([]*models.PendingScrobble, error) {
+	var scrobbles []*models.PendingScrobble
+	query := r.db.Reader.NewSelect().Model(&scrobbles).Order("timestamp ASC", "id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Scan(ctx)
+	return scrobbles, err
+}
+
+func (r *BunScrobbleRepository) Dequeue(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.Bun.NewDelete().
+		Model((*models.PendingScrobble)(nil)).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	return err
+}
+
+func (r *BunScrobbleRepository) MarkFailed(ctx context.Context, lastError string, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.Bun.NewUpdate().
+		Model((*models.PendingScrobble)(nil)).
+		Set("attempts = attempts + 1").
+		Set("last_error = ?", lastError).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	return err
+}
+
+type BunAutoDjRepository struct {
+	db *database.DB
+}
+
+var _ AutoDjRepository = (*BunAutoDjRepository)(nil)
+
+func NewBunAutoDjRepository(db *database.DB) *BunAutoDjRepository {
+	return &BunAutoDjRepository{db}
+}
+
+func (r *BunAutoDjRepository) Get(ctx context.Context, userId int64) (*models.AutoDjSettings, error) {
+	settings := &models.AutoDjSettings{}
+	err := r.db.Reader.NewSelect().
+		Model(settings).
+		Where("user_id = ?", userId).
+		Scan(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return settings, nil
+}
+
+func (r *BunAutoDjRepository) Save(ctx context.Context, settings *models.AutoDjSettings) error {
+	_, err := r.db.Bun.NewInsert().
+		Model(&models.AutoDjSettings{
+			UserId:          settings.UserId,
+			Enabled:         settings.Enabled,
+			QueueAhead:      settings.QueueAhead,
+			TargetEnergy:    settings.TargetEnergy,
+			MinEnergy:       settings.MinEnergy,
+			MaxEnergy:       settings.MaxEnergy,
+			AllowExplicit:   settings.AllowExplicit,
+			BlockedTrackIds: settings.BlockedTrackIds,
+		}).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("enabled = EXCLUDED.enabled").
+		Set("queue_ahead = EXCLUDED.queue_ahead").
+		Set("target_energy = EXCLUDED.target_energy").
+		Set("min_energy = EXCLUDED.min_energy").
+		Set("max_energy = EXCLUDED.max_energy").
+		Set("allow_explicit = EXCLUDED.allow_explicit").
+		Set("blocked_track_ids = EXCLUDED.blocked_track_ids").
+		Set("updated_at = current_timestamp").
+		Exec(ctx)
+	return err
+}
+
+type BunContentPolicyRepository struct {
+	db *database.DB
+}
+
+var _ ContentPolicyRepository = (*BunContentPolicyRepository)(nil)
+
+func NewBunContentPolicyRepository(db *database.DB) *BunContentPolicyRepository {
+	return &BunContentPolicyRepository{db}
+}
+
+func (r *BunContentPolicyRepository) Get(ctx context.Context, userId int64) (*models.ContentPolicy, error) {
+	policy := &models.ContentPolicy{}
+	err := r.db.Reader.NewSelect().
+		Model(policy).
+		Where("user_id = ?", userId).
+		Scan(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return policy, nil
+}
+
+func (r *BunContentPolicyRepository) List(ctx context.Context) ([]*models.ContentPolicy, error) {
+	var policies []*models.ContentPolicy
+	err := r.db.Reader.NewSelect().
+		Model(&policies).
+		Order("user_id").
+		Scan(ctx)
+	return policies, err
+}
+
+func (r *BunContentPolicyRepository) Save(ctx context.Context, policy *models.ContentPolicy) error {
+	_, err := r.db.Bun.NewInsert().
+		Model(&models.ContentPolicy{
+			UserId:           policy.UserId,
+			BlockExplicit:    policy.BlockExplicit,
+			BlockedArtistIds: policy.BlockedArtistIds,
+			BlockedTrackIds:  policy.BlockedTrackIds,
+			AllowedFrom:      policy.AllowedFrom,
+			AllowedUntil:     policy.AllowedUntil,
+			UpdatedBy:        policy.UpdatedBy,
+		}).
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("block_explicit = EXCLUDED.block_explicit").
+		Set("blocked_artist_ids = EXCLUDED.blocked_artist_ids").
+		Set("blocked_track_ids = EXCLUDED.blocked_track_ids").
+		Set("allowed_from = EXCLUDED.allowed_from").
+		Set("allowed_until = EXCLUDED.allowed_until").
+		Set("updated_by = EXCLUDED.updated_by").
+		Set("updated_at = current_timestamp").
+		Exec(ctx)
+	return err
+}
+
+func (r *BunContentPolicyRepository) Delete(ctx context.Context, userId int64) error {
+	_, err := r.db.Bun.NewDelete().
+		Model((*models.ContentPolicy)(nil)).
+		Where("user_id = ?", userId).
+		Exec(ctx)
+	return err
+}
+
+type BunHouseholdRepository struct {
+	db *database.DB
+}
+
+var _ HouseholdRepository = (*BunHouseholdRepository)(nil)
+
+func NewBunHouseholdRepository(db *database.DB) *BunHouseholdRepository {
+	return &BunHouseholdRepository{db}
+}
+
+func (r *BunHouseholdRepository) Get(ctx context.Context) (*models.HouseholdSettings, error) {
+	settings := &models.HouseholdSettings{}
+	err := r.db.Reader.NewSelect().
+		Model(settings).
+		Where("id = ?", models.HOUSEHOLD_SETTINGS_ID).
+		Scan(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return settings, nil
+}
+
+func (r *BunHouseholdRepository) Save(ctx context.Context, settings *models.HouseholdSettings) error {
+	_, err := r.db.Bun.NewInsert().
+		Model(&models.HouseholdSettings{
+			Id:                  models.HOUSEHOLD_SETTINGS_ID,
+			KeepPlaybackOnKiosk: settings.KeepPlaybackOnKiosk,
+			UpdatedBy:           settings.UpdatedBy,
+		}).
+		On("CONFLICT (id) DO UPDATE").
+		Set("keep_playback_on_kiosk = EXCLUDED.keep_playback_on_kiosk").
+		Set("updated_by = EXCLUDED.updated_by").
+		Set("updated_at = current_timestamp").
+		Exec(ctx)
+	return err
+}
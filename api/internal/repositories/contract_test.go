@@ -0,0 +1,552 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/database/migrations"
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// repositories groups the implementations under test, which must share their data.
+type repositories struct {
+	users      UserRepository
+	sessions   SessionRepository
+	trackMedia TrackMediaRepository
+	audit      AuditRepository
+	plays      PlayEventRepository
+	scrobbles  ScrobbleRepository
+	autoDj     AutoDjRepository
+	policies   ContentPolicyRepository
+	household  HouseholdRepository
+}
+
+func newBunRepositories(t *testing.T) repositories {
+	t.Helper()
+
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "db.sqlite3"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = database.Migrate(context.Background(), db, migrations.Migrations)
+	require.NoError(t, err)
+
+	return repositories{
+		NewBunUserRepository(db),
+		NewBunSessionRepository(db),
+		NewBunTrackMediaRepository(db),
+		NewBunAuditRepository(db),
+		NewBunPlayEventRepository(db),
+		NewBunScrobbleRepository(db),
+		NewBunAutoDjRepository(db),
+		NewBunContentPolicyRepository(db),
+		NewBunHouseholdRepository(db),
+	}
+}
+
+// newPostgresRepositories migrates a schema of its own on the server at TEST_DATABASE_URL, dropped after the test.
+// Tests are skipped when no server is configured.
+func newPostgresRepositories(t *testing.T) repositories {
+	t.Helper()
+	ctx := context.Background()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := database.NewPostgresDB(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("pify_test_%d", time.Now().UnixNano())
+	_, err = admin.Bun.ExecContext(ctx, "CREATE SCHEMA ?", bun.Ident(schema))
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Bun.ExecContext(context.Background(), "DROP SCHEMA ? CASCADE", bun.Ident(schema)) })
+
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	db, err := database.NewPostgresDB(u.String())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = database.Migrate(ctx, db, migrations.Migrations)
+	require.NoError(t, err)
+
+	return repositories{
+		NewBunUserRepository(db),
+		NewBunSessionRepository(db),
+		NewBunTrackMediaRepository(db),
+		NewBunAuditRepository(db),
+		NewBunPlayEventRepository(db),
+		NewBunScrobbleRepository(db),
+		NewBunAutoDjRepository(db),
+		NewBunContentPolicyRepository(db),
+		NewBunHouseholdRepository(db),
+	}
+}
+
+func newMemoryRepositories(t *testing.T) repositories {
+	store := NewMemoryStore()
+	return repositories{store.Users(), store.Sessions(), store.TrackMedia(), store.Audit(), store.Plays(), store.Scrobbles(), store.AutoDj(), store.Policies(), store.Household()}
+}
+
+func TestBunRepositories(t *testing.T) {
+	runContract(t, newBunRepositories)
+}
+
+func TestPostgresRepositories(t *testing.T) {
+	runContract(t, newPostgresRepositories)
+}
+
+func TestMemoryRepositories(t *testing.T) {
+	runContract(t, newMemoryRepositories)
+}
+
+// runContract checks the behaviour every implementation of the repositories must have.
+func runContract(t *testing.T, newRepositories func(t *testing.T) repositories) {
+	ctx := context.Background()
+
+	saveUser := func(t *testing.T, r repositories, username string) *models.User {
+		t.Helper()
+		user, err := r.users.Upsert(ctx, &models.User{Username: username, DisplayName: username + " name"})
+		require.NoError(t, err)
+		return user
+	}
+
+	saveSession := func(t *testing.T, r repositories, userId int64, uuid, accessToken string) *models.UserSession {
+		t.Helper()
+		session, err := r.sessions.Upsert(ctx, &models.UserSession{
+			UserId:               userId,
+			Uuid:                 uuid,
+			UserAgent:            "test",
+			AccessToken:          accessToken,
+			AccessTokenExpiresAt: time.Now().Add(time.Hour),
+			RefreshToken:         "refresh",
+		})
+		require.NoError(t, err)
+		return session
+	}
+
+	t.Run("user not found", func(t *testing.T) {
+		r := newRepositories(t)
+		_, err := r.users.GetByUsername(ctx, "nobody")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("user upsert updates profile", func(t *testing.T) {
+		r := newRepositories(t)
+		created := saveUser(t, r, "alice")
+		assert.NotZero(t, created.Id)
+		assert.Equal(t, "alice name", created.DisplayName)
+
+		updated, err := r.users.Upsert(ctx, &models.User{
+			Username:        "alice",
+			DisplayName:     "Alice",
+			ProfileImageUrl: "https://example.com/alice.png",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, created.Id, updated.Id)
+		assert.Equal(t, "Alice", updated.DisplayName)
+		assert.Equal(t, "https://example.com/alice.png", updated.ProfileImageUrl)
+	})
+
+	t.Run("session includes user profile", func(t *testing.T) {
+		r := newRepositories(t)
+		user := saveUser(t, r, "alice")
+		saveSession(t, r, user.Id, "session", "token")
+
+		session, err := r.sessions.Get(ctx, "session")
+		require.NoError(t, err)
+		assert.Equal(t, user.Id, session.UserId)
+		assert.Equal(t, "token", session.AccessToken)
+		require.NotNil(t, session.User)
+		assert.Equal(t, "alice name", session.User.DisplayName)
+
+		_, err = r.sessions.Get(ctx, "other")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("session upsert restores deleted session", func(t *testing.T) {
+		r := newRepositories(t)
+		user := saveUser(t, r, "alice")
+		saveSession(t, r, user.Id, "session", "first")
+
+		require.NoError(t, r.sessions.Delete(ctx, "session"))
+		_, err := r.sessions.Get(ctx, "session")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		session := saveSession(t, r, user.Id, "session", "second")
+		assert.Equal(t, "second", session.AccessToken)
+
+		count, err := r.sessions.CountActive(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("session access token update", func(t *testing.T) {
+		r := newRepositories(t)
+		user := saveUser(t, r, "alice")
+		saveSession(t, r, user.Id, "session", "old")
+
+		expiresAt := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+		require.NoError(t, r.sessions.UpdateAccessToken(ctx, "session", "new", expiresAt))
+
+		session, err := r.sessions.Get(ctx, "session")
+		require.NoError(t, err)
+		assert.Equal(t, "new", session.AccessToken)
+		assert.True(t, expiresAt.Equal(session.AccessTokenExpiresAt))
+	})
+
+	t.Run("controller session", func(t *testing.T) {
+		r := newRepositories(t)
+		user := saveUser(t, r, "alice")
+		saveSession(t, r, user.Id, "phone", "token")
+		saveSession(t, r, user.Id, "kiosk", "token")
+
+		_, err := r.sessions.GetController(ctx)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, r.sessions.SetController(ctx, "kiosk"))
+		controller, err := r.sessions.GetController(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "kiosk", controller.Uuid)
+		assert.True(t, *controller.IsController)
+		assert.Equal(t, "alice name", controller.User.DisplayName)
+
+		count, err := r.sessions.CountControllers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		count, err = r.sessions.CountActive(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		// deleted sessions lose their controller privileges
+		require.NoError(t, r.sessions.Delete(ctx, "kiosk"))
+		_, err = r.sessions.GetController(ctx)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("track media upsert replaces media id", func(t *testing.T) {
+		r := newRepositories(t)
+
+		_, err := r.trackMedia.Get(ctx, "track", "youtube")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, r.trackMedia.Upsert(ctx, &models.TrackMedia{SpotifyTrackId: "track", MediaType: "youtube", MediaId: "first"}))
+		require.NoError(t, r.trackMedia.Upsert(ctx, &models.TrackMedia{SpotifyTrackId: "track", MediaType: "youtube", MediaId: "second"}))
+		require.NoError(t, r.trackMedia.Upsert(ctx, &models.TrackMedia{SpotifyTrackId: "track", MediaType: "other", MediaId: "third"}))
+
+		media, err := r.trackMedia.Get(ctx, "track", "youtube")
+		require.NoError(t, err)
+		assert.Equal(t, "second", media.MediaId)
+	})
+
+	t.Run("list users and sessions", func(t *testing.T) {
+		r := newRepositories(t)
+		alice := saveUser(t, r, "alice")
+		bob := saveUser(t, r, "bob")
+		saveSession(t, r, alice.Id, "alice-phone", "token")
+		saveSession(t, r, alice.Id, "alice-laptop", "token")
+		saveSession(t, r, bob.Id, "bob-phone", "token")
+		require.NoError(t, r.sessions.Delete(ctx, "alice-laptop"))
+
+		users, err := r.users.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		assert.Equal(t, "alice", users[0].Username)
+		assert.Equal(t, "bob", users[1].Username)
+
+		sessions, err := r.sessions.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		assert.Equal(t, "alice-phone", sessions[0].Uuid)
+		assert.Equal(t, "alice", sessions[0].User.Username)
+		assert.Equal(t, "bob-phone", sessions[1].Uuid)
+	})
+
+	t.Run("delete sessions of user", func(t *testing.T) {
+		r := newRepositories(t)
+		alice := saveUser(t, r, "alice")
+		bob := saveUser(t, r, "bob")
+		saveSession(t, r, alice.Id, "alice-phone", "token")
+		saveSession(t, r, alice.Id, "alice-laptop", "token")
+		saveSession(t, r, bob.Id, "bob-phone", "token")
+
+		count, err := r.sessions.DeleteByUser(ctx, alice.Id)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		count, err = r.sessions.CountActive(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("unset controller", func(t *testing.T) {
+		r := newRepositories(t)
+		user := saveUser(t, r, "alice")
+		saveSession(t, r, user.Id, "kiosk", "token")
+		require.NoError(t, r.sessions.SetController(ctx, "kiosk"))
+
+		require.NoError(t, r.sessions.UnsetController(ctx, "kiosk"))
+		_, err := r.sessions.GetController(ctx)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("list and purge track media", func(t *testing.T) {
+		r := newRepositories(t)
+		require.NoError(t, r.trackMedia.Upsert(ctx, &models.TrackMedia{SpotifyTrackId: "first", MediaType: "youtube", MediaId: "a"}))
+		require.NoError(t, r.trackMedia.Upsert(ctx, &models.TrackMedia{SpotifyTrackId: "first", MediaType: "other", MediaId: "b"}))
+		require.NoError(t, r.trackMedia.Upsert(ctx, &models.TrackMedia{SpotifyTrackId: "second", MediaType: "youtube", MediaId: "c"}))
+
+		media, err := r.trackMedia.List(ctx, "first")
+		require.NoError(t, err)
+		assert.Len(t, media, 2)
+
+		count, err := r.trackMedia.Purge(ctx, "first")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+		_, err = r.trackMedia.Get(ctx, "first", "youtube")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// purged media can be saved again
+		require.NoError(t, r.trackMedia.Upsert(ctx, &models.TrackMedia{SpotifyTrackId: "first", MediaType: "youtube", MediaId: "d"}))
+
+		count, err = r.trackMedia.Purge(ctx, "")
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+		media, err = r.trackMedia.List(ctx, "")
+		require.NoError(t, err)
+		assert.Empty(t, media)
+	})
+
+	t.Run("list audit events", func(t *testing.T) {
+		r := newRepositories(t)
+		for _, action := range []string{"lockout", "other", "lockout"} {
+			require.NoError(t, r.audit.Add(ctx, &models.AuditEvent{Action: action, Actor: "ip:127.0.0.1", Subject: "admin"}))
+		}
+
+		all, err := r.audit.List(ctx, "", 0)
+		require.NoError(t, err)
+		require.Len(t, all, 3)
+		assert.Equal(t, "lockout", all[0].Action)
+		assert.Equal(t, "other", all[1].Action)
+		assert.False(t, all[0].CreatedAt.IsZero())
+
+		// newest first
+		events, err := r.audit.List(ctx, "lockout", 1)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, all[0].Id, events[0].Id)
+		assert.Equal(t, "ip:127.0.0.1", events[0].Actor)
+	})
+	t.Run("play events deduplicated by played at", func(t *testing.T) {
+		r := newRepositories(t)
+		alice := saveUser(t, r, "alice")
+		bob := saveUser(t, r, "bob")
+		at := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+		play := func(userId int64, trackId string, playedAt time.Time) *models.PlayEvent {
+			return &models.PlayEvent{
+				UserId:         userId,
+				SpotifyTrackId: trackId,
+				StartedAt:      playedAt.Add(-3 * time.Minute),
+				PlayedAt:       playedAt,
+				PlayedPercent:  100,
+				Source:         models.PLAY_SOURCE_POLLER,
+			}
+		}
+
+		for _, p := range []*models.PlayEvent{
+			play(alice.Id, "t1", at),
+			play(alice.Id, "t2", at.Add(time.Hour)),
+			play(alice.Id, "t1", at.Add(2*time.Hour)),
+			play(bob.Id, "t1", at),
+		} {
+			added, err := r.plays.Add(ctx, p)
+			require.NoError(t, err)
+			assert.True(t, added)
+		}
+
+		added, err := r.plays.Add(ctx, play(alice.Id, "t3", at))
+		require.NoError(t, err)
+		assert.False(t, added)
+
+		// latest first
+		plays, err := r.plays.List(ctx, PlayFilter{UserId: alice.Id})
+		require.NoError(t, err)
+		require.Len(t, plays, 3)
+		assert.Equal(t, "t1", plays[0].SpotifyTrackId)
+		assert.Equal(t, "t2", plays[1].SpotifyTrackId)
+		assert.True(t, plays[2].PlayedAt.Equal(at))
+		assert.Equal(t, 100, plays[2].PlayedPercent)
+
+		plays, err = r.plays.List(ctx, PlayFilter{From: at, To: at.Add(2 * time.Hour)})
+		require.NoError(t, err)
+		assert.Len(t, plays, 3)
+
+		plays, err = r.plays.List(ctx, PlayFilter{UserId: alice.Id, SpotifyTrackId: "t1", Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, plays, 1)
+		assert.True(t, plays[0].PlayedAt.Equal(at.Add(2*time.Hour)))
+	})
+	t.Run("scrobble accounts and queue", func(t *testing.T) {
+		r := newRepositories(t)
+		alice := saveUser(t, r, "alice")
+		bob := saveUser(t, r, "bob")
+		at := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+		_, err := r.scrobbles.GetAccount(ctx, alice.Id)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, r.scrobbles.SaveAccount(ctx, &models.ScrobbleAccount{UserId: alice.Id, Username: "al", SessionKey: "key-1"}))
+		require.NoError(t, r.scrobbles.SaveAccount(ctx, &models.ScrobbleAccount{UserId: alice.Id, Username: "alice", SessionKey: "key-2"}))
+		require.NoError(t, r.scrobbles.SaveAccount(ctx, &models.ScrobbleAccount{UserId: bob.Id, Username: "bob", SessionKey: "key-3"}))
+		account, err := r.scrobbles.GetAccount(ctx, alice.Id)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", account.Username)
+		assert.Equal(t, "key-2", account.SessionKey)
+
+		scrobble := func(userId int64, track string, timestamp time.Time) *models.PendingScrobble {
+			return &models.PendingScrobble{UserId: userId, Artist: "Band", Track: track, DurationMs: 200000, Timestamp: timestamp}
+		}
+		for _, s := range []*models.PendingScrobble{
+			scrobble(alice.Id, "Two", at.Add(time.Hour)),
+			scrobble(alice.Id, "One", at),
+			scrobble(bob.Id, "Three", at.Add(2*time.Hour)),
+		} {
+			added, err := r.scrobbles.Enqueue(ctx, s)
+			require.NoError(t, err)
+			assert.True(t, added)
+		}
+		added, err := r.scrobbles.Enqueue(ctx, scrobble(alice.Id, "Again", at))
+		require.NoError(t, err)
+		assert.False(t, added)
+
+		// oldest first
+		pending, err := r.scrobbles.Pending(ctx, 0)
+		require.NoError(t, err)
+		require.Len(t, pending, 3)
+		assert.Equal(t, "One", pending[0].Track)
+		assert.True(t, pending[0].Timestamp.Equal(at))
+		assert.Equal(t, "Three", pending[2].Track)
+
+		require.NoError(t, r.scrobbles.MarkFailed(ctx, "offline", pending[0].Id, pending[1].Id))
+		require.NoError(t, r.scrobbles.Dequeue(ctx, pending[1].Id))
+		pending, err = r.scrobbles.Pending(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, 1, pending[0].Attempts)
+		assert.Equal(t, "offline", pending[0].LastError)
+
+		// unlinking drops the pending scrobbles of the user
+		require.NoError(t, r.scrobbles.DeleteAccount(ctx, alice.Id))
+		assert.ErrorIs(t, r.scrobbles.DeleteAccount(ctx, alice.Id), ErrNotFound)
+		pending, err = r.scrobbles.Pending(ctx, 0)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, bob.Id, pending[0].UserId)
+	})
+
+	t.Run("auto-DJ settings", func(t *testing.T) {
+		r := newRepositories(t)
+		alice := saveUser(t, r, "alice")
+		bob := saveUser(t, r, "bob")
+		energy := 0.7
+
+		_, err := r.autoDj.Get(ctx, alice.Id)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, r.autoDj.Save(ctx, &models.AutoDjSettings{UserId: alice.Id, Enabled: true, QueueAhead: 3, TargetEnergy: &energy}))
+		require.NoError(t, r.autoDj.Save(ctx, &models.AutoDjSettings{UserId: bob.Id, QueueAhead: 5, BlockedTrackIds: "t1"}))
+		require.NoError(t, r.autoDj.Save(ctx, &models.AutoDjSettings{UserId: alice.Id, QueueAhead: 4, AllowExplicit: true, BlockedTrackIds: "t2,t3"}))
+
+		settings, err := r.autoDj.Get(ctx, alice.Id)
+		require.NoError(t, err)
+		assert.False(t, settings.Enabled)
+		assert.Equal(t, 4, settings.QueueAhead)
+		assert.Nil(t, settings.TargetEnergy)
+		assert.True(t, settings.AllowExplicit)
+		assert.Equal(t, "t2,t3", settings.BlockedTrackIds)
+
+		settings, err = r.autoDj.Get(ctx, bob.Id)
+		require.NoError(t, err)
+		assert.Equal(t, 5, settings.QueueAhead)
+	})
+	t.Run("content policies", func(t *testing.T) {
+		r := newRepositories(t)
+
+		_, err := r.policies.Get(ctx, 0)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, r.policies.Save(ctx, &models.ContentPolicy{UserId: 2, BlockedArtistIds: "a1", UpdatedBy: "alice"}))
+		require.NoError(t, r.policies.Save(ctx, &models.ContentPolicy{UserId: 0, BlockExplicit: true, AllowedFrom: "07:00", AllowedUntil: "20:00", UpdatedBy: "alice"}))
+		require.NoError(t, r.policies.Save(ctx, &models.ContentPolicy{UserId: 2, BlockedTrackIds: "t1,t2", UpdatedBy: "bob"}))
+
+		policy, err := r.policies.Get(ctx, 2)
+		require.NoError(t, err)
+		assert.Empty(t, policy.BlockedArtistIds)
+		assert.Equal(t, "t1,t2", policy.BlockedTrackIds)
+		assert.Equal(t, "bob", policy.UpdatedBy)
+
+		policies, err := r.policies.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, policies, 2)
+		assert.Equal(t, int64(0), policies[0].UserId)
+		assert.True(t, policies[0].BlockExplicit)
+		assert.Equal(t, "07:00", policies[0].AllowedFrom)
+		assert.Equal(t, "20:00", policies[0].AllowedUntil)
+
+		require.NoError(t, r.policies.Delete(ctx, 2))
+		_, err = r.policies.Get(ctx, 2)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("user role", func(t *testing.T) {
+		r := newRepositories(t)
+		alice := saveUser(t, r, "alice")
+		assert.Equal(t, models.USER_ROLE_MEMBER, alice.Role)
+		saveSession(t, r, alice.Id, "uuid-1", "token")
+
+		require.NoError(t, r.users.SetRole(ctx, "alice", models.USER_ROLE_OWNER))
+		assert.ErrorIs(t, r.users.SetRole(ctx, "bob", models.USER_ROLE_OWNER), ErrNotFound)
+
+		// logging in again keeps the role
+		_, err := r.users.Upsert(ctx, &models.User{Username: "alice", DisplayName: "Alice"})
+		require.NoError(t, err)
+		session, err := r.sessions.Get(ctx, "uuid-1")
+		require.NoError(t, err)
+		assert.Equal(t, models.USER_ROLE_OWNER, session.User.Role)
+	})
+
+	t.Run("household settings", func(t *testing.T) {
+		r := newRepositories(t)
+
+		_, err := r.household.Get(ctx)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, r.household.Save(ctx, &models.HouseholdSettings{KeepPlaybackOnKiosk: true, UpdatedBy: "alice"}))
+		require.NoError(t, r.household.Save(ctx, &models.HouseholdSettings{KeepPlaybackOnKiosk: false, UpdatedBy: "bob"}))
+
+		settings, err := r.household.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(models.HOUSEHOLD_SETTINGS_ID), settings.Id)
+		assert.False(t, settings.KeepPlaybackOnKiosk)
+		assert.Equal(t, "bob", settings.UpdatedBy)
+		assert.False(t, settings.UpdatedAt.IsZero())
+	})
+}
@@ -0,0 +1,715 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// MemoryStore keeps users, sessions, track media, audit events, play events, scrobbles, auto-DJ settings, content policies and household settings in memory. It is meant for tests that do not
+// need a database. Repositories of the same store share their data, e.g. sessions see their users.
+type MemoryStore struct {
+	mu         sync.Mutex
+	nextId     int64
+	users      map[int64]*models.User
+	sessions   map[int64]*models.UserSession
+	trackMedia map[int64]*models.TrackMedia
+	audit      map[int64]*models.AuditEvent
+	plays      map[int64]*models.PlayEvent
+	accounts   map[int64]*models.ScrobbleAccount
+	scrobbles  map[int64]*models.PendingScrobble
+	autoDj     map[int64]*models.AutoDjSettings
+	policies   map[int64]*models.ContentPolicy
+	household  *models.HouseholdSettings
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:      make(map[int64]*models.User),
+		sessions:   make(map[int64]*models.UserSession),
+		trackMedia: make(map[int64]*models.TrackMedia),
+		audit:      make(map[int64]*models.AuditEvent),
+		plays:      make(map[int64]*models.PlayEvent),
+		accounts:   make(map[int64]*models.ScrobbleAccount),
+		scrobbles:  make(map[int64]*models.PendingScrobble),
+		autoDj:     make(map[int64]*models.AutoDjSettings),
+		policies:   make(map[int64]*models.ContentPolicy),
+	}
+}
+
+func (s *MemoryStore) Users() UserRepository {
+	return &memoryUserRepository{s}
+}
+
+func (s *MemoryStore) Sessions() SessionRepository {
+	return &memorySessionRepository{s}
+}
+
+func (s *MemoryStore) TrackMedia() TrackMediaRepository {
+	return &memoryTrackMediaRepository{s}
+}
+
+func (s *MemoryStore) Audit() AuditRepository {
+	return &memoryAuditRepository{s}
+}
+
+func (s *MemoryStore) Plays() PlayEventRepository {
+	return &memoryPlayEventRepository{s}
+}
+
+func (s *MemoryStore) Scrobbles() ScrobbleRepository {
+	return &memoryScrobbleRepository{s}
+}
+
+func (s *MemoryStore) AutoDj() AutoDjRepository {
+	return &memoryAutoDjRepository{s}
+}
+
+func (s *MemoryStore) Policies() ContentPolicyRepository {
+	return &memoryContentPolicyRepository{s}
+}
+
+func (s *MemoryStore) Household() HouseholdRepository {
+	return &memoryHouseholdRepository{s}
+}
+
+func (s *MemoryStore) id() int64 {
+	s.nextId++
+	return s.nextId
+}
+
+// sortedIds returns the ids of a table in insert order, so lookups are deterministic.
+func sortedIds[T any](rows map[int64]*T) []int64 {
+	ids := make([]int64, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+type memoryUserRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryUserRepository) GetByUsername(_ context.Context, username string) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if user := r.find(username, false); user != nil {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) Upsert(ctx context.Context, user *models.User) (*models.User, error) {
+	r.s.mu.Lock()
+	existing := r.find(user.Username, true)
+	if existing == nil {
+		existing = &models.User{Id: r.s.id(), Username: user.Username, Role: models.USER_ROLE_MEMBER, CreatedAt: time.Now()}
+		r.s.users[existing.Id] = existing
+	}
+	existing.DisplayName = user.DisplayName
+	existing.ProfileImageUrl = user.ProfileImageUrl
+	existing.DeletedAt = nil
+	r.s.mu.Unlock()
+
+	return r.GetByUsername(ctx, user.Username)
+}
+
+func (r *memoryUserRepository) List(_ context.Context) ([]*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var users []*models.User
+	for _, id := range sortedIds(r.s.users) {
+		if user := r.s.users[id]; user.DeletedAt == nil {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	return users, nil
+}
+
+func (r *memoryUserRepository) SetRole(_ context.Context, username, role string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user := r.find(username, false)
+	if user == nil {
+		return ErrNotFound
+	}
+	user.Role = role
+	return nil
+}
+
+func (r *memoryUserRepository) find(username string, withDeleted bool) *models.User {
+	for _, id := range sortedIds(r.s.users) {
+		user := r.s.users[id]
+		if user.Username == username && (withDeleted || user.DeletedAt == nil) {
+			return user
+		}
+	}
+	return nil
+}
+
+type memorySessionRepository struct {
+	s *MemoryStore
+}
+
+// withUser returns a copy of the session with the profile of its user, like the bun repository.
+func (r *memorySessionRepository) withUser(session *models.UserSession) *models.UserSession {
+	copied := *session
+	copied.User = nil
+	if user, ok := r.s.users[session.UserId]; ok {
+		copied.User = &models.User{Username: user.Username, DisplayName: user.DisplayName, ProfileImageUrl: user.ProfileImageUrl, Role: user.Role}
+	}
+	return &copied
+}
+
+func (r *memorySessionRepository) find(match func(*models.UserSession) bool, withDeleted bool) *models.UserSession {
+	for _, id := range sortedIds(r.s.sessions) {
+		session := r.s.sessions[id]
+		if match(session) && (withDeleted || session.DeletedAt == nil) {
+			return session
+		}
+	}
+	return nil
+}
+
+func byUuid(uuid string) func(*models.UserSession) bool {
+	return func(session *models.UserSession) bool { return session.Uuid == uuid }
+}
+
+func (r *memorySessionRepository) Get(_ context.Context, uuid string) (*models.UserSession, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if session := r.find(byUuid(uuid), false); session != nil {
+		return r.withUser(session), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memorySessionRepository) GetController(_ context.Context) (*models.UserSession, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	isController := func(session *models.UserSession) bool {
+		return session.IsController != nil && *session.IsController
+	}
+	if session := r.find(isController, false); session != nil {
+		return r.withUser(session), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memorySessionRepository) Upsert(ctx context.Context, session *models.UserSession) (*models.UserSession, error) {
+	r.s.mu.Lock()
+	existing := r.find(byUuid(session.Uuid), true)
+	if existing == nil {
+		existing = &models.UserSession{
+			Id:                    r.s.id(),
+			Uuid:                  session.Uuid,
+			RefreshTokenExpiresAt: session.RefreshTokenExpiresAt,
+			CreatedAt:             time.Now(),
+		}
+		r.s.sessions[existing.Id] = existing
+	}
+	existing.UserId = session.UserId
+	existing.UserAgent = session.UserAgent
+	existing.AccessToken = session.AccessToken
+	existing.RefreshToken = session.RefreshToken
+	existing.AccessTokenExpiresAt = session.AccessTokenExpiresAt
+	existing.DeletedAt = nil
+	r.s.mu.Unlock()
+
+	return r.Get(ctx, session.Uuid)
+}
+
+func (r *memorySessionRepository) UpdateAccessToken(_ context.Context, uuid, accessToken string, expiresAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if session := r.find(byUuid(uuid), false); session != nil {
+		session.AccessToken = accessToken
+		session.AccessTokenExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) SetController(_ context.Context, uuid string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if session := r.find(byUuid(uuid), false); session != nil {
+		isController := true
+		session.IsController = &isController
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) UnsetController(_ context.Context, uuid string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if session := r.find(byUuid(uuid), false); session != nil {
+		isController := false
+		session.IsController = &isController
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) Delete(_ context.Context, uuid string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if session := r.find(byUuid(uuid), false); session != nil {
+		now := time.Now()
+		session.DeletedAt = &now
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) DeleteByUser(_ context.Context, userId int64) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for _, session := range r.s.sessions {
+		if session.UserId == userId && session.DeletedAt == nil {
+			session.DeletedAt = &now
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memorySessionRepository) List(_ context.Context) ([]*models.UserSession, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var sessions []*models.UserSession
+	for _, id := range sortedIds(r.s.sessions) {
+		if session := r.s.sessions[id]; session.DeletedAt == nil {
+			sessions = append(sessions, r.withUser(session))
+		}
+	}
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) count(match func(*models.UserSession) bool) int {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	count := 0
+	for _, session := range r.s.sessions {
+		if session.DeletedAt == nil && match(session) {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *memorySessionRepository) CountActive(_ context.Context) (int, error) {
+	return r.count(func(*models.UserSession) bool { return true }), nil
+}
+
+func (r *memorySessionRepository) CountControllers(_ context.Context) (int, error) {
+	return r.count(func(session *models.UserSession) bool {
+		return session.IsController != nil && *session.IsController
+	}), nil
+}
+
+type memoryTrackMediaRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryTrackMediaRepository) find(spotifyTrackId, mediaType string) *models.TrackMedia {
+	for _, id := range sortedIds(r.s.trackMedia) {
+		media := r.s.trackMedia[id]
+		if media.SpotifyTrackId == spotifyTrackId && media.MediaType == mediaType {
+			return media
+		}
+	}
+	return nil
+}
+
+func (r *memoryTrackMediaRepository) Get(_ context.Context, spotifyTrackId, mediaType string) (*models.TrackMedia, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if media := r.find(spotifyTrackId, mediaType); media != nil && media.DeletedAt == nil {
+		copied := *media
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryTrackMediaRepository) Upsert(_ context.Context, media *models.TrackMedia) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	existing := r.find(media.SpotifyTrackId, media.MediaType)
+	if existing == nil {
+		existing = &models.TrackMedia{
+			Id:             r.s.id(),
+			SpotifyTrackId: media.SpotifyTrackId,
+			MediaType:      media.MediaType,
+			CreatedAt:      time.Now(),
+		}
+		r.s.trackMedia[existing.Id] = existing
+	}
+	existing.MediaId = media.MediaId
+	existing.DeletedAt = nil
+	return nil
+}
+
+func (r *memoryTrackMediaRepository) List(_ context.Context, spotifyTrackId string) ([]*models.TrackMedia, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var media []*models.TrackMedia
+	for _, id := range sortedIds(r.s.trackMedia) {
+		m := r.s.trackMedia[id]
+		if m.DeletedAt == nil && (spotifyTrackId == "" || m.SpotifyTrackId == spotifyTrackId) {
+			copied := *m
+			media = append(media, &copied)
+		}
+	}
+	return media, nil
+}
+
+func (r *memoryTrackMediaRepository) Purge(_ context.Context, spotifyTrackId string) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	count := 0
+	for id, m := range r.s.trackMedia {
+		if spotifyTrackId == "" || m.SpotifyTrackId == spotifyTrackId {
+			delete(r.s.trackMedia, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+type memoryAuditRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryAuditRepository) Add(_ context.Context, event *models.AuditEvent) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	event.Id = r.s.id()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	copied := *event
+	r.s.audit[event.Id] = &copied
+	return nil
+}
+
+func (r *memoryAuditRepository) List(_ context.Context, action string, limit int) ([]*models.AuditEvent, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	ids := sortedIds(r.s.audit)
+	var events []*models.AuditEvent
+	for i := len(ids) - 1; i >= 0 && (limit <= 0 || len(events) < limit); i-- {
+		if event := r.s.audit[ids[i]]; action == "" || event.Action == action {
+			copied := *event
+			events = append(events, &copied)
+		}
+	}
+	return events, nil
+}
+
+type memoryPlayEventRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryPlayEventRepository) Add(_ context.Context, event *models.PlayEvent) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, play := range r.s.plays {
+		if play.UserId == event.UserId && play.PlayedAt.Equal(event.PlayedAt) {
+			return false, nil
+		}
+	}
+
+	event.Id = r.s.id()
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	copied := *event
+	r.s.plays[event.Id] = &copied
+	return true, nil
+}
+
+func (r *memoryPlayEventRepository) List(_ context.Context, filter PlayFilter) ([]*models.PlayEvent, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var events []*models.PlayEvent
+	for _, id := range sortedIds(r.s.plays) {
+		play := r.s.plays[id]
+		if (filter.UserId != 0 && play.UserId != filter.UserId) ||
+			(filter.SpotifyTrackId != "" && play.SpotifyTrackId != filter.SpotifyTrackId) ||
+			(!filter.From.IsZero() && play.PlayedAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && !play.PlayedAt.Before(filter.To)) {
+			continue
+		}
+		copied := *play
+		events = append(events, &copied)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].PlayedAt.Equal(events[j].PlayedAt) {
+			return events[i].PlayedAt.After(events[j].PlayedAt)
+		}
+		return events[i].Id > events[j].Id
+	})
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+	return events, nil
+}
+
+type memoryScrobbleRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryScrobbleRepository) GetAccount(_ context.Context, userId int64) (*models.ScrobbleAccount, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, account := range r.s.accounts {
+		if account.UserId == userId {
+			copied := *account
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryScrobbleRepository) SaveAccount(_ context.Context, account *models.ScrobbleAccount) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for _, existing := range r.s.accounts {
+		if existing.UserId == account.UserId {
+			existing.Username = account.Username
+			existing.SessionKey = account.SessionKey
+			existing.UpdatedAt = now
+			return nil
+		}
+	}
+
+	copied := *account
+	copied.Id = r.s.id()
+	copied.CreatedAt, copied.UpdatedAt = now, now
+	r.s.accounts[copied.Id] = &copied
+	return nil
+}
+
+func (r *memoryScrobbleRepository) DeleteAccount(_ context.Context, userId int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, scrobble := range r.s.scrobbles {
+		if scrobble.UserId == userId {
+			delete(r.s.scrobbles, id)
+		}
+	}
+	for id, account := range r.s.accounts {
+		if account.UserId == userId {
+			delete(r.s.accounts, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryScrobbleRepository) Enqueue(_ context.Context, scrobble *models.PendingScrobble) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, pending := range r.s.scrobbles {
+		if pending.UserId == scrobble.UserId && pending.Timestamp.Equal(scrobble.Timestamp) {
+			return false, nil
+		}
+	}
+
+	scrobble.Id = r.s.id()
+	if scrobble.CreatedAt.IsZero() {
+		scrobble.CreatedAt = time.Now()
+	}
+	copied := *scrobble
+	r.s.scrobbles[scrobble.Id] = &copied
+	return true, nil
+}
+
+func (r *memoryScrobbleRepository) Pending(_ context.Context, limit int) ([]*models.PendingScrobble, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var scrobbles []*models.PendingScrobble
+	for _, id := range sortedIds(r.s.scrobbles) {
+		copied := *r.s.scrobbles[id]
+		scrobbles = append(scrobbles, &copied)
+	}
+
+	sort.SliceStable(scrobbles, func(i, j int) bool {
+		return scrobbles[i].Timestamp.Before(scrobbles[j].Timestamp)
+	})
+	if limit > 0 && len(scrobbles) > limit {
+		scrobbles = scrobbles[:limit]
+	}
+	return scrobbles, nil
+}
+
+func (r *memoryScrobbleRepository) Dequeue(_ context.Context, ids ...int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, id := range ids {
+		delete(r.s.scrobbles, id)
+	}
+	return nil
+}
+
+func (r *memoryScrobbleRepository) MarkFailed(_ context.Context, lastError string, ids ...int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, id := range ids {
+		if scrobble, ok := r.s.scrobbles[id]; ok {
+			scrobble.Attempts++
+			scrobble.LastError = lastError
+		}
+	}
+	return nil
+}
+
+type memoryAutoDjRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryAutoDjRepository) Get(_ context.Context, userId int64) (*models.AutoDjSettings, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, settings := range r.s.autoDj {
+		if settings.UserId == userId {
+			copied := *settings
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryAutoDjRepository) Save(_ context.Context, settings *models.AutoDjSettings) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	copied := *settings
+	copied.UpdatedAt = time.Now()
+	for id, existing := range r.s.autoDj {
+		if existing.UserId == settings.UserId {
+			copied.Id = id
+			r.s.autoDj[id] = &copied
+			return nil
+		}
+	}
+
+	copied.Id = r.s.id()
+	r.s.autoDj[copied.Id] = &copied
+	return nil
+}
+
+// memoryContentPolicyRepository keys the policies by user id, as they are unique.
+type memoryContentPolicyRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryContentPolicyRepository) Get(_ context.Context, userId int64) (*models.ContentPolicy, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	policy, ok := r.s.policies[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *policy
+	return &copied, nil
+}
+
+func (r *memoryContentPolicyRepository) List(_ context.Context) ([]*models.ContentPolicy, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	policies := make([]*models.ContentPolicy, 0, len(r.s.policies))
+	for _, userId := range sortedIds(r.s.policies) {
+		copied := *r.s.policies[userId]
+		policies = append(policies, &copied)
+	}
+	return policies, nil
+}
+
+func (r *memoryContentPolicyRepository) Save(_ context.Context, policy *models.ContentPolicy) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	copied := *policy
+	copied.UpdatedAt = time.Now()
+	if existing, ok := r.s.policies[policy.UserId]; ok {
+		copied.Id = existing.Id
+	} else {
+		copied.Id = r.s.id()
+	}
+	r.s.policies[policy.UserId] = &copied
+	return nil
+}
+
+func (r *memoryContentPolicyRepository) Delete(_ context.Context, userId int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.policies, userId)
+	return nil
+}
+
+type memoryHouseholdRepository struct {
+	s *MemoryStore
+}
+
+func (r *memoryHouseholdRepository) Get(_ context.Context) (*models.HouseholdSettings, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.household == nil {
+		return nil, ErrNotFound
+	}
+	copied := *r.s.household
+	return &copied, nil
+}
+
+func (r *memoryHouseholdRepository) Save(_ context.Context, settings *models.HouseholdSettings) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	copied := *settings
+	copied.Id = models.HOUSEHOLD_SETTINGS_ID
+	copied.UpdatedAt = time.Now()
+	r.s.household = &copied
+	return nil
+}
@@ -0,0 +1,125 @@
+// Package repositories provides the persistence of users, sessions, track media, audit events, play events and scrobbles behind interfaces,
+// with implementations backed by bun and in-memory fakes for tests.
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+)
+
+// ErrNotFound is returned when no matching row exists, or the row has been deleted.
+var ErrNotFound = errors.New("not found")
+
+type UserRepository interface {
+	// GetByUsername returns the user with the given Spotify username.
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	// Upsert creates the user, or updates the profile of the user with the same username,
+	// restoring it if it was deleted.
+	Upsert(ctx context.Context, user *models.User) (*models.User, error)
+	// List returns the users that have not been deleted, ordered by id.
+	List(ctx context.Context) ([]*models.User, error)
+	// SetRole changes the role of the user with the given username.
+	SetRole(ctx context.Context, username, role string) error
+}
+
+type SessionRepository interface {
+	// Get returns the session with the given uuid, including the display name, profile image and role of its user.
+	Get(ctx context.Context, uuid string) (*models.UserSession, error)
+	// GetController returns a session with controller privileges, including the profile of its user.
+	GetController(ctx context.Context) (*models.UserSession, error)
+	// Upsert creates the session, or updates the user, user agent and tokens of the session with the same uuid,
+	// restoring it if it was deleted.
+	Upsert(ctx context.Context, session *models.UserSession) (*models.UserSession, error)
+	UpdateAccessToken(ctx context.Context, uuid, accessToken string, expiresAt time.Time) error
+	SetController(ctx context.Context, uuid string) error
+	// UnsetController removes the controller privileges of the session.
+	UnsetController(ctx context.Context, uuid string) error
+	Delete(ctx context.Context, uuid string) error
+	// DeleteByUser deletes all sessions of the user and returns how many were deleted.
+	DeleteByUser(ctx context.Context, userId int64) (int, error)
+	// List returns the sessions that have not been deleted, ordered by id, including the profile of their user.
+	List(ctx context.Context) ([]*models.UserSession, error)
+	CountActive(ctx context.Context) (int, error)
+	CountControllers(ctx context.Context) (int, error)
+}
+
+type TrackMediaRepository interface {
+	Get(ctx context.Context, spotifyTrackId, mediaType string) (*models.TrackMedia, error)
+	// Upsert saves the media of a track, replacing the media id previously saved for the same type.
+	Upsert(ctx context.Context, media *models.TrackMedia) error
+	// List returns the media saved for a track, or of all tracks if spotifyTrackId is empty, ordered by id.
+	List(ctx context.Context, spotifyTrackId string) ([]*models.TrackMedia, error)
+	// Purge permanently deletes the media of a track, or of all tracks if spotifyTrackId is empty,
+	// and returns how many rows were deleted.
+	Purge(ctx context.Context, spotifyTrackId string) (int, error)
+}
+
+type AuditRepository interface {
+	Add(ctx context.Context, event *models.AuditEvent) error
+	// List returns the latest events of action, or of all actions if action is empty, newest first.
+	// A limit of zero or less returns all events.
+	List(ctx context.Context, action string, limit int) ([]*models.AuditEvent, error)
+}
+
+// PlayFilter selects play events, zero fields select all of them.
+type PlayFilter struct {
+	UserId         int64
+	SpotifyTrackId string
+	// From and To bound PlayedAt, From is inclusive and To exclusive
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+type PlayEventRepository interface {
+	// Add saves the play unless the user already has a play at the same PlayedAt, and reports whether it was saved.
+	Add(ctx context.Context, event *models.PlayEvent) (bool, error)
+	// List returns the plays matching filter, latest first.
+	List(ctx context.Context, filter PlayFilter) ([]*models.PlayEvent, error)
+}
+
+type ScrobbleRepository interface {
+	// GetAccount returns the scrobbling account linked by the user.
+	GetAccount(ctx context.Context, userId int64) (*models.ScrobbleAccount, error)
+	// SaveAccount links the account to its user, replacing the account the user linked before.
+	SaveAccount(ctx context.Context, account *models.ScrobbleAccount) error
+	// DeleteAccount unlinks the account of the user and drops the pending scrobbles of the user.
+	DeleteAccount(ctx context.Context, userId int64) error
+	// Enqueue adds the scrobble to the queue unless the user has one pending at the same Timestamp,
+	// and reports whether it was added.
+	Enqueue(ctx context.Context, scrobble *models.PendingScrobble) (bool, error)
+	// Pending returns the pending scrobbles, oldest first. A limit of zero or less returns all of them.
+	Pending(ctx context.Context, limit int) ([]*models.PendingScrobble, error)
+	// Dequeue deletes the pending scrobbles with the given ids.
+	Dequeue(ctx context.Context, ids ...int64) error
+	// MarkFailed counts a failed attempt to send the pending scrobbles with the given ids.
+	MarkFailed(ctx context.Context, lastError string, ids ...int64) error
+}
+
+type AutoDjRepository interface {
+	// Get returns the auto-DJ settings of the user.
+	Get(ctx context.Context, userId int64) (*models.AutoDjSettings, error)
+	// Save saves the settings of their user, replacing the settings saved before.
+	Save(ctx context.Context, settings *models.AutoDjSettings) error
+}
+
+type ContentPolicyRepository interface {
+	// Get returns the policy of the user, of the household for user id 0.
+	Get(ctx context.Context, userId int64) (*models.ContentPolicy, error)
+	// List returns the policies ordered by user id, the policy of the household first.
+	List(ctx context.Context) ([]*models.ContentPolicy, error)
+	// Save saves the policy of its user, replacing the policy saved before.
+	Save(ctx context.Context, policy *models.ContentPolicy) error
+	// Delete deletes the policy of the user.
+	Delete(ctx context.Context, userId int64) error
+}
+
+type HouseholdRepository interface {
+	// Get returns the settings of the household, ErrNotFound until they are saved.
+	Get(ctx context.Context) (*models.HouseholdSettings, error)
+	// Save saves the settings of the household, replacing the settings saved before.
+	Save(ctx context.Context, settings *models.HouseholdSettings) error
+}
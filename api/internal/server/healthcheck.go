@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+// HEALTHCHECK_TIMEOUT is how long Healthcheck waits for the server to answer.
+const HEALTHCHECK_TIMEOUT = 2 * time.Second
+
+// Healthcheck requests /healthz of the server started with settings on this host, over plain HTTP or
+// HTTPS following its TLS mode, and fails unless it answers 200. It is run by the healthcheck of the
+// container, as the probe has to follow TLS_MODE and SERVER_PORT.
+func Healthcheck(ctx context.Context, settings utils.ServerSettings) error {
+	ctx, cancel := context.WithTimeout(ctx, HEALTHCHECK_TIMEOUT)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthcheckURL(settings), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: &http.Transport{
+		// the certificate is issued for the domain of the server, not for localhost
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("healthcheck answered %d", res.StatusCode)
+	}
+	return nil
+}
+
+// healthcheckURL returns the url of /healthz of the server started with settings on this host.
+func healthcheckURL(settings utils.ServerSettings) string {
+	scheme := "https"
+	if settings.TlsMode == constants.TLS_MODE_PLAIN {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://localhost:%s/healthz", scheme, serverPort(settings.Port))
+}
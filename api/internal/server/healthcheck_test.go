@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+func TestHealthcheckURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings utils.ServerSettings
+		expected string
+	}{
+		{name: "file", settings: utils.ServerSettings{Port: "443", TlsMode: constants.TLS_MODE_FILE}, expected: "https://localhost:443/healthz"},
+		{name: "default mode", settings: utils.ServerSettings{Port: "443"}, expected: "https://localhost:443/healthz"},
+		{name: "local ca", settings: utils.ServerSettings{Port: "8443", TlsMode: constants.TLS_MODE_LOCAL_CA}, expected: "https://localhost:8443/healthz"},
+		{name: "plain", settings: utils.ServerSettings{Port: "8080", TlsMode: constants.TLS_MODE_PLAIN}, expected: "http://localhost:8080/healthz"},
+		{name: "default port", settings: utils.ServerSettings{TlsMode: constants.TLS_MODE_PLAIN}, expected: "http://localhost:8080/healthz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, healthcheckURL(tt.settings))
+		})
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	settings := utils.ServerSettings{Port: serverURL.Port(), TlsMode: constants.TLS_MODE_PLAIN}
+
+	assert.NoError(t, Healthcheck(context.Background(), settings))
+
+	status = http.StatusServiceUnavailable
+	assert.ErrorContains(t, Healthcheck(context.Background(), settings), "503")
+}
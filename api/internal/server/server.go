@@ -3,52 +3,73 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
-	"github.com/edgejay/pify-player/api/internal/database"
-	"github.com/edgejay/pify-player/api/internal/handlers"
+	"github.com/edgejay/pify-player/api/internal/app"
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/openapi"
+	"github.com/edgejay/pify-player/api/internal/utils"
 )
 
 type Server struct {
-	port        string
-	corsOrigins []string
-	sslDomain   string
-	e           *echo.Echo
+	port           string
+	corsOrigins    []string
+	sslDomain      string
+	tlsMode        string
+	trustedProxies []string
+	app            *app.App
+	e              *echo.Echo
+	// cancels background tasks such as certificate reloading and renewal
+	cancel context.CancelFunc
 }
 
-func NewServer(port string, corsOrigins []string, sslDomain string) *Server {
-	return &Server{port, corsOrigins, sslDomain, nil}
+func NewServer(settings utils.ServerSettings, app *app.App) *Server {
+	return &Server{
+		port:           settings.Port,
+		corsOrigins:    settings.CorsOrigins,
+		sslDomain:      settings.SslDomain,
+		tlsMode:        settings.TlsMode,
+		trustedProxies: settings.TrustedProxies,
+		app:            app,
+	}
 }
 
 // Start function initializes and starts the Echo server with the specified configurations.
 //   - Sets up middleware for logging, recovery, and CORS (if specified).
-//   - Sets up the API routes and starts the server with TLS using the provided SSL domain.
+//   - Sets up the API routes and starts the server according to the TLS mode:
+//     plain HTTP behind a proxy, certificate files reloaded on change, or a certificate issued by the local CA.
 //   - If port is not a valid integer, it defaults to "8080".
 //
 // In case of a server start failure, it logs the error and exits the application.
 func (svr *Server) Start() {
-	// Initialise the database
-	if err := database.GetSQLiteDB().Ping(); err != nil {
-		log.Fatalf("Database connection failed: %v\n", err)
+	// Check the database connection
+	if err := svr.app.DB.Ping(); err != nil {
+		slog.Error("database connection failed", "error", err)
+		os.Exit(1)
 	}
 
-	if _, err := strconv.Atoi(svr.port); err != nil {
-		svr.port = "8080"
-	}
+	svr.port = serverPort(svr.port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svr.cancel = cancel
 
 	svr.e = echo.New()
+	svr.e.IPExtractor = svr.ipExtractor()
 
-	// Enable logging middleware
-	svr.e.Use(middleware.Logger())
+	// Enable request id and logging middleware
+	svr.e.Use(svr.app.MiddlewareFactory.RequestId())
+	svr.e.Use(svr.app.MiddlewareFactory.RequestLogger())
 	svr.e.Use(middleware.Recover())
+	svr.e.Use(svr.app.Metrics.Middleware())
 
 	if len(svr.corsOrigins) > 0 {
-		log.Printf("Setting up CORS for origins: %v\n", svr.corsOrigins)
+		slog.Info("setting up CORS", "origins", svr.corsOrigins)
 
 		// Enable CORS middleware
 		svr.e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
@@ -59,30 +80,81 @@ func (svr *Server) Start() {
 	}
 
 	// Handlers
-	apiGroup := svr.e.Group("/api")
-	authGroup := apiGroup.Group("/auth")
-	playerGroup := apiGroup.Group("/player")
-	deviceGroup := apiGroup.Group("/device")
-	handlers.SetAuthRoutes(authGroup)
-	handlers.SetPlayerRoutes(playerGroup)
-	handlers.SetDeviceRoutes(deviceGroup)
-
-	log.Printf("Server is running on port %s...\n", svr.port)
+	validator, err := openapi.NewValidator()
+	if err != nil {
+		slog.Error("openapi spec is invalid", "error", err)
+		os.Exit(1)
+	}
+	svr.setRoutes(svr.e, validator)
 
 	// Start the server
-	if err := svr.e.StartTLS(
-		fmt.Sprintf(":%s", svr.port),
-		fmt.Sprintf("./certs/%s.pem", svr.sslDomain),
-		fmt.Sprintf("./certs/%s.key.pem", svr.sslDomain),
-	); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Server failed to start: %v\n", err)
+	addr := fmt.Sprintf(":%s", svr.port)
+
+	if svr.tlsMode == constants.TLS_MODE_PLAIN {
+		slog.Info("server is running", "port", svr.port, "tls_mode", svr.tlsMode)
+		err = svr.e.Start(addr)
+	} else {
+		tlsConfig, tlsErr := svr.tlsConfig(ctx)
+		if tlsErr != nil {
+			slog.Error("server TLS setup failed", "tls_mode", svr.tlsMode, "error", tlsErr)
+			os.Exit(1)
+		}
+
+		slog.Info("server is running", "port", svr.port, "tls_mode", svr.tlsMode)
+		svr.e.TLSServer.Addr = addr
+		svr.e.TLSServer.TLSConfig = tlsConfig
+		err = svr.e.StartServer(svr.e.TLSServer)
+	}
+
+	if err != nil && err != http.ErrServerClosed {
+		slog.Error("server failed to start", "error", err)
+		os.Exit(1)
+	}
+}
+
+// serverPort returns port, or "8080" if it is not a valid integer.
+func serverPort(port string) string {
+	if _, err := strconv.Atoi(port); err != nil {
+		return "8080"
+	}
+	return port
+}
+
+// setRoutes registers the health, metrics and api routes, and the handler answering their errors.
+// The api routes are served under /api/v1, and unversioned under /api for existing clients.
+// Requests are validated against the OpenAPI specification, which is served at openapi.json.
+func (svr *Server) setRoutes(e *echo.Echo, validator *openapi.Validator) {
+	e.HTTPErrorHandler = svr.app.Handlers.HTTPErrorHandler
+
+	svr.app.Handlers.SetHealthRoutes(e.Group(""))
+	e.GET("/metrics", echo.WrapHandler(svr.app.Metrics.Handler()))
+
+	for _, prefix := range []string{constants.API_V1_PREFIX, constants.API_PREFIX} {
+		apiGroup := e.Group(prefix, validator.Middleware())
+		apiGroup.GET("/openapi.json", validator.Handler())
+		svr.app.Handlers.SetAuthRoutes(apiGroup.Group("/auth"))
+		svr.app.Handlers.SetPlayerRoutes(apiGroup.Group("/player"))
+		svr.app.Handlers.SetDeviceRoutes(apiGroup.Group("/device"))
+		svr.app.Handlers.SetAdminRoutes(apiGroup.Group("/admin"))
+		svr.app.Handlers.SetSearchRoutes(apiGroup.Group("/search"))
+		svr.app.Handlers.SetLibraryRoutes(apiGroup.Group("/library"))
+		svr.app.Handlers.SetHistoryRoutes(apiGroup.Group("/history"))
+		svr.app.Handlers.SetStatsRoutes(apiGroup.Group("/stats"))
+		svr.app.Handlers.SetScrobbleRoutes(apiGroup.Group("/scrobble"))
+		svr.app.Handlers.SetAutoDjRoutes(apiGroup.Group("/autodj"))
+		svr.app.Handlers.SetPolicyRoutes(apiGroup.Group("/policy"))
 	}
 }
 
 // Shutdown function gracefully shuts down the server with a timeout of 5 seconds.
 //   - Logs the error if the server is forced to shutdown.
 func (svr *Server) Shutdown(ctx context.Context) {
+	if svr.cancel != nil {
+		svr.cancel()
+	}
+
 	if err := svr.e.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		slog.Error("server forced to shutdown", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/app"
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/database"
+	"github.com/edgejay/pify-player/api/internal/errors"
+	pifyHttp "github.com/edgejay/pify-player/api/internal/http"
+	"github.com/edgejay/pify-player/api/internal/openapi"
+)
+
+// newTestRoutes registers the routes of the server on a new echo instance.
+func newTestRoutes(t *testing.T) (*echo.Echo, *openapi.Validator) {
+	t.Helper()
+
+	db, err := database.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+
+	a := app.NewApp(db, app.Config{})
+	t.Cleanup(func() {
+		a.Close()
+	})
+
+	validator, err := openapi.NewValidator()
+	require.NoError(t, err)
+
+	e := echo.New()
+	(&Server{app: a}).setRoutes(e, validator)
+	return e, validator
+}
+
+var echoParam = regexp.MustCompile(`:(\w+)`)
+
+func TestRoutesAreInSpec(t *testing.T) {
+	e, validator := newTestRoutes(t)
+	spec := validator.Spec()
+
+	registered := map[string]bool{}
+	for _, route := range e.Routes() {
+		// catch all routes registered by the middlewares of the groups answer 404
+		if !strings.HasPrefix(route.Path, constants.API_PREFIX+"/") || route.Method == echo.RouteNotFound {
+			continue
+		}
+
+		path := echoParam.ReplaceAllString(route.Path, "{$1}")
+		registered[route.Method+" "+path] = true
+
+		// paths of the spec are relative to the servers /api/v1 and /api
+		path = strings.TrimPrefix(path, constants.API_V1_PREFIX)
+		path = strings.TrimPrefix(path, constants.API_PREFIX)
+
+		pathItem := spec.Paths.Value(path)
+		if !assert.NotNil(t, pathItem, "path %s of %s is missing from the openapi spec", path, route.Path) {
+			continue
+		}
+		assert.NotNil(t, pathItem.GetOperation(route.Method), "%s %s is missing from the openapi spec", route.Method, path)
+	}
+
+	// and the other way around, the spec does not describe routes that do not exist
+	for path, pathItem := range spec.Paths.Map() {
+		for method := range pathItem.Operations() {
+			for _, prefix := range []string{constants.API_V1_PREFIX, constants.API_PREFIX} {
+				assert.True(t, registered[method+" "+prefix+path], "%s %s is in the openapi spec but not registered", method, prefix+path)
+			}
+		}
+	}
+}
+
+func TestRoutesValidateRequests(t *testing.T) {
+	t.Setenv("BASIC_AUTH_USERNAME", "player")
+	t.Setenv("BASIC_AUTH_PASSWORD", "secret")
+	e, _ := newTestRoutes(t)
+
+	do := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"command": "reboot"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.SetBasicAuth("player", "secret")
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/api/v1/player/command")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var res pifyHttp.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, errors.REQUEST_VALIDATION_FAILED, res.Error.Code)
+	assert.Contains(t, res.Error.Message, "/command")
+
+	// unversioned routes answer with the error code only
+	rec = do("/api/player/command")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"data": null, "error_code": "request_validation_failed"}`, rec.Body.String())
+}
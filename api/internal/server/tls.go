@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/edgejay/pify-player/api/internal/certs"
+	"github.com/edgejay/pify-player/api/internal/constants"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+const (
+	// how often certificate files are checked for changes
+	certWatchInterval = 30 * time.Second
+	// how often the local CA checks whether the certificate needs renewal
+	certRenewInterval = 12 * time.Hour
+	// certificates issued by the local CA are renewed when they expire within this duration
+	certRenewBefore = 30 * 24 * time.Hour
+)
+
+// tlsConfig builds the TLS config of the server for the file and local CA modes.
+// The certificate is reloaded whenever its files change, until ctx is done.
+func (svr *Server) tlsConfig(ctx context.Context) (*tls.Config, error) {
+	certFile, keyFile := utils.GetSSLCertFiles(svr.sslDomain)
+
+	switch svr.tlsMode {
+	case "", constants.TLS_MODE_FILE:
+		// certs are provided externally, e.g. generated with mkcert
+	case constants.TLS_MODE_LOCAL_CA:
+		ca, err := certs.LoadOrCreateCA(filepath.Join(utils.GetCertsDir(), "ca"))
+		if err != nil {
+			return nil, err
+		}
+		if err := svr.renewLocalCertificate(ca, certFile, keyFile); err != nil {
+			return nil, err
+		}
+		go svr.renewLocalCertificatePeriodically(ctx, ca, certFile, keyFile)
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q", svr.tlsMode)
+	}
+
+	reloader, err := certs.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.Watch(ctx, certWatchInterval)
+
+	return reloader.TLSConfig(), nil
+}
+
+// localHosts returns the hosts certificates issued by the local CA are valid for.
+func (svr *Server) localHosts() []string {
+	hosts := []string{}
+	if svr.sslDomain != "" {
+		hosts = append(hosts, svr.sslDomain)
+	}
+	return append(hosts, "localhost", "127.0.0.1", "::1")
+}
+
+func (svr *Server) renewLocalCertificate(ca *certs.LocalCA, certFile, keyFile string) error {
+	issued, err := ca.EnsureCertificate(svr.localHosts(), certFile, keyFile, certRenewBefore)
+	if err != nil {
+		return err
+	}
+	if issued {
+		slog.Info("certificate issued by local CA", "cert_file", certFile, "hosts", svr.localHosts())
+	}
+	return nil
+}
+
+func (svr *Server) renewLocalCertificatePeriodically(ctx context.Context, ca *certs.LocalCA, certFile, keyFile string) {
+	ticker := time.NewTicker(certRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := svr.renewLocalCertificate(ca, certFile, keyFile); err != nil {
+				slog.Error("renew certificate failed", "cert_file", certFile, "error", err)
+			}
+		}
+	}
+}
+
+// ipExtractor determines how the client IP is resolved. Behind a proxy, X-Forwarded-For is trusted
+// only when sent by loopback or explicitly configured proxy addresses. Private network addresses are
+// not trusted, since clients on the home network reach the api directly.
+func (svr *Server) ipExtractor() echo.IPExtractor {
+	if svr.tlsMode != constants.TLS_MODE_PLAIN {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(true), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range svr.trustedProxies {
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			slog.Warn("ignoring invalid trusted proxy", "cidr", cidr, "error", err)
+			continue
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/edgejay/pify-player/api/internal/constants"
+)
+
+func TestIpExtractor(t *testing.T) {
+	svr := &Server{tlsMode: constants.TLS_MODE_PLAIN, trustedProxies: []string{"172.20.0.0/16", "invalid"}}
+	extract := svr.ipExtractor()
+
+	clientIp := func(remoteAddr string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		return extract(req)
+	}
+	assert.Equal(t, "203.0.113.7", clientIp("127.0.0.1:1234"))
+	assert.Equal(t, "203.0.113.7", clientIp("172.20.0.5:1234"))
+	// clients of the home network reaching the api directly cannot pick their IP
+	assert.Equal(t, "192.168.1.20", clientIp("192.168.1.20:1234"))
+	assert.Equal(t, "10.0.0.3", clientIp("10.0.0.3:1234"))
+	assert.Equal(t, "169.254.1.1", clientIp("169.254.1.1:1234"))
+
+	// without a proxy in front, X-Forwarded-For is never trusted
+	svr.tlsMode = constants.TLS_MODE_FILE
+	extract = svr.ipExtractor()
+	assert.Equal(t, "127.0.0.1", clientIp("127.0.0.1:1234"))
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+// UserSummary describes a user for administration, without any token.
+type UserSummary struct {
+	Id             int64     `json:"id"`
+	Username       string    `json:"username"`
+	DisplayName    string    `json:"display_name"`
+	Role           string    `json:"role"`
+	ActiveSessions int       `json:"active_sessions"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SessionSummary describes a session for administration, without any token.
+type SessionSummary struct {
+	Uuid                 string    `json:"uuid"`
+	Username             string    `json:"username"`
+	DisplayName          string    `json:"display_name"`
+	UserAgent            string    `json:"user_agent"`
+	IsController         bool      `json:"is_controller"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+type TrackMediaSummary struct {
+	SpotifyTrackId string    `json:"spotify_track_id"`
+	MediaType      string    `json:"media_type"`
+	MediaId        string    `json:"media_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AdminService implements the administrative operations of pifyctl, served by the admin routes
+// or run directly against the database when the api is offline.
+type AdminService struct {
+	users          repositories.UserRepository
+	sessions       repositories.SessionRepository
+	trackMedia     repositories.TrackMediaRepository
+	audit          repositories.AuditRepository
+	spotifyService *SpotifyService
+}
+
+func NewAdminService(
+	users repositories.UserRepository,
+	sessions repositories.SessionRepository,
+	trackMedia repositories.TrackMediaRepository,
+	audit repositories.AuditRepository,
+	spotifyService *SpotifyService,
+) *AdminService {
+	return &AdminService{users, sessions, trackMedia, audit, spotifyService}
+}
+
+func (s *AdminService) ListUsers(ctx context.Context) ([]UserSummary, error) {
+	users, err := s.users.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.sessions.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[int64]int)
+	for _, session := range sessions {
+		active[session.UserId]++
+	}
+
+	summaries := make([]UserSummary, len(users))
+	for i, user := range users {
+		summaries[i] = UserSummary{
+			Id:             user.Id,
+			Username:       user.Username,
+			DisplayName:    user.DisplayName,
+			Role:           user.Role,
+			ActiveSessions: active[user.Id],
+			CreatedAt:      user.CreatedAt,
+		}
+	}
+	return summaries, nil
+}
+
+// RevokeUser logs the user out of all sessions and returns how many were revoked.
+func (s *AdminService) RevokeUser(ctx context.Context, username string) (int, error) {
+	user, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return 0, errors.New(pifyErrors.USER_NOT_FOUND)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return s.sessions.DeleteByUser(ctx, user.Id)
+}
+
+// SetRole gives the user the role, recorded in the audit log, and returns the updated user.
+func (s *AdminService) SetRole(ctx context.Context, username, role string) (*UserSummary, error) {
+	if role != models.USER_ROLE_MEMBER && role != models.USER_ROLE_OWNER {
+		return nil, errors.New(pifyErrors.INVALID_USER_ROLE)
+	}
+	err := s.users.SetRole(ctx, username, role)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errors.New(pifyErrors.USER_NOT_FOUND)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := NewAuditService(s.audit).Record(ctx, models.AUDIT_ACTION_ROLE_CHANGED, "admin", username, "role="+role); err != nil {
+		return nil, err
+	}
+
+	users, err := s.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, errors.New(pifyErrors.USER_NOT_FOUND)
+}
+
+func (s *AdminService) ListSessions(ctx context.Context) ([]SessionSummary, error) {
+	sessions, err := s.sessions.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]SessionSummary, len(sessions))
+	for i, session := range sessions {
+		summaries[i] = summarizeSession(session)
+	}
+	return summaries, nil
+}
+
+// RevokeSession logs the session out, which also removes its controller privileges.
+func (s *AdminService) RevokeSession(ctx context.Context, uuid string) error {
+	if _, err := s.getSession(ctx, uuid); err != nil {
+		return err
+	}
+	return s.sessions.Delete(ctx, uuid)
+}
+
+func (s *AdminService) GetController(ctx context.Context) (*SessionSummary, error) {
+	session, err := s.sessions.GetController(ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errors.New(pifyErrors.CONTROLLER_NOT_FOUND)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	summary := summarizeSession(session)
+	return &summary, nil
+}
+
+// SetController makes the session the only one with controller privileges.
+func (s *AdminService) SetController(ctx context.Context, uuid string) (*SessionSummary, error) {
+	if _, err := s.getSession(ctx, uuid); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessions.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if session.Uuid != uuid && session.IsController != nil && *session.IsController {
+			if err := s.sessions.UnsetController(ctx, session.Uuid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.sessions.SetController(ctx, uuid); err != nil {
+		return nil, err
+	}
+
+	return s.GetController(ctx)
+}
+
+func (s *AdminService) ListTrackMedia(ctx context.Context, spotifyTrackId string) ([]TrackMediaSummary, error) {
+	media, err := s.trackMedia.List(ctx, spotifyTrackId)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]TrackMediaSummary, len(media))
+	for i, m := range media {
+		summaries[i] = TrackMediaSummary{m.SpotifyTrackId, m.MediaType, m.MediaId, m.CreatedAt}
+	}
+	return summaries, nil
+}
+
+// PurgeTrackMedia deletes the cached media of a track, or of all tracks if all is set, so they are
+// searched again on the next play. It returns how many were deleted.
+func (s *AdminService) PurgeTrackMedia(ctx context.Context, spotifyTrackId string, all bool) (int, error) {
+	if spotifyTrackId == "" && !all {
+		return 0, errors.New(pifyErrors.MISSING_PURGE_TARGET)
+	}
+	if all {
+		spotifyTrackId = ""
+	}
+	return s.trackMedia.Purge(ctx, spotifyTrackId)
+}
+
+// RefreshToken refreshes the access token of the session, or of the controller if uuid is empty.
+func (s *AdminService) RefreshToken(ctx context.Context, uuid string) (*SessionSummary, error) {
+	session, err := s.sessionOrController(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.refresh(ctx, session); err != nil {
+		return nil, err
+	}
+
+	session, err = s.sessions.Get(ctx, session.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	summary := summarizeSession(session)
+	return &summary, nil
+}
+
+// ListDevices returns the Spotify devices of the controller.
+func (s *AdminService) ListDevices(ctx context.Context) (*SpotifyDevices, error) {
+	accessToken, err := s.controllerAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.spotifyService.GetUserDevices(ctx, accessToken)
+}
+
+// TransferPlayback moves the playback of the controller to the device.
+func (s *AdminService) TransferPlayback(ctx context.Context, deviceId string) error {
+	accessToken, err := s.controllerAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.spotifyService.TransferPlayback(ctx, accessToken, deviceId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ListAuditEvents returns the latest audit events of action, or of all actions if action is empty, newest first.
+func (s *AdminService) ListAuditEvents(ctx context.Context, action string, limit int) ([]AuditEventSummary, error) {
+	events, err := s.audit.List(ctx, action, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]AuditEventSummary, len(events))
+	for i, event := range events {
+		summaries[i] = summarizeAuditEvent(event)
+	}
+	return summaries, nil
+}
+
+// LoginURL returns the url encoded in the login QR code shown by the player.
+func (s *AdminService) LoginURL(_ context.Context) (string, error) {
+	return utils.GetCallbackDestination(), nil
+}
+
+func (s *AdminService) getSession(ctx context.Context, uuid string) (*models.UserSession, error) {
+	session, err := s.sessions.Get(ctx, uuid)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errors.New(pifyErrors.SESSION_NOT_FOUND)
+	}
+	return session, err
+}
+
+func (s *AdminService) sessionOrController(ctx context.Context, uuid string) (*models.UserSession, error) {
+	if uuid != "" {
+		return s.getSession(ctx, uuid)
+	}
+	return getController(ctx, s.sessions)
+}
+
+func (s *AdminService) controllerAccessToken(ctx context.Context) (string, error) {
+	return controllerAccessToken(ctx, s.sessions, s.spotifyService)
+}
+
+func (s *AdminService) refresh(ctx context.Context, session *models.UserSession) (string, error) {
+	return refreshSessionToken(ctx, s.sessions, s.spotifyService, session)
+}
+
+func summarizeSession(session *models.UserSession) SessionSummary {
+	summary := SessionSummary{
+		Uuid:                 session.Uuid,
+		UserAgent:            session.UserAgent,
+		IsController:         session.IsController != nil && *session.IsController,
+		AccessTokenExpiresAt: session.AccessTokenExpiresAt,
+		CreatedAt:            session.CreatedAt,
+	}
+	if session.User != nil {
+		summary.Username = session.User.Username
+		summary.DisplayName = session.User.DisplayName
+	}
+	return summary
+}
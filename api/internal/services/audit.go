@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// AuditEventSummary describes an audit event for administration.
+type AuditEventSummary struct {
+	Id        int64     `json:"id"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	Subject   string    `json:"subject"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditService records the audit events of the api, listed by the admin routes.
+type AuditService struct {
+	audit repositories.AuditRepository
+}
+
+func NewAuditService(audit repositories.AuditRepository) *AuditService {
+	return &AuditService{audit}
+}
+
+// Record saves an audit event, and logs it so that it also shows up with the requests that caused it.
+func (s *AuditService) Record(ctx context.Context, action, actor, subject, details string) error {
+	slog.WarnContext(ctx, "audit event", "action", action, "actor", actor, "subject", subject, "details", details)
+
+	return s.audit.Add(ctx, &models.AuditEvent{
+		Action:  action,
+		Actor:   actor,
+		Subject: subject,
+		Details: details,
+	})
+}
+
+func summarizeAuditEvent(event *models.AuditEvent) AuditEventSummary {
+	return AuditEventSummary{
+		Id:        event.Id,
+		Action:    event.Action,
+		Actor:     event.Actor,
+		Subject:   event.Subject,
+		Details:   event.Details,
+		CreatedAt: event.CreatedAt,
+	}
+}
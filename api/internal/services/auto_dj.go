@@ -0,0 +1,486 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// DEFAULT_AUTO_DJ_QUEUE_AHEAD is how many tracks the auto-DJ keeps queued unless the user sets it.
+const DEFAULT_AUTO_DJ_QUEUE_AHEAD = 3
+
+// MAX_AUTO_DJ_QUEUE_AHEAD is the most tracks the auto-DJ keeps queued.
+const MAX_AUTO_DJ_QUEUE_AHEAD = 10
+
+// AUTO_DJ_INTERVAL is how often the auto-DJ checks the queue when the poller has nothing to tell.
+const AUTO_DJ_INTERVAL = 30 * time.Second
+
+// AUTO_DJ_RECENT_PLAYS is how many of the latest plays of the controller seed the recommendations
+// and are not queued again.
+const AUTO_DJ_RECENT_PLAYS = 50
+
+// AUTO_DJ_HISTORY is how many of the tracks it queued the auto-DJ remembers, not to queue them again.
+const AUTO_DJ_HISTORY = 200
+
+// AUTO_DJ_RELATED_ARTISTS is how many related artists the top tracks are taken from when Spotify
+// does not recommend anything.
+const AUTO_DJ_RELATED_ARTISTS = 3
+
+// AutoDjSettings are the settings of the auto-DJ of a user. The energies, from 0 to 1, are left
+// to Spotify when nil.
+type AutoDjSettings struct {
+	Enabled         bool     `json:"enabled"`
+	QueueAhead      int      `json:"queue_ahead"`
+	TargetEnergy    *float64 `json:"target_energy"`
+	MinEnergy       *float64 `json:"min_energy"`
+	MaxEnergy       *float64 `json:"max_energy"`
+	AllowExplicit   bool     `json:"allow_explicit"`
+	BlockedTrackIds []string `json:"blocked_track_ids"`
+}
+
+// AutoDjService keeps tracks queued after the playing track with the Spotify account of the controller,
+// when the user of the controller enabled it. It tops up the queue to the settings' QueueAhead while
+// something plays, and starts playing recommendations when the poller sees the queue run dry. Candidates
+// are recommended by Spotify from the recent plays and the queue, falling back to the top tracks of
+// related artists, and leave out recent plays, tracks already queued and blocked tracks.
+type AutoDjService struct {
+	sessions        repositories.SessionRepository
+	settings        repositories.AutoDjRepository
+	plays           repositories.PlayEventRepository
+	spotifyService  *SpotifyService
+	playbackService *PlaybackService
+	// policies leaves blocked tracks out, and keeps the auto-DJ quiet outside the allowed hours, when set
+	policies *ContentPolicyService
+
+	// wake asks Run to check the queue now
+	wake chan struct{}
+	// fillMu keeps the queue from being topped up twice at once
+	fillMu sync.Mutex
+	mu     sync.Mutex
+	// dry is set when the poller saw the playback end, so that the next fill starts playing
+	dry bool
+	// the tracks the auto-DJ queued, latest last
+	queued []string
+}
+
+func NewAutoDjService(
+	sessions repositories.SessionRepository,
+	settings repositories.AutoDjRepository,
+	plays repositories.PlayEventRepository,
+	spotifyService *SpotifyService,
+	playbackService *PlaybackService,
+) *AutoDjService {
+	return &AutoDjService{
+		sessions:        sessions,
+		settings:        settings,
+		plays:           plays,
+		spotifyService:  spotifyService,
+		playbackService: playbackService,
+		wake:            make(chan struct{}, 1),
+	}
+}
+
+// WithPolicies has the auto-DJ follow the content policies.
+func (s *AutoDjService) WithPolicies(policies *ContentPolicyService) *AutoDjService {
+	s.policies = policies
+	return s
+}
+
+// GetSettings returns the auto-DJ settings of the user, the defaults if they never saved any.
+func (s *AutoDjService) GetSettings(ctx context.Context, userId int64) (*AutoDjSettings, error) {
+	settings, err := s.settings.Get(ctx, userId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return &AutoDjSettings{QueueAhead: DEFAULT_AUTO_DJ_QUEUE_AHEAD, BlockedTrackIds: []string{}}, nil
+	}
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.AUTO_DJ_FAILED, err)
+	}
+	return newAutoDjSettings(settings), nil
+}
+
+// SaveSettings replaces the auto-DJ settings of the user. A QueueAhead of zero is the default.
+func (s *AutoDjService) SaveSettings(ctx context.Context, userId int64, settings AutoDjSettings) (*AutoDjSettings, error) {
+	if settings.QueueAhead == 0 {
+		settings.QueueAhead = DEFAULT_AUTO_DJ_QUEUE_AHEAD
+	}
+	settings.BlockedTrackIds = compactIds(settings.BlockedTrackIds)
+	if err := validateAutoDjSettings(settings); err != nil {
+		return nil, err
+	}
+
+	if err := s.settings.Save(ctx, &models.AutoDjSettings{
+		UserId:          userId,
+		Enabled:         settings.Enabled,
+		QueueAhead:      settings.QueueAhead,
+		TargetEnergy:    settings.TargetEnergy,
+		MinEnergy:       settings.MinEnergy,
+		MaxEnergy:       settings.MaxEnergy,
+		AllowExplicit:   settings.AllowExplicit,
+		BlockedTrackIds: strings.Join(settings.BlockedTrackIds, ","),
+	}); err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.AUTO_DJ_FAILED, err)
+	}
+
+	// the queue is topped up right away once enabled
+	s.Wake()
+	return s.GetSettings(ctx, userId)
+}
+
+// Listen checks the queue whenever the poller sees the track change, and remembers when the playback ran dry.
+func (s *AutoDjService) Listen(poller *PlaybackPoller) {
+	poller.Subscribe(s.onPlayback)
+}
+
+func (s *AutoDjService) onPlayback(event PlaybackEvent) {
+	switch {
+	case event.Type == PLAYBACK_EVENT_TRACK && event.Current.trackId() == "":
+		// the last track ended and nothing followed
+		s.setDry(true)
+	case event.Type == PLAYBACK_EVENT_PAUSE && ranDry(event.Current):
+		s.setDry(true)
+	case event.Type != PLAYBACK_EVENT_TRACK:
+		return
+	default:
+		// something plays again, the queue is only topped up
+		s.setDry(false)
+	}
+	s.Wake()
+}
+
+// ranDry reports whether the playback stopped by itself: Spotify leaves the last track of a list paused
+// at its start or its end.
+func ranDry(current *NowPlaying) bool {
+	if current == nil || current.IsPlaying || current.Track == nil {
+		return false
+	}
+	return current.ProgressMs == 0 || current.remaining() <= SEEK_TOLERANCE
+}
+
+func (s *AutoDjService) setDry(dry bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dry = dry
+}
+
+// isDry reports whether the playback ran dry and the auto-DJ has not started playing since.
+func (s *AutoDjService) isDry() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dry
+}
+
+// Wake asks Run to check the queue without waiting for the interval.
+func (s *AutoDjService) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run tops up the queue when woken up, and every AUTO_DJ_INTERVAL, until ctx is cancelled.
+func (s *AutoDjService) Run(ctx context.Context) {
+	ticker := time.NewTicker(AUTO_DJ_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+
+		if _, err := s.Fill(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.WarnContext(ctx, "auto-DJ did not fill the queue", "error", err)
+		}
+	}
+}
+
+// Fill tops up the queue of the controller to its QueueAhead, and returns how many tracks it queued.
+// It only starts playing when the poller saw the playback run dry, so the auto-DJ never starts music
+// on an idle kiosk, and keeps trying at every fill until it does.
+func (s *AutoDjService) Fill(ctx context.Context) (int, error) {
+	s.fillMu.Lock()
+	defer s.fillMu.Unlock()
+
+	dry := s.isDry()
+	session, err := getController(ctx, s.sessions)
+	if err != nil {
+		if err.Error() == pifyErrors.CONTROLLER_NOT_FOUND {
+			return 0, nil
+		}
+		return 0, err
+	}
+	settings, err := s.GetSettings(ctx, session.UserId)
+	if err != nil || !settings.Enabled {
+		return 0, err
+	}
+
+	rules := &contentRules{}
+	if s.policies != nil {
+		if rules, err = s.policies.rules(ctx); err != nil {
+			return 0, err
+		}
+		if !rules.allowsTime(s.policies.now()) {
+			return 0, nil
+		}
+	}
+
+	accessToken, err := controllerAccessToken(ctx, s.sessions, s.spotifyService)
+	if err != nil {
+		return 0, err
+	}
+	queue, err := s.spotifyService.GetQueue(ctx, accessToken)
+	if err != nil {
+		return 0, err
+	}
+
+	if dry {
+		// the first track plays, the others are queued after it
+		tracks, err := s.candidates(ctx, accessToken, session.UserId, settings, rules, queue, settings.QueueAhead+1)
+		if err != nil || len(tracks) == 0 {
+			return 0, err
+		}
+		if err := s.playbackService.Play(ctx, PlayContextRequest{Uris: trackUris(tracks)}); err != nil {
+			return 0, err
+		}
+		s.setDry(false)
+		s.remember(tracks)
+		slog.InfoContext(ctx, "auto-DJ started playing", "tracks", len(tracks))
+		return len(tracks), nil
+	}
+	if queue.CurrentlyPlaying == nil {
+		return 0, nil
+	}
+
+	needed := settings.QueueAhead - len(queue.Queue)
+	if needed <= 0 {
+		return 0, nil
+	}
+	tracks, err := s.candidates(ctx, accessToken, session.UserId, settings, rules, queue, needed)
+	if err != nil {
+		return 0, err
+	}
+	for i, track := range tracks {
+		if err := s.spotifyService.AddToQueue(ctx, accessToken, "", track.Uri); err != nil {
+			s.remember(tracks[:i])
+			return i, err
+		}
+	}
+	s.remember(tracks)
+	if len(tracks) > 0 {
+		slog.InfoContext(ctx, "auto-DJ queued tracks", "tracks", len(tracks))
+	}
+	return len(tracks), nil
+}
+
+// candidates returns up to count tracks to queue, recommended from the recent plays of the user and
+// the queue, within the settings and the content policies.
+func (s *AutoDjService) candidates(
+	ctx context.Context,
+	accessToken string,
+	userId int64,
+	settings *AutoDjSettings,
+	rules *contentRules,
+	queue *SpotifyQueue,
+	count int,
+) ([]SpotifyTrack, error) {
+	recent, err := s.plays.List(ctx, repositories.PlayFilter{UserId: userId, Limit: AUTO_DJ_RECENT_PLAYS})
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.HISTORY_FAILED, err)
+	}
+
+	excluded := make(map[string]bool)
+	for _, id := range settings.BlockedTrackIds {
+		excluded[id] = true
+	}
+	for _, play := range recent {
+		excluded[play.SpotifyTrackId] = true
+	}
+	queued := queue.Queue
+	if queue.CurrentlyPlaying != nil {
+		queued = append([]SpotifyTrack{*queue.CurrentlyPlaying}, queued...)
+	}
+	for _, track := range queued {
+		excluded[track.Id] = true
+	}
+	s.mu.Lock()
+	for _, id := range s.queued {
+		excluded[id] = true
+	}
+	s.mu.Unlock()
+
+	seedTracks, seedArtists := autoDjSeeds(queued, recent)
+	if len(seedTracks) == 0 && len(seedArtists) == 0 {
+		return nil, nil
+	}
+
+	pick := func(tracks []SpotifyTrack, picked []SpotifyTrack) []SpotifyTrack {
+		for _, track := range tracks {
+			if len(picked) == count {
+				break
+			}
+			if track.Uri == "" || excluded[track.Id] || (track.Explicit && !settings.AllowExplicit) || rules.blocks(trackItem(&track)) {
+				continue
+			}
+			excluded[track.Id] = true
+			picked = append(picked, track)
+		}
+		return picked
+	}
+
+	recommended, err := s.spotifyService.GetRecommendations(ctx, accessToken, RecommendationsRequest{
+		SeedTracks:   seedTracks,
+		SeedArtists:  seedArtists,
+		Limit:        max(count*5, 20),
+		TargetEnergy: settings.TargetEnergy,
+		MinEnergy:    settings.MinEnergy,
+		MaxEnergy:    settings.MaxEnergy,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "auto-DJ recommendations failed, trying related artists", "error", err)
+	}
+	picked := pick(recommended, nil)
+	if len(picked) == count || len(seedArtists) == 0 {
+		return picked, nil
+	}
+
+	// the energy of the top tracks of related artists is not known, they are only picked when Spotify
+	// does not recommend enough
+	related, err := s.spotifyService.GetRelatedArtists(ctx, accessToken, seedArtists[0])
+	if err != nil {
+		if len(picked) > 0 {
+			return picked, nil
+		}
+		return nil, err
+	}
+	for _, artist := range related[:min(len(related), AUTO_DJ_RELATED_ARTISTS)] {
+		tracks, err := s.spotifyService.GetArtistTopTracks(ctx, accessToken, artist.Id)
+		if err != nil {
+			return picked, nil
+		}
+		if picked = pick(tracks, picked); len(picked) == count {
+			break
+		}
+	}
+	return picked, nil
+}
+
+// remember adds the tracks to the tracks queued by the auto-DJ, forgetting the oldest past AUTO_DJ_HISTORY.
+func (s *AutoDjService) remember(tracks []SpotifyTrack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, track := range tracks {
+		s.queued = append(s.queued, track.Id)
+	}
+	if len(s.queued) > AUTO_DJ_HISTORY {
+		s.queued = slices.Clone(s.queued[len(s.queued)-AUTO_DJ_HISTORY:])
+	}
+}
+
+// autoDjSeeds returns the seeds of the recommendations: up to 3 tracks, the latest queued first then
+// the latest played, and the artists played most recently, up to MAX_RECOMMENDATION_SEEDS in all.
+func autoDjSeeds(queued []SpotifyTrack, recent []*models.PlayEvent) ([]string, []string) {
+	var tracks []string
+	addTrack := func(id string) {
+		if id != "" && len(tracks) < 3 && !slices.Contains(tracks, id) {
+			tracks = append(tracks, id)
+		}
+	}
+	for i := len(queued) - 1; i >= 0; i-- {
+		addTrack(queued[i].Id)
+	}
+	for _, play := range recent {
+		addTrack(play.SpotifyTrackId)
+	}
+
+	// artists of the playing track first, then by plays
+	plays := make(map[string]int)
+	var artists []string
+	for _, track := range queued {
+		for _, id := range artistIds(track.Artists) {
+			if plays[id] == 0 {
+				artists = append(artists, id)
+			}
+			plays[id] += len(recent) + 1
+		}
+	}
+	for _, play := range recent {
+		for _, id := range playArtistIds(play) {
+			if plays[id] == 0 {
+				artists = append(artists, id)
+			}
+			plays[id]++
+		}
+	}
+	sort.SliceStable(artists, func(i, j int) bool {
+		return plays[artists[i]] > plays[artists[j]]
+	})
+	return tracks, artists[:min(len(artists), MAX_RECOMMENDATION_SEEDS-len(tracks))]
+}
+
+func validateAutoDjSettings(settings AutoDjSettings) error {
+	invalid := errors.New(pifyErrors.INVALID_AUTO_DJ_SETTINGS)
+
+	if settings.QueueAhead < 1 || settings.QueueAhead > MAX_AUTO_DJ_QUEUE_AHEAD {
+		return invalid
+	}
+	for _, energy := range []*float64{settings.TargetEnergy, settings.MinEnergy, settings.MaxEnergy} {
+		if energy != nil && (*energy < 0 || *energy > 1) {
+			return invalid
+		}
+	}
+	if settings.MinEnergy != nil && settings.MaxEnergy != nil && *settings.MinEnergy > *settings.MaxEnergy {
+		return invalid
+	}
+	for _, id := range settings.BlockedTrackIds {
+		if strings.ContainsAny(id, ",: ") {
+			return invalid
+		}
+	}
+	return nil
+}
+
+func newAutoDjSettings(settings *models.AutoDjSettings) *AutoDjSettings {
+	return &AutoDjSettings{
+		Enabled:         settings.Enabled,
+		QueueAhead:      settings.QueueAhead,
+		TargetEnergy:    settings.TargetEnergy,
+		MinEnergy:       settings.MinEnergy,
+		MaxEnergy:       settings.MaxEnergy,
+		AllowExplicit:   settings.AllowExplicit,
+		BlockedTrackIds: compactIds(strings.Split(settings.BlockedTrackIds, ",")),
+	}
+}
+
+// compactIds returns the ids trimmed, without empty and duplicate ids.
+func compactIds(ids []string) []string {
+	compacted := []string{}
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id != "" && !slices.Contains(compacted, id) {
+			compacted = append(compacted, id)
+		}
+	}
+	return compacted
+}
+
+func trackUris(tracks []SpotifyTrack) []string {
+	uris := make([]string, len(tracks))
+	for i, track := range tracks {
+		uris[i] = track.Uri
+	}
+	return uris
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+func djTrack(id, artistId string, explicit bool) SpotifyTrack {
+	return SpotifyTrack{
+		Id:         id,
+		Name:       strings.ToUpper(id),
+		Uri:        "spotify:track:" + id,
+		DurationMs: 200000,
+		Explicit:   explicit,
+		Artists:    []SpotifySimpleArtist{{Id: artistId, Name: artistId}},
+	}
+}
+
+// fakeDjSpotify is the playback of the controller as the auto-DJ sees it.
+type fakeDjSpotify struct {
+	mu          sync.Mutex
+	current     *SpotifyTrack
+	queue       []SpotifyTrack
+	recommended []SpotifyTrack
+	// recommendations fail with this status when set
+	recommendStatus int
+	// reading the queue fails with this status when set
+	queueStatus int
+	// query of the latest recommendations request
+	recommendQuery map[string]string
+	played         []string
+}
+
+func (f *fakeDjSpotify) handle(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/v1/me/player/queue" && r.Method == http.MethodGet:
+			if f.queueStatus != 0 {
+				w.WriteHeader(f.queueStatus)
+				return
+			}
+			json.NewEncoder(w).Encode(SpotifyQueue{CurrentlyPlaying: f.current, Queue: f.queue})
+		case r.URL.Path == "/v1/me/player/queue" && r.Method == http.MethodPost:
+			uri := r.URL.Query().Get("uri")
+			f.queue = append(f.queue, djTrack(strings.TrimPrefix(uri, "spotify:track:"), "", false))
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/v1/recommendations":
+			f.recommendQuery = map[string]string{}
+			for name := range r.URL.Query() {
+				f.recommendQuery[name] = r.URL.Query().Get(name)
+			}
+			if f.recommendStatus != 0 {
+				w.WriteHeader(f.recommendStatus)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"tracks": f.recommended})
+		case r.URL.Path == "/v1/artists/a1/related-artists":
+			fmt.Fprint(w, `{"artists": [{"id": "r1", "name": "Related"}]}`)
+		case r.URL.Path == "/v1/artists/r1/top-tracks":
+			assert.Equal(t, "from_token", r.URL.Query().Get("market"))
+			json.NewEncoder(w).Encode(map[string]any{"tracks": []SpotifyTrack{djTrack("top1", "r1", false), djTrack("top2", "r1", true)}})
+		case r.URL.Path == "/v1/me/player/devices":
+			fmt.Fprint(w, `{"devices": [{"id": "kiosk-id", "name": "Pify Player"}]}`)
+		case r.URL.Path == "/v1/me/player/play":
+			var req PlayContextRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			f.played = req.Uris
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+// newTestAutoDjService returns an auto-DJ of alice, the controller, who recently played p1 and p2 by a1.
+func newTestAutoDjService(t *testing.T) (*AutoDjService, *fakeDjSpotify, int64) {
+	t.Helper()
+	ctx := context.Background()
+
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+	session, err := store.Sessions().Get(ctx, "kiosk")
+	require.NoError(t, err)
+	for i, id := range []string{"p1", "p2"} {
+		_, err := store.Plays().Add(ctx, &models.PlayEvent{
+			UserId:         session.UserId,
+			SpotifyTrackId: id,
+			ArtistIds:      "a1",
+			PlayedAt:       time.Date(2026, 10, 19, 10, i, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+	}
+
+	fake := &fakeDjSpotify{}
+	spotifyService := newTestSpotifyService(t, fake.handle(t))
+	playbackService := NewPlaybackService(store.Sessions(), spotifyService, "Pify Player")
+	service := NewAutoDjService(store.Sessions(), store.AutoDj(), store.Plays(), spotifyService, playbackService)
+	return service, fake, session.UserId
+}
+
+func TestAutoDjSettings(t *testing.T) {
+	service, _, userId := newTestAutoDjService(t)
+	ctx := context.Background()
+
+	settings, err := service.GetSettings(ctx, userId)
+	require.NoError(t, err)
+	assert.Equal(t, &AutoDjSettings{QueueAhead: DEFAULT_AUTO_DJ_QUEUE_AHEAD, BlockedTrackIds: []string{}}, settings)
+
+	low, high := 0.2, 0.8
+	settings, err = service.SaveSettings(ctx, userId, AutoDjSettings{
+		Enabled:         true,
+		MinEnergy:       &low,
+		MaxEnergy:       &high,
+		BlockedTrackIds: []string{" t1", "t2", "", "t1"},
+	})
+	require.NoError(t, err)
+	assert.True(t, settings.Enabled)
+	assert.Equal(t, DEFAULT_AUTO_DJ_QUEUE_AHEAD, settings.QueueAhead)
+	assert.Equal(t, 0.2, *settings.MinEnergy)
+	assert.Equal(t, []string{"t1", "t2"}, settings.BlockedTrackIds)
+
+	for name, invalid := range map[string]AutoDjSettings{
+		"queue ahead":      {QueueAhead: MAX_AUTO_DJ_QUEUE_AHEAD + 1},
+		"energy":           {TargetEnergy: &[]float64{1.5}[0]},
+		"energy range":     {MinEnergy: &high, MaxEnergy: &low},
+		"blocked track id": {BlockedTrackIds: []string{"spotify:track:t1"}},
+	} {
+		_, err := service.SaveSettings(ctx, userId, invalid)
+		assert.EqualError(t, err, pifyErrors.INVALID_AUTO_DJ_SETTINGS, name)
+	}
+}
+
+func TestAutoDjFill(t *testing.T) {
+	service, fake, userId := newTestAutoDjService(t)
+	ctx := context.Background()
+
+	current := djTrack("c1", "a2", false)
+	fake.current = &current
+	fake.queue = []SpotifyTrack{djTrack("q1", "a2", false)}
+	fake.recommended = []SpotifyTrack{
+		djTrack("p1", "a1", false),
+		djTrack("x1", "a3", true),
+		djTrack("b1", "a3", false),
+		djTrack("q1", "a2", false),
+		djTrack("n1", "a3", false),
+		djTrack("n2", "a3", false),
+		djTrack("n3", "a3", false),
+	}
+
+	// disabled
+	queued, err := service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, queued)
+
+	energy := 0.6
+	_, err = service.SaveSettings(ctx, userId, AutoDjSettings{Enabled: true, TargetEnergy: &energy, BlockedTrackIds: []string{"b1"}})
+	require.NoError(t, err)
+
+	// recent plays, explicit, blocked and queued tracks are left out
+	queued, err = service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, queued)
+	assert.Equal(t, []string{"q1", "n1", "n2"}, trackIds(fake.queue))
+	assert.Equal(t, "q1,c1,p2", fake.recommendQuery["seed_tracks"])
+	assert.Equal(t, "a2,a1", fake.recommendQuery["seed_artists"])
+	assert.Equal(t, "0.6", fake.recommendQuery["target_energy"])
+	assert.Empty(t, fake.recommendQuery["min_energy"])
+
+	// the queue is full
+	queued, err = service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, queued)
+
+	// tracks it queued before are not queued again, unlike q1 the user queued
+	fake.queue = nil
+	queued, err = service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, queued)
+	assert.Equal(t, []string{"q1", "n3"}, trackIds(fake.queue))
+}
+
+func TestAutoDjFillRelatedArtists(t *testing.T) {
+	service, fake, userId := newTestAutoDjService(t)
+	ctx := context.Background()
+
+	_, err := service.SaveSettings(ctx, userId, AutoDjSettings{Enabled: true, QueueAhead: 2})
+	require.NoError(t, err)
+	current := djTrack("c1", "a1", false)
+	fake.current = &current
+	fake.recommendStatus = http.StatusNotFound
+
+	queued, err := service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, queued)
+	assert.Equal(t, []string{"top1"}, trackIds(fake.queue))
+}
+
+func TestAutoDjRunsDry(t *testing.T) {
+	service, fake, userId := newTestAutoDjService(t)
+	ctx := context.Background()
+
+	_, err := service.SaveSettings(ctx, userId, AutoDjSettings{Enabled: true, QueueAhead: 1})
+	require.NoError(t, err)
+	fake.recommended = []SpotifyTrack{djTrack("n1", "a3", false), djTrack("n2", "a3", false), djTrack("n3", "a3", false)}
+
+	// nothing plays, the auto-DJ does not start music on its own
+	queued, err := service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, queued)
+	assert.Empty(t, fake.played)
+
+	// the poller saw the last track end, while Spotify fails
+	fake.queueStatus = http.StatusBadGateway
+	last := &NowPlaying{Active: true, IsPlaying: true, Track: &CatalogItem{Id: "p2", DurationMs: 200000}}
+	service.onPlayback(PlaybackEvent{Type: PLAYBACK_EVENT_TRACK, Previous: last, At: time.Now()})
+	_, err = service.Fill(ctx)
+	require.Error(t, err)
+	assert.True(t, service.isDry())
+
+	// the next fill tries again
+	fake.queueStatus = 0
+	queued, err = service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, queued)
+	assert.Equal(t, []string{"spotify:track:n1", "spotify:track:n2"}, fake.played)
+	assert.False(t, service.isDry())
+
+	// a pause halfway through is the user's
+	paused := &NowPlaying{Active: true, Track: &CatalogItem{Id: "n2", DurationMs: 200000}, ProgressMs: 100000}
+	service.onPlayback(PlaybackEvent{Type: PLAYBACK_EVENT_PAUSE, Previous: last, Current: paused, At: time.Now()})
+	assert.False(t, service.isDry())
+	paused.ProgressMs = 199000
+	service.onPlayback(PlaybackEvent{Type: PLAYBACK_EVENT_PAUSE, Previous: last, Current: paused, At: time.Now()})
+	assert.True(t, service.isDry())
+
+	// the user plays something
+	playing := &NowPlaying{Active: true, IsPlaying: true, Track: &CatalogItem{Id: "u1", DurationMs: 200000}}
+	service.onPlayback(PlaybackEvent{Type: PLAYBACK_EVENT_TRACK, Previous: paused, Current: playing, At: time.Now()})
+	assert.False(t, service.isDry())
+}
+
+func TestAutoDjFollowsPolicies(t *testing.T) {
+	service, fake, userId := newTestAutoDjService(t)
+	ctx := context.Background()
+
+	store := repositories.NewMemoryStore()
+	policies := NewContentPolicyService(store.Policies(), store.Users(), service.sessions, service.spotifyService, NewAuditService(store.Audit()))
+	policies.now = func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local) }
+	service.WithPolicies(policies)
+	_, err := policies.Save(ctx, "alice", "", ContentPolicy{BlockExplicit: true, BlockedArtistIds: []string{"a3"}, AllowedFrom: "07:00", AllowedUntil: "20:00"})
+	require.NoError(t, err)
+
+	// the policies win over the settings
+	_, err = service.SaveSettings(ctx, userId, AutoDjSettings{Enabled: true, QueueAhead: 2, AllowExplicit: true})
+	require.NoError(t, err)
+	current := djTrack("c1", "a2", false)
+	fake.current = &current
+	fake.recommended = []SpotifyTrack{
+		djTrack("n1", "a3", false),
+		djTrack("x1", "a4", true),
+		djTrack("n2", "a4", false),
+		djTrack("n3", "a4", false),
+	}
+
+	queued, err := service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, queued)
+	assert.Equal(t, []string{"n2", "n3"}, trackIds(fake.queue))
+
+	// nothing is queued outside the allowed hours
+	policies.now = func() time.Time { return time.Date(2026, 10, 19, 21, 0, 0, 0, time.Local) }
+	fake.queue = nil
+	queued, err = service.Fill(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, queued)
+}
+
+func TestAutoDjSeeds(t *testing.T) {
+	recent := []*models.PlayEvent{
+		{SpotifyTrackId: "p1", ArtistIds: "a1,a2"},
+		{SpotifyTrackId: "p2", ArtistIds: "a2"},
+		{SpotifyTrackId: "p1", ArtistIds: "a1,a2"},
+	}
+
+	tracks, artists := autoDjSeeds(nil, recent)
+	assert.Equal(t, []string{"p1", "p2"}, tracks)
+	assert.Equal(t, []string{"a2", "a1"}, artists)
+
+	// the queue comes first, and seeds are at most MAX_RECOMMENDATION_SEEDS
+	queued := []SpotifyTrack{djTrack("c1", "a9", false), djTrack("q1", "a8", false)}
+	tracks, artists = autoDjSeeds(queued, recent)
+	assert.Equal(t, []string{"q1", "c1", "p1"}, tracks)
+	assert.Equal(t, []string{"a9", "a8"}, artists)
+}
+
+func trackIds(tracks []SpotifyTrack) []string {
+	ids := make([]string, len(tracks))
+	for i, track := range tracks {
+		ids[i] = track.Id
+	}
+	return ids
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+)
+
+const (
+	BACKUP_FILE_PREFIX = "pify-"
+	BACKUP_FILE_SUFFIX = ".sqlite3"
+)
+
+// BackupService periodically copies the database into a backup folder, keeping the most recent backups.
+type BackupService struct {
+	db        *database.DB
+	dir       string
+	retention int
+}
+
+func NewBackupService(db *database.DB, dir string, retention int) *BackupService {
+	return &BackupService{db, dir, retention}
+}
+
+// Run creates a backup every interval until ctx is cancelled.
+func (s *BackupService) Run(ctx context.Context, interval time.Duration) {
+	slog.InfoContext(ctx, "database backups enabled", "dir", s.dir, "interval", interval, "retention", s.retention)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Backup(ctx); err != nil {
+				slog.ErrorContext(ctx, "database backup failed", "error", err)
+			}
+		}
+	}
+}
+
+// Backup writes a new backup named after the current time and removes backups beyond the retention.
+func (s *BackupService) Backup(ctx context.Context) (string, error) {
+	file := filepath.Join(s.dir, BACKUP_FILE_PREFIX+time.Now().UTC().Format("20060102-150405")+BACKUP_FILE_SUFFIX)
+	if err := s.db.Backup(ctx, file); err != nil {
+		return "", err
+	}
+	slog.InfoContext(ctx, "database backup created", "file", file)
+
+	return file, s.prune(ctx)
+}
+
+// prune removes the oldest backups so that at most retention backups are kept.
+func (s *BackupService) prune(ctx context.Context) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, BACKUP_FILE_PREFIX) && strings.HasSuffix(name, BACKUP_FILE_SUFFIX) {
+			backups = append(backups, name)
+		}
+	}
+
+	// names embed the creation time, so lexical order is chronological
+	sort.Strings(backups)
+	for len(backups) > s.retention {
+		file := filepath.Join(s.dir, backups[0])
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("remove old backup: %w", err)
+		}
+		slog.InfoContext(ctx, "old database backup removed", "file", file)
+		backups = backups[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+)
+
+func TestBackupRetention(t *testing.T) {
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "db.sqlite3"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	dir := t.TempDir()
+	// older backups and unrelated files in the folder
+	for _, name := range []string{"pify-20240101-000000.sqlite3", "pify-20240102-000000.sqlite3", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	file, err := NewBackupService(db, dir, 2).Backup(context.Background())
+	require.NoError(t, err)
+	assert.FileExists(t, file)
+
+	assert.NoFileExists(t, filepath.Join(dir, "pify-20240101-000000.sqlite3"))
+	assert.FileExists(t, filepath.Join(dir, "pify-20240102-000000.sqlite3"))
+	assert.FileExists(t, filepath.Join(dir, "notes.txt"))
+}
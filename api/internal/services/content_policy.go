@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// HOUSEHOLD_POLICY is the subject of the audit events of the policy of the household.
+const HOUSEHOLD_POLICY = "household"
+
+// ContentPolicy restricts what plays on the player. The policy of the household, without username,
+// applies to everyone, the policy of a user only while the user is the controller. The allowed hours
+// are "HH:MM" local times of the api, any time when both are empty, and wrap past midnight when
+// AllowedFrom is after AllowedUntil.
+type ContentPolicy struct {
+	Username         string     `json:"username,omitempty"`
+	BlockExplicit    bool       `json:"block_explicit"`
+	BlockedArtistIds []string   `json:"blocked_artist_ids"`
+	BlockedTrackIds  []string   `json:"blocked_track_ids"`
+	AllowedFrom      string     `json:"allowed_from"`
+	AllowedUntil     string     `json:"allowed_until"`
+	UpdatedBy        string     `json:"updated_by,omitempty"`
+	UpdatedAt        *time.Time `json:"updated_at,omitempty"`
+}
+
+// ContentPolicyService keeps the content policies edited by the owners of the household, and enforces
+// them: the playback service and the auto-DJ check what they play, and the poller's tracks started from
+// the Spotify app are skipped, or paused outside the allowed hours.
+type ContentPolicyService struct {
+	policies       repositories.ContentPolicyRepository
+	users          repositories.UserRepository
+	sessions       repositories.SessionRepository
+	spotifyService *SpotifyService
+	auditService   *AuditService
+	now            func() time.Time
+}
+
+func NewContentPolicyService(
+	policies repositories.ContentPolicyRepository,
+	users repositories.UserRepository,
+	sessions repositories.SessionRepository,
+	spotifyService *SpotifyService,
+	auditService *AuditService,
+) *ContentPolicyService {
+	return &ContentPolicyService{
+		policies:       policies,
+		users:          users,
+		sessions:       sessions,
+		spotifyService: spotifyService,
+		auditService:   auditService,
+		now:            time.Now,
+	}
+}
+
+// List returns the policy of the household first, an empty one if it was never saved, then the
+// policies of users by user id.
+func (s *ContentPolicyService) List(ctx context.Context) ([]ContentPolicy, error) {
+	saved, err := s.policies.List(ctx)
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+	}
+	users, err := s.users.List(ctx)
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+	}
+	usernames := make(map[int64]string, len(users))
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+
+	policies := []ContentPolicy{{BlockedArtistIds: []string{}, BlockedTrackIds: []string{}}}
+	for _, policy := range saved {
+		if policy.UserId == 0 {
+			policies[0] = newContentPolicy(policy, "")
+		} else if username, ok := usernames[policy.UserId]; ok {
+			// policies of deleted users no longer apply
+			policies = append(policies, newContentPolicy(policy, username))
+		}
+	}
+	return policies, nil
+}
+
+// Save replaces the policy of the user with the given username, of the household if it is empty,
+// and records the change in the audit log under the username of the owner.
+func (s *ContentPolicyService) Save(ctx context.Context, owner, username string, policy ContentPolicy) (*ContentPolicy, error) {
+	policy.BlockedArtistIds = compactIds(policy.BlockedArtistIds)
+	policy.BlockedTrackIds = compactIds(policy.BlockedTrackIds)
+	policy.AllowedFrom = strings.TrimSpace(policy.AllowedFrom)
+	policy.AllowedUntil = strings.TrimSpace(policy.AllowedUntil)
+	if err := validateContentPolicy(policy); err != nil {
+		return nil, err
+	}
+	userId, err := s.userId(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.policies.Save(ctx, &models.ContentPolicy{
+		UserId:           userId,
+		BlockExplicit:    policy.BlockExplicit,
+		BlockedArtistIds: strings.Join(policy.BlockedArtistIds, ","),
+		BlockedTrackIds:  strings.Join(policy.BlockedTrackIds, ","),
+		AllowedFrom:      policy.AllowedFrom,
+		AllowedUntil:     policy.AllowedUntil,
+		UpdatedBy:        owner,
+	}); err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+	}
+	details := fmt.Sprintf(
+		"block_explicit=%t blocked_artists=%d blocked_tracks=%d allowed=%s-%s",
+		policy.BlockExplicit, len(policy.BlockedArtistIds), len(policy.BlockedTrackIds), policy.AllowedFrom, policy.AllowedUntil,
+	)
+	if err := s.auditService.Record(ctx, models.AUDIT_ACTION_POLICY_CHANGED, owner, policySubject(username), details); err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+	}
+
+	saved, err := s.policies.Get(ctx, userId)
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+	}
+	savedPolicy := newContentPolicy(saved, username)
+	return &savedPolicy, nil
+}
+
+// Delete deletes the policy of the user, leaving only the policy of the household to apply to them,
+// and records it in the audit log under the username of the owner.
+func (s *ContentPolicyService) Delete(ctx context.Context, owner, username string) error {
+	userId, err := s.userId(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err := s.policies.Delete(ctx, userId); err != nil {
+		return pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+	}
+	if err := s.auditService.Record(ctx, models.AUDIT_ACTION_POLICY_DELETED, owner, policySubject(username), ""); err != nil {
+		return pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+	}
+	return nil
+}
+
+// userId returns the id of the user with the given username, 0 for the household.
+func (s *ContentPolicyService) userId(ctx context.Context, username string) (int64, error) {
+	if username == "" {
+		return 0, nil
+	}
+	user, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return 0, errors.New(pifyErrors.USER_NOT_FOUND)
+	}
+	if err != nil {
+		return 0, pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+	}
+	return user.Id, nil
+}
+
+// CheckPlay fails with CONTENT_BLOCKED if req plays outside the allowed hours, plays an artist that is
+// blocked, or plays tracks that are blocked. Albums and playlists are left to the poller, which skips
+// their blocked tracks as they come up.
+func (s *ContentPolicyService) CheckPlay(ctx context.Context, accessToken string, req PlayContextRequest) error {
+	rules, err := s.rules(ctx)
+	if err != nil {
+		return err
+	}
+	blocked := errors.New(pifyErrors.CONTENT_BLOCKED)
+
+	if !rules.allowsTime(s.now()) {
+		return blocked
+	}
+	if artistId, ok := strings.CutPrefix(req.ContextUri, "spotify:artist:"); ok && rules.artists[artistId] {
+		return blocked
+	}
+
+	var trackIds []string
+	for _, uri := range req.Uris {
+		if id, ok := strings.CutPrefix(uri, "spotify:track:"); ok {
+			if rules.tracks[id] {
+				return blocked
+			}
+			trackIds = append(trackIds, id)
+		}
+	}
+	if len(trackIds) == 0 || (!rules.blockExplicit && len(rules.artists) == 0) {
+		return nil
+	}
+	tracks, err := s.spotifyService.GetTracks(ctx, accessToken, trackIds)
+	if err != nil {
+		return err
+	}
+	for _, track := range tracks {
+		if rules.blocks(trackItem(&track)) {
+			return blocked
+		}
+	}
+	return nil
+}
+
+// Listen enforces the policies on what the poller sees playing, such as tracks started from the Spotify app.
+func (s *ContentPolicyService) Listen(poller *PlaybackPoller) {
+	poller.Subscribe(s.onPlayback)
+}
+
+func (s *ContentPolicyService) onPlayback(event PlaybackEvent) {
+	current := event.Current
+	if current == nil || !current.IsPlaying || current.Track == nil {
+		return
+	}
+	// a new track, or a track resumed that may have become out of hours
+	if event.Type != PLAYBACK_EVENT_TRACK && event.Type != PLAYBACK_EVENT_PAUSE {
+		return
+	}
+
+	// the poller must not wait for Spotify
+	go func() {
+		ctx := context.Background()
+		if err := s.Enforce(ctx, *current); err != nil {
+			slog.WarnContext(ctx, "content policy not enforced", "track_id", current.Track.Id, "error", err)
+		}
+	}()
+}
+
+// Enforce pauses the playback outside the allowed hours, and skips to the next track if the playing
+// track is blocked.
+func (s *ContentPolicyService) Enforce(ctx context.Context, playing NowPlaying) error {
+	rules, err := s.rules(ctx)
+	if err != nil {
+		return err
+	}
+	allowed := rules.allowsTime(s.now())
+	if allowed && (playing.Track == nil || !rules.blocks(*playing.Track)) {
+		return nil
+	}
+
+	accessToken, err := controllerAccessToken(ctx, s.sessions, s.spotifyService)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		slog.InfoContext(ctx, "pausing playback outside the allowed hours")
+		return s.spotifyService.Pause(ctx, accessToken, playing.DeviceId)
+	}
+	slog.InfoContext(ctx, "skipping blocked track", "track_id", playing.Track.Id)
+	return s.spotifyService.SkipToNext(ctx, accessToken, playing.DeviceId)
+}
+
+// contentRules are the policies that apply at once, merged: content is blocked if any policy blocks it.
+type contentRules struct {
+	blockExplicit bool
+	artists       map[string]bool
+	tracks        map[string]bool
+	// allowed hours of each policy that restricts them, in minutes since midnight
+	hours [][2]int
+}
+
+// rules returns the merged policies of the household and of the controller.
+func (s *ContentPolicyService) rules(ctx context.Context) (*contentRules, error) {
+	userIds := []int64{0}
+	session, err := getController(ctx, s.sessions)
+	if err == nil {
+		userIds = append(userIds, session.UserId)
+	} else if err.Error() != pifyErrors.CONTROLLER_NOT_FOUND {
+		return nil, err
+	}
+
+	rules := &contentRules{artists: make(map[string]bool), tracks: make(map[string]bool)}
+	for _, userId := range userIds {
+		policy, err := s.policies.Get(ctx, userId)
+		if errors.Is(err, repositories.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, pifyErrors.Wrap(pifyErrors.CONTENT_POLICY_FAILED, err)
+		}
+
+		rules.blockExplicit = rules.blockExplicit || policy.BlockExplicit
+		for _, id := range compactIds(strings.Split(policy.BlockedArtistIds, ",")) {
+			rules.artists[id] = true
+		}
+		for _, id := range compactIds(strings.Split(policy.BlockedTrackIds, ",")) {
+			rules.tracks[id] = true
+		}
+		if policy.AllowedFrom != "" {
+			from, _ := parseMinutes(policy.AllowedFrom)
+			until, _ := parseMinutes(policy.AllowedUntil)
+			rules.hours = append(rules.hours, [2]int{from, until})
+		}
+	}
+	return rules, nil
+}
+
+// blocks reports whether the track is explicit while explicit content is blocked, or the track or one
+// of its artists is blocked.
+func (r *contentRules) blocks(track CatalogItem) bool {
+	if (track.Explicit && r.blockExplicit) || r.tracks[track.Id] {
+		return true
+	}
+	for _, id := range track.ArtistIds {
+		if r.artists[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsTime reports whether t is within the allowed hours of every policy.
+func (r *contentRules) allowsTime(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	for _, hours := range r.hours {
+		from, until := hours[0], hours[1]
+		if from <= until && (minutes < from || minutes >= until) {
+			return false
+		}
+		if from > until && minutes < from && minutes >= until {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMinutes returns the minutes since midnight of a "HH:MM" time.
+func parseMinutes(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func validateContentPolicy(policy ContentPolicy) error {
+	invalid := errors.New(pifyErrors.INVALID_CONTENT_POLICY)
+
+	for _, id := range append(policy.BlockedArtistIds, policy.BlockedTrackIds...) {
+		if strings.ContainsAny(id, ",: ") {
+			return invalid
+		}
+	}
+	if policy.AllowedFrom == "" && policy.AllowedUntil == "" {
+		return nil
+	}
+	from, err := parseMinutes(policy.AllowedFrom)
+	if err != nil {
+		return invalid
+	}
+	until, err := parseMinutes(policy.AllowedUntil)
+	if err != nil || from == until {
+		return invalid
+	}
+	return nil
+}
+
+func newContentPolicy(policy *models.ContentPolicy, username string) ContentPolicy {
+	updatedAt := policy.UpdatedAt
+	return ContentPolicy{
+		Username:         username,
+		BlockExplicit:    policy.BlockExplicit,
+		BlockedArtistIds: compactIds(strings.Split(policy.BlockedArtistIds, ",")),
+		BlockedTrackIds:  compactIds(strings.Split(policy.BlockedTrackIds, ",")),
+		AllowedFrom:      policy.AllowedFrom,
+		AllowedUntil:     policy.AllowedUntil,
+		UpdatedBy:        policy.UpdatedBy,
+		UpdatedAt:        &updatedAt,
+	}
+}
+
+// policySubject returns the subject of the audit events of the policy of the user, of the household
+// if username is empty.
+func policySubject(username string) string {
+	if username == "" {
+		return HOUSEHOLD_POLICY
+	}
+	return "user:" + username
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// fakePolicySpotify knows tracks by id, and records the player requests of the policy service.
+type fakePolicySpotify struct {
+	mu       sync.Mutex
+	tracks   map[string]SpotifyTrack
+	requests []string
+}
+
+func (f *fakePolicySpotify) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/tracks":
+		var tracks []*SpotifyTrack
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if track, ok := f.tracks[id]; ok {
+				tracks = append(tracks, &track)
+			} else {
+				tracks = append(tracks, nil)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"tracks": tracks})
+	case "/v1/me/player/next", "/v1/me/player/pause":
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestContentPolicyService returns the policies of alice, the controller, and bob, at 12:00.
+func newTestContentPolicyService(t *testing.T) (*ContentPolicyService, *fakePolicySpotify, *repositories.MemoryStore) {
+	t.Helper()
+
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+	_, err := store.Users().Upsert(context.Background(), &models.User{Username: "bob"})
+	require.NoError(t, err)
+
+	fake := &fakePolicySpotify{tracks: map[string]SpotifyTrack{
+		"clean":    djTrack("clean", "a1", false),
+		"explicit": djTrack("explicit", "a1", true),
+		"banned":   djTrack("banned", "a2", false),
+	}}
+	service := NewContentPolicyService(store.Policies(), store.Users(), store.Sessions(), newTestSpotifyService(t, fake.handle), NewAuditService(store.Audit()))
+	service.now = func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local) }
+	return service, fake, store
+}
+
+func TestContentPolicySave(t *testing.T) {
+	service, _, store := newTestContentPolicyService(t)
+	ctx := context.Background()
+
+	policies, err := service.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []ContentPolicy{{BlockedArtistIds: []string{}, BlockedTrackIds: []string{}}}, policies)
+
+	policy, err := service.Save(ctx, "alice", "", ContentPolicy{BlockExplicit: true, AllowedFrom: " 07:00", AllowedUntil: "20:30"})
+	require.NoError(t, err)
+	assert.True(t, policy.BlockExplicit)
+	assert.Equal(t, "07:00", policy.AllowedFrom)
+	assert.Equal(t, "alice", policy.UpdatedBy)
+
+	policy, err = service.Save(ctx, "alice", "bob", ContentPolicy{BlockedArtistIds: []string{"a2", "", "a2"}})
+	require.NoError(t, err)
+	assert.Equal(t, "bob", policy.Username)
+	assert.Equal(t, []string{"a2"}, policy.BlockedArtistIds)
+
+	policies, err = service.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.Empty(t, policies[0].Username)
+	assert.True(t, policies[0].BlockExplicit)
+	assert.Equal(t, "bob", policies[1].Username)
+
+	_, err = service.Save(ctx, "alice", "carol", ContentPolicy{})
+	assert.EqualError(t, err, pifyErrors.USER_NOT_FOUND)
+	for name, invalid := range map[string]ContentPolicy{
+		"uri":          {BlockedTrackIds: []string{"spotify:track:t1"}},
+		"until only":   {AllowedUntil: "20:00"},
+		"no time":      {AllowedFrom: "7am", AllowedUntil: "20:00"},
+		"out of range": {AllowedFrom: "07:00", AllowedUntil: "24:00"},
+		"empty range":  {AllowedFrom: "07:00", AllowedUntil: "07:00"},
+	} {
+		_, err := service.Save(ctx, "alice", "", invalid)
+		assert.EqualError(t, err, pifyErrors.INVALID_CONTENT_POLICY, name)
+	}
+
+	require.NoError(t, service.Delete(ctx, "alice", "bob"))
+	policies, err = service.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	events, err := store.Audit().List(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, models.AUDIT_ACTION_POLICY_DELETED, events[0].Action)
+	assert.Equal(t, "user:bob", events[0].Subject)
+	assert.Equal(t, models.AUDIT_ACTION_POLICY_CHANGED, events[2].Action)
+	assert.Equal(t, "alice", events[2].Actor)
+	assert.Equal(t, HOUSEHOLD_POLICY, events[2].Subject)
+}
+
+func TestContentPolicyCheckPlay(t *testing.T) {
+	service, _, _ := newTestContentPolicyService(t)
+	ctx := context.Background()
+
+	play := func(uris ...string) error {
+		return service.CheckPlay(ctx, "access-token", PlayContextRequest{Uris: uris})
+	}
+	assert.NoError(t, play("spotify:track:explicit"))
+
+	_, err := service.Save(ctx, "alice", "", ContentPolicy{BlockExplicit: true, BlockedTrackIds: []string{"t9"}})
+	require.NoError(t, err)
+	// the policy of alice applies while she is the controller, the one of bob does not
+	_, err = service.Save(ctx, "alice", "alice", ContentPolicy{BlockedArtistIds: []string{"a2"}})
+	require.NoError(t, err)
+	_, err = service.Save(ctx, "alice", "bob", ContentPolicy{BlockedArtistIds: []string{"a1"}})
+	require.NoError(t, err)
+
+	assert.NoError(t, play("spotify:track:clean", "spotify:track:unknown"))
+	assert.EqualError(t, play("spotify:track:clean", "spotify:track:explicit"), pifyErrors.CONTENT_BLOCKED)
+	assert.EqualError(t, play("spotify:track:banned"), pifyErrors.CONTENT_BLOCKED)
+	assert.EqualError(t, play("spotify:track:t9"), pifyErrors.CONTENT_BLOCKED)
+	assert.EqualError(t, service.CheckPlay(ctx, "access-token", PlayContextRequest{ContextUri: "spotify:artist:a2"}), pifyErrors.CONTENT_BLOCKED)
+	assert.NoError(t, service.CheckPlay(ctx, "access-token", PlayContextRequest{ContextUri: "spotify:album:al1"}))
+
+	_, err = service.Save(ctx, "alice", "", ContentPolicy{AllowedFrom: "07:00", AllowedUntil: "11:30"})
+	require.NoError(t, err)
+	assert.EqualError(t, play("spotify:track:clean"), pifyErrors.CONTENT_BLOCKED)
+}
+
+func TestContentPolicyEnforce(t *testing.T) {
+	service, fake, _ := newTestContentPolicyService(t)
+	ctx := context.Background()
+
+	_, err := service.Save(ctx, "alice", "", ContentPolicy{BlockExplicit: true})
+	require.NoError(t, err)
+	playing := func(id string) NowPlaying {
+		track := fake.tracks[id]
+		item := trackItem(&track)
+		return NowPlaying{Active: true, IsPlaying: true, Track: &item, DeviceId: "phone"}
+	}
+
+	require.NoError(t, service.Enforce(ctx, playing("clean")))
+	assert.Empty(t, fake.requests)
+	require.NoError(t, service.Enforce(ctx, playing("explicit")))
+	assert.Equal(t, []string{"POST /v1/me/player/next?device_id=phone"}, fake.requests)
+
+	// outside the allowed hours nothing plays
+	_, err = service.Save(ctx, "alice", "", ContentPolicy{AllowedFrom: "19:00", AllowedUntil: "07:00"})
+	require.NoError(t, err)
+	require.NoError(t, service.Enforce(ctx, playing("clean")))
+	assert.Equal(t, "PUT /v1/me/player/pause?device_id=phone", fake.requests[1])
+}
+
+func TestContentRulesAllowsTime(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 10, 19, hour, minute, 0, 0, time.UTC)
+	}
+	day := &contentRules{hours: [][2]int{{7 * 60, 20*60 + 30}}}
+	assert.False(t, day.allowsTime(at(6, 59)))
+	assert.True(t, day.allowsTime(at(7, 0)))
+	assert.True(t, day.allowsTime(at(20, 29)))
+	assert.False(t, day.allowsTime(at(20, 30)))
+
+	night := &contentRules{hours: [][2]int{{22 * 60, 2 * 60}}}
+	assert.True(t, night.allowsTime(at(23, 0)))
+	assert.True(t, night.allowsTime(at(1, 59)))
+	assert.False(t, night.allowsTime(at(12, 0)))
+
+	// every policy must allow the time
+	both := &contentRules{hours: append(day.hours, night.hours...)}
+	assert.False(t, both.allowsTime(at(12, 0)))
+	assert.True(t, (&contentRules{}).allowsTime(at(3, 0)))
+}
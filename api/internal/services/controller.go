@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// getController returns the session with controller privileges, whose Spotify account the kiosk plays with.
+func getController(ctx context.Context, sessions repositories.SessionRepository) (*models.UserSession, error) {
+	session, err := sessions.GetController(ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errors.New(pifyErrors.CONTROLLER_NOT_FOUND)
+	}
+	return session, err
+}
+
+// controllerAccessToken returns a valid access token of the controller, refreshing it if it expired.
+func controllerAccessToken(ctx context.Context, sessions repositories.SessionRepository, spotifyService *SpotifyService) (string, error) {
+	session, err := getController(ctx, sessions)
+	if err != nil {
+		return "", err
+	}
+	if !spotifyService.IsApiTokenExpired(session.AccessTokenExpiresAt) {
+		return session.AccessToken, nil
+	}
+	return refreshSessionToken(ctx, sessions, spotifyService, session)
+}
+
+// refreshSessionToken exchanges the refresh token of the session for a new access token and saves it.
+func refreshSessionToken(
+	ctx context.Context,
+	sessions repositories.SessionRepository,
+	spotifyService *SpotifyService,
+	session *models.UserSession,
+) (string, error) {
+	res, err := spotifyService.RefreshApiToken(ctx, session.RefreshToken)
+	if err != nil {
+		return "", err
+	}
+	if res.AccessToken == "" {
+		// spotify rejected the refresh token, the user has to log in again
+		return "", errors.New(pifyErrors.REFRESH_TOKEN_FAILED)
+	}
+
+	expiresAt := time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	if err := sessions.UpdateAccessToken(ctx, session.Uuid, res.AccessToken, expiresAt); err != nil {
+		return "", err
+	}
+	return res.AccessToken, nil
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// actions of watchdog events
+const (
+	// the kiosk is not among the devices of the controller anymore
+	WATCHDOG_KIOSK_LOST = "kiosk_lost"
+	// the kiosk is back among the devices under a new id, after a crash or a reload of the player page
+	WATCHDOG_KIOSK_REAPPEARED = "kiosk_reappeared"
+	WATCHDOG_TRANSFERRED      = "transferred"
+	WATCHDOG_TRANSFER_FAILED  = "transfer_failed"
+)
+
+// WatchdogEvent reports what the device watchdog saw or did.
+type WatchdogEvent struct {
+	Action   string `json:"action"`
+	DeviceId string `json:"device_id,omitempty"`
+	// PreviousDeviceId is the id the kiosk had before it went away
+	PreviousDeviceId string `json:"previous_device_id,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+// WatchdogStatus is the preference of the household and what the watchdog knows of the kiosk.
+type WatchdogStatus struct {
+	KeepPlaybackOnKiosk bool `json:"keep_playback_on_kiosk"`
+	// KioskDeviceId is the id of the kiosk, empty while it is not among the devices of the controller
+	KioskDeviceId  string     `json:"kiosk_device_id,omitempty"`
+	KioskSeenAt    *time.Time `json:"kiosk_seen_at,omitempty"`
+	LastTransferAt *time.Time `json:"last_transfer_at,omitempty"`
+	UpdatedBy      string     `json:"updated_by,omitempty"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// DeviceWatchdog follows the device of the kiosk among the devices of the controller. The Web Playback
+// SDK registers a new device id whenever the player page is reloaded, and Spotify then moves playback
+// elsewhere or stops it. When the kiosk reappears under a new id and the household prefers to keep
+// playback on the kiosk, the watchdog transfers playback back to it. It reports what it does on the
+// event stream.
+type DeviceWatchdog struct {
+	sessions        repositories.SessionRepository
+	household       repositories.HouseholdRepository
+	spotifyService  *SpotifyService
+	playbackService *PlaybackService
+	auditService    *AuditService
+	events          *EventStream
+	now             func() time.Time
+
+	// wake asks Run to check the devices now
+	wake chan struct{}
+	// checkMu keeps the devices from being checked twice at once
+	checkMu sync.Mutex
+	mu      sync.Mutex
+	// kioskId is the id the kiosk was last seen under, kept while it is away
+	kioskId string
+	// connected is set while the kiosk is among the devices
+	connected bool
+	// pendingFrom is the previous id of a kiosk that reappeared, until playback is transferred to it,
+	// so that a failed transfer is tried again by the next check
+	pendingFrom    string
+	kioskSeenAt    time.Time
+	lastTransferAt time.Time
+}
+
+func NewDeviceWatchdog(
+	sessions repositories.SessionRepository,
+	household repositories.HouseholdRepository,
+	spotifyService *SpotifyService,
+	playbackService *PlaybackService,
+	auditService *AuditService,
+	events *EventStream,
+) *DeviceWatchdog {
+	return &DeviceWatchdog{
+		sessions:        sessions,
+		household:       household,
+		spotifyService:  spotifyService,
+		playbackService: playbackService,
+		auditService:    auditService,
+		events:          events,
+		now:             time.Now,
+		wake:            make(chan struct{}, 1),
+	}
+}
+
+// Status returns the preference of the household and the kiosk as last checked.
+func (w *DeviceWatchdog) Status(ctx context.Context) (*WatchdogStatus, error) {
+	settings, err := w.settings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &WatchdogStatus{
+		KeepPlaybackOnKiosk: settings.KeepPlaybackOnKiosk,
+		UpdatedBy:           settings.UpdatedBy,
+	}
+	if !settings.UpdatedAt.IsZero() {
+		status.UpdatedAt = &settings.UpdatedAt
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.connected {
+		status.KioskDeviceId = w.kioskId
+	}
+	if !w.kioskSeenAt.IsZero() {
+		seenAt := w.kioskSeenAt
+		status.KioskSeenAt = &seenAt
+	}
+	if !w.lastTransferAt.IsZero() {
+		transferAt := w.lastTransferAt
+		status.LastTransferAt = &transferAt
+	}
+	return status, nil
+}
+
+// SetKeepPlaybackOnKiosk saves whether playback is moved back to the kiosk, and records the change
+// in the audit log. owner is the username of the owner changing it.
+func (w *DeviceWatchdog) SetKeepPlaybackOnKiosk(ctx context.Context, owner string, keep bool) (*WatchdogStatus, error) {
+	if err := w.household.Save(ctx, &models.HouseholdSettings{
+		KeepPlaybackOnKiosk: keep,
+		UpdatedBy:           owner,
+	}); err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.HOUSEHOLD_SETTINGS_FAILED, err)
+	}
+	details := fmt.Sprintf("keep_playback_on_kiosk=%t", keep)
+	if err := w.auditService.Record(ctx, models.AUDIT_ACTION_HOUSEHOLD_CHANGED, owner, "household", details); err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.HOUSEHOLD_SETTINGS_FAILED, err)
+	}
+
+	if keep {
+		w.Wake()
+	}
+	return w.Status(ctx)
+}
+
+// settings returns the settings of the household, the defaults until an owner saves them.
+func (w *DeviceWatchdog) settings(ctx context.Context) (*models.HouseholdSettings, error) {
+	settings, err := w.household.Get(ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return &models.HouseholdSettings{}, nil
+	}
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.HOUSEHOLD_SETTINGS_FAILED, err)
+	}
+	return settings, nil
+}
+
+// Listen checks the devices as soon as the poller sees the playback move to another device.
+func (w *DeviceWatchdog) Listen(poller *PlaybackPoller) {
+	poller.Subscribe(w.onPlayback)
+}
+
+func (w *DeviceWatchdog) onPlayback(event PlaybackEvent) {
+	if event.Type == PLAYBACK_EVENT_DEVICE {
+		w.Wake()
+	}
+}
+
+// Wake asks Run to check the devices now. It does not block.
+func (w *DeviceWatchdog) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks the devices every interval, and when woken up, until ctx is cancelled.
+func (w *DeviceWatchdog) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+
+		if err := w.Check(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.WarnContext(ctx, "device watchdog did not check the kiosk", "error", err)
+		}
+	}
+}
+
+// Check looks for the kiosk among the devices of the controller, and transfers playback back to it
+// when it reappeared under a new id and the household prefers to keep playback on the kiosk. A failed
+// transfer is tried again by the next check. Nothing is checked without a controller.
+func (w *DeviceWatchdog) Check(ctx context.Context) error {
+	w.checkMu.Lock()
+	defer w.checkMu.Unlock()
+
+	accessToken, err := controllerAccessToken(ctx, w.sessions, w.spotifyService)
+	if err != nil {
+		if err.Error() == pifyErrors.CONTROLLER_NOT_FOUND {
+			return nil
+		}
+		return err
+	}
+	devices, err := w.spotifyService.GetUserDevices(ctx, accessToken)
+	if err != nil {
+		return pifyErrors.Wrap(pifyErrors.GET_DEVICES_FAILED, err)
+	}
+
+	kiosk := w.playbackService.findKiosk(devices.Devices)
+	if kiosk == nil {
+		w.mu.Lock()
+		lost := w.connected
+		w.connected = false
+		previousId := w.kioskId
+		w.mu.Unlock()
+
+		if lost {
+			w.events.Publish(EVENT_WATCHDOG, WatchdogEvent{Action: WATCHDOG_KIOSK_LOST, PreviousDeviceId: previousId})
+		}
+		return nil
+	}
+
+	w.mu.Lock()
+	previousId := w.kioskId
+	// the first sighting of the kiosk is not a reappearance
+	reappeared := previousId != "" && previousId != kiosk.ID
+	if reappeared {
+		w.pendingFrom = previousId
+	}
+	pendingFrom := w.pendingFrom
+	w.kioskId = kiosk.ID
+	w.connected = true
+	w.kioskSeenAt = w.now()
+	w.mu.Unlock()
+
+	if reappeared {
+		w.events.Publish(EVENT_WATCHDOG, WatchdogEvent{
+			Action:           WATCHDOG_KIOSK_REAPPEARED,
+			DeviceId:         kiosk.ID,
+			PreviousDeviceId: previousId,
+		})
+	}
+	if pendingFrom == "" {
+		return nil
+	}
+
+	settings, err := w.settings(ctx)
+	if err != nil {
+		return err
+	}
+	if !settings.KeepPlaybackOnKiosk || kiosk.IsActive {
+		w.setPendingFrom("")
+		return nil
+	}
+
+	if _, err := w.spotifyService.TransferPlayback(ctx, accessToken, kiosk.ID); err != nil {
+		w.events.Publish(EVENT_WATCHDOG, WatchdogEvent{
+			Action:           WATCHDOG_TRANSFER_FAILED,
+			DeviceId:         kiosk.ID,
+			PreviousDeviceId: pendingFrom,
+			Error:            err.Error(),
+		})
+		return err
+	}
+
+	w.mu.Lock()
+	w.pendingFrom = ""
+	w.lastTransferAt = w.now()
+	w.mu.Unlock()
+	w.events.Publish(EVENT_WATCHDOG, WatchdogEvent{
+		Action:           WATCHDOG_TRANSFERRED,
+		DeviceId:         kiosk.ID,
+		PreviousDeviceId: pendingFrom,
+	})
+	return nil
+}
+
+func (w *DeviceWatchdog) setPendingFrom(deviceId string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pendingFrom = deviceId
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// fakeDevices answers the devices of the controller, and records the transfers of playback.
+type fakeDevices struct {
+	mu      sync.Mutex
+	devices string
+	// status returned by the transfer playback endpoint
+	transferStatus int
+	transfers      int
+}
+
+func (f *fakeDevices) set(devices string, transferStatus int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.devices, f.transferStatus = devices, transferStatus
+}
+
+func (f *fakeDevices) transferred() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.transfers
+}
+
+func (f *fakeDevices) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/me/player/devices":
+		w.Write([]byte(`{"devices": [` + f.devices + `]}`))
+	case r.URL.Path == "/v1/me/player" && r.Method == http.MethodPut:
+		f.transfers++
+		w.WriteHeader(f.transferStatus)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestDeviceWatchdog(t *testing.T) (*DeviceWatchdog, *fakeDevices, *repositories.MemoryStore) {
+	t.Helper()
+
+	store := repositories.NewMemoryStore()
+	fake := &fakeDevices{}
+	spotifyService := newTestSpotifyService(t, fake.handle)
+	watchdog := NewDeviceWatchdog(
+		store.Sessions(),
+		store.Household(),
+		spotifyService,
+		NewPlaybackService(store.Sessions(), spotifyService, "Pify Player"),
+		NewAuditService(store.Audit()),
+		NewEventStream(),
+	)
+	return watchdog, fake, store
+}
+
+// watchdogEvents returns the watchdog events published so far.
+func watchdogEvents(events <-chan Event) []WatchdogEvent {
+	var published []WatchdogEvent
+	for {
+		select {
+		case event := <-events:
+			published = append(published, event.Data.(WatchdogEvent))
+		default:
+			return published
+		}
+	}
+}
+
+const (
+	kioskDevice   = `{"id": "kiosk-1", "name": "Pify Player", "is_active": true}`
+	phoneDevice   = `{"id": "phone", "name": "Phone", "is_active": true}`
+	reloadedKiosk = `{"id": "kiosk-2", "name": "pify player", "is_active": false}`
+)
+
+func TestDeviceWatchdogCheck(t *testing.T) {
+	watchdog, fake, store := newTestDeviceWatchdog(t)
+	ctx := context.Background()
+	events, unsubscribe := watchdog.events.Subscribe()
+	defer unsubscribe()
+
+	// nothing to check without a controller
+	require.NoError(t, watchdog.Check(ctx))
+	saveTestController(t, store)
+	_, err := watchdog.SetKeepPlaybackOnKiosk(ctx, "alice", true)
+	require.NoError(t, err)
+
+	fake.set(kioskDevice, http.StatusNoContent)
+	require.NoError(t, watchdog.Check(ctx))
+	assert.Empty(t, watchdogEvents(events))
+
+	// Chromium crashed, Spotify moved playback to the phone
+	fake.set(phoneDevice, http.StatusNoContent)
+	require.NoError(t, watchdog.Check(ctx))
+	require.NoError(t, watchdog.Check(ctx))
+	assert.Equal(t, []WatchdogEvent{{Action: WATCHDOG_KIOSK_LOST, PreviousDeviceId: "kiosk-1"}}, watchdogEvents(events))
+
+	fake.set(phoneDevice+","+reloadedKiosk, http.StatusNoContent)
+	require.NoError(t, watchdog.Check(ctx))
+	assert.Equal(t, []WatchdogEvent{
+		{Action: WATCHDOG_KIOSK_REAPPEARED, DeviceId: "kiosk-2", PreviousDeviceId: "kiosk-1"},
+		{Action: WATCHDOG_TRANSFERRED, DeviceId: "kiosk-2", PreviousDeviceId: "kiosk-1"},
+	}, watchdogEvents(events))
+	assert.Equal(t, 1, fake.transferred())
+
+	status, err := watchdog.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, status.KeepPlaybackOnKiosk)
+	assert.Equal(t, "kiosk-2", status.KioskDeviceId)
+	assert.NotNil(t, status.LastTransferAt)
+
+	// the same id again is not a reappearance
+	require.NoError(t, watchdog.Check(ctx))
+	assert.Empty(t, watchdogEvents(events))
+	assert.Equal(t, 1, fake.transferred())
+}
+
+func TestDeviceWatchdogRetriesTransfer(t *testing.T) {
+	watchdog, fake, store := newTestDeviceWatchdog(t)
+	ctx := context.Background()
+	saveTestController(t, store)
+	_, err := watchdog.SetKeepPlaybackOnKiosk(ctx, "alice", true)
+	require.NoError(t, err)
+	events, unsubscribe := watchdog.events.Subscribe()
+	defer unsubscribe()
+
+	fake.set(kioskDevice, http.StatusNoContent)
+	require.NoError(t, watchdog.Check(ctx))
+
+	// the kiosk reloaded between two checks
+	fake.set(reloadedKiosk, http.StatusTooManyRequests)
+	assert.EqualError(t, watchdog.Check(ctx), pifyErrors.RATE_LIMIT_EXCEEDED)
+	assert.Equal(t, []WatchdogEvent{
+		{Action: WATCHDOG_KIOSK_REAPPEARED, DeviceId: "kiosk-2", PreviousDeviceId: "kiosk-1"},
+		{Action: WATCHDOG_TRANSFER_FAILED, DeviceId: "kiosk-2", PreviousDeviceId: "kiosk-1", Error: pifyErrors.RATE_LIMIT_EXCEEDED},
+	}, watchdogEvents(events))
+
+	fake.set(reloadedKiosk, http.StatusNoContent)
+	require.NoError(t, watchdog.Check(ctx))
+	assert.Equal(t, []WatchdogEvent{
+		{Action: WATCHDOG_TRANSFERRED, DeviceId: "kiosk-2", PreviousDeviceId: "kiosk-1"},
+	}, watchdogEvents(events))
+	assert.Equal(t, 2, fake.transferred())
+}
+
+func TestDeviceWatchdogKeepsPlaybackWhereItIs(t *testing.T) {
+	watchdog, fake, store := newTestDeviceWatchdog(t)
+	ctx := context.Background()
+	saveTestController(t, store)
+	events, unsubscribe := watchdog.events.Subscribe()
+	defer unsubscribe()
+
+	// the household did not ask to keep playback on the kiosk
+	fake.set(kioskDevice, http.StatusNoContent)
+	require.NoError(t, watchdog.Check(ctx))
+	fake.set(phoneDevice+","+reloadedKiosk, http.StatusNoContent)
+	require.NoError(t, watchdog.Check(ctx))
+	assert.Equal(t, []WatchdogEvent{
+		{Action: WATCHDOG_KIOSK_REAPPEARED, DeviceId: "kiosk-2", PreviousDeviceId: "kiosk-1"},
+	}, watchdogEvents(events))
+	assert.Zero(t, fake.transferred())
+
+	// a later change of the preference does not move playback that was left alone
+	_, err := watchdog.SetKeepPlaybackOnKiosk(ctx, "alice", true)
+	require.NoError(t, err)
+	require.NoError(t, watchdog.Check(ctx))
+	assert.Zero(t, fake.transferred())
+
+	auditEvents, err := store.Audit().List(ctx, "", 10)
+	require.NoError(t, err)
+	require.Len(t, auditEvents, 1)
+	assert.Equal(t, models.AUDIT_ACTION_HOUSEHOLD_CHANGED, auditEvents[0].Action)
+	assert.Equal(t, "alice", auditEvents[0].Actor)
+	assert.Equal(t, "keep_playback_on_kiosk=true", auditEvents[0].Details)
+}
+
+func TestDeviceWatchdogWakesOnDeviceChanges(t *testing.T) {
+	watchdog, _, _ := newTestDeviceWatchdog(t)
+
+	watchdog.onPlayback(PlaybackEvent{Type: PLAYBACK_EVENT_TRACK})
+	assert.Len(t, watchdog.wake, 0)
+	watchdog.onPlayback(PlaybackEvent{Type: PLAYBACK_EVENT_DEVICE})
+	watchdog.onPlayback(PlaybackEvent{Type: PLAYBACK_EVENT_DEVICE})
+	assert.Len(t, watchdog.wake, 1)
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"time"
+)
+
+//go:embed templates/digest_card.html
+var digestCardHtml string
+
+var digestCardTemplate = template.Must(template.New("digest_card").Funcs(template.FuncMap{
+	"duration": formatListened,
+	"percent":  func(rate float64) string { return fmt.Sprintf("%.0f%%", rate*100) },
+	"trend":    formatTrend,
+}).Parse(digestCardHtml))
+
+// RenderDigestCard writes the digest as an HTML page the kiosk shows while idle.
+func RenderDigestCard(w io.Writer, digest *WeeklyDigest) error {
+	return digestCardTemplate.Execute(w, digest)
+}
+
+// formatListened formats a listening time as hours and minutes, e.g. "3 h 05 min".
+func formatListened(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	if hours == 0 {
+		return fmt.Sprintf("%d min", minutes)
+	}
+	return fmt.Sprintf("%d h %02d min", hours, minutes)
+}
+
+// formatTrend formats the change from the listening time of the previous week, empty if nothing was
+// played then.
+func formatTrend(ms, previousMs int64) string {
+	if previousMs == 0 {
+		return ""
+	}
+	change := math.Round(float64(ms-previousMs) / float64(previousMs) * 100)
+	return fmt.Sprintf("%+.0f%%", change)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// types of events of the event stream
+const (
+	// the data is a PlaybackEvent of the poller
+	EVENT_PLAYBACK = "playback"
+	// the data is a WatchdogEvent
+	EVENT_WATCHDOG = "watchdog"
+)
+
+// EVENT_BUFFER is how many events a subscriber may fall behind before further events are dropped for it.
+const EVENT_BUFFER = 32
+
+// Event is an event of the event stream, sent to the clients of the api as it happens.
+type Event struct {
+	Type string    `json:"type"`
+	Data any       `json:"data"`
+	At   time.Time `json:"at"`
+}
+
+// EventStream fans the events of the background jobs out to its subscribers, such as the clients
+// following /player/events. Publishing never blocks: a subscriber that falls behind misses events.
+type EventStream struct {
+	now func() time.Time
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewEventStream() *EventStream {
+	return &EventStream{
+		now:         time.Now,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Listen publishes the changes of the playback seen by the poller.
+func (s *EventStream) Listen(poller *PlaybackPoller) {
+	poller.Subscribe(func(event PlaybackEvent) {
+		s.publish(Event{Type: EVENT_PLAYBACK, Data: event, At: event.At})
+	})
+}
+
+// Publish sends an event of the given type to the subscribers.
+func (s *EventStream) Publish(eventType string, data any) {
+	s.publish(Event{Type: eventType, Data: data, At: s.now()})
+}
+
+func (s *EventStream) publish(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for events := range s.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events published from now on, and a function to stop
+// receiving them, which closes the channel.
+func (s *EventStream) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, EVENT_BUFFER)
+
+	s.mu.Lock()
+	s.subscribers[events] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			delete(s.subscribers, events)
+			close(events)
+		})
+	}
+}
+
+// Subscribers returns how many subscribers receive the events.
+func (s *EventStream) Subscribers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.subscribers)
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStream(t *testing.T) {
+	stream := NewEventStream()
+	at := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	stream.now = func() time.Time { return at }
+
+	first, unsubscribeFirst := stream.Subscribe()
+	second, unsubscribeSecond := stream.Subscribe()
+	assert.Equal(t, 2, stream.Subscribers())
+
+	stream.Publish(EVENT_WATCHDOG, WatchdogEvent{Action: WATCHDOG_KIOSK_LOST})
+	for _, events := range []<-chan Event{first, second} {
+		event := <-events
+		assert.Equal(t, EVENT_WATCHDOG, event.Type)
+		assert.Equal(t, WatchdogEvent{Action: WATCHDOG_KIOSK_LOST}, event.Data)
+		assert.Equal(t, at, event.At)
+	}
+
+	// a subscriber that falls behind misses events instead of blocking the others
+	for range EVENT_BUFFER + 1 {
+		stream.Publish(EVENT_WATCHDOG, WatchdogEvent{})
+		<-second
+	}
+	assert.Len(t, first, EVENT_BUFFER)
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	assert.Equal(t, 1, stream.Subscribers())
+	for range first {
+	}
+	unsubscribeSecond()
+	_, open := <-second
+	assert.False(t, open)
+	require.Zero(t, stream.Subscribers())
+}
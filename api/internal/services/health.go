@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+)
+
+const (
+	READINESS_CHECK_DATABASE   = "database"
+	READINESS_CHECK_MIGRATIONS = "migrations"
+	READINESS_CHECK_SPOTIFY    = "spotify_credentials"
+	READINESS_CHECK_CERTS      = "certs"
+)
+
+type ReadinessCheck struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type ReadinessReport struct {
+	Ready  bool                      `json:"ready"`
+	Checks map[string]ReadinessCheck `json:"checks"`
+}
+
+// HealthService verifies that the dependencies required to serve requests are available.
+type HealthService struct {
+	db             *database.DB
+	migrations     *migrate.Migrations
+	spotifyService *SpotifyService
+	certFile       string
+	keyFile        string
+}
+
+// NewHealthService creates the service checking readiness. Pass empty cert files to skip the certs check,
+// e.g. when TLS is terminated by a proxy.
+func NewHealthService(
+	db *database.DB,
+	migrations *migrate.Migrations,
+	spotifyService *SpotifyService,
+	certFile,
+	keyFile string,
+) *HealthService {
+	return &HealthService{db, migrations, spotifyService, certFile, keyFile}
+}
+
+// CheckReadiness runs all readiness checks. The api is ready only if every check passes.
+func (s *HealthService) CheckReadiness(ctx context.Context) ReadinessReport {
+	report := ReadinessReport{
+		Ready:  true,
+		Checks: make(map[string]ReadinessCheck),
+	}
+
+	checks := map[string]func(context.Context) error{
+		READINESS_CHECK_DATABASE:   s.checkDatabase,
+		READINESS_CHECK_MIGRATIONS: s.checkMigrations,
+		READINESS_CHECK_SPOTIFY:    s.checkSpotifyCredentials,
+	}
+
+	// certs are not checked when TLS is terminated by a proxy
+	if s.certFile != "" {
+		checks[READINESS_CHECK_CERTS] = s.checkCerts
+	}
+
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			report.Ready = false
+			report.Checks[name] = ReadinessCheck{Ok: false, Error: err.Error()}
+		} else {
+			report.Checks[name] = ReadinessCheck{Ok: true}
+		}
+	}
+
+	return report
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) error {
+	return s.db.Bun.PingContext(ctx)
+}
+
+func (s *HealthService) checkMigrations(ctx context.Context) error {
+	migrator := migrate.NewMigrator(s.db.Bun, s.migrations)
+	ms, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if unapplied := ms.Unapplied(); len(unapplied) > 0 {
+		return fmt.Errorf("%d pending migrations: %s", len(unapplied), unapplied)
+	}
+
+	return nil
+}
+
+func (s *HealthService) checkSpotifyCredentials(_ context.Context) error {
+	if !s.spotifyService.HasCredentials() {
+		return errors.New("spotify client id, client secret or redirect uri not configured")
+	}
+	return nil
+}
+
+func (s *HealthService) checkCerts(_ context.Context) error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return err
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("certificate not valid before %s", leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
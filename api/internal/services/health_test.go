@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun/migrate"
+
+	"github.com/edgejay/pify-player/api/internal/database"
+)
+
+// writeTestCert writes a self-signed certificate valid between notBefore and notAfter into dir.
+func writeTestCert(t *testing.T, dir string, notBefore, notAfter time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "localhost.pem")
+	keyFile := filepath.Join(dir, "localhost.key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return certFile, keyFile
+}
+
+func TestCheckReadiness(t *testing.T) {
+	db, err := database.NewSQLiteDB(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	migrations := migrate.NewMigrations()
+	require.NoError(t, migrate.NewMigrator(db.Bun, migrations).Init(ctx))
+
+	now := time.Now()
+	certFile, keyFile := writeTestCert(t, t.TempDir(), now.Add(-time.Hour), now.Add(time.Hour))
+
+	credentials := SpotifyCredentials{
+		ClientID:     "test-client-id",
+		ClientSecret: "test-client-secret",
+		RedirectURI:  "http://localhost:8080/callback",
+	}
+
+	t.Run("all checks pass", func(t *testing.T) {
+		service := NewHealthService(db, migrations, NewSpotifyService(credentials, nil), certFile, keyFile)
+		report := service.CheckReadiness(ctx)
+
+		assert.True(t, report.Ready)
+		for name, check := range report.Checks {
+			assert.True(t, check.Ok, "check %s failed: %s", name, check.Error)
+		}
+	})
+
+	t.Run("missing credentials and certs", func(t *testing.T) {
+		service := NewHealthService(db, migrations, NewSpotifyService(SpotifyCredentials{}, nil), certFile+".missing", keyFile)
+		report := service.CheckReadiness(ctx)
+
+		assert.False(t, report.Ready)
+		assert.True(t, report.Checks[READINESS_CHECK_DATABASE].Ok)
+		assert.True(t, report.Checks[READINESS_CHECK_MIGRATIONS].Ok)
+		assert.False(t, report.Checks[READINESS_CHECK_SPOTIFY].Ok)
+		assert.False(t, report.Checks[READINESS_CHECK_CERTS].Ok)
+	})
+
+	t.Run("certs skipped behind proxy", func(t *testing.T) {
+		service := NewHealthService(db, migrations, NewSpotifyService(credentials, nil), "", "")
+		report := service.CheckReadiness(ctx)
+
+		assert.True(t, report.Ready)
+		assert.NotContains(t, report.Checks, READINESS_CHECK_CERTS)
+	})
+
+	t.Run("expired certs", func(t *testing.T) {
+		expiredCert, expiredKey := writeTestCert(t, t.TempDir(), now.Add(-2*time.Hour), now.Add(-time.Hour))
+		service := NewHealthService(db, migrations, NewSpotifyService(credentials, nil), expiredCert, expiredKey)
+		report := service.CheckReadiness(ctx)
+
+		assert.False(t, report.Ready)
+		assert.Contains(t, report.Checks[READINESS_CHECK_CERTS].Error, "expired")
+	})
+
+	t.Run("pending migrations", func(t *testing.T) {
+		pending := migrate.NewMigrations()
+		pending.Add(migrate.Migration{Name: "20250101000000", Comment: "pending"})
+
+		service := NewHealthService(db, pending, NewSpotifyService(credentials, nil), certFile, keyFile)
+		report := service.CheckReadiness(ctx)
+
+		assert.False(t, report.Ready)
+		assert.False(t, report.Checks[READINESS_CHECK_MIGRATIONS].Ok)
+	})
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// PLAY_SKIP_PERCENT is how far into a track a play has to get not to count as skipped.
+const PLAY_SKIP_PERCENT = 80
+
+// PLAY_DEDUP_WINDOW is how close the ends of two plays of the same track by the same user have to be
+// to be the same play, seen by more than one source such as the poller and the kiosk.
+const PLAY_DEDUP_WINDOW = 30 * time.Second
+
+// MAX_HISTORY_LIMIT is the largest page of the play history.
+const MAX_HISTORY_LIMIT = 500
+
+// PlayReport is a play the kiosk saw end: from StartedAt to EndedAt, PositionMs into the track.
+type PlayReport struct {
+	TrackId     string
+	TrackName   string
+	ArtistIds   []string
+	ArtistNames string
+	DurationMs  int
+	StartedAt   time.Time
+	EndedAt     time.Time
+	PositionMs  int
+}
+
+// Play is a play of the history. PlayedAt is when the play ended.
+type Play struct {
+	Id            int64     `json:"id"`
+	UserId        int64     `json:"user_id"`
+	TrackId       string    `json:"track_id"`
+	TrackName     string    `json:"track_name"`
+	ArtistIds     []string  `json:"artist_ids"`
+	ArtistNames   string    `json:"artist_names"`
+	DurationMs    int       `json:"duration_ms"`
+	StartedAt     time.Time `json:"started_at"`
+	PlayedAt      time.Time `json:"played_at"`
+	PlayedPercent int       `json:"played_percent"`
+	Skipped       bool      `json:"skipped"`
+	Source        string    `json:"source"`
+}
+
+// HistoryService records the plays of the household, from the playback poller, the reports of the
+// kiosk and the recently played tracks of Spotify, and lists them.
+type HistoryService struct {
+	sessions       repositories.SessionRepository
+	plays          repositories.PlayEventRepository
+	spotifyService *SpotifyService
+
+	mu sync.Mutex
+	// the track the poller last saw start, when it started and the user of the controller then
+	playing   string
+	startedAt time.Time
+	userId    int64
+	listeners []func(*models.PlayEvent)
+}
+
+func NewHistoryService(sessions repositories.SessionRepository, plays repositories.PlayEventRepository, spotifyService *SpotifyService) *HistoryService {
+	return &HistoryService{
+		sessions:       sessions,
+		plays:          plays,
+		spotifyService: spotifyService,
+	}
+}
+
+// Listen records the plays of the controller seen by poller.
+func (s *HistoryService) Listen(poller *PlaybackPoller) {
+	poller.Subscribe(s.onPlayback)
+}
+
+// Subscribe adds a listener of the plays added to the history. Listeners are called one after the
+// other once the play is saved and must not block.
+func (s *HistoryService) Subscribe(listener func(*models.PlayEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listeners = append(s.listeners, listener)
+}
+
+// onPlayback records the previous track when the poller sees the track change. The play ended when
+// the current track started, or when the change was seen if nothing plays anymore. It is recorded
+// for the user who was the controller when the track started, even if the controller changed since.
+func (s *HistoryService) onPlayback(event PlaybackEvent) {
+	if event.Type != PLAYBACK_EVENT_TRACK {
+		return
+	}
+	previous, current := event.Previous, event.Current
+
+	// the controller now listens to the current track
+	ctx := context.Background()
+	var controllerId int64
+	session, err := getController(ctx, s.sessions)
+	if err == nil {
+		controllerId = session.UserId
+	}
+
+	s.mu.Lock()
+	startedAt, userId, known := s.startedAt, s.userId, s.playing != "" && s.playing == previous.trackId()
+	s.playing = current.trackId()
+	if s.playing != "" {
+		s.startedAt = current.UpdatedAt.Add(-time.Duration(current.ProgressMs) * time.Millisecond)
+		s.userId = controllerId
+	}
+	s.mu.Unlock()
+
+	if previous.trackId() == "" {
+		return
+	}
+
+	endedAt := event.At
+	if current.trackId() != "" {
+		endedAt = current.UpdatedAt.Add(-time.Duration(current.ProgressMs) * time.Millisecond)
+	}
+	if endedAt.Before(previous.UpdatedAt) {
+		endedAt = previous.UpdatedAt
+	}
+	positionMs := previous.ProgressMs
+	if previous.IsPlaying {
+		positionMs += int(endedAt.Sub(previous.UpdatedAt).Milliseconds())
+	}
+	if !known {
+		// the poller started during the track
+		startedAt = previous.UpdatedAt.Add(-time.Duration(previous.ProgressMs) * time.Millisecond)
+		userId = controllerId
+	}
+	if userId == 0 {
+		slog.WarnContext(ctx, "play not recorded, no controller", "track_id", previous.trackId(), "error", err)
+		return
+	}
+
+	track := previous.Track
+	play := newPlayEvent(userId, track.Id, track.Name, track.ArtistIds, track.Subtitle, track.DurationMs, startedAt, endedAt, positionMs)
+	play.Source = models.PLAY_SOURCE_POLLER
+	if _, err := s.Record(ctx, play); err != nil {
+		slog.ErrorContext(ctx, "play not recorded", "track_id", track.Id, "error", err)
+	}
+}
+
+// Report records a play reported by the kiosk, for the user of the controller.
+func (s *HistoryService) Report(ctx context.Context, report PlayReport) error {
+	if report.TrackId == "" || report.StartedAt.IsZero() || report.EndedAt.Before(report.StartedAt) ||
+		report.PositionMs < 0 || report.DurationMs < 0 {
+		return errors.New(pifyErrors.INVALID_PLAY_REPORT)
+	}
+
+	session, err := getController(ctx, s.sessions)
+	if err != nil {
+		return err
+	}
+
+	play := newPlayEvent(
+		session.UserId,
+		report.TrackId,
+		report.TrackName,
+		report.ArtistIds,
+		report.ArtistNames,
+		report.DurationMs,
+		report.StartedAt,
+		report.EndedAt,
+		report.PositionMs,
+	)
+	play.Source = models.PLAY_SOURCE_KIOSK
+	_, err = s.Record(ctx, play)
+	return err
+}
+
+// Backfill records the tracks recently played by the user that are not in the history yet, and
+// returns how many were added. Spotify does not tell how far they got, they count as played through.
+func (s *HistoryService) Backfill(ctx context.Context, userId int64, accessToken string) (int, error) {
+	added := 0
+	for item, err := range s.spotifyService.ListRecentlyPlayed(accessToken).All(ctx) {
+		if err != nil {
+			return added, err
+		}
+
+		track := trackItem(&item.Track)
+		startedAt := item.PlayedAt.Add(-time.Duration(track.DurationMs) * time.Millisecond)
+		play := newPlayEvent(userId, track.Id, track.Name, track.ArtistIds, track.Subtitle, track.DurationMs, startedAt, item.PlayedAt, track.DurationMs)
+		play.Source = models.PLAY_SOURCE_RECENTLY_PLAYED
+
+		ok, err := s.Record(ctx, play)
+		if err != nil {
+			return added, err
+		}
+		if ok {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// Record saves play unless the history has it already, and reports whether it was saved. PlayedAt
+// is truncated to the second, as Spotify reports it.
+func (s *HistoryService) Record(ctx context.Context, play *models.PlayEvent) (bool, error) {
+	play.PlayedAt = play.PlayedAt.UTC().Truncate(time.Second)
+	play.StartedAt = play.StartedAt.UTC()
+
+	existing, err := s.plays.List(ctx, repositories.PlayFilter{
+		UserId:         play.UserId,
+		SpotifyTrackId: play.SpotifyTrackId,
+		From:           play.PlayedAt.Add(-PLAY_DEDUP_WINDOW),
+		To:             play.PlayedAt.Add(PLAY_DEDUP_WINDOW),
+		Limit:          1,
+	})
+	if err != nil {
+		return false, pifyErrors.Wrap(pifyErrors.HISTORY_FAILED, err)
+	}
+	if len(existing) > 0 {
+		return false, nil
+	}
+
+	added, err := s.plays.Add(ctx, play)
+	if err != nil {
+		return false, pifyErrors.Wrap(pifyErrors.HISTORY_FAILED, err)
+	}
+	if added {
+		s.mu.Lock()
+		listeners := s.listeners
+		s.mu.Unlock()
+		for _, listener := range listeners {
+			listener(play)
+		}
+	}
+	return added, nil
+}
+
+// History returns the plays of the user between from and to, latest first. A zero userId lists the
+// plays of the household, zero times leave the range open.
+func (s *HistoryService) History(ctx context.Context, userId int64, from, to time.Time, limit int) ([]Play, error) {
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, errors.New(pifyErrors.INVALID_HISTORY_RANGE)
+	}
+
+	events, err := s.plays.List(ctx, repositories.PlayFilter{
+		UserId: userId,
+		From:   from,
+		To:     to,
+		Limit:  min(max(limit, 1), MAX_HISTORY_LIMIT),
+	})
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.HISTORY_FAILED, err)
+	}
+
+	plays := make([]Play, len(events))
+	for i, event := range events {
+		plays[i] = newPlay(event)
+	}
+	return plays, nil
+}
+
+// newPlayEvent returns the play of a track from startedAt to endedAt, that got positionMs into it.
+func newPlayEvent(
+	userId int64,
+	trackId, trackName string,
+	artistIds []string,
+	artistNames string,
+	durationMs int,
+	startedAt, endedAt time.Time,
+	positionMs int,
+) *models.PlayEvent {
+	percent := 100
+	if durationMs > 0 {
+		percent = min(max(positionMs*100/durationMs, 0), 100)
+	}
+	return &models.PlayEvent{
+		UserId:         userId,
+		SpotifyTrackId: trackId,
+		TrackName:      trackName,
+		ArtistIds:      strings.Join(artistIds, ","),
+		ArtistNames:    artistNames,
+		DurationMs:     durationMs,
+		StartedAt:      startedAt,
+		PlayedAt:       endedAt,
+		PlayedPercent:  percent,
+		Skipped:        percent < PLAY_SKIP_PERCENT,
+	}
+}
+
+func newPlay(event *models.PlayEvent) Play {
+	return Play{
+		Id:            event.Id,
+		UserId:        event.UserId,
+		TrackId:       event.SpotifyTrackId,
+		TrackName:     event.TrackName,
+		ArtistIds:     playArtistIds(event),
+		ArtistNames:   event.ArtistNames,
+		DurationMs:    event.DurationMs,
+		StartedAt:     event.StartedAt,
+		PlayedAt:      event.PlayedAt,
+		PlayedPercent: event.PlayedPercent,
+		Skipped:       event.Skipped,
+		Source:        event.Source,
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+func TestHistoryRecordsPollerPlays(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+	player := &fakePlayer{}
+	spotifyService := newTestSpotifyService(t, player.ServeHTTP)
+
+	poller := NewPlaybackPoller(store.Sessions(), spotifyService, testIntervals)
+	now := time.Unix(1000, 0)
+	poller.now = func() time.Time { return now }
+	history := NewHistoryService(store.Sessions(), store.Plays(), spotifyService)
+	history.Listen(poller)
+	ctx := context.Background()
+
+	player.set(playerState("t1", true, 0, 50))
+	poller.Poll(ctx)
+
+	// skipped after 58s, the next track started 2s before the poll
+	now = now.Add(time.Minute)
+	player.set(playerState("t2", true, 2000, 50))
+	poller.Poll(ctx)
+
+	// played through
+	now = now.Add(200 * time.Second)
+	player.set(playerState("t3", true, 1000, 50))
+	poller.Poll(ctx)
+
+	// stopped after 41s
+	now = now.Add(40 * time.Second)
+	player.set("")
+	poller.Poll(ctx)
+
+	plays, err := history.History(ctx, 0, time.Time{}, time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, plays, 3)
+
+	assert.Equal(t, "t3", plays[0].TrackId)
+	assert.Equal(t, 20, plays[0].PlayedPercent)
+	assert.True(t, plays[0].Skipped)
+	assert.Equal(t, time.Unix(1300, 0).UTC(), plays[0].PlayedAt)
+
+	assert.Equal(t, "t2", plays[1].TrackId)
+	assert.Equal(t, 100, plays[1].PlayedPercent)
+	assert.False(t, plays[1].Skipped)
+	assert.Equal(t, time.Unix(1058, 0).UTC(), plays[1].StartedAt)
+	assert.Equal(t, time.Unix(1259, 0).UTC(), plays[1].PlayedAt)
+
+	assert.Equal(t, "t1", plays[2].TrackId)
+	assert.Equal(t, 29, plays[2].PlayedPercent)
+	assert.True(t, plays[2].Skipped)
+	assert.Equal(t, time.Unix(1000, 0).UTC(), plays[2].StartedAt)
+	assert.Equal(t, time.Unix(1058, 0).UTC(), plays[2].PlayedAt)
+	assert.Equal(t, models.PLAY_SOURCE_POLLER, plays[2].Source)
+}
+
+func TestHistoryRecordsPlaysForTheControllerWhenTheyStarted(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+	player := &fakePlayer{}
+	spotifyService := newTestSpotifyService(t, player.ServeHTTP)
+
+	poller := NewPlaybackPoller(store.Sessions(), spotifyService, testIntervals)
+	now := time.Unix(1000, 0)
+	poller.now = func() time.Time { return now }
+	history := NewHistoryService(store.Sessions(), store.Plays(), spotifyService)
+	history.Listen(poller)
+	ctx := context.Background()
+
+	alice, err := store.Sessions().Get(ctx, "kiosk")
+	require.NoError(t, err)
+	player.set(playerState("t1", true, 0, 50))
+	poller.Poll(ctx)
+
+	// bob takes over the controller during t1
+	bob, err := store.Users().Upsert(ctx, &models.User{Username: "bob"})
+	require.NoError(t, err)
+	_, err = store.Sessions().Upsert(ctx, &models.UserSession{
+		UserId:               bob.Id,
+		Uuid:                 "phone",
+		AccessToken:          "access-token",
+		AccessTokenExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Sessions().UnsetController(ctx, "kiosk"))
+	require.NoError(t, store.Sessions().SetController(ctx, "phone"))
+
+	now = now.Add(time.Minute)
+	player.set(playerState("t2", true, 2000, 50))
+	poller.Poll(ctx)
+	now = now.Add(time.Minute)
+	player.set("")
+	poller.Poll(ctx)
+
+	plays, err := history.History(ctx, 0, time.Time{}, time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, plays, 2)
+	assert.Equal(t, "t2", plays[0].TrackId)
+	assert.Equal(t, bob.Id, plays[0].UserId)
+	assert.Equal(t, "t1", plays[1].TrackId)
+	assert.Equal(t, alice.UserId, plays[1].UserId)
+}
+
+func TestHistoryReport(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	history := NewHistoryService(store.Sessions(), store.Plays(), nil)
+	ctx := context.Background()
+
+	report := PlayReport{
+		TrackId:     "t1",
+		TrackName:   "Song",
+		ArtistIds:   []string{"a1", "a2"},
+		ArtistNames: "Band, Singer",
+		DurationMs:  200000,
+		StartedAt:   time.Unix(1000, 0),
+		EndedAt:     time.Unix(1180, 500),
+		PositionMs:  180000,
+	}
+	assert.EqualError(t, history.Report(ctx, report), pifyErrors.CONTROLLER_NOT_FOUND)
+
+	saveTestController(t, store)
+	require.NoError(t, history.Report(ctx, report))
+
+	// the poller saw the same play end a few seconds later
+	_, err := history.Record(ctx, &models.PlayEvent{UserId: 1, SpotifyTrackId: "t1", PlayedAt: time.Unix(1183, 0)})
+	require.NoError(t, err)
+
+	invalid := report
+	invalid.EndedAt = report.StartedAt.Add(-time.Second)
+	assert.EqualError(t, history.Report(ctx, invalid), pifyErrors.INVALID_PLAY_REPORT)
+
+	plays, err := history.History(ctx, 1, time.Time{}, time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, plays, 1)
+	assert.Equal(t, []string{"a1", "a2"}, plays[0].ArtistIds)
+	assert.Equal(t, "Band, Singer", plays[0].ArtistNames)
+	assert.Equal(t, 90, plays[0].PlayedPercent)
+	assert.False(t, plays[0].Skipped)
+	assert.Equal(t, time.Unix(1180, 0).UTC(), plays[0].PlayedAt)
+	assert.Equal(t, models.PLAY_SOURCE_KIOSK, plays[0].Source)
+}
+
+func TestHistoryBackfill(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+	spotifyService := newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/me/player/recently-played", r.URL.Path)
+		if r.URL.Query().Get("before") == "" {
+			fmt.Fprint(w, `{"items": [
+				{"played_at": "2026-10-19T12:10:00.123Z", "track": {"id": "t2", "name": "Two", "duration_ms": 120000, "artists": [{"id": "a1", "name": "Band"}]}},
+				{"played_at": "2026-10-19T12:05:00Z", "track": {"id": "t1", "name": "One", "duration_ms": 180000}}
+			], "next": "https://api.spotify.com/v1/me/player/recently-played?before=1"}`)
+			return
+		}
+		fmt.Fprint(w, `{"items": [
+			{"played_at": "2026-10-19T12:00:00Z", "track": {"id": "t0", "name": "Zero", "duration_ms": 60000}}
+		], "next": null}`)
+	})
+	history := NewHistoryService(store.Sessions(), store.Plays(), spotifyService)
+	ctx := context.Background()
+
+	// the poller recorded t1 already
+	_, err := history.Record(ctx, &models.PlayEvent{
+		UserId:         1,
+		SpotifyTrackId: "t1",
+		PlayedAt:       time.Date(2026, 10, 19, 12, 4, 58, 0, time.UTC),
+		Source:         models.PLAY_SOURCE_POLLER,
+	})
+	require.NoError(t, err)
+
+	added, err := history.Backfill(ctx, 1, "access-token")
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	// backfilling again adds nothing
+	added, err = history.Backfill(ctx, 1, "access-token")
+	require.NoError(t, err)
+	assert.Equal(t, 0, added)
+
+	plays, err := history.History(ctx, 1, time.Time{}, time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, plays, 3)
+	assert.Equal(t, "t2", plays[0].TrackId)
+	assert.Equal(t, time.Date(2026, 10, 19, 12, 10, 0, 0, time.UTC), plays[0].PlayedAt)
+	assert.Equal(t, time.Date(2026, 10, 19, 12, 8, 0, 123000000, time.UTC), plays[0].StartedAt)
+	assert.Equal(t, []string{"a1"}, plays[0].ArtistIds)
+	assert.Equal(t, 100, plays[0].PlayedPercent)
+	assert.Equal(t, models.PLAY_SOURCE_RECENTLY_PLAYED, plays[0].Source)
+	assert.Equal(t, models.PLAY_SOURCE_POLLER, plays[1].Source)
+	assert.Equal(t, "t0", plays[2].TrackId)
+}
+
+func TestHistoryRange(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	history := NewHistoryService(store.Sessions(), store.Plays(), nil)
+	ctx := context.Background()
+
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	for i, userId := range []int64{1, 2, 1} {
+		_, err := history.Record(ctx, &models.PlayEvent{
+			UserId:         userId,
+			SpotifyTrackId: fmt.Sprintf("t%d", i),
+			PlayedAt:       day.Add(time.Duration(i) * 24 * time.Hour),
+		})
+		require.NoError(t, err)
+	}
+
+	plays, err := history.History(ctx, 1, day, day.Add(48*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, plays, 1)
+	assert.Equal(t, "t0", plays[0].TrackId)
+
+	plays, err = history.History(ctx, 0, day.Add(time.Hour), time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Len(t, plays, 2)
+
+	_, err = history.History(ctx, 1, day, day, 10)
+	assert.EqualError(t, err, pifyErrors.INVALID_HISTORY_RANGE)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+// cursorPrefix versions the content of cursors, which clients treat as opaque.
+const cursorPrefix = "offset:"
+
+// LibraryItem is a catalog item of the library, with the time it was added to it if known.
+type LibraryItem struct {
+	CatalogItem
+	AddedAt *time.Time `json:"added_at,omitempty"`
+}
+
+// LibraryPage is a page of a library list. NextCursor lists the next page, it is empty on the last one.
+type LibraryPage struct {
+	Items      []LibraryItem `json:"items"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// LibraryService lists the playlists and saved tracks and albums of users, paged by cursors.
+type LibraryService struct {
+	spotifyService *SpotifyService
+}
+
+func NewLibraryService(spotifyService *SpotifyService) *LibraryService {
+	return &LibraryService{spotifyService: spotifyService}
+}
+
+func (s *LibraryService) Playlists(ctx context.Context, accessToken, cursor string, limit int) (*LibraryPage, error) {
+	offset, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return libraryPage(ctx, s.spotifyService.ListPlaylists(accessToken, limit, offset), func(playlist *SpotifySimplePlaylist) (LibraryItem, bool) {
+		return LibraryItem{CatalogItem: playlistItem(playlist)}, true
+	})
+}
+
+// PlaylistTracks lists the tracks of a playlist, leaving out the ones that are no longer available.
+func (s *LibraryService) PlaylistTracks(ctx context.Context, accessToken, playlistId, cursor string, limit int) (*LibraryPage, error) {
+	offset, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	page, err := libraryPage(ctx, s.spotifyService.ListPlaylistTracks(accessToken, playlistId, limit, offset), func(item *SpotifyPlaylistTrack) (LibraryItem, bool) {
+		if item.Track == nil {
+			return LibraryItem{}, false
+		}
+		return LibraryItem{CatalogItem: trackItem(item.Track), AddedAt: addedAt(item.AddedAt)}, true
+	})
+	if apiStatus(err) == http.StatusNotFound {
+		return nil, errors.New(pifyErrors.PLAYLIST_NOT_FOUND)
+	}
+	return page, err
+}
+
+func (s *LibraryService) SavedTracks(ctx context.Context, accessToken, cursor string, limit int) (*LibraryPage, error) {
+	offset, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return libraryPage(ctx, s.spotifyService.ListSavedTracks(accessToken, limit, offset), func(item *SpotifySavedTrack) (LibraryItem, bool) {
+		return LibraryItem{CatalogItem: trackItem(&item.Track), AddedAt: addedAt(item.AddedAt)}, true
+	})
+}
+
+func (s *LibraryService) SavedAlbums(ctx context.Context, accessToken, cursor string, limit int) (*LibraryPage, error) {
+	offset, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return libraryPage(ctx, s.spotifyService.ListSavedAlbums(accessToken, limit, offset), func(item *SpotifySavedAlbum) (LibraryItem, bool) {
+		return LibraryItem{CatalogItem: albumItem(&item.Album), AddedAt: addedAt(item.AddedAt)}, true
+	})
+}
+
+// libraryPage requests the first page of pager and converts its items, skipping those toItem rejects.
+func libraryPage[T any](ctx context.Context, pager *SpotifyPager[T], toItem func(*T) (LibraryItem, bool)) (*LibraryPage, error) {
+	page, err := pager.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &LibraryPage{Items: []LibraryItem{}, Total: page.Total}
+	for _, item := range page.Items {
+		if item == nil {
+			continue
+		}
+		if libraryItem, ok := toItem(item); ok {
+			res.Items = append(res.Items, libraryItem)
+		}
+	}
+	if pager.More() {
+		res.NextCursor = encodeCursor(page.Offset + page.Limit)
+	}
+	return res, nil
+}
+
+// encodeCursor returns the opaque cursor of the page at offset.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset of cursor, 0 for the empty cursor of the first page.
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), cursorPrefix) {
+		return 0, errors.New(pifyErrors.INVALID_CURSOR)
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(b), cursorPrefix))
+	if err != nil || offset < 0 {
+		return 0, errors.New(pifyErrors.INVALID_CURSOR)
+	}
+	return offset, nil
+}
+
+// addedAt returns nil for the zero time, Spotify has no date for items added long ago.
+func addedAt(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
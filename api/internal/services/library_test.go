@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+func TestLibraryCursor(t *testing.T) {
+	offset, err := decodeCursor(encodeCursor(40))
+	require.NoError(t, err)
+	assert.Equal(t, 40, offset)
+
+	offset, err = decodeCursor("")
+	require.NoError(t, err)
+	assert.Zero(t, offset)
+
+	for _, cursor := range []string{"40", "!!", encodeCursor(-1)} {
+		_, err := decodeCursor(cursor)
+		assert.EqualError(t, err, pifyErrors.INVALID_CURSOR, cursor)
+	}
+}
+
+func TestLibraryPlaylistTracks(t *testing.T) {
+	var query string
+	service := NewLibraryService(newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/playlists/p1/tracks" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"items": [
+			{"added_at": "2026-01-02T03:04:05Z", "track": {"id": "t1", "name": "Song"}},
+			{"added_at": "2026-01-02T03:04:05Z", "track": null},
+			{"added_at": null, "track": {"id": "t2", "name": "Old song"}}
+		], "limit": 3, "offset": 3, "next": "https://api.spotify.com/v1/playlists/p1/tracks?offset=6&limit=3", "total": 10}`)
+	}))
+	ctx := context.Background()
+
+	page, err := service.PlaylistTracks(ctx, "access-token", "p1", encodeCursor(3), 3)
+	require.NoError(t, err)
+	assert.Equal(t, "limit=3&offset=3", query)
+	assert.Equal(t, 10, page.Total)
+	assert.Equal(t, encodeCursor(6), page.NextCursor)
+
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "t1", page.Items[0].Id)
+	assert.Equal(t, CATALOG_TYPE_TRACK, page.Items[0].Type)
+	require.NotNil(t, page.Items[0].AddedAt)
+	assert.Equal(t, 2026, page.Items[0].AddedAt.Year())
+	assert.Nil(t, page.Items[1].AddedAt)
+
+	_, err = service.PlaylistTracks(ctx, "access-token", "missing", "", 3)
+	assert.EqualError(t, err, pifyErrors.PLAYLIST_NOT_FOUND)
+
+	_, err = service.PlaylistTracks(ctx, "access-token", "p1", "not-a-cursor", 3)
+	assert.EqualError(t, err, pifyErrors.INVALID_CURSOR)
+}
+
+func TestLibraryLastPage(t *testing.T) {
+	service := NewLibraryService(newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items": [{"added_at": "2026-01-02T03:04:05Z", "album": {"id": "a1", "name": "Album"}}], "limit": 20, "offset": 0, "next": null, "total": 1}`)
+	}))
+
+	page, err := service.SavedAlbums(context.Background(), "access-token", "", 20)
+	require.NoError(t, err)
+	assert.Empty(t, page.NextCursor)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, CATALOG_TYPE_ALBUM, page.Items[0].Type)
+}
@@ -0,0 +1,20 @@
+package services
+
+const (
+	TOKEN_REFRESH_SUCCESS  = "success"
+	TOKEN_REFRESH_REJECTED = "rejected"
+	TOKEN_REFRESH_FAILED   = "failed"
+)
+
+// Observer is notified of noteworthy events inside services, e.g. to record metrics.
+type Observer interface {
+	ObserveTokenRefresh(outcome string)
+	ObserveTrackMediaLookup(hit bool)
+}
+
+// nopObserver is used by services until an observer is provided.
+type nopObserver struct{}
+
+func (nopObserver) ObserveTokenRefresh(string) {}
+
+func (nopObserver) ObserveTrackMediaLookup(bool) {}
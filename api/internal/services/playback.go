@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// PlaybackService controls the playback of the kiosk, with the Spotify account of the controller.
+// The kiosk is the Web Playback SDK device registered under the player name, its device id changes
+// whenever the player page is reloaded so clients never pass it in.
+type PlaybackService struct {
+	sessions       repositories.SessionRepository
+	spotifyService *SpotifyService
+	playerName     string
+	// policies checks what is played, when set
+	policies *ContentPolicyService
+}
+
+func NewPlaybackService(sessions repositories.SessionRepository, spotifyService *SpotifyService, playerName string) *PlaybackService {
+	return &PlaybackService{
+		sessions:       sessions,
+		spotifyService: spotifyService,
+		playerName:     playerName,
+	}
+}
+
+// WithPolicies has the content policies checked before anything plays.
+func (s *PlaybackService) WithPolicies(policies *ContentPolicyService) *PlaybackService {
+	s.policies = policies
+	return s
+}
+
+// KioskDevice returns the device of the kiosk among the devices of the access token, preferring the
+// active one if the player registered more than once.
+func (s *PlaybackService) KioskDevice(ctx context.Context, accessToken string) (*SpotifyDevice, error) {
+	devices, err := s.spotifyService.GetUserDevices(ctx, accessToken)
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.GET_DEVICES_FAILED, err)
+	}
+
+	kiosk := s.findKiosk(devices.Devices)
+	if kiosk == nil {
+		return nil, errors.New(pifyErrors.KIOSK_DEVICE_NOT_FOUND)
+	}
+	return kiosk, nil
+}
+
+// findKiosk returns the device of the kiosk among devices, preferring the active one, or nil.
+func (s *PlaybackService) findKiosk(devices []SpotifyDevice) *SpotifyDevice {
+	var kiosk *SpotifyDevice
+	for i, device := range devices {
+		if strings.EqualFold(strings.TrimSpace(device.Name), s.playerName) && (kiosk == nil || device.IsActive) {
+			kiosk = &devices[i]
+		}
+	}
+	return kiosk
+}
+
+// Play starts playback of a context or tracks on the kiosk. Content the policies block fails with
+// CONTENT_BLOCKED.
+func (s *PlaybackService) Play(ctx context.Context, req PlayContextRequest) error {
+	if err := validatePlayRequest(req); err != nil {
+		return err
+	}
+
+	accessToken, err := controllerAccessToken(ctx, s.sessions, s.spotifyService)
+	if err != nil {
+		return err
+	}
+	if s.policies != nil {
+		if err := s.policies.CheckPlay(ctx, accessToken, req); err != nil {
+			return err
+		}
+	}
+	device, err := s.KioskDevice(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	err = s.spotifyService.PlayContext(ctx, accessToken, device.ID, req)
+	if apiStatus(err) == http.StatusNotFound {
+		// the player went away since the devices were listed
+		return errors.New(pifyErrors.KIOSK_DEVICE_NOT_FOUND)
+	}
+	return err
+}
+
+// validatePlayRequest checks that req plays either a context or tracks, and that its offset can be
+// applied: Spotify only supports offsets into albums, playlists and lists of tracks.
+func validatePlayRequest(req PlayContextRequest) error {
+	invalid := errors.New(pifyErrors.INVALID_PLAY_REQUEST)
+
+	if (req.ContextUri == "") == (len(req.Uris) == 0) || req.PositionMs < 0 {
+		return invalid
+	}
+	if req.ContextUri != "" && !strings.HasPrefix(req.ContextUri, "spotify:") {
+		return invalid
+	}
+	for _, uri := range req.Uris {
+		if !strings.HasPrefix(uri, "spotify:") {
+			return invalid
+		}
+	}
+
+	if offset := req.Offset; offset != nil {
+		if (offset.Position == nil) == (offset.Uri == "") {
+			return invalid
+		}
+		if offset.Position != nil && *offset.Position < 0 {
+			return invalid
+		}
+		if strings.HasPrefix(req.ContextUri, "spotify:artist:") {
+			return invalid
+		}
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// types of PlaybackEvent
+const (
+	PLAYBACK_EVENT_TRACK   = "track"
+	PLAYBACK_EVENT_PAUSE   = "pause"
+	PLAYBACK_EVENT_SEEK    = "seek"
+	PLAYBACK_EVENT_VOLUME  = "volume"
+	PLAYBACK_EVENT_DEVICE  = "device"
+	PLAYBACK_EVENT_SHUFFLE = "shuffle"
+	PLAYBACK_EVENT_REPEAT  = "repeat"
+)
+
+// SEEK_TOLERANCE is how far the progress may drift from the expected progress before it counts as a seek.
+const SEEK_TOLERANCE = 3 * time.Second
+
+// PollIntervals are the intervals of the PlaybackPoller: Playing while a track plays, NearEnd once the
+// track is within NearEndWindow of its end, so that the next track is seen quickly, Paused while paused
+// and Idle while nothing plays or Spotify can't be asked.
+type PollIntervals struct {
+	Playing       time.Duration
+	NearEnd       time.Duration
+	NearEndWindow time.Duration
+	Paused        time.Duration
+	Idle          time.Duration
+}
+
+// NewPollIntervals derives the intervals from the interval while playing.
+func NewPollIntervals(playing time.Duration) PollIntervals {
+	return PollIntervals{
+		Playing:       playing,
+		NearEnd:       min(time.Second, playing),
+		NearEndWindow: 2 * playing,
+		Paused:        3 * playing,
+		Idle:          6 * playing,
+	}
+}
+
+// NowPlaying is a snapshot of the playback of the controller.
+type NowPlaying struct {
+	// whether anything is playing or paused, the other fields are empty otherwise
+	Active    bool         `json:"active"`
+	Track     *CatalogItem `json:"track,omitempty"`
+	IsPlaying bool         `json:"is_playing"`
+	// progress into the track at UpdatedAt
+	ProgressMs    int    `json:"progress_ms"`
+	DeviceId      string `json:"device_id,omitempty"`
+	DeviceName    string `json:"device_name,omitempty"`
+	VolumePercent int    `json:"volume_percent"`
+	ShuffleState  bool   `json:"shuffle_state"`
+	RepeatState   string `json:"repeat_state,omitempty"`
+	ContextUri    string `json:"context_uri,omitempty"`
+	// when the snapshot was taken
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// trackId returns the id of the track, empty if nothing is playing.
+func (n *NowPlaying) trackId() string {
+	if n == nil || n.Track == nil {
+		return ""
+	}
+	return n.Track.Id
+}
+
+// remaining returns how long until the end of the track.
+func (n *NowPlaying) remaining() time.Duration {
+	return time.Duration(n.Track.DurationMs-n.ProgressMs) * time.Millisecond
+}
+
+// replayed reports whether the same track started over once played past its middle, as with repeat set
+// to track or the track queued twice, rather than being sought back to its start.
+func replayed(previous, current *NowPlaying) bool {
+	if previous == nil || current == nil || previous.trackId() == "" || previous.trackId() != current.trackId() {
+		return false
+	}
+	elapsed := current.UpdatedAt.Sub(previous.UpdatedAt)
+	expected := previous.ProgressMs
+	if previous.IsPlaying {
+		expected += int(elapsed.Milliseconds())
+	}
+	// the track started over since the previous poll at the latest
+	nearStart := time.Duration(current.ProgressMs)*time.Millisecond <= elapsed+SEEK_TOLERANCE
+	return nearStart && current.ProgressMs < previous.ProgressMs && 2*expected >= previous.Track.DurationMs
+}
+
+// PlaybackEvent is a change of the playback between two polls. Previous or Current is nil when
+// nothing played before, or nothing plays anymore.
+type PlaybackEvent struct {
+	Type     string      `json:"type"`
+	Previous *NowPlaying `json:"previous"`
+	Current  *NowPlaying `json:"current"`
+	At       time.Time   `json:"at"`
+}
+
+// PlaybackPoller follows the playback of the controller by polling Spotify, keeps the latest snapshot
+// and notifies its listeners of changes.
+type PlaybackPoller struct {
+	sessions       repositories.SessionRepository
+	spotifyService *SpotifyService
+	intervals      PollIntervals
+	now            func() time.Time
+
+	mu        sync.RWMutex
+	current   *NowPlaying
+	polledAt  time.Time
+	listeners []func(PlaybackEvent)
+}
+
+func NewPlaybackPoller(sessions repositories.SessionRepository, spotifyService *SpotifyService, intervals PollIntervals) *PlaybackPoller {
+	return &PlaybackPoller{
+		sessions:       sessions,
+		spotifyService: spotifyService,
+		intervals:      intervals,
+		now:            time.Now,
+	}
+}
+
+// Subscribe adds a listener of the changes of the playback. Listeners are called one after the
+// other by the poller and must not block.
+func (p *PlaybackPoller) Subscribe(listener func(PlaybackEvent)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.listeners = append(p.listeners, listener)
+}
+
+// NowPlaying returns the latest snapshot, with the progress of a playing track moved forward to now.
+func (p *PlaybackPoller) NowPlaying() NowPlaying {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.current == nil {
+		return NowPlaying{UpdatedAt: p.polledAt}
+	}
+
+	snapshot := *p.current
+	if snapshot.IsPlaying && snapshot.Track != nil {
+		now := p.now()
+		snapshot.ProgressMs = min(snapshot.ProgressMs+int(now.Sub(snapshot.UpdatedAt).Milliseconds()), snapshot.Track.DurationMs)
+		snapshot.UpdatedAt = now
+	}
+	return snapshot
+}
+
+// Run polls until ctx is cancelled.
+func (p *PlaybackPoller) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "playback polling enabled", "interval", p.intervals.Playing)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			timer.Reset(p.Poll(ctx))
+		}
+	}
+}
+
+// Poll takes a snapshot of the playback, notifies the listeners of what changed since the previous
+// one, and returns when to poll next.
+func (p *PlaybackPoller) Poll(ctx context.Context) time.Duration {
+	current, err := p.fetch(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			slog.WarnContext(ctx, "playback poll failed", "error", err)
+		}
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.retryAfter > p.intervals.Idle {
+			return apiErr.retryAfter
+		}
+		return p.intervals.Idle
+	}
+
+	p.mu.Lock()
+	previous := p.current
+	if !current.Active {
+		current = nil
+	}
+	p.current, p.polledAt = current, p.now()
+	polledAt, listeners := p.polledAt, p.listeners
+	p.mu.Unlock()
+
+	for _, event := range diffPlayback(previous, current, polledAt) {
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+	return p.interval(current)
+}
+
+// fetch returns the playback of the controller, inactive while there is no controller.
+func (p *PlaybackPoller) fetch(ctx context.Context) (*NowPlaying, error) {
+	accessToken, err := controllerAccessToken(ctx, p.sessions, p.spotifyService)
+	if err != nil {
+		if err.Error() == pifyErrors.CONTROLLER_NOT_FOUND {
+			return &NowPlaying{UpdatedAt: p.now()}, nil
+		}
+		return nil, err
+	}
+
+	state, err := p.spotifyService.GetPlaybackState(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return newNowPlaying(state, p.now()), nil
+}
+
+func (p *PlaybackPoller) interval(current *NowPlaying) time.Duration {
+	switch {
+	case current == nil:
+		return p.intervals.Idle
+	case !current.IsPlaying:
+		return p.intervals.Paused
+	case current.Track == nil:
+		return p.intervals.Playing
+	}
+
+	remaining := current.remaining()
+	if remaining <= p.intervals.NearEndWindow {
+		return p.intervals.NearEnd
+	}
+	// wake up as the track enters the window
+	return max(min(p.intervals.Playing, remaining-p.intervals.NearEndWindow), p.intervals.NearEnd)
+}
+
+func newNowPlaying(state *SpotifyPlaybackState, now time.Time) *NowPlaying {
+	if state == nil {
+		return &NowPlaying{UpdatedAt: now}
+	}
+
+	n := &NowPlaying{
+		Active:        true,
+		IsPlaying:     state.IsPlaying,
+		ProgressMs:    state.ProgressMs,
+		DeviceId:      state.Device.ID,
+		DeviceName:    state.Device.Name,
+		VolumePercent: state.Device.VolumePercent,
+		ShuffleState:  state.ShuffleState,
+		RepeatState:   state.RepeatState,
+		UpdatedAt:     now,
+	}
+	if state.Item != nil {
+		track := trackItem(state.Item)
+		n.Track = &track
+	}
+	if state.Context != nil {
+		n.ContextUri = state.Context.Uri
+	}
+	return n
+}
+
+// diffPlayback returns the changes from previous to current, seen at. Pauses and seeks are only
+// reported within the same track, volume changes within the same device.
+func diffPlayback(previous, current *NowPlaying, at time.Time) []PlaybackEvent {
+	if previous == nil && current == nil {
+		return nil
+	}
+
+	var events []PlaybackEvent
+	add := func(eventType string) {
+		events = append(events, PlaybackEvent{Type: eventType, Previous: previous, Current: current, At: at})
+	}
+
+	if previous.trackId() != current.trackId() || replayed(previous, current) {
+		add(PLAYBACK_EVENT_TRACK)
+	}
+	if previous == nil || current == nil {
+		return events
+	}
+
+	// a replay of the track is a new track, not a seek
+	sameTrack := previous.trackId() == current.trackId() && !replayed(previous, current)
+	if previous.DeviceId != current.DeviceId {
+		add(PLAYBACK_EVENT_DEVICE)
+	} else if previous.VolumePercent != current.VolumePercent {
+		add(PLAYBACK_EVENT_VOLUME)
+	}
+	// the progress to expect of a track paused or resumed in between is unknown, it is not checked for seeks
+	if sameTrack && previous.IsPlaying != current.IsPlaying {
+		add(PLAYBACK_EVENT_PAUSE)
+	} else if sameTrack {
+		expected := previous.ProgressMs
+		if previous.IsPlaying {
+			expected += int(current.UpdatedAt.Sub(previous.UpdatedAt).Milliseconds())
+		}
+		drift := time.Duration(current.ProgressMs-expected) * time.Millisecond
+		if drift > SEEK_TOLERANCE || drift < -SEEK_TOLERANCE {
+			add(PLAYBACK_EVENT_SEEK)
+		}
+	}
+	if previous.ShuffleState != current.ShuffleState {
+		add(PLAYBACK_EVENT_SHUFFLE)
+	}
+	if previous.RepeatState != current.RepeatState {
+		add(PLAYBACK_EVENT_REPEAT)
+	}
+	return events
+}
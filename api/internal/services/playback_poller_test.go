@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+var testIntervals = PollIntervals{
+	Playing:       5 * time.Second,
+	NearEnd:       time.Second,
+	NearEndWindow: 10 * time.Second,
+	Paused:        15 * time.Second,
+	Idle:          30 * time.Second,
+}
+
+// fakePlayer answers /me/player with its state, or without content while state is empty.
+type fakePlayer struct {
+	mu     sync.Mutex
+	state  string
+	status int
+}
+
+func (f *fakePlayer) set(state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state, f.status = state, 0
+}
+
+// fail answers /me/player with status.
+func (f *fakePlayer) fail(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *fakePlayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.status != 0:
+		w.WriteHeader(f.status)
+	case f.state == "":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fmt.Fprint(w, f.state)
+	}
+}
+
+func playerState(trackId string, isPlaying bool, progressMs, volume int) string {
+	return fmt.Sprintf(`{"device": {"id": "kiosk", "name": "Pify Player", "volume_percent": %d}, "is_playing": %t,
+		"progress_ms": %d, "shuffle_state": false, "repeat_state": "off",
+		"item": {"id": "%s", "name": "Song", "duration_ms": 200000}}`, volume, isPlaying, progressMs, trackId)
+}
+
+func newTestPoller(t *testing.T, player *fakePlayer) (*PlaybackPoller, *time.Time, *[]PlaybackEvent) {
+	t.Helper()
+
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+
+	poller := NewPlaybackPoller(store.Sessions(), newTestSpotifyService(t, player.ServeHTTP), testIntervals)
+	now := time.Unix(1000, 0)
+	poller.now = func() time.Time { return now }
+
+	var events []PlaybackEvent
+	poller.Subscribe(func(event PlaybackEvent) {
+		events = append(events, event)
+	})
+	return poller, &now, &events
+}
+
+func eventTypes(events []PlaybackEvent) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestPlaybackPoller(t *testing.T) {
+	player := &fakePlayer{}
+	poller, now, events := newTestPoller(t, player)
+	ctx := context.Background()
+
+	assert.Equal(t, testIntervals.Idle, poller.Poll(ctx))
+	assert.Empty(t, *events)
+	assert.False(t, poller.NowPlaying().Active)
+
+	player.set(playerState("t1", true, 10000, 50))
+	assert.Equal(t, testIntervals.Playing, poller.Poll(ctx))
+	assert.Equal(t, []string{PLAYBACK_EVENT_TRACK}, eventTypes(*events))
+	assert.Nil(t, (*events)[0].Previous)
+	assert.Equal(t, "t1", (*events)[0].Current.Track.Id)
+
+	// the snapshot moves forward while playing
+	*now = now.Add(2 * time.Second)
+	nowPlaying := poller.NowPlaying()
+	assert.True(t, nowPlaying.Active)
+	assert.Equal(t, 12000, nowPlaying.ProgressMs)
+
+	*events = nil
+	*now = now.Add(3 * time.Second)
+	player.set(playerState("t1", false, 15000, 70))
+	assert.Equal(t, testIntervals.Paused, poller.Poll(ctx))
+	assert.Equal(t, []string{PLAYBACK_EVENT_VOLUME, PLAYBACK_EVENT_PAUSE}, eventTypes(*events))
+
+	*events = nil
+	*now = now.Add(15 * time.Second)
+	player.set(playerState("t1", false, 120000, 70))
+	poller.Poll(ctx)
+	assert.Equal(t, []string{PLAYBACK_EVENT_SEEK}, eventTypes(*events))
+
+	// nothing plays anymore
+	*events = nil
+	player.set("")
+	assert.Equal(t, testIntervals.Idle, poller.Poll(ctx))
+	assert.Equal(t, []string{PLAYBACK_EVENT_TRACK}, eventTypes(*events))
+	assert.Nil(t, (*events)[0].Current)
+}
+
+func TestPlaybackPollerKeepsSnapshotOnErrors(t *testing.T) {
+	player := &fakePlayer{}
+	poller, _, events := newTestPoller(t, player)
+	ctx := context.Background()
+
+	player.set(playerState("t1", true, 10000, 50))
+	poller.Poll(ctx)
+
+	*events = nil
+	player.fail(http.StatusBadGateway)
+	assert.Equal(t, testIntervals.Idle, poller.Poll(ctx))
+	assert.Empty(t, *events)
+	assert.True(t, poller.NowPlaying().Active)
+}
+
+func TestPlaybackPollerWithoutController(t *testing.T) {
+	poller := NewPlaybackPoller(repositories.NewMemoryStore().Sessions(), NewSpotifyService(SpotifyCredentials{}, nil), testIntervals)
+
+	assert.Equal(t, testIntervals.Idle, poller.Poll(context.Background()))
+	assert.False(t, poller.NowPlaying().Active)
+}
+
+func TestPlaybackPollerInterval(t *testing.T) {
+	poller := NewPlaybackPoller(nil, nil, testIntervals)
+	playing := func(progressMs int) *NowPlaying {
+		return &NowPlaying{Active: true, IsPlaying: true, ProgressMs: progressMs, Track: &CatalogItem{Id: "t1", DurationMs: 200000}}
+	}
+
+	assert.Equal(t, testIntervals.Playing, poller.interval(playing(0)))
+	// wakes up as the track enters the last 10s
+	assert.Equal(t, 3*time.Second, poller.interval(playing(187000)))
+	assert.Equal(t, testIntervals.NearEnd, poller.interval(playing(195000)))
+	assert.Equal(t, testIntervals.Paused, poller.interval(&NowPlaying{Active: true, Track: &CatalogItem{Id: "t1"}}))
+	assert.Equal(t, testIntervals.Idle, poller.interval(nil))
+}
+
+func TestDiffPlayback(t *testing.T) {
+	at := time.Unix(1000, 0)
+	base := NowPlaying{
+		Active:        true,
+		Track:         &CatalogItem{Id: "t1", DurationMs: 200000},
+		IsPlaying:     true,
+		ProgressMs:    10000,
+		DeviceId:      "kiosk",
+		VolumePercent: 50,
+		RepeatState:   "off",
+		UpdatedAt:     at,
+	}
+	// the next poll, 5s later, with the progress that is expected
+	next := func(change func(*NowPlaying)) *NowPlaying {
+		n := base
+		n.ProgressMs += 5000
+		n.UpdatedAt = at.Add(5 * time.Second)
+		change(&n)
+		return &n
+	}
+
+	tests := []struct {
+		name    string
+		current *NowPlaying
+		// changes the previous playback, the base one otherwise
+		previous func(*NowPlaying)
+		expected []string
+	}{
+		{name: "nothing changed", current: next(func(n *NowPlaying) {})},
+		{name: "small drift", current: next(func(n *NowPlaying) { n.ProgressMs += 1000 })},
+		{name: "track", current: next(func(n *NowPlaying) { n.Track = &CatalogItem{Id: "t2"}; n.ProgressMs = 0 }), expected: []string{PLAYBACK_EVENT_TRACK}},
+		{name: "same track again", current: next(func(n *NowPlaying) { n.ProgressMs = 0 }), expected: []string{PLAYBACK_EVENT_SEEK}},
+		{name: "replay after the end", current: next(func(n *NowPlaying) { n.ProgressMs = 1000 }), previous: func(n *NowPlaying) { n.ProgressMs = 198000 }, expected: []string{PLAYBACK_EVENT_TRACK}},
+		{name: "replay past the middle", current: next(func(n *NowPlaying) { n.ProgressMs = 2000 }), previous: func(n *NowPlaying) { n.ProgressMs = 120000 }, expected: []string{PLAYBACK_EVENT_TRACK}},
+		{name: "seek forward", current: next(func(n *NowPlaying) { n.ProgressMs = 90000 }), expected: []string{PLAYBACK_EVENT_SEEK}},
+		{name: "pause", current: next(func(n *NowPlaying) { n.IsPlaying = false; n.ProgressMs = 12000 }), expected: []string{PLAYBACK_EVENT_PAUSE}},
+		{name: "volume", current: next(func(n *NowPlaying) { n.VolumePercent = 80 }), expected: []string{PLAYBACK_EVENT_VOLUME}},
+		{name: "device", current: next(func(n *NowPlaying) { n.DeviceId = "phone"; n.VolumePercent = 100 }), expected: []string{PLAYBACK_EVENT_DEVICE}},
+		{name: "shuffle and repeat", current: next(func(n *NowPlaying) { n.ShuffleState = true; n.RepeatState = "context" }), expected: []string{PLAYBACK_EVENT_SHUFFLE, PLAYBACK_EVENT_REPEAT}},
+		{name: "stopped", current: nil, expected: []string{PLAYBACK_EVENT_TRACK}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := base
+			if tt.previous != nil {
+				tt.previous(&previous)
+			}
+			events := diffPlayback(&previous, tt.current, at)
+			if len(tt.expected) == 0 {
+				assert.Empty(t, events)
+				return
+			}
+			require.Equal(t, tt.expected, eventTypes(events))
+			assert.Equal(t, at, events[0].At)
+		})
+	}
+
+	assert.Empty(t, diffPlayback(nil, nil, at))
+}
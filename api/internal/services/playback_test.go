@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// saveTestController stores a controller session with a valid access token.
+func saveTestController(t *testing.T, store *repositories.MemoryStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := store.Users().Upsert(ctx, &models.User{Username: "alice"})
+	require.NoError(t, err)
+	_, err = store.Sessions().Upsert(ctx, &models.UserSession{
+		UserId:               user.Id,
+		Uuid:                 "kiosk",
+		AccessToken:          "access-token",
+		AccessTokenExpiresAt: time.Now().Add(time.Hour),
+		RefreshToken:         "refresh-token",
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Sessions().SetController(ctx, "kiosk"))
+}
+
+func TestKioskDevice(t *testing.T) {
+	service := NewPlaybackService(nil, newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"devices": [
+			{"id": "phone", "name": "Phone"},
+			{"id": "stale", "name": "pify player"},
+			{"id": "kiosk", "name": "Pify Player", "is_active": true}
+		]}`)
+	}), "Pify Player")
+
+	device, err := service.KioskDevice(context.Background(), "access-token")
+	require.NoError(t, err)
+	assert.Equal(t, "kiosk", device.ID)
+
+	service.playerName = "Living Room"
+	_, err = service.KioskDevice(context.Background(), "access-token")
+	assert.EqualError(t, err, pifyErrors.KIOSK_DEVICE_NOT_FOUND)
+}
+
+func TestPlay(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+
+	var deviceId string
+	var body PlayContextRequest
+	playStatus := http.StatusNoContent
+	service := NewPlaybackService(store.Sessions(), newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/me/player/devices":
+			fmt.Fprint(w, `{"devices": [{"id": "kiosk-id", "name": "Pify Player"}]}`)
+		case "/v1/me/player/play":
+			assert.Equal(t, http.MethodPut, r.Method)
+			deviceId = r.URL.Query().Get("device_id")
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			w.WriteHeader(playStatus)
+		}
+	}), "Pify Player")
+
+	position := 4
+	req := PlayContextRequest{
+		ContextUri: "spotify:playlist:p1",
+		Offset:     &PlayOffset{Position: &position},
+		PositionMs: 30000,
+	}
+	require.NoError(t, service.Play(context.Background(), req))
+	assert.Equal(t, "kiosk-id", deviceId)
+	assert.Equal(t, req, body)
+
+	playStatus = http.StatusNotFound
+	assert.EqualError(t, service.Play(context.Background(), req), pifyErrors.KIOSK_DEVICE_NOT_FOUND)
+
+	playStatus = http.StatusInternalServerError
+	assert.EqualError(t, service.Play(context.Background(), req), pifyErrors.PLAYBACK_FAILED)
+}
+
+func TestPlayWithoutController(t *testing.T) {
+	service := NewPlaybackService(repositories.NewMemoryStore().Sessions(), NewSpotifyService(SpotifyCredentials{}, nil), "Pify Player")
+
+	err := service.Play(context.Background(), PlayContextRequest{ContextUri: "spotify:album:a1"})
+	assert.EqualError(t, err, pifyErrors.CONTROLLER_NOT_FOUND)
+}
+
+func TestValidatePlayRequest(t *testing.T) {
+	zero, negative := 0, -1
+	tests := []struct {
+		name  string
+		req   PlayContextRequest
+		valid bool
+	}{
+		{name: "context", req: PlayContextRequest{ContextUri: "spotify:album:a1"}, valid: true},
+		{name: "tracks from uri", req: PlayContextRequest{Uris: []string{"spotify:track:t1", "spotify:track:t2"}, Offset: &PlayOffset{Uri: "spotify:track:t2"}}, valid: true},
+		{name: "playlist from position", req: PlayContextRequest{ContextUri: "spotify:playlist:p1", Offset: &PlayOffset{Position: &zero}, PositionMs: 1000}, valid: true},
+		{name: "artist", req: PlayContextRequest{ContextUri: "spotify:artist:b1"}, valid: true},
+		{name: "nothing", req: PlayContextRequest{}},
+		{name: "context and tracks", req: PlayContextRequest{ContextUri: "spotify:album:a1", Uris: []string{"spotify:track:t1"}}},
+		{name: "not a uri", req: PlayContextRequest{Uris: []string{"https://open.spotify.com/track/t1"}}},
+		{name: "negative position", req: PlayContextRequest{ContextUri: "spotify:album:a1", Offset: &PlayOffset{Position: &negative}}},
+		{name: "position and uri", req: PlayContextRequest{ContextUri: "spotify:album:a1", Offset: &PlayOffset{Position: &zero, Uri: "spotify:track:t1"}}},
+		{name: "empty offset", req: PlayContextRequest{ContextUri: "spotify:album:a1", Offset: &PlayOffset{}}},
+		{name: "artist offset", req: PlayContextRequest{ContextUri: "spotify:artist:b1", Offset: &PlayOffset{Position: &zero}}},
+		{name: "negative position_ms", req: PlayContextRequest{ContextUri: "spotify:album:a1", PositionMs: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePlayRequest(tt.req)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, pifyErrors.INVALID_PLAY_REQUEST)
+			}
+		})
+	}
+}
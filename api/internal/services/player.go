@@ -4,10 +4,9 @@ import (
 	"context"
 	"errors"
 
-	"github.com/edgejay/pify-player/api/internal/database"
 	"github.com/edgejay/pify-player/api/internal/database/models"
 	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
-	"github.com/uptrace/bun"
+	"github.com/edgejay/pify-player/api/internal/repositories"
 )
 
 const (
@@ -23,25 +22,23 @@ const (
 )
 
 type PlayerService struct {
-	db *database.SQLiteDB
+	sessions   repositories.SessionRepository
+	trackMedia repositories.TrackMediaRepository
+	observer   Observer
 }
 
-func NewPlayerService(db *database.SQLiteDB) *PlayerService {
-	ps := &PlayerService{db}
-	return ps
+func NewPlayerService(sessions repositories.SessionRepository, trackMedia repositories.TrackMediaRepository) *PlayerService {
+	return &PlayerService{sessions, trackMedia, nopObserver{}}
 }
 
-func (s *PlayerService) GetControllerSession() (*models.UserSession, error) {
-	// fetch session
-	session := &models.UserSession{}
-	err := s.db.Bun.NewSelect().
-		Model(session).
-		Relation("User", func(sq *bun.SelectQuery) *bun.SelectQuery {
-			return sq.Column("display_name", "profile_image_url")
-		}).
-		Where("user_session.is_controller = TRUE").
-		Scan(context.Background())
+// WithObserver sets the observer notified of track media cache hits and misses.
+func (s *PlayerService) WithObserver(observer Observer) *PlayerService {
+	s.observer = observer
+	return s
+}
 
+func (s *PlayerService) GetControllerSession(ctx context.Context) (*models.UserSession, error) {
+	session, err := s.sessions.GetController(ctx)
 	if err != nil {
 		// no session or session with controller privileges found
 		return nil, errors.New(pifyErrors.INVALID_SESSION)
@@ -50,33 +47,21 @@ func (s *PlayerService) GetControllerSession() (*models.UserSession, error) {
 	return session, nil
 }
 
-func (s *PlayerService) GetTrackMedia(spotifyTrackId string, mediaType TrackMediaType) *models.TrackMedia {
-	trackMedia := &models.TrackMedia{}
-
-	err := s.db.Bun.NewSelect().
-		Model(trackMedia).
-		Where("spotify_track_id = ? AND media_type = ?", spotifyTrackId, mediaType).
-		Scan(context.Background())
-
+func (s *PlayerService) GetTrackMedia(ctx context.Context, spotifyTrackId string, mediaType TrackMediaType) *models.TrackMedia {
+	trackMedia, err := s.trackMedia.Get(ctx, spotifyTrackId, string(mediaType))
 	if err != nil {
+		s.observer.ObserveTrackMediaLookup(false)
 		return nil
 	}
 
+	s.observer.ObserveTrackMediaLookup(true)
 	return trackMedia
 }
 
-func (s *PlayerService) SaveTrackMedia(spotifyTrackId, mediaId string, mediaType TrackMediaType) error {
-	_, err := s.db.Bun.NewInsert().
-		Model(&models.TrackMedia{
-			SpotifyTrackId: spotifyTrackId,
-			MediaId:        mediaId,
-			MediaType:      string(mediaType),
-		}).
-		Exec(context.Background())
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+func (s *PlayerService) SaveTrackMedia(ctx context.Context, spotifyTrackId, mediaId string, mediaType TrackMediaType) error {
+	return s.trackMedia.Upsert(ctx, &models.TrackMedia{
+		SpotifyTrackId: spotifyTrackId,
+		MediaId:        mediaId,
+		MediaType:      string(mediaType),
+	})
 }
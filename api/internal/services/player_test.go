@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+func TestSaveTrackMediaUpserts(t *testing.T) {
+	ctx := context.Background()
+	store := repositories.NewMemoryStore()
+	s := NewPlayerService(store.Sessions(), store.TrackMedia())
+
+	require.NoError(t, s.SaveTrackMedia(ctx, "track", "first", TRACK_MEDIA_TYPE_YOUTUBE))
+	require.NoError(t, s.SaveTrackMedia(ctx, "track", "second", TRACK_MEDIA_TYPE_YOUTUBE))
+
+	media := s.GetTrackMedia(ctx, "track", TRACK_MEDIA_TYPE_YOUTUBE)
+	require.NotNil(t, media)
+	assert.Equal(t, "second", media.MediaId)
+}
+
+func TestGetControllerSessionWithoutController(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	s := NewPlayerService(store.Sessions(), store.TrackMedia())
+
+	_, err := s.GetControllerSession(context.Background())
+	assert.EqualError(t, err, pifyErrors.INVALID_SESSION)
+}
@@ -0,0 +1,512 @@
+package services
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+// MAX_SCROBBLE_BATCH is the largest number of plays scrobbled in one call.
+const MAX_SCROBBLE_BATCH = 50
+
+// MAX_SCROBBLE_AGE is how old a play may get before scrobbling services stop accepting it. Older
+// pending scrobbles are dropped.
+const MAX_SCROBBLE_AGE = 14 * 24 * time.Hour
+
+// SCROBBLE_ERROR_INVALID_PARAMETERS is the error code of the AudioScrobbler 2.0 api for calls it
+// will never accept.
+const SCROBBLE_ERROR_INVALID_PARAMETERS = 6
+
+// ScrobbleApiError is an error answered by the scrobbling service.
+type ScrobbleApiError struct {
+	Code    int    `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *ScrobbleApiError) Error() string {
+	return fmt.Sprintf("scrobble api error %d: %s", e.Code, e.Message)
+}
+
+// ScrobbleAccount describes the scrobbling account linked by a user.
+type ScrobbleAccount struct {
+	Username string    `json:"username"`
+	LinkedAt time.Time `json:"linked_at"`
+	// Pending is the number of plays of the user waiting to be scrobbled
+	Pending int `json:"pending"`
+}
+
+// ScrobbleService scrobbles the plays of the history to a service speaking the Last.fm AudioScrobbler
+// 2.0 api, such as Last.fm, Libre.fm or ListenBrainz, for the users that linked an account. Plays are
+// queued in the database first, so that plays made while the network is down are sent later.
+type ScrobbleService struct {
+	apiUrl        string
+	authUrl       string
+	apiKey        string
+	apiSecret     string
+	retryInterval time.Duration
+	sessions      repositories.SessionRepository
+	scrobbles     repositories.ScrobbleRepository
+	httpClient    *http.Client
+	now           func() time.Time
+
+	// wake asks Run to send the pending scrobbles now
+	wake chan struct{}
+	// flushMu keeps a batch from being sent twice
+	flushMu sync.Mutex
+}
+
+func NewScrobbleService(
+	settings utils.ScrobbleSettings,
+	sessions repositories.SessionRepository,
+	scrobbles repositories.ScrobbleRepository,
+	httpClient *http.Client,
+) *ScrobbleService {
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Timeout: time.Second * 30,
+		}
+	}
+
+	return &ScrobbleService{
+		apiUrl:        settings.ApiUrl,
+		authUrl:       settings.AuthUrl,
+		apiKey:        settings.ApiKey,
+		apiSecret:     settings.ApiSecret,
+		retryInterval: settings.RetryInterval,
+		sessions:      sessions,
+		scrobbles:     scrobbles,
+		httpClient:    httpClient,
+		now:           time.Now,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// Enabled reports whether the api key and secret of the scrobbling service are configured.
+func (s *ScrobbleService) Enabled() bool {
+	return s.apiKey != "" && s.apiSecret != ""
+}
+
+// GetAuthUrl returns the page of the scrobbling service the user authorizes the api on, which then
+// redirects to callbackUrl with a token.
+func (s *ScrobbleService) GetAuthUrl(callbackUrl string) (string, error) {
+	if !s.Enabled() {
+		return "", errors.New(pifyErrors.SCROBBLING_DISABLED)
+	}
+
+	authUrl, err := url.Parse(s.authUrl)
+	if err != nil {
+		return "", err
+	}
+	query := authUrl.Query()
+	query.Set("api_key", s.apiKey)
+	query.Set("cb", callbackUrl)
+	authUrl.RawQuery = query.Encode()
+	return authUrl.String(), nil
+}
+
+// Link exchanges the token the scrobbling service redirected with for a session, and links the
+// account to the user in place of the account the user linked before.
+func (s *ScrobbleService) Link(ctx context.Context, userId int64, token string) (*ScrobbleAccount, error) {
+	if !s.Enabled() {
+		return nil, errors.New(pifyErrors.SCROBBLING_DISABLED)
+	}
+	if token == "" {
+		return nil, errors.New(pifyErrors.MISSING_SCROBBLE_TOKEN)
+	}
+
+	var res struct {
+		Session struct {
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		} `json:"session"`
+	}
+	if err := s.call(ctx, "auth.getSession", url.Values{"token": {token}}, &res); err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.LINK_SCROBBLE_ACCOUNT_FAILED, err)
+	}
+	if res.Session.Key == "" {
+		return nil, errors.New(pifyErrors.LINK_SCROBBLE_ACCOUNT_FAILED)
+	}
+
+	if err := s.scrobbles.SaveAccount(ctx, &models.ScrobbleAccount{
+		UserId:     userId,
+		Username:   res.Session.Name,
+		SessionKey: res.Session.Key,
+	}); err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+	}
+	slog.InfoContext(ctx, "scrobbling account linked", "user_id", userId, "username", res.Session.Name)
+
+	// plays queued while the session key was invalid can be sent again
+	s.Wake()
+	return s.GetAccount(ctx, userId)
+}
+
+// GetAccount returns the account linked by the user.
+func (s *ScrobbleService) GetAccount(ctx context.Context, userId int64) (*ScrobbleAccount, error) {
+	account, err := s.scrobbles.GetAccount(ctx, userId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errors.New(pifyErrors.SCROBBLE_ACCOUNT_NOT_FOUND)
+	}
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+	}
+
+	pending, err := s.scrobbles.Pending(ctx, 0)
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+	}
+	count := 0
+	for _, scrobble := range pending {
+		if scrobble.UserId == userId {
+			count++
+		}
+	}
+
+	return &ScrobbleAccount{
+		Username: account.Username,
+		LinkedAt: account.UpdatedAt,
+		Pending:  count,
+	}, nil
+}
+
+// Unlink removes the account linked by the user, and the plays of the user not scrobbled yet.
+func (s *ScrobbleService) Unlink(ctx context.Context, userId int64) error {
+	err := s.scrobbles.DeleteAccount(ctx, userId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return errors.New(pifyErrors.SCROBBLE_ACCOUNT_NOT_FOUND)
+	}
+	if err != nil {
+		return pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+	}
+	return nil
+}
+
+// Listen sends the tracks the controller starts playing, seen by poller, as now playing, and
+// scrobbles the plays added to history.
+func (s *ScrobbleService) Listen(poller *PlaybackPoller, history *HistoryService) {
+	poller.Subscribe(s.onPlayback)
+	history.Subscribe(s.onPlay)
+}
+
+func (s *ScrobbleService) onPlayback(event PlaybackEvent) {
+	if !s.Enabled() || event.Type != PLAYBACK_EVENT_TRACK || event.Current == nil || !event.Current.IsPlaying || event.Current.Track == nil {
+		return
+	}
+	track := *event.Current.Track
+
+	// the poller must not wait for the scrobbling service
+	go func() {
+		ctx := context.Background()
+		session, err := getController(ctx, s.sessions)
+		if err != nil {
+			return
+		}
+		if err := s.NowPlaying(ctx, session.UserId, track); err != nil && err.Error() != pifyErrors.SCROBBLE_ACCOUNT_NOT_FOUND {
+			slog.WarnContext(ctx, "now playing not sent", "track_id", track.Id, "error", err)
+		}
+	}()
+}
+
+func (s *ScrobbleService) onPlay(play *models.PlayEvent) {
+	if !s.Enabled() {
+		return
+	}
+
+	ctx := context.Background()
+	if _, err := s.Queue(ctx, play); err != nil {
+		slog.ErrorContext(ctx, "play not queued for scrobbling", "track_id", play.SpotifyTrackId, "error", err)
+		return
+	}
+	s.Wake()
+}
+
+// NowPlaying tells the scrobbling service that the user started listening to track. Now playing
+// notifications are not retried.
+func (s *ScrobbleService) NowPlaying(ctx context.Context, userId int64, track CatalogItem) error {
+	account, err := s.scrobbles.GetAccount(ctx, userId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return errors.New(pifyErrors.SCROBBLE_ACCOUNT_NOT_FOUND)
+	}
+	if err != nil {
+		return pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+	}
+
+	params := url.Values{
+		"sk":     {account.SessionKey},
+		"artist": {mainArtist(track.Subtitle, len(track.ArtistIds))},
+		"track":  {track.Name},
+	}
+	if track.DurationMs > 0 {
+		params.Set("duration", strconv.Itoa(track.DurationMs/1000))
+	}
+	if err := s.call(ctx, "track.updateNowPlaying", params, nil); err != nil {
+		return pifyErrors.Wrap(pifyErrors.SCROBBLE_FAILED, err)
+	}
+	return nil
+}
+
+// Queue adds the play to the scrobbles to send if the user linked an account and the play counts
+// as a scrobble, and reports whether it was added. Plays backfilled from the recently played tracks
+// of Spotify are left out, they were played elsewhere and scrobbled from there.
+func (s *ScrobbleService) Queue(ctx context.Context, play *models.PlayEvent) (bool, error) {
+	if play.Source == models.PLAY_SOURCE_RECENTLY_PLAYED || !scrobbleable(play) {
+		return false, nil
+	}
+
+	if _, err := s.scrobbles.GetAccount(ctx, play.UserId); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return false, nil
+		}
+		return false, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+	}
+
+	added, err := s.scrobbles.Enqueue(ctx, &models.PendingScrobble{
+		UserId:     play.UserId,
+		Artist:     mainArtist(play.ArtistNames, len(playArtistIds(play))),
+		Track:      play.TrackName,
+		DurationMs: play.DurationMs,
+		Timestamp:  play.StartedAt.UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		return false, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+	}
+	return added, nil
+}
+
+// Wake asks Run to send the pending scrobbles without waiting for the retry interval.
+func (s *ScrobbleService) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the pending scrobbles when woken up, and every retry interval, until ctx is cancelled.
+func (s *ScrobbleService) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "scrobbling enabled", "api_url", s.apiUrl, "retry_interval", s.retryInterval)
+
+	ticker := time.NewTicker(s.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Flush(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			slog.WarnContext(ctx, "scrobbles not sent, retrying later", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// Flush sends the pending scrobbles, user by user in batches, and returns how many were sent.
+// Scrobbles the service can't accept and scrobbles too old are dropped, the others are kept for
+// the next attempt when the service or the network fails.
+func (s *ScrobbleService) Flush(ctx context.Context) (int, error) {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	pending, err := s.scrobbles.Pending(ctx, 0)
+	if err != nil {
+		return 0, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+	}
+
+	var userIds []int64
+	byUser := make(map[int64][]*models.PendingScrobble)
+	for _, scrobble := range pending {
+		if _, ok := byUser[scrobble.UserId]; !ok {
+			userIds = append(userIds, scrobble.UserId)
+		}
+		byUser[scrobble.UserId] = append(byUser[scrobble.UserId], scrobble)
+	}
+
+	sent := 0
+	var failed error
+	for _, userId := range userIds {
+		scrobbles := byUser[userId]
+
+		account, err := s.scrobbles.GetAccount(ctx, userId)
+		if errors.Is(err, repositories.ErrNotFound) {
+			// unlinked since
+			if err := s.scrobbles.Dequeue(ctx, scrobbleIds(scrobbles)...); err != nil {
+				return sent, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+			}
+			continue
+		}
+		if err != nil {
+			return sent, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+		}
+
+		oldest := s.now().Add(-MAX_SCROBBLE_AGE)
+		var expired, fresh []*models.PendingScrobble
+		for _, scrobble := range scrobbles {
+			if scrobble.Timestamp.Before(oldest) {
+				expired = append(expired, scrobble)
+			} else {
+				fresh = append(fresh, scrobble)
+			}
+		}
+		if len(expired) > 0 {
+			slog.WarnContext(ctx, "scrobbles dropped, too old", "user_id", userId, "count", len(expired))
+			if err := s.scrobbles.Dequeue(ctx, scrobbleIds(expired)...); err != nil {
+				return sent, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+			}
+		}
+
+		for batch := range slices.Chunk(fresh, MAX_SCROBBLE_BATCH) {
+			err := s.scrobble(ctx, account, batch)
+			if err != nil && !refused(err) {
+				// kept for the next attempt, the next batches of the user would fail as well
+				if err := s.scrobbles.MarkFailed(ctx, err.Error(), scrobbleIds(batch)...); err != nil {
+					return sent, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+				}
+				failed = err
+				break
+			}
+
+			if err != nil {
+				slog.WarnContext(ctx, "scrobbles dropped, refused by the scrobbling service", "user_id", userId, "count", len(batch), "error", err)
+			} else {
+				sent += len(batch)
+			}
+			if err := s.scrobbles.Dequeue(ctx, scrobbleIds(batch)...); err != nil {
+				return sent, pifyErrors.Wrap(pifyErrors.SCROBBLE_QUEUE_FAILED, err)
+			}
+		}
+	}
+
+	if failed != nil {
+		return sent, pifyErrors.Wrap(pifyErrors.SCROBBLE_FAILED, failed)
+	}
+	return sent, nil
+}
+
+// scrobble sends a batch of plays of the account.
+func (s *ScrobbleService) scrobble(ctx context.Context, account *models.ScrobbleAccount, batch []*models.PendingScrobble) error {
+	params := url.Values{"sk": {account.SessionKey}}
+	for i, scrobble := range batch {
+		params.Set(fmt.Sprintf("artist[%d]", i), scrobble.Artist)
+		params.Set(fmt.Sprintf("track[%d]", i), scrobble.Track)
+		params.Set(fmt.Sprintf("timestamp[%d]", i), strconv.FormatInt(scrobble.Timestamp.Unix(), 10))
+		if scrobble.DurationMs > 0 {
+			params.Set(fmt.Sprintf("duration[%d]", i), strconv.Itoa(scrobble.DurationMs/1000))
+		}
+	}
+	return s.call(ctx, "track.scrobble", params, nil)
+}
+
+// call posts a signed call of method to the scrobbling service, and decodes the answer into res
+// unless it is nil.
+func (s *ScrobbleService) call(ctx context.Context, method string, params url.Values, res any) error {
+	params.Set("method", method)
+	params.Set("api_key", s.apiKey)
+	params.Set("api_sig", signScrobbleCall(params, s.apiSecret))
+	params.Set("format", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiUrl, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// errors are answered as {"error": 9, "message": "Invalid session key"}, with any status
+	apiErr := &ScrobbleApiError{}
+	if json.Unmarshal(body, apiErr) == nil && apiErr.Code != 0 {
+		return apiErr
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("scrobble api answered %s", resp.Status)
+	}
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal(body, res)
+}
+
+// refused reports whether the scrobbling service refused the call itself, so that sending it again
+// would not change the outcome. Failures of the network, of the service and invalid session keys
+// are worth retrying, the latter once the account is linked again.
+func refused(err error) bool {
+	var apiErr *ScrobbleApiError
+	return errors.As(err, &apiErr) && apiErr.Code == SCROBBLE_ERROR_INVALID_PARAMETERS
+}
+
+// signScrobbleCall returns the api_sig of a call: the md5 of the parameters sorted by name,
+// concatenated as name and value, followed by the secret.
+func signScrobbleCall(params url.Values, secret string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if name != "format" && name != "callback" && name != "api_sig" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteString(params.Get(name))
+	}
+	b.WriteString(secret)
+
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// scrobbleable reports whether the play counts as a scrobble: the track is longer than 30 seconds,
+// and was played for half of it or 4 minutes.
+func scrobbleable(play *models.PlayEvent) bool {
+	listened := time.Duration(play.DurationMs*play.PlayedPercent/100) * time.Millisecond
+	duration := time.Duration(play.DurationMs) * time.Millisecond
+	return duration > 30*time.Second && listened >= min(duration/2, 4*time.Minute)
+}
+
+// mainArtist returns the name of the main artist of a track from the names of its artists joined by
+// commas. The names of single artist tracks are kept whole, as they may contain commas themselves.
+func mainArtist(artistNames string, artistCount int) string {
+	if artistCount <= 1 {
+		return artistNames
+	}
+	name, _, _ := strings.Cut(artistNames, ", ")
+	return name
+}
+
+func scrobbleIds(scrobbles []*models.PendingScrobble) []int64 {
+	ids := make([]int64, len(scrobbles))
+	for i, scrobble := range scrobbles {
+		ids[i] = scrobble.Id
+	}
+	return ids
+}
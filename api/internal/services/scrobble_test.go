@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+	"github.com/edgejay/pify-player/api/internal/utils"
+)
+
+// fakeScrobbler is a scrobbling service speaking the AudioScrobbler 2.0 api, that checks the
+// signature of the calls and records them.
+type fakeScrobbler struct {
+	t  *testing.T
+	mu sync.Mutex
+	// calls are the form values of the calls, signature excluded
+	calls []url.Values
+	// offline answers every call with a temporarily unavailable error
+	offline bool
+	// refuse answers scrobbles with an invalid parameters error
+	refuse bool
+}
+
+func (f *fakeScrobbler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	require.NoError(f.t, r.ParseForm())
+	params := r.PostForm
+	assert.Equal(f.t, "json", params.Get("format"))
+	assert.Equal(f.t, "api-key", params.Get("api_key"))
+	signature := params.Get("api_sig")
+	params.Del("api_sig")
+	if signature != signScrobbleCall(params, "api-secret") {
+		fmt.Fprint(w, `{"error": 13, "message": "Invalid method signature supplied"}`)
+		return
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, params)
+	offline, refuse := f.offline, f.refuse
+	f.mu.Unlock()
+
+	if offline {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error": 16, "message": "There was a temporary error processing your request"}`)
+		return
+	}
+
+	switch params.Get("method") {
+	case "auth.getSession":
+		if params.Get("token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error": 4, "message": "Invalid authentication token supplied"}`)
+			return
+		}
+		fmt.Fprint(w, `{"session": {"name": "alice-fm", "key": "session-key", "subscriber": 0}}`)
+	case "track.updateNowPlaying":
+		fmt.Fprint(w, `{"nowplaying": {}}`)
+	case "track.scrobble":
+		if refuse {
+			fmt.Fprint(w, `{"error": 6, "message": "Invalid parameters"}`)
+			return
+		}
+		fmt.Fprint(w, `{"scrobbles": {"@attr": {"accepted": 1, "ignored": 0}}}`)
+	default:
+		fmt.Fprint(w, `{"error": 3, "message": "Invalid Method"}`)
+	}
+}
+
+func (f *fakeScrobbler) set(offline, refuse bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offline, f.refuse = offline, refuse
+}
+
+// methodCalls returns the calls of method.
+func (f *fakeScrobbler) methodCalls(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []url.Values
+	for _, call := range f.calls {
+		if call.Get("method") == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// newTestScrobbleService returns a scrobble service of the fake scrobbler, for the users of store.
+func newTestScrobbleService(t *testing.T) (*ScrobbleService, *fakeScrobbler, *repositories.MemoryStore) {
+	t.Helper()
+
+	fake := &fakeScrobbler{t: t}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+
+	service := NewScrobbleService(utils.ScrobbleSettings{
+		ApiUrl:        server.URL + "/2.0/",
+		AuthUrl:       "https://scrobbler.example.com/api/auth/",
+		ApiKey:        "api-key",
+		ApiSecret:     "api-secret",
+		RetryInterval: time.Minute,
+	}, store.Sessions(), store.Scrobbles(), server.Client())
+	service.now = func() time.Time { return time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC) }
+	return service, fake, store
+}
+
+// scrobblePlay is a play of alice, the controller, started at start.
+func scrobblePlay(trackId, name string, durationMs, percent int, start time.Time) *models.PlayEvent {
+	play := newPlayEvent(1, trackId, name, []string{"a1", "a2"}, "Band, Singer", durationMs, start,
+		start.Add(time.Duration(durationMs*percent/100)*time.Millisecond), durationMs*percent/100)
+	play.Source = models.PLAY_SOURCE_POLLER
+	return play
+}
+
+func TestSignScrobbleCall(t *testing.T) {
+	params := url.Values{
+		"method":  {"auth.getSession"},
+		"api_key": {"key"},
+		"token":   {"tok"},
+		"format":  {"json"},
+	}
+	assert.Equal(t, "04e870be4bb79756721b7bc1937fe83d", signScrobbleCall(params, "secret"))
+}
+
+func TestScrobbleLink(t *testing.T) {
+	service, fake, _ := newTestScrobbleService(t)
+	ctx := context.Background()
+
+	authUrl, err := service.GetAuthUrl("https://localhost/api/v1/scrobble/callback")
+	require.NoError(t, err)
+	assert.Equal(t, "https://scrobbler.example.com/api/auth/?api_key=api-key&cb=https%3A%2F%2Flocalhost%2Fapi%2Fv1%2Fscrobble%2Fcallback", authUrl)
+
+	_, err = service.GetAccount(ctx, 1)
+	assert.EqualError(t, err, pifyErrors.SCROBBLE_ACCOUNT_NOT_FOUND)
+
+	_, err = service.Link(ctx, 1, "expired")
+	assert.EqualError(t, err, pifyErrors.LINK_SCROBBLE_ACCOUNT_FAILED)
+	_, err = service.Link(ctx, 1, "")
+	assert.EqualError(t, err, pifyErrors.MISSING_SCROBBLE_TOKEN)
+
+	account, err := service.Link(ctx, 1, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "alice-fm", account.Username)
+	assert.Zero(t, account.Pending)
+	assert.Len(t, fake.methodCalls("auth.getSession"), 2)
+
+	require.NoError(t, service.NowPlaying(ctx, 1, CatalogItem{Name: "Song", Subtitle: "Band, Singer", ArtistIds: []string{"a1", "a2"}, DurationMs: 200000}))
+	nowPlaying := fake.methodCalls("track.updateNowPlaying")
+	require.Len(t, nowPlaying, 1)
+	assert.Equal(t, "session-key", nowPlaying[0].Get("sk"))
+	assert.Equal(t, "Band", nowPlaying[0].Get("artist"))
+	assert.Equal(t, "200", nowPlaying[0].Get("duration"))
+
+	require.NoError(t, service.Unlink(ctx, 1))
+	assert.EqualError(t, service.Unlink(ctx, 1), pifyErrors.SCROBBLE_ACCOUNT_NOT_FOUND)
+	assert.EqualError(t, service.NowPlaying(ctx, 1, CatalogItem{Name: "Song"}), pifyErrors.SCROBBLE_ACCOUNT_NOT_FOUND)
+}
+
+func TestScrobbleDisabled(t *testing.T) {
+	service := NewScrobbleService(utils.ScrobbleSettings{ApiUrl: utils.DEFAULT_SCROBBLE_API_URL}, nil, nil, nil)
+
+	assert.False(t, service.Enabled())
+	_, err := service.GetAuthUrl("https://localhost/api/v1/scrobble/callback")
+	assert.EqualError(t, err, pifyErrors.SCROBBLING_DISABLED)
+	_, err = service.Link(context.Background(), 1, "token")
+	assert.EqualError(t, err, pifyErrors.SCROBBLING_DISABLED)
+}
+
+func TestScrobbleQueue(t *testing.T) {
+	service, fake, _ := newTestScrobbleService(t)
+	ctx := context.Background()
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	// nothing is queued before an account is linked
+	added, err := service.Queue(ctx, scrobblePlay("t1", "One", 200000, 100, start))
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	_, err = service.Link(ctx, 1, "token")
+	require.NoError(t, err)
+
+	elsewhere := scrobblePlay("t7", "Seven", 200000, 100, start.Add(5*time.Hour))
+	elsewhere.Source = models.PLAY_SOURCE_RECENTLY_PLAYED
+
+	// in order, the play started at the same time as a queued one is not queued again
+	tests := []struct {
+		name     string
+		play     *models.PlayEvent
+		expected bool
+	}{
+		{"played through", scrobblePlay("t1", "One", 200000, 100, start), true},
+		{"played half", scrobblePlay("t2", "Two", 200000, 50, start.Add(time.Hour)), true},
+		{"played 4 minutes", scrobblePlay("t3", "Three", 600000, 40, start.Add(2*time.Hour)), true},
+		{"same start", scrobblePlay("t4", "Four", 200000, 100, start), false},
+		{"skipped", scrobblePlay("t5", "Five", 200000, 49, start.Add(3*time.Hour)), false},
+		{"30 seconds long", scrobblePlay("t6", "Six", 30000, 100, start.Add(4*time.Hour)), false},
+		{"recently played elsewhere", elsewhere, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			added, err := service.Queue(ctx, test.play)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, added)
+		})
+	}
+
+	account, err := service.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, account.Pending)
+	assert.Empty(t, fake.methodCalls("track.scrobble"))
+}
+
+func TestScrobbleFlush(t *testing.T) {
+	service, fake, store := newTestScrobbleService(t)
+	ctx := context.Background()
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+	_, err := service.Link(ctx, 1, "token")
+	require.NoError(t, err)
+	for i := range MAX_SCROBBLE_BATCH + 1 {
+		_, err := service.Queue(ctx, scrobblePlay("t1", "One", 200000, 100, start.Add(time.Duration(i)*time.Minute)))
+		require.NoError(t, err)
+	}
+	// older than 14 days
+	_, err = service.Queue(ctx, scrobblePlay("t2", "Two", 200000, 100, start.AddDate(0, 0, -15)))
+	require.NoError(t, err)
+
+	// the network is down, the scrobbles are kept
+	fake.set(true, false)
+	sent, err := service.Flush(ctx)
+	assert.EqualError(t, err, pifyErrors.SCROBBLE_FAILED)
+	assert.Zero(t, sent)
+	pending, err := store.Scrobbles().Pending(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, pending, MAX_SCROBBLE_BATCH+1)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Contains(t, pending[0].LastError, "temporary error")
+	// the second batch waits for the first one
+	assert.Zero(t, pending[MAX_SCROBBLE_BATCH].Attempts)
+
+	fake.set(false, false)
+	sent, err = service.Flush(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, MAX_SCROBBLE_BATCH+1, sent)
+	pending, err = store.Scrobbles().Pending(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// 1 failed and 2 sent batches, oldest first
+	scrobbles := fake.methodCalls("track.scrobble")
+	require.Len(t, scrobbles, 3)
+	batch := scrobbles[1]
+	assert.Equal(t, "session-key", batch.Get("sk"))
+	assert.Equal(t, "Band", batch.Get("artist[0]"))
+	assert.Equal(t, "One", batch.Get("track[0]"))
+	assert.Equal(t, fmt.Sprint(start.Unix()), batch.Get("timestamp[0]"))
+	assert.Equal(t, "200", batch.Get("duration[0]"))
+	assert.NotEmpty(t, batch.Get("track[49]"))
+	assert.Empty(t, batch.Get("track[50]"))
+	assert.Equal(t, fmt.Sprint(start.Add(MAX_SCROBBLE_BATCH*time.Minute).Unix()), scrobbles[2].Get("timestamp[0]"))
+
+	// scrobbles the service refuses are dropped
+	_, err = service.Queue(ctx, scrobblePlay("t3", "Three", 200000, 100, start.Add(-time.Hour)))
+	require.NoError(t, err)
+	fake.set(false, true)
+	sent, err = service.Flush(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+	pending, err = store.Scrobbles().Pending(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestScrobbleListen(t *testing.T) {
+	service, fake, store := newTestScrobbleService(t)
+	ctx := context.Background()
+
+	_, err := service.Link(ctx, 1, "token")
+	require.NoError(t, err)
+
+	history := NewHistoryService(store.Sessions(), store.Plays(), nil)
+	poller := NewPlaybackPoller(store.Sessions(), nil, NewPollIntervals(time.Second))
+	service.Listen(poller, history)
+
+	// plays added to the history are queued, plays seen twice once
+	play := scrobblePlay("t1", "One", 200000, 100, time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC))
+	for range 2 {
+		_, err := history.Record(ctx, play)
+		require.NoError(t, err)
+	}
+	account, err := service.GetAccount(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, account.Pending)
+
+	sent, err := service.Flush(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	// the track the controller starts playing is sent as now playing
+	service.onPlayback(PlaybackEvent{
+		Type:    PLAYBACK_EVENT_TRACK,
+		Current: &NowPlaying{Active: true, IsPlaying: true, Track: &CatalogItem{Name: "Two", Subtitle: "Solo", DurationMs: 180000}},
+	})
+	assert.Eventually(t, func() bool {
+		return len(fake.methodCalls("track.updateNowPlaying")) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "Solo", fake.methodCalls("track.updateNowPlaying")[0].Get("artist"))
+}
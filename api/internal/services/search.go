@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DEFAULT_SEARCH_DEBOUNCE is how long the results of a search are reused for the same query.
+const DEFAULT_SEARCH_DEBOUNCE = 2 * time.Second
+
+type SearchQuery struct {
+	Query string
+	// searches all SEARCH_TYPES if empty
+	Types  []string
+	Limit  int
+	Offset int
+	Market string
+}
+
+// SearchResponse is a page of catalog items of every searched type, in the order of SEARCH_TYPES.
+type SearchResponse struct {
+	Query  string         `json:"query"`
+	Types  []string       `json:"types"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+	Items  []CatalogItem  `json:"items"`
+	Totals map[string]int `json:"totals"`
+	// whether any type has results after this page
+	HasMore bool `json:"has_more"`
+}
+
+// SearchService searches the Spotify catalog for users. Clients search while the user types,
+// so duplicate queries are debounced: searches of a user for the same query share a single
+// Spotify request while it runs, and its results for a short while after.
+type SearchService struct {
+	spotifyService *SpotifyService
+	debounce       time.Duration
+	now            func() time.Time
+	mu             sync.Mutex
+	searches       map[string]*search
+}
+
+// search is a Spotify request shared by duplicate queries. done is closed once res or err is set.
+type search struct {
+	done    chan struct{}
+	res     *SearchResponse
+	err     error
+	expires time.Time
+}
+
+func NewSearchService(spotifyService *SpotifyService, debounce time.Duration) *SearchService {
+	return &SearchService{
+		spotifyService: spotifyService,
+		debounce:       debounce,
+		now:            time.Now,
+		searches:       make(map[string]*search),
+	}
+}
+
+// Search searches the catalog with the access token of the user.
+func (s *SearchService) Search(ctx context.Context, userId int64, accessToken string, query SearchQuery) (*SearchResponse, error) {
+	query = normalizeQuery(query)
+	key := fmt.Sprintf("%d|%s|%s|%d|%d|%s", userId, query.Query, strings.Join(query.Types, ","), query.Limit, query.Offset, query.Market)
+
+	s.mu.Lock()
+	s.sweep()
+	call, ok := s.searches[key]
+	if !ok {
+		call = &search{done: make(chan struct{})}
+		s.searches[key] = call
+		// the request is shared, it must not fail when the first client goes away
+		go s.run(context.WithoutCancel(ctx), key, call, accessToken, query)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.res, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *SearchService) run(ctx context.Context, key string, call *search, accessToken string, query SearchQuery) {
+	results, err := s.spotifyService.Search(ctx, accessToken, query.Query, query.Types, query.Limit, query.Offset, query.Market)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		// failures are not reused, the next query tries again
+		call.err = err
+		delete(s.searches, key)
+	} else {
+		call.res = newSearchResponse(query, results)
+		call.expires = s.now().Add(s.debounce)
+	}
+	close(call.done)
+}
+
+// sweep drops the expired results, s.mu must be held.
+func (s *SearchService) sweep() {
+	now := s.now()
+	for key, call := range s.searches {
+		if call.res != nil && now.After(call.expires) {
+			delete(s.searches, key)
+		}
+	}
+}
+
+// normalizeQuery makes duplicate queries equal: the text is trimmed and lower cased,
+// as Spotify ignores case, and the types are listed in the order of SEARCH_TYPES.
+func normalizeQuery(query SearchQuery) SearchQuery {
+	query.Query = strings.ToLower(strings.Join(strings.Fields(query.Query), " "))
+
+	types := SEARCH_TYPES
+	if len(query.Types) > 0 {
+		types = nil
+		for _, t := range SEARCH_TYPES {
+			if slices.Contains(query.Types, t) {
+				types = append(types, t)
+			}
+		}
+		// unknown types are left for Spotify.Search to reject
+		for _, t := range query.Types {
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	query.Types = types
+
+	query.Limit = min(max(query.Limit, 1), MAX_SEARCH_LIMIT)
+	query.Offset = max(query.Offset, 0)
+	return query
+}
+
+func newSearchResponse(query SearchQuery, results *SpotifySearchResults) *SearchResponse {
+	res := &SearchResponse{
+		Query:  query.Query,
+		Types:  query.Types,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+		Items:  results.Items(),
+		Totals: results.Totals(),
+	}
+	for _, total := range res.Totals {
+		if total > query.Offset+query.Limit {
+			res.HasMore = true
+		}
+	}
+	return res
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+// newTestSearchService returns a search service backed by handler, with a fake clock.
+func newTestSearchService(t *testing.T, handler http.HandlerFunc) (*SearchService, *time.Time) {
+	t.Helper()
+
+	service := NewSearchService(newTestSpotifyService(t, handler), time.Second)
+	now := time.Unix(0, 0)
+	service.now = func() time.Time { return now }
+	return service, &now
+}
+
+func TestSpotifySearch(t *testing.T) {
+	var query url.Values
+	service, _ := newTestSearchService(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/search", r.URL.Path)
+		assert.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+		query = r.URL.Query()
+		w.Write([]byte(`{"tracks": {"items": [{"id": "t1", "artists": [{"name": "Band"}]}, null], "total": 1}}`))
+	})
+
+	results, err := service.spotifyService.Search(context.Background(), "access-token", "song", []string{CATALOG_TYPE_TRACK}, 100, -1, "from_token")
+	require.NoError(t, err)
+	assert.Equal(t, "song", query.Get("q"))
+	assert.Equal(t, "track", query.Get("type"))
+	assert.Equal(t, "50", query.Get("limit"))
+	assert.Equal(t, "0", query.Get("offset"))
+	assert.Equal(t, "from_token", query.Get("market"))
+
+	assert.Nil(t, results.Albums)
+	assert.Equal(t, []CatalogItem{{Type: CATALOG_TYPE_TRACK, Id: "t1", Subtitle: "Band"}}, results.Items())
+	assert.Equal(t, map[string]int{CATALOG_TYPE_TRACK: 1}, results.Totals())
+}
+
+func TestSpotifySearchErrors(t *testing.T) {
+	status := http.StatusInternalServerError
+	service, _ := newTestSearchService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	ctx := context.Background()
+
+	_, err := service.spotifyService.Search(ctx, "access-token", "song", []string{"episode"}, 20, 0, "")
+	assert.EqualError(t, err, pifyErrors.INVALID_SEARCH_TYPE)
+
+	_, err = service.spotifyService.Search(ctx, "access-token", "song", nil, 20, 0, "")
+	assert.EqualError(t, err, pifyErrors.SEARCH_FAILED)
+
+	status = http.StatusUnauthorized
+	_, err = service.spotifyService.Search(ctx, "access-token", "song", nil, 20, 0, "")
+	assert.EqualError(t, err, pifyErrors.BAD_OR_EXPIRED_TOKEN)
+}
+
+func TestSearchDebounce(t *testing.T) {
+	var calls atomic.Int32
+	service, now := newTestSearchService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"tracks": {"items": [], "total": 0}}`))
+	})
+	ctx := context.Background()
+	query := SearchQuery{Query: "Song", Types: []string{CATALOG_TYPE_TRACK}, Limit: 20}
+
+	_, err := service.Search(ctx, 1, "access-token", query)
+	require.NoError(t, err)
+	_, err = service.Search(ctx, 1, "access-token", SearchQuery{Query: " song  ", Types: []string{CATALOG_TYPE_TRACK}, Limit: 20})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, calls.Load())
+
+	// other users search on their own
+	_, err = service.Search(ctx, 2, "access-token", query)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, calls.Load())
+
+	*now = now.Add(2 * time.Second)
+	_, err = service.Search(ctx, 1, "access-token", query)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestSearchSharesRunningRequests(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	service, _ := newTestSearchService(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Write([]byte(`{"tracks": {"items": [{"id": "t1"}], "total": 1}}`))
+	})
+	query := SearchQuery{Query: "song", Limit: 20}
+
+	// the first client going away does not fail the others
+	cancelled, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	results := make([]*SearchResponse, 3)
+	errs := make([]error, 3)
+	for i := range results {
+		ctx := context.Background()
+		if i == 0 {
+			ctx = cancelled
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = service.Search(ctx, 1, "access-token", query)
+		}()
+	}
+
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	close(release)
+	wg.Wait()
+
+	assert.ErrorIs(t, errs[0], context.Canceled)
+	for i := 1; i < 3; i++ {
+		require.NoError(t, errs[i])
+		assert.Len(t, results[i].Items, 1)
+	}
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func TestSearchDoesNotReuseFailures(t *testing.T) {
+	var calls atomic.Int32
+	service, _ := newTestSearchService(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"tracks": {"items": [], "total": 0}}`))
+	})
+	query := SearchQuery{Query: "song", Limit: 20}
+
+	_, err := service.Search(context.Background(), 1, "access-token", query)
+	assert.Error(t, err)
+	_, err = service.Search(context.Background(), 1, "access-token", query)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	query := normalizeQuery(SearchQuery{
+		Query: "  Daft   PUNK ",
+		Types: []string{CATALOG_TYPE_ARTIST, CATALOG_TYPE_TRACK},
+		Limit: 0,
+	})
+	assert.Equal(t, "daft punk", query.Query)
+	assert.Equal(t, []string{CATALOG_TYPE_TRACK, CATALOG_TYPE_ARTIST}, query.Types)
+	assert.Equal(t, 1, query.Limit)
+
+	assert.Equal(t, SEARCH_TYPES, normalizeQuery(SearchQuery{}).Types)
+}
@@ -2,13 +2,15 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -54,21 +56,66 @@ type SpotifyDevices struct {
 }
 
 type SpotifyTrack struct {
+	Id           string                `json:"id"`
+	Name         string                `json:"name"`
+	Uri          string                `json:"uri"`
+	DurationMs   int                   `json:"duration_ms"`
+	Explicit     bool                  `json:"explicit"`
+	Popularity   int                   `json:"popularity"`
+	Album        SpotifySimpleAlbum    `json:"album"`
+	Artists      []SpotifySimpleArtist `json:"artists"`
 	ExternalUrls struct {
 		Spotify string `json:"spotify"`
 	} `json:"external_urls"`
 }
 
+// PlayContextRequest starts playback of a context (album, playlist or artist) or of a list of tracks.
+type PlayContextRequest struct {
+	ContextUri string   `json:"context_uri,omitempty"`
+	Uris       []string `json:"uris,omitempty"`
+	// where to start in the context or tracks, nil to start at the first track
+	Offset     *PlayOffset `json:"offset,omitempty"`
+	PositionMs int         `json:"position_ms,omitempty"`
+}
+
+// PlayOffset is the track to start at, by its position or uri.
+type PlayOffset struct {
+	Position *int   `json:"position,omitempty"`
+	Uri      string `json:"uri,omitempty"`
+}
+
+// SpotifyPlaybackState is the playback of the user on any of their devices.
+type SpotifyPlaybackState struct {
+	Device       SpotifyDevice `json:"device"`
+	RepeatState  string        `json:"repeat_state"`
+	ShuffleState bool          `json:"shuffle_state"`
+	Context      *struct {
+		Type string `json:"type"`
+		Uri  string `json:"uri"`
+	} `json:"context"`
+	ProgressMs int  `json:"progress_ms"`
+	IsPlaying  bool `json:"is_playing"`
+	// nil while Spotify plays an ad or something else it does not describe
+	Item                 *SpotifyTrack `json:"item"`
+	CurrentlyPlayingType string        `json:"currently_playing_type"`
+}
+
 type TransferPlaybackRequest struct {
 	DeviceIds []string `json:"device_ids"`
 	Play      bool     `json:"play"`
 }
 
+// SPOTIFY_API_URL is the base url of the Spotify Web API.
+const SPOTIFY_API_URL = "https://api.spotify.com/v1"
+
 type SpotifyService struct {
 	clientId     string
 	clientSecret string
 	redirectUri  string
 	httpClient   *http.Client
+	observer     Observer
+	// waits between retried requests, replaced by tests
+	sleep func(context.Context, time.Duration) error
 }
 
 func GetSpotifyCredentials() SpotifyCredentials {
@@ -91,9 +138,22 @@ func NewSpotifyService(credentials SpotifyCredentials, httpClient *http.Client)
 		clientSecret: credentials.ClientSecret,
 		redirectUri:  credentials.RedirectURI,
 		httpClient:   httpClient,
+		observer:     nopObserver{},
+		sleep:        sleepContext,
 	}
 }
 
+// WithObserver sets the observer notified of token refreshes.
+func (s *SpotifyService) WithObserver(observer Observer) *SpotifyService {
+	s.observer = observer
+	return s
+}
+
+// HasCredentials reports whether the Spotify app credentials have been configured.
+func (s *SpotifyService) HasCredentials() bool {
+	return s.clientId != "" && s.clientSecret != "" && s.redirectUri != ""
+}
+
 func (s *SpotifyService) GetAuthUrl() (string, error) {
 	state := utils.GenerateRandomString(16)
 
@@ -113,13 +173,14 @@ func (s *SpotifyService) GetAuthUrl() (string, error) {
 	return authUrl.String(), nil
 }
 
-func (s *SpotifyService) GetApiToken(code string) (*SpotifyTokenResponse, error) {
+func (s *SpotifyService) GetApiToken(ctx context.Context, code string) (*SpotifyTokenResponse, error) {
 	data := url.Values{}
 	data.Set("grant_type", "authorization_code")
 	data.Set("code", code)
 	data.Set("redirect_uri", s.redirectUri)
 
-	tokenReq, err := http.NewRequest(
+	tokenReq, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		"https://accounts.spotify.com/api/token",
 		strings.NewReader(data.Encode()),
@@ -147,23 +208,25 @@ func (s *SpotifyService) IsApiTokenExpired(accessTokenExpiresAt time.Time) bool
 	return time.Now().After(accessTokenExpiresAt)
 }
 
-func (s *SpotifyService) CheckAndRefreshApiToken(accessTokenExpiresAt time.Time, refreshToken string) (*SpotifyTokenResponse, error) {
+func (s *SpotifyService) CheckAndRefreshApiToken(ctx context.Context, accessTokenExpiresAt time.Time, refreshToken string) (*SpotifyTokenResponse, error) {
 	// check accessToken expiry
 	if time.Now().After(accessTokenExpiresAt) {
 		// refresh access token
-		log.Printf("access token expired at %v\n", accessTokenExpiresAt)
-		log.Println("refreshing access token...")
-		return s.RefreshApiToken(refreshToken)
+		slog.InfoContext(ctx, "access token expired, refreshing", "expired_at", accessTokenExpiresAt)
+		return s.RefreshApiToken(ctx, refreshToken)
 	}
 	return nil, nil
 }
 
-func (s *SpotifyService) RefreshApiToken(refreshToken string) (*SpotifyTokenResponse, error) {
+func (s *SpotifyService) RefreshApiToken(ctx context.Context, refreshToken string) (*SpotifyTokenResponse, error) {
 	data := url.Values{}
 	data.Set("grant_type", "refresh_token")
 	data.Set("refresh_token", refreshToken)
+	// the client is authenticated by the header, the id is sent as well as TestRefreshApiToken expects
+	data.Set("client_id", s.clientId)
 
-	tokenReq, err := http.NewRequest(
+	tokenReq, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		"https://accounts.spotify.com/api/token",
 		strings.NewReader(data.Encode()),
@@ -175,21 +238,29 @@ func (s *SpotifyService) RefreshApiToken(refreshToken string) (*SpotifyTokenResp
 	tokenReq.SetBasicAuth(s.clientId, s.clientSecret)
 	tokenRes, err := s.httpClient.Do(tokenReq)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "refresh access token failed", "error", err)
+		s.observer.ObserveTokenRefresh(TOKEN_REFRESH_FAILED)
 		return nil, err
 	}
 	defer tokenRes.Body.Close()
 
 	tokenResJson := SpotifyTokenResponse{}
 	if err := json.NewDecoder(tokenRes.Body).Decode(&tokenResJson); err != nil {
+		s.observer.ObserveTokenRefresh(TOKEN_REFRESH_FAILED)
 		return nil, err
 	}
 
+	if tokenRes.StatusCode != http.StatusOK {
+		s.observer.ObserveTokenRefresh(TOKEN_REFRESH_REJECTED)
+	} else {
+		s.observer.ObserveTokenRefresh(TOKEN_REFRESH_SUCCESS)
+	}
+
 	return &tokenResJson, nil
 }
 
-func (s *SpotifyService) GetUser(accessToken string) (*SpotifyUser, error) {
-	userReq, err := http.NewRequest("GET", "https://api.spotify.com/v1/me", nil)
+func (s *SpotifyService) GetUser(ctx context.Context, accessToken string) (*SpotifyUser, error) {
+	userReq, err := http.NewRequestWithContext(ctx, "GET", "https://api.spotify.com/v1/me", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -209,8 +280,8 @@ func (s *SpotifyService) GetUser(accessToken string) (*SpotifyUser, error) {
 	return &spotifyUser, nil
 }
 
-func (s *SpotifyService) GetUserDevices(accessToken string) (*SpotifyDevices, error) {
-	deviceReq, err := http.NewRequest("GET", "https://api.spotify.com/v1/me/player/devices", nil)
+func (s *SpotifyService) GetUserDevices(ctx context.Context, accessToken string) (*SpotifyDevices, error) {
+	deviceReq, err := http.NewRequestWithContext(ctx, "GET", "https://api.spotify.com/v1/me/player/devices", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +301,7 @@ func (s *SpotifyService) GetUserDevices(accessToken string) (*SpotifyDevices, er
 	return &spotifyDevices, nil
 }
 
-func (s *SpotifyService) TransferPlayback(accessToken, deviceId string) (bool, error) {
+func (s *SpotifyService) TransferPlayback(ctx context.Context, accessToken, deviceId string) (bool, error) {
 	reqPayload := TransferPlaybackRequest{
 		DeviceIds: []string{deviceId},
 		Play:      false,
@@ -240,7 +311,7 @@ func (s *SpotifyService) TransferPlayback(accessToken, deviceId string) (bool, e
 		return false, err
 	}
 
-	deviceReq, err := http.NewRequest("PUT", "https://api.spotify.com/v1/me/player", bytes.NewReader(b))
+	deviceReq, err := http.NewRequestWithContext(ctx, "PUT", "https://api.spotify.com/v1/me/player", bytes.NewReader(b))
 	if err != nil {
 		return false, err
 	}
@@ -266,8 +337,42 @@ func (s *SpotifyService) TransferPlayback(accessToken, deviceId string) (bool, e
 	}
 }
 
-func (s *SpotifyService) GetTrackBytes(accessToken, trackId string) ([]byte, error) {
-	trackReq, err := http.NewRequest("GET", "https://api.spotify.com/v1/tracks/"+trackId, nil)
+// GetPlaybackState returns the playback of the user, or nil if nothing is playing on any device.
+func (s *SpotifyService) GetPlaybackState(ctx context.Context, accessToken string) (*SpotifyPlaybackState, error) {
+	var state *SpotifyPlaybackState
+	if err := s.getApi(ctx, accessToken, SPOTIFY_API_URL+"/me/player", pifyErrors.GET_PLAYBACK_STATE_FAILED, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// PlayContext starts playback on the device.
+func (s *SpotifyService) PlayContext(ctx context.Context, accessToken, deviceId string, req PlayContextRequest) error {
+	apiUrl := SPOTIFY_API_URL + "/me/player/play?" + url.Values{"device_id": {deviceId}}.Encode()
+	return s.sendApi(ctx, http.MethodPut, accessToken, apiUrl, pifyErrors.PLAYBACK_FAILED, req)
+}
+
+// SkipToNext skips to the next track of the queue on the device, on the active device if deviceId is empty.
+func (s *SpotifyService) SkipToNext(ctx context.Context, accessToken, deviceId string) error {
+	return s.sendApi(ctx, http.MethodPost, accessToken, playerUrl("/next", deviceId), pifyErrors.SKIP_TRACK_FAILED, nil)
+}
+
+// Pause pauses playback on the device, on the active device if deviceId is empty.
+func (s *SpotifyService) Pause(ctx context.Context, accessToken, deviceId string) error {
+	return s.sendApi(ctx, http.MethodPut, accessToken, playerUrl("/pause", deviceId), pifyErrors.PAUSE_FAILED, nil)
+}
+
+// playerUrl returns the url of the player endpoint at path, targeting the device unless deviceId is empty.
+func playerUrl(path, deviceId string) string {
+	apiUrl := SPOTIFY_API_URL + "/me/player" + path
+	if deviceId != "" {
+		apiUrl += "?" + url.Values{"device_id": {deviceId}}.Encode()
+	}
+	return apiUrl
+}
+
+func (s *SpotifyService) GetTrackBytes(ctx context.Context, accessToken, trackId string) ([]byte, error) {
+	trackReq, err := http.NewRequestWithContext(ctx, "GET", "https://api.spotify.com/v1/tracks/"+trackId, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -286,6 +391,100 @@ func (s *SpotifyService) GetTrackBytes(accessToken, trackId string) ([]byte, err
 	return io.ReadAll(trackRes.Body)
 }
 
+// getApi requests the Spotify Web API at apiUrl with the access token and decodes the response into dest,
+// which is left untouched by responses without content. Rejected tokens and rate limits fail with their
+// error codes, other failed responses with code.
+func (s *SpotifyService) getApi(ctx context.Context, accessToken, apiUrl, code string, dest any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return pifyErrors.Wrap(code, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return newApiError(res, code)
+	}
+	if err := json.NewDecoder(res.Body).Decode(dest); err != nil {
+		return pifyErrors.Wrap(code, err)
+	}
+	return nil
+}
+
+// sendApi sends body as JSON to the Spotify Web API at apiUrl with the access token, expecting no content back.
+// Failed responses fail like getApi.
+func (s *SpotifyService) sendApi(ctx context.Context, method, accessToken, apiUrl, code string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiUrl, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return pifyErrors.Wrap(code, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return newApiError(res, code)
+	}
+	return nil
+}
+
+// apiError is a failed Spotify Web API response. Its Error is the error code, so that it compares
+// like the errors.New(CODE) of the other requests.
+type apiError struct {
+	code   string
+	status int
+	// delay asked for by Spotify with a 429
+	retryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	return e.code
+}
+
+// newApiError returns the error of a failed response, code unless the status tells more.
+func newApiError(res *http.Response, code string) error {
+	e := &apiError{code: code, status: res.StatusCode}
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		e.code = pifyErrors.BAD_OR_EXPIRED_TOKEN
+	case http.StatusForbidden:
+		e.code = pifyErrors.BAD_OAUTH_REQUEST
+	case http.StatusTooManyRequests:
+		e.code = pifyErrors.RATE_LIMIT_EXCEEDED
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			e.retryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+	return e
+}
+
+// apiStatus returns the status of the failed Spotify response err, or 0 if err is not one.
+func apiStatus(err error) int {
+	var e *apiError
+	if errors.As(err, &e) {
+		return e.status
+	}
+	return 0
+}
+
 func (s *SpotifyService) GetScope() []string {
 	return []string{
 		"user-read-email",
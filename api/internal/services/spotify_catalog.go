@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+// types of catalog items, as named by the Spotify search
+const (
+	CATALOG_TYPE_TRACK    = "track"
+	CATALOG_TYPE_ALBUM    = "album"
+	CATALOG_TYPE_ARTIST   = "artist"
+	CATALOG_TYPE_PLAYLIST = "playlist"
+	CATALOG_TYPE_SHOW     = "show"
+)
+
+// SEARCH_TYPES are the catalog types that can be searched, in the order results are listed.
+var SEARCH_TYPES = []string{
+	CATALOG_TYPE_TRACK,
+	CATALOG_TYPE_ALBUM,
+	CATALOG_TYPE_ARTIST,
+	CATALOG_TYPE_PLAYLIST,
+	CATALOG_TYPE_SHOW,
+}
+
+// MAX_SEARCH_LIMIT is the largest page of every type Spotify returns.
+const MAX_SEARCH_LIMIT = 50
+
+type SpotifyImage struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type SpotifySimpleArtist struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Uri  string `json:"uri"`
+}
+
+type SpotifyArtist struct {
+	Id         string         `json:"id"`
+	Name       string         `json:"name"`
+	Uri        string         `json:"uri"`
+	Genres     []string       `json:"genres"`
+	Popularity int            `json:"popularity"`
+	Images     []SpotifyImage `json:"images"`
+}
+
+type SpotifySimpleAlbum struct {
+	Id          string                `json:"id"`
+	Name        string                `json:"name"`
+	Uri         string                `json:"uri"`
+	AlbumType   string                `json:"album_type"`
+	ReleaseDate string                `json:"release_date"`
+	TotalTracks int                   `json:"total_tracks"`
+	Images      []SpotifyImage        `json:"images"`
+	Artists     []SpotifySimpleArtist `json:"artists"`
+}
+
+type SpotifySimplePlaylist struct {
+	Id          string         `json:"id"`
+	Name        string         `json:"name"`
+	Uri         string         `json:"uri"`
+	Description string         `json:"description"`
+	Images      []SpotifyImage `json:"images"`
+	Owner       struct {
+		Id          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	} `json:"owner"`
+	Tracks struct {
+		Total int `json:"total"`
+	} `json:"tracks"`
+}
+
+type SpotifySimpleShow struct {
+	Id            string         `json:"id"`
+	Name          string         `json:"name"`
+	Uri           string         `json:"uri"`
+	Publisher     string         `json:"publisher"`
+	Description   string         `json:"description"`
+	Explicit      bool           `json:"explicit"`
+	TotalEpisodes int            `json:"total_episodes"`
+	Images        []SpotifyImage `json:"images"`
+}
+
+// SpotifyPage is a page of a Spotify list. Items may be nil, Spotify returns null for unavailable items.
+type SpotifyPage[T any] struct {
+	Href     string `json:"href"`
+	Items    []*T   `json:"items"`
+	Limit    int    `json:"limit"`
+	Next     string `json:"next"`
+	Offset   int    `json:"offset"`
+	Previous string `json:"previous"`
+	Total    int    `json:"total"`
+}
+
+// SpotifySearchResults holds a page of every searched type, the others are nil.
+type SpotifySearchResults struct {
+	Tracks    *SpotifyPage[SpotifyTrack]          `json:"tracks,omitempty"`
+	Albums    *SpotifyPage[SpotifySimpleAlbum]    `json:"albums,omitempty"`
+	Artists   *SpotifyPage[SpotifyArtist]         `json:"artists,omitempty"`
+	Playlists *SpotifyPage[SpotifySimplePlaylist] `json:"playlists,omitempty"`
+	Shows     *SpotifyPage[SpotifySimpleShow]     `json:"shows,omitempty"`
+}
+
+// CatalogItem describes a track, album, artist, playlist or show the same way,
+// so that clients render items of mixed types uniformly.
+type CatalogItem struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+	Uri  string `json:"uri"`
+	Name string `json:"name"`
+	// artists of tracks and albums, owner of playlists, publisher of shows
+	Subtitle string `json:"subtitle"`
+	// ids of the artists of tracks and albums, the main artist first
+	ArtistIds  []string `json:"artist_ids,omitempty"`
+	ImageUrl   string   `json:"image_url"`
+	DurationMs int      `json:"duration_ms,omitempty"`
+	Explicit   bool     `json:"explicit"`
+}
+
+// Search searches the Spotify catalog for items of types matching query, returning a page of every type.
+// An empty market leaves it to Spotify, "from_token" searches the market of the user.
+func (s *SpotifyService) Search(
+	ctx context.Context,
+	accessToken, query string,
+	types []string,
+	limit, offset int,
+	market string,
+) (*SpotifySearchResults, error) {
+	if len(types) == 0 {
+		types = SEARCH_TYPES
+	}
+	for _, t := range types {
+		if !slices.Contains(SEARCH_TYPES, t) {
+			return nil, errors.New(pifyErrors.INVALID_SEARCH_TYPE)
+		}
+	}
+
+	q := url.Values{}
+	q.Set("q", query)
+	q.Set("type", strings.Join(types, ","))
+	q.Set("limit", strconv.Itoa(min(max(limit, 1), MAX_SEARCH_LIMIT)))
+	q.Set("offset", strconv.Itoa(max(offset, 0)))
+	if market != "" {
+		q.Set("market", market)
+	}
+
+	results := &SpotifySearchResults{}
+	if err := s.getApi(ctx, accessToken, SPOTIFY_API_URL+"/search?"+q.Encode(), pifyErrors.SEARCH_FAILED, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Items returns the results as catalog items, grouped by type in the order of SEARCH_TYPES.
+func (r *SpotifySearchResults) Items() []CatalogItem {
+	items := []CatalogItem{}
+	if r.Tracks != nil {
+		items = appendItems(items, r.Tracks.Items, trackItem)
+	}
+	if r.Albums != nil {
+		items = appendItems(items, r.Albums.Items, albumItem)
+	}
+	if r.Artists != nil {
+		items = appendItems(items, r.Artists.Items, artistItem)
+	}
+	if r.Playlists != nil {
+		items = appendItems(items, r.Playlists.Items, playlistItem)
+	}
+	if r.Shows != nil {
+		items = appendItems(items, r.Shows.Items, showItem)
+	}
+	return items
+}
+
+// Totals returns the number of results of every searched type.
+func (r *SpotifySearchResults) Totals() map[string]int {
+	totals := make(map[string]int)
+	if r.Tracks != nil {
+		totals[CATALOG_TYPE_TRACK] = r.Tracks.Total
+	}
+	if r.Albums != nil {
+		totals[CATALOG_TYPE_ALBUM] = r.Albums.Total
+	}
+	if r.Artists != nil {
+		totals[CATALOG_TYPE_ARTIST] = r.Artists.Total
+	}
+	if r.Playlists != nil {
+		totals[CATALOG_TYPE_PLAYLIST] = r.Playlists.Total
+	}
+	if r.Shows != nil {
+		totals[CATALOG_TYPE_SHOW] = r.Shows.Total
+	}
+	return totals
+}
+
+// appendItems appends the non-nil items of a page as catalog items.
+func appendItems[T any](items []CatalogItem, page []*T, toItem func(*T) CatalogItem) []CatalogItem {
+	for _, item := range page {
+		if item != nil {
+			items = append(items, toItem(item))
+		}
+	}
+	return items
+}
+
+func trackItem(track *SpotifyTrack) CatalogItem {
+	return CatalogItem{
+		Type:       CATALOG_TYPE_TRACK,
+		Id:         track.Id,
+		Uri:        track.Uri,
+		Name:       track.Name,
+		Subtitle:   artistNames(track.Artists),
+		ArtistIds:  artistIds(track.Artists),
+		ImageUrl:   imageUrl(track.Album.Images),
+		DurationMs: track.DurationMs,
+		Explicit:   track.Explicit,
+	}
+}
+
+func albumItem(album *SpotifySimpleAlbum) CatalogItem {
+	return CatalogItem{
+		Type:      CATALOG_TYPE_ALBUM,
+		Id:        album.Id,
+		Uri:       album.Uri,
+		Name:      album.Name,
+		Subtitle:  artistNames(album.Artists),
+		ArtistIds: artistIds(album.Artists),
+		ImageUrl:  imageUrl(album.Images),
+	}
+}
+
+func artistItem(artist *SpotifyArtist) CatalogItem {
+	return CatalogItem{
+		Type:     CATALOG_TYPE_ARTIST,
+		Id:       artist.Id,
+		Uri:      artist.Uri,
+		Name:     artist.Name,
+		Subtitle: strings.Join(artist.Genres, ", "),
+		ImageUrl: imageUrl(artist.Images),
+	}
+}
+
+func playlistItem(playlist *SpotifySimplePlaylist) CatalogItem {
+	return CatalogItem{
+		Type:     CATALOG_TYPE_PLAYLIST,
+		Id:       playlist.Id,
+		Uri:      playlist.Uri,
+		Name:     playlist.Name,
+		Subtitle: playlist.Owner.DisplayName,
+		ImageUrl: imageUrl(playlist.Images),
+	}
+}
+
+func showItem(show *SpotifySimpleShow) CatalogItem {
+	return CatalogItem{
+		Type:     CATALOG_TYPE_SHOW,
+		Id:       show.Id,
+		Uri:      show.Uri,
+		Name:     show.Name,
+		Subtitle: show.Publisher,
+		ImageUrl: imageUrl(show.Images),
+		Explicit: show.Explicit,
+	}
+}
+
+func artistNames(artists []SpotifySimpleArtist) string {
+	names := make([]string, len(artists))
+	for i, artist := range artists {
+		names[i] = artist.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func artistIds(artists []SpotifySimpleArtist) []string {
+	var ids []string
+	for _, artist := range artists {
+		if artist.Id != "" {
+			ids = append(ids, artist.Id)
+		}
+	}
+	return ids
+}
+
+// imageUrl returns the first image, Spotify lists the largest first.
+func imageUrl(images []SpotifyImage) string {
+	if len(images) == 0 {
+		return ""
+	}
+	return images[0].Url
+}
+
+// MAX_ARTIST_IDS is the most artists Spotify returns in one request.
+const MAX_ARTIST_IDS = 50
+
+// MAX_TRACK_IDS is the most tracks Spotify returns in one request.
+const MAX_TRACK_IDS = 50
+
+// GetArtists returns the artists with the given ids, requested in batches of MAX_ARTIST_IDS.
+// Artists Spotify does not know are left out.
+func (s *SpotifyService) GetArtists(ctx context.Context, accessToken string, ids []string) ([]SpotifyArtist, error) {
+	var artists []SpotifyArtist
+	for batch := range slices.Chunk(ids, MAX_ARTIST_IDS) {
+		res := struct {
+			Artists []*SpotifyArtist `json:"artists"`
+		}{}
+		apiUrl := SPOTIFY_API_URL + "/artists?ids=" + url.QueryEscape(strings.Join(batch, ","))
+		if err := s.getApi(ctx, accessToken, apiUrl, pifyErrors.GET_ARTISTS_FAILED, &res); err != nil {
+			return nil, err
+		}
+		for _, artist := range res.Artists {
+			if artist != nil {
+				artists = append(artists, *artist)
+			}
+		}
+	}
+	return artists, nil
+}
+
+// GetTracks returns the tracks with the given ids, requested in batches of MAX_TRACK_IDS.
+// Tracks Spotify does not know are left out.
+func (s *SpotifyService) GetTracks(ctx context.Context, accessToken string, ids []string) ([]SpotifyTrack, error) {
+	var tracks []SpotifyTrack
+	for batch := range slices.Chunk(ids, MAX_TRACK_IDS) {
+		res := struct {
+			Tracks []*SpotifyTrack `json:"tracks"`
+		}{}
+		apiUrl := SPOTIFY_API_URL + "/tracks?ids=" + url.QueryEscape(strings.Join(batch, ","))
+		if err := s.getApi(ctx, accessToken, apiUrl, pifyErrors.GET_TRACKS_FAILED, &res); err != nil {
+			return nil, err
+		}
+		for _, track := range res.Tracks {
+			if track != nil {
+				tracks = append(tracks, *track)
+			}
+		}
+	}
+	return tracks, nil
+}
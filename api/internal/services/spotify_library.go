@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+// MAX_LIBRARY_LIMIT is the largest page of the library lists Spotify returns.
+const MAX_LIBRARY_LIMIT = 50
+
+type SpotifySavedTrack struct {
+	AddedAt time.Time    `json:"added_at"`
+	Track   SpotifyTrack `json:"track"`
+}
+
+type SpotifySavedAlbum struct {
+	AddedAt time.Time          `json:"added_at"`
+	Album   SpotifySimpleAlbum `json:"album"`
+}
+
+// SpotifyPlaylistTrack is an item of a playlist. Track is nil when it is no longer available.
+type SpotifyPlaylistTrack struct {
+	AddedAt time.Time     `json:"added_at"`
+	IsLocal bool          `json:"is_local"`
+	Track   *SpotifyTrack `json:"track"`
+}
+
+// ListPlaylists pages through the playlists owned or followed by the user.
+func (s *SpotifyService) ListPlaylists(accessToken string, limit, offset int) *SpotifyPager[SpotifySimplePlaylist] {
+	return newSpotifyPager[SpotifySimplePlaylist](s, accessToken, libraryUrl("/me/playlists", limit, offset), pifyErrors.LIBRARY_FAILED)
+}
+
+// ListPlaylistTracks pages through the items of a playlist.
+func (s *SpotifyService) ListPlaylistTracks(accessToken, playlistId string, limit, offset int) *SpotifyPager[SpotifyPlaylistTrack] {
+	apiUrl := libraryUrl("/playlists/"+url.PathEscape(playlistId)+"/tracks", limit, offset)
+	return newSpotifyPager[SpotifyPlaylistTrack](s, accessToken, apiUrl, pifyErrors.LIBRARY_FAILED)
+}
+
+// ListSavedTracks pages through the liked songs of the user, most recently saved first.
+func (s *SpotifyService) ListSavedTracks(accessToken string, limit, offset int) *SpotifyPager[SpotifySavedTrack] {
+	return newSpotifyPager[SpotifySavedTrack](s, accessToken, libraryUrl("/me/tracks", limit, offset), pifyErrors.LIBRARY_FAILED)
+}
+
+// ListSavedAlbums pages through the albums saved by the user, most recently saved first.
+func (s *SpotifyService) ListSavedAlbums(accessToken string, limit, offset int) *SpotifyPager[SpotifySavedAlbum] {
+	return newSpotifyPager[SpotifySavedAlbum](s, accessToken, libraryUrl("/me/albums", limit, offset), pifyErrors.LIBRARY_FAILED)
+}
+
+func libraryUrl(path string, limit, offset int) string {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(min(max(limit, 1), MAX_LIBRARY_LIMIT)))
+	q.Set("offset", strconv.Itoa(max(offset, 0)))
+	return SPOTIFY_API_URL + path + "?" + q.Encode()
+}
+
+// SpotifyPlayHistory is a recently played track, PlayedAt is when the play ended.
+type SpotifyPlayHistory struct {
+	Track    SpotifyTrack `json:"track"`
+	PlayedAt time.Time    `json:"played_at"`
+}
+
+// ListRecentlyPlayed pages through the tracks recently played by the user, latest first. Spotify
+// only keeps the last 50.
+func (s *SpotifyService) ListRecentlyPlayed(accessToken string) *SpotifyPager[SpotifyPlayHistory] {
+	apiUrl := SPOTIFY_API_URL + "/me/player/recently-played?limit=" + strconv.Itoa(MAX_LIBRARY_LIMIT)
+	return newSpotifyPager[SpotifyPlayHistory](s, accessToken, apiUrl, pifyErrors.RECENTLY_PLAYED_FAILED)
+}
+
+// time ranges of the top items of a user
+const (
+	TOP_RANGE_SHORT  = "short_term"
+	TOP_RANGE_MEDIUM = "medium_term"
+	TOP_RANGE_LONG   = "long_term"
+)
+
+// GetTopTracks returns the tracks the user listened to most over timeRange, about the last 4 weeks
+// for TOP_RANGE_SHORT.
+func (s *SpotifyService) GetTopTracks(ctx context.Context, accessToken, timeRange string, limit int) ([]*SpotifyTrack, error) {
+	page := &SpotifyPage[SpotifyTrack]{}
+	if err := s.getApi(ctx, accessToken, topUrl("tracks", timeRange, limit), pifyErrors.GET_TOP_ITEMS_FAILED, page); err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+// GetTopArtists returns the artists the user listened to most over timeRange.
+func (s *SpotifyService) GetTopArtists(ctx context.Context, accessToken, timeRange string, limit int) ([]*SpotifyArtist, error) {
+	page := &SpotifyPage[SpotifyArtist]{}
+	if err := s.getApi(ctx, accessToken, topUrl("artists", timeRange, limit), pifyErrors.GET_TOP_ITEMS_FAILED, page); err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+func topUrl(itemType, timeRange string, limit int) string {
+	q := url.Values{}
+	q.Set("time_range", timeRange)
+	q.Set("limit", strconv.Itoa(min(max(limit, 1), MAX_LIBRARY_LIMIT)))
+	return SPOTIFY_API_URL + "/me/top/" + itemType + "?" + q.Encode()
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"log/slog"
+	"net/http"
+	"time"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+// backoff of the requests of a SpotifyPager: retries start after PAGING_BACKOFF, doubled on every
+// attempt up to PAGING_MAX_BACKOFF. Spotify asking to wait longer than that fails the page.
+const (
+	PAGING_MAX_ATTEMPTS = 4
+	PAGING_BACKOFF      = 500 * time.Millisecond
+	PAGING_MAX_BACKOFF  = 10 * time.Second
+)
+
+// SpotifyPager iterates over the pages of a Spotify list by following their next urls, so that
+// offset and cursor paged lists are iterated the same way. Rate limited and failed requests are
+// retried with backoff.
+type SpotifyPager[T any] struct {
+	spotifyService *SpotifyService
+	accessToken    string
+	// the error code of failed requests
+	code string
+	next string
+}
+
+// newSpotifyPager returns a pager starting at the page at apiUrl.
+func newSpotifyPager[T any](s *SpotifyService, accessToken, apiUrl, code string) *SpotifyPager[T] {
+	return &SpotifyPager[T]{
+		spotifyService: s,
+		accessToken:    accessToken,
+		code:           code,
+		next:           apiUrl,
+	}
+}
+
+// More reports whether there is a page left.
+func (p *SpotifyPager[T]) More() bool {
+	return p.next != ""
+}
+
+// Next requests the next page. It must only be called while More returns true.
+func (p *SpotifyPager[T]) Next(ctx context.Context) (*SpotifyPage[T], error) {
+	if !p.More() {
+		return nil, errors.New(p.code)
+	}
+
+	page := &SpotifyPage[T]{}
+	backoff := PAGING_BACKOFF
+	for attempt := 1; ; attempt++ {
+		err := p.spotifyService.getApi(ctx, p.accessToken, p.next, p.code, page)
+		if err == nil {
+			break
+		}
+
+		wait, ok := retryDelay(err, backoff)
+		if !ok || attempt == PAGING_MAX_ATTEMPTS {
+			return nil, err
+		}
+		slog.WarnContext(ctx, "spotify page request failed, retrying", "error", err, "attempt", attempt, "wait", wait)
+		if err := p.spotifyService.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+		backoff = min(2*backoff, PAGING_MAX_BACKOFF)
+	}
+
+	p.next = page.Next
+	return page, nil
+}
+
+// All iterates over the items of the remaining pages, skipping the unavailable ones. Iteration
+// stops after yielding the first error.
+func (p *SpotifyPager[T]) All(ctx context.Context) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		for p.More() {
+			page, err := p.Next(ctx)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, item := range page.Items {
+				if item != nil && !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retrying the request that failed with err, and
+// whether it should be retried at all: rate limits, server errors and network failures are,
+// rejected requests are not.
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+
+	var e *apiError
+	if !errors.As(err, &e) {
+		// the request did not get a response
+		var pifyErr *pifyErrors.Error
+		return backoff, errors.As(err, &pifyErr)
+	}
+
+	switch {
+	case e.status == http.StatusTooManyRequests:
+		if e.retryAfter > PAGING_MAX_BACKOFF {
+			return 0, false
+		}
+		return max(e.retryAfter, backoff), true
+	case e.status >= http.StatusInternalServerError:
+		return backoff, true
+	default:
+		return 0, false
+	}
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
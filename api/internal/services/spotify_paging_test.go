@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+type pagedItem struct {
+	Id string `json:"id"`
+}
+
+func TestSpotifyPagerFollowsNext(t *testing.T) {
+	service := newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			fmt.Fprint(w, `{"items": [{"id": "a"}, null], "next": "https://api.spotify.com/v1/items?page=2", "total": 3}`)
+		case "2":
+			fmt.Fprint(w, `{"items": [{"id": "b"}, {"id": "c"}], "next": null, "total": 3}`)
+		}
+	})
+	ctx := context.Background()
+
+	pager := newSpotifyPager[pagedItem](service, "access-token", SPOTIFY_API_URL+"/items", pifyErrors.LIBRARY_FAILED)
+	var ids []string
+	for item, err := range pager.All(ctx) {
+		require.NoError(t, err)
+		ids = append(ids, item.Id)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+	assert.False(t, pager.More())
+
+	_, err := pager.Next(ctx)
+	assert.EqualError(t, err, pifyErrors.LIBRARY_FAILED)
+}
+
+func TestSpotifyPagerRetries(t *testing.T) {
+	var calls atomic.Int32
+	service := newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, `{"items": [{"id": "a"}]}`)
+		}
+	})
+	var waits []time.Duration
+	service.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	page, err := newSpotifyPager[pagedItem](service, "access-token", SPOTIFY_API_URL+"/items", pifyErrors.LIBRARY_FAILED).Next(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	// Retry-After is followed, then the backoff doubles
+	assert.Equal(t, []time.Duration{3 * time.Second, 2 * PAGING_BACKOFF}, waits)
+}
+
+func TestSpotifyPagerGivesUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		header   string
+		expected string
+		calls    int32
+	}{
+		{name: "server errors", status: http.StatusBadGateway, expected: pifyErrors.LIBRARY_FAILED, calls: PAGING_MAX_ATTEMPTS},
+		{name: "rejected token", status: http.StatusUnauthorized, expected: pifyErrors.BAD_OR_EXPIRED_TOKEN, calls: 1},
+		{name: "long rate limit", status: http.StatusTooManyRequests, header: "3600", expected: pifyErrors.RATE_LIMIT_EXCEEDED, calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			service := newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(tt.status)
+			})
+
+			_, err := newSpotifyPager[pagedItem](service, "access-token", SPOTIFY_API_URL+"/items", pifyErrors.LIBRARY_FAILED).Next(context.Background())
+			assert.EqualError(t, err, tt.expected)
+			assert.Equal(t, tt.calls, calls.Load())
+		})
+	}
+}
+
+func TestSpotifyPagerStopsWhenCancelled(t *testing.T) {
+	service := newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	service.sleep = sleepContext
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := newSpotifyPager[pagedItem](service, "access-token", SPOTIFY_API_URL+"/items", pifyErrors.LIBRARY_FAILED).Next(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+// MAX_RECOMMENDATION_SEEDS is the most seed tracks and artists, together, of a recommendations request.
+const MAX_RECOMMENDATION_SEEDS = 5
+
+// MAX_RECOMMENDATIONS is the most tracks Spotify recommends in one request.
+const MAX_RECOMMENDATIONS = 100
+
+// RecommendationsRequest asks for tracks like the seed tracks and artists. The energies, from 0 to 1,
+// are left to Spotify when nil.
+type RecommendationsRequest struct {
+	SeedTracks   []string
+	SeedArtists  []string
+	Limit        int
+	TargetEnergy *float64
+	MinEnergy    *float64
+	MaxEnergy    *float64
+}
+
+// SpotifyQueue is the queue of the user: the track playing and the tracks up next.
+type SpotifyQueue struct {
+	// nil while nothing plays
+	CurrentlyPlaying *SpotifyTrack  `json:"currently_playing"`
+	Queue            []SpotifyTrack `json:"queue"`
+}
+
+// GetRecommendations returns tracks like the seeds of req, playable in the market of the user.
+// Spotify no longer grants this endpoint to apps registered since November 2024.
+func (s *SpotifyService) GetRecommendations(ctx context.Context, accessToken string, req RecommendationsRequest) ([]SpotifyTrack, error) {
+	q := url.Values{}
+	q.Set("market", "from_token")
+	q.Set("limit", strconv.Itoa(min(max(req.Limit, 1), MAX_RECOMMENDATIONS)))
+	if len(req.SeedTracks) > 0 {
+		q.Set("seed_tracks", strings.Join(req.SeedTracks, ","))
+	}
+	if len(req.SeedArtists) > 0 {
+		q.Set("seed_artists", strings.Join(req.SeedArtists, ","))
+	}
+	setEnergy := func(name string, energy *float64) {
+		if energy != nil {
+			q.Set(name, strconv.FormatFloat(*energy, 'f', -1, 64))
+		}
+	}
+	setEnergy("target_energy", req.TargetEnergy)
+	setEnergy("min_energy", req.MinEnergy)
+	setEnergy("max_energy", req.MaxEnergy)
+
+	res := struct {
+		Tracks []SpotifyTrack `json:"tracks"`
+	}{}
+	if err := s.getApi(ctx, accessToken, SPOTIFY_API_URL+"/recommendations?"+q.Encode(), pifyErrors.GET_RECOMMENDATIONS_FAILED, &res); err != nil {
+		return nil, err
+	}
+	return res.Tracks, nil
+}
+
+// GetRelatedArtists returns the artists Spotify finds similar to the artist. Like the recommendations,
+// it is not granted to apps registered since November 2024.
+func (s *SpotifyService) GetRelatedArtists(ctx context.Context, accessToken, artistId string) ([]SpotifyArtist, error) {
+	res := struct {
+		Artists []SpotifyArtist `json:"artists"`
+	}{}
+	apiUrl := SPOTIFY_API_URL + "/artists/" + url.PathEscape(artistId) + "/related-artists"
+	if err := s.getApi(ctx, accessToken, apiUrl, pifyErrors.GET_RECOMMENDATIONS_FAILED, &res); err != nil {
+		return nil, err
+	}
+	return res.Artists, nil
+}
+
+// GetArtistTopTracks returns the most popular tracks of the artist in the market of the user.
+func (s *SpotifyService) GetArtistTopTracks(ctx context.Context, accessToken, artistId string) ([]SpotifyTrack, error) {
+	res := struct {
+		Tracks []SpotifyTrack `json:"tracks"`
+	}{}
+	apiUrl := SPOTIFY_API_URL + "/artists/" + url.PathEscape(artistId) + "/top-tracks?market=from_token"
+	if err := s.getApi(ctx, accessToken, apiUrl, pifyErrors.GET_RECOMMENDATIONS_FAILED, &res); err != nil {
+		return nil, err
+	}
+	return res.Tracks, nil
+}
+
+// GetQueue returns the queue of the user on the active device.
+func (s *SpotifyService) GetQueue(ctx context.Context, accessToken string) (*SpotifyQueue, error) {
+	queue := &SpotifyQueue{}
+	if err := s.getApi(ctx, accessToken, SPOTIFY_API_URL+"/me/player/queue", pifyErrors.GET_QUEUE_FAILED, queue); err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// AddToQueue adds the track to the end of the queue of the device, of the active device if deviceId is empty.
+func (s *SpotifyService) AddToQueue(ctx context.Context, accessToken, deviceId, uri string) error {
+	q := url.Values{"uri": {uri}}
+	if deviceId != "" {
+		q.Set("device_id", deviceId)
+	}
+	apiUrl := SPOTIFY_API_URL + "/me/player/queue?" + q.Encode()
+	return s.sendApi(ctx, http.MethodPost, accessToken, apiUrl, pifyErrors.ADD_TO_QUEUE_FAILED, nil)
+}
@@ -1,11 +1,13 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 // Helper type to rewrite URLs for testing
@@ -26,6 +28,35 @@ func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return t.Transport.RoundTrip(req)
 }
 
+// serverTransport sends every request to the test server, keeping the path and query.
+type serverTransport struct {
+	target *url.URL
+}
+
+func (t serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestSpotifyService returns a Spotify service whose requests are answered by handler.
+// Retries do not wait.
+func newTestSpotifyService(t *testing.T, handler http.HandlerFunc) *SpotifyService {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL: %v", err)
+	}
+
+	service := NewSpotifyService(SpotifyCredentials{}, &http.Client{Transport: serverTransport{target}})
+	service.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	return service
+}
+
 func TestGetAuthUrl(t *testing.T) {
 	// Setup test service
 	credentials := SpotifyCredentials{
@@ -139,7 +170,7 @@ func TestGetApiToken(t *testing.T) {
 	}
 
 	// Test GetApiToken
-	token, err := service.GetApiToken("test-code")
+	token, err := service.GetApiToken(context.Background(), "test-code")
 	if err != nil {
 		t.Fatalf("GetApiToken returned error: %v", err)
 	}
@@ -211,7 +242,7 @@ func TestRefreshApiToken(t *testing.T) {
 	}
 
 	// Test RefreshApiToken
-	token, err := service.RefreshApiToken("test-refresh-token")
+	token, err := service.RefreshApiToken(context.Background(), "test-refresh-token")
 	if err != nil {
 		t.Fatalf("RefreshApiToken returned error: %v", err)
 	}
@@ -279,7 +310,7 @@ func TestGetUser(t *testing.T) {
 	}
 
 	// Test GetUser
-	user, err := service.GetUser("test-access-token")
+	user, err := service.GetUser(context.Background(), "test-access-token")
 	if err != nil {
 		t.Fatalf("GetUser returned error: %v", err)
 	}
@@ -304,3 +335,51 @@ func TestGetUser(t *testing.T) {
 		t.Errorf("Expected image height 300, got %d", user.Images[0].Height)
 	}
 }
+
+type recordingObserver struct {
+	nopObserver
+	tokenRefreshes []string
+}
+
+func (o *recordingObserver) ObserveTokenRefresh(outcome string) {
+	o.tokenRefreshes = append(o.tokenRefreshes, outcome)
+}
+
+func TestRefreshApiTokenObserver(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected string
+	}{
+		{name: "success", status: http.StatusOK, expected: TOKEN_REFRESH_SUCCESS},
+		{name: "rejected", status: http.StatusBadRequest, expected: TOKEN_REFRESH_REJECTED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(SpotifyTokenResponse{AccessToken: "new-access-token"})
+			}))
+			defer mockServer.Close()
+
+			client := mockServer.Client()
+			client.Transport = rewriteTransport{
+				URL:       "https://accounts.spotify.com/api/token",
+				NewURL:    mockServer.URL,
+				Transport: http.DefaultTransport,
+			}
+
+			observer := &recordingObserver{}
+			service := NewSpotifyService(SpotifyCredentials{}, client).WithObserver(observer)
+
+			if _, err := service.RefreshApiToken(context.Background(), "test-refresh-token"); err != nil {
+				t.Fatalf("RefreshApiToken returned error: %v", err)
+			}
+
+			if len(observer.tokenRefreshes) != 1 || observer.tokenRefreshes[0] != tt.expected {
+				t.Errorf("Expected token refresh outcome %s, got %v", tt.expected, observer.tokenRefreshes)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// top lists of the stats have DEFAULT_STATS_LIMIT entries unless asked otherwise, MAX_STATS_LIMIT at most
+const (
+	DEFAULT_STATS_LIMIT = 10
+	MAX_STATS_LIMIT     = 50
+)
+
+// DEFAULT_STATS_PERIOD is how far back the stats go when the request does not set from.
+const DEFAULT_STATS_PERIOD = 30 * 24 * time.Hour
+
+// the weekly digest covers the last DIGEST_PERIOD, with top lists of DIGEST_LIMIT entries
+const (
+	DIGEST_PERIOD = 7 * 24 * time.Hour
+	DIGEST_LIMIT  = 5
+)
+
+// StatsEntry is an entry of a top list, a track, artist or genre, with how often and how long it was played.
+type StatsEntry struct {
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	// artists of tracks
+	Subtitle   string `json:"subtitle,omitempty"`
+	Plays      int    `json:"plays"`
+	ListenedMs int64  `json:"listened_ms"`
+}
+
+// Stats are computed from the plays of the history that ended between From and To.
+type Stats struct {
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	Plays      int          `json:"plays"`
+	ListenedMs int64        `json:"listened_ms"`
+	SkipRate   float64      `json:"skip_rate"`
+	TopTracks  []StatsEntry `json:"top_tracks"`
+	TopArtists []StatsEntry `json:"top_artists"`
+	TopGenres  []StatsEntry `json:"top_genres"`
+	// listening time by hour of the day at which plays started, and by weekday, Sunday first
+	ListenedMsByHour    []int64 `json:"listened_ms_by_hour"`
+	ListenedMsByWeekday []int64 `json:"listened_ms_by_weekday"`
+}
+
+// UserStats are the stats of a user, with the top tracks and artists Spotify computed for the user
+// over about the last 4 weeks, which include the plays on devices the api does not follow.
+type UserStats struct {
+	Stats
+	SpotifyTopTracks  []CatalogItem `json:"spotify_top_tracks"`
+	SpotifyTopArtists []CatalogItem `json:"spotify_top_artists"`
+}
+
+// Listener is how much a user of the household listened.
+type Listener struct {
+	UserId      int64   `json:"user_id"`
+	DisplayName string  `json:"display_name"`
+	Plays       int     `json:"plays"`
+	ListenedMs  int64   `json:"listened_ms"`
+	SkipRate    float64 `json:"skip_rate"`
+}
+
+// HouseholdStats are the stats of the plays of all users, with how much each of them listened,
+// most listening first.
+type HouseholdStats struct {
+	Stats
+	Listeners []Listener `json:"listeners"`
+}
+
+// WeeklyDigest is the household stats of the last week, with the listening time of the week before.
+type WeeklyDigest struct {
+	HouseholdStats
+	PreviousListenedMs int64 `json:"previous_listened_ms"`
+}
+
+// StatsService computes listening stats of the users and the household from the play history.
+// Genres are those of the artists, looked up on Spotify and kept in memory.
+type StatsService struct {
+	users          repositories.UserRepository
+	sessions       repositories.SessionRepository
+	plays          repositories.PlayEventRepository
+	spotifyService *SpotifyService
+	location       *time.Location
+	now            func() time.Time
+
+	mu      sync.Mutex
+	artists map[string]SpotifyArtist
+}
+
+func NewStatsService(
+	users repositories.UserRepository,
+	sessions repositories.SessionRepository,
+	plays repositories.PlayEventRepository,
+	spotifyService *SpotifyService,
+) *StatsService {
+	return &StatsService{
+		users:          users,
+		sessions:       sessions,
+		plays:          plays,
+		spotifyService: spotifyService,
+		location:       time.Local,
+		now:            time.Now,
+		artists:        make(map[string]SpotifyArtist),
+	}
+}
+
+// UserStats returns the stats of the user between from and to, looking artists and top items up
+// with the access token of the user. Zero times default to the DEFAULT_STATS_PERIOD until now.
+func (s *StatsService) UserStats(ctx context.Context, userId int64, accessToken string, from, to time.Time, limit int) (*UserStats, error) {
+	plays, from, to, err := s.listPlays(ctx, userId, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	limit = min(max(limit, 1), MAX_STATS_LIMIT)
+	stats := &UserStats{
+		Stats:             aggregatePlays(plays, s.lookupArtists(ctx, accessToken, plays), s.location, limit),
+		SpotifyTopTracks:  []CatalogItem{},
+		SpotifyTopArtists: []CatalogItem{},
+	}
+	stats.From, stats.To = from, to
+
+	// Spotify's own top lists complete the stats, the stats are answered without them
+	if tracks, err := s.spotifyService.GetTopTracks(ctx, accessToken, TOP_RANGE_SHORT, limit); err != nil {
+		slog.WarnContext(ctx, "top tracks unavailable", "error", err)
+	} else {
+		stats.SpotifyTopTracks = appendItems(stats.SpotifyTopTracks, tracks, trackItem)
+	}
+	if artists, err := s.spotifyService.GetTopArtists(ctx, accessToken, TOP_RANGE_SHORT, limit); err != nil {
+		slog.WarnContext(ctx, "top artists unavailable", "error", err)
+	} else {
+		stats.SpotifyTopArtists = appendItems(stats.SpotifyTopArtists, artists, artistItem)
+	}
+	return stats, nil
+}
+
+// HouseholdStats returns the stats of all users between from and to, looking artists up with the
+// access token of the controller. Zero times default like for UserStats.
+func (s *StatsService) HouseholdStats(ctx context.Context, from, to time.Time, limit int) (*HouseholdStats, error) {
+	plays, from, to, err := s.listPlays(ctx, 0, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := controllerAccessToken(ctx, s.sessions, s.spotifyService)
+	if err != nil {
+		// genres are left out
+		slog.DebugContext(ctx, "artists not looked up", "error", err)
+	}
+
+	users, err := s.users.List(ctx)
+	if err != nil {
+		return nil, pifyErrors.Wrap(pifyErrors.HISTORY_FAILED, err)
+	}
+	names := make(map[int64]string, len(users))
+	for _, user := range users {
+		names[user.Id] = cmp.Or(user.DisplayName, user.Username)
+	}
+
+	stats := &HouseholdStats{
+		Stats:     aggregatePlays(plays, s.lookupArtists(ctx, accessToken, plays), s.location, min(max(limit, 1), MAX_STATS_LIMIT)),
+		Listeners: listeners(plays, names),
+	}
+	stats.From, stats.To = from, to
+	return stats, nil
+}
+
+// WeeklyDigest returns the household stats of the last DIGEST_PERIOD.
+func (s *StatsService) WeeklyDigest(ctx context.Context) (*WeeklyDigest, error) {
+	to := s.now()
+	from := to.Add(-DIGEST_PERIOD)
+
+	household, err := s.HouseholdStats(ctx, from, to, DIGEST_LIMIT)
+	if err != nil {
+		return nil, err
+	}
+	previous, _, _, err := s.listPlays(ctx, 0, from.Add(-DIGEST_PERIOD), from)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &WeeklyDigest{HouseholdStats: *household}
+	for _, play := range previous {
+		digest.PreviousListenedMs += listenedMs(play)
+	}
+	return digest, nil
+}
+
+// listPlays returns the plays of the user, or of all users for a zero userId, with the range applied.
+func (s *StatsService) listPlays(ctx context.Context, userId int64, from, to time.Time) ([]*models.PlayEvent, time.Time, time.Time, error) {
+	if to.IsZero() {
+		to = s.now()
+	}
+	if from.IsZero() {
+		from = to.Add(-DEFAULT_STATS_PERIOD)
+	}
+	if !from.Before(to) {
+		return nil, from, to, errors.New(pifyErrors.INVALID_HISTORY_RANGE)
+	}
+
+	plays, err := s.plays.List(ctx, repositories.PlayFilter{UserId: userId, From: from, To: to})
+	if err != nil {
+		return nil, from, to, pifyErrors.Wrap(pifyErrors.HISTORY_FAILED, err)
+	}
+	return plays, from, to, nil
+}
+
+// lookupArtists returns the artists of plays, requesting those not seen before from Spotify. Without
+// an access token, or if Spotify fails, only the artists seen before are returned.
+func (s *StatsService) lookupArtists(ctx context.Context, accessToken string, plays []*models.PlayEvent) map[string]SpotifyArtist {
+	s.mu.Lock()
+	var missing []string
+	for _, play := range plays {
+		for _, id := range playArtistIds(play) {
+			if _, ok := s.artists[id]; !ok && !slices.Contains(missing, id) {
+				missing = append(missing, id)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if len(missing) > 0 && accessToken != "" {
+		artists, err := s.spotifyService.GetArtists(ctx, accessToken, missing)
+		s.mu.Lock()
+		if err != nil {
+			slog.WarnContext(ctx, "artists not looked up", "error", err)
+		} else {
+			// artists Spotify does not know are not asked for again
+			for _, id := range missing {
+				s.artists[id] = SpotifyArtist{Id: id}
+			}
+		}
+		for _, artist := range artists {
+			s.artists[artist.Id] = artist
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.artists)
+}
+
+// tally counts the plays and listening time of the entries of a top list, by id.
+type tally map[string]*StatsEntry
+
+func (t tally) add(id, name, subtitle string, ms int64) {
+	entry, ok := t[id]
+	if !ok {
+		entry = &StatsEntry{Id: id, Name: name, Subtitle: subtitle}
+		t[id] = entry
+	}
+	entry.Plays++
+	entry.ListenedMs += ms
+}
+
+// top returns the limit entries played most often, then longest, then by name.
+func (t tally) top(limit int) []StatsEntry {
+	entries := make([]StatsEntry, 0, len(t))
+	for _, entry := range t {
+		entries = append(entries, *entry)
+	}
+	slices.SortFunc(entries, func(a, b StatsEntry) int {
+		return cmp.Or(
+			cmp.Compare(b.Plays, a.Plays),
+			cmp.Compare(b.ListenedMs, a.ListenedMs),
+			cmp.Compare(a.Name, b.Name),
+			cmp.Compare(a.Id, b.Id),
+		)
+	})
+	return entries[:min(limit, len(entries))]
+}
+
+// aggregatePlays computes the stats of plays, with top lists of up to limit entries. artists gives
+// the names and genres of the artists, artists missing from it count without genres. Hours and
+// weekdays are those of loc.
+func aggregatePlays(plays []*models.PlayEvent, artists map[string]SpotifyArtist, loc *time.Location, limit int) Stats {
+	stats := Stats{
+		ListenedMsByHour:    make([]int64, 24),
+		ListenedMsByWeekday: make([]int64, 7),
+	}
+	tracks, artistTally, genres := tally{}, tally{}, tally{}
+	skipped := 0
+
+	for _, play := range plays {
+		ms := listenedMs(play)
+		stats.Plays++
+		stats.ListenedMs += ms
+		if play.Skipped {
+			skipped++
+		}
+
+		startedAt := play.StartedAt.In(loc)
+		stats.ListenedMsByHour[startedAt.Hour()] += ms
+		stats.ListenedMsByWeekday[startedAt.Weekday()] += ms
+
+		tracks.add(play.SpotifyTrackId, play.TrackName, play.ArtistNames, ms)
+
+		ids := playArtistIds(play)
+		var playGenres []string
+		for _, id := range ids {
+			artist := artists[id]
+			name := artist.Name
+			if name == "" && len(ids) == 1 {
+				name = play.ArtistNames
+			}
+			artistTally.add(id, cmp.Or(name, id), "", ms)
+
+			for _, genre := range artist.Genres {
+				if !slices.Contains(playGenres, genre) {
+					playGenres = append(playGenres, genre)
+				}
+			}
+		}
+		// a play counts once for every genre of its artists
+		for _, genre := range playGenres {
+			genres.add(genre, genre, "", ms)
+		}
+	}
+
+	if stats.Plays > 0 {
+		stats.SkipRate = float64(skipped) / float64(stats.Plays)
+	}
+	stats.TopTracks = tracks.top(limit)
+	stats.TopArtists = artistTally.top(limit)
+	stats.TopGenres = genres.top(limit)
+	// genres have no id
+	for i := range stats.TopGenres {
+		stats.TopGenres[i].Id = ""
+	}
+	return stats
+}
+
+// listeners returns how much every user of plays listened, most listening first.
+func listeners(plays []*models.PlayEvent, names map[int64]string) []Listener {
+	byUser := map[int64]*Listener{}
+	skipped := map[int64]int{}
+	for _, play := range plays {
+		listener, ok := byUser[play.UserId]
+		if !ok {
+			listener = &Listener{UserId: play.UserId, DisplayName: names[play.UserId]}
+			byUser[play.UserId] = listener
+		}
+		listener.Plays++
+		listener.ListenedMs += listenedMs(play)
+		if play.Skipped {
+			skipped[play.UserId]++
+		}
+	}
+
+	res := make([]Listener, 0, len(byUser))
+	for userId, listener := range byUser {
+		listener.SkipRate = float64(skipped[userId]) / float64(listener.Plays)
+		res = append(res, *listener)
+	}
+	slices.SortFunc(res, func(a, b Listener) int {
+		return cmp.Or(cmp.Compare(b.ListenedMs, a.ListenedMs), cmp.Compare(a.UserId, b.UserId))
+	})
+	return res
+}
+
+// listenedMs returns how long the track of play was listened to, the part of the track the play got
+// through, or the time between its start and end for tracks of unknown duration.
+func listenedMs(play *models.PlayEvent) int64 {
+	if play.DurationMs > 0 {
+		return int64(play.DurationMs) * int64(play.PlayedPercent) / 100
+	}
+	return max(play.PlayedAt.Sub(play.StartedAt).Milliseconds(), 0)
+}
+
+func playArtistIds(play *models.PlayEvent) []string {
+	if play.ArtistIds == "" {
+		return nil
+	}
+	return strings.Split(play.ArtistIds, ",")
+}
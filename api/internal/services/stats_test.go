@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/database/models"
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+// fixturePlay is a play of the stats fixtures, started at start and listened to for percent of the track.
+func fixturePlay(userId int64, trackId, name, artistIds, artistNames string, durationMs, percent int, start string) *models.PlayEvent {
+	startedAt, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		panic(err)
+	}
+	return &models.PlayEvent{
+		UserId:         userId,
+		SpotifyTrackId: trackId,
+		TrackName:      name,
+		ArtistIds:      artistIds,
+		ArtistNames:    artistNames,
+		DurationMs:     durationMs,
+		StartedAt:      startedAt,
+		PlayedAt:       startedAt.Add(time.Duration(durationMs*percent/100) * time.Millisecond),
+		PlayedPercent:  percent,
+		Skipped:        percent < PLAY_SKIP_PERCENT,
+		Source:         models.PLAY_SOURCE_POLLER,
+	}
+}
+
+// fixturePlays are a week of plays of two users, 930000 ms in total.
+func fixturePlays(alice, bob int64) []*models.PlayEvent {
+	return []*models.PlayEvent{
+		// Monday and Tuesday mornings
+		fixturePlay(alice, "t1", "One", "a1", "Band", 200000, 100, "2026-10-12T08:00:00Z"),
+		fixturePlay(alice, "t1", "One", "a1", "Band", 200000, 100, "2026-10-13T08:10:00Z"),
+		// skipped on Tuesday evening
+		fixturePlay(alice, "t2", "Two", "a1,a2", "Band, Singer", 100000, 30, "2026-10-13T20:00:00Z"),
+		// Saturday evening
+		fixturePlay(bob, "t3", "Three", "a3", "Solo", 300000, 100, "2026-10-17T20:30:00Z"),
+		fixturePlay(bob, "t1", "One", "a1", "Band", 200000, 100, "2026-10-17T21:00:00Z"),
+	}
+}
+
+var fixtureArtists = map[string]SpotifyArtist{
+	"a1": {Id: "a1", Name: "Band", Genres: []string{"indie", "rock"}},
+	"a2": {Id: "a2", Name: "Singer", Genres: []string{"pop", "indie"}},
+}
+
+func TestAggregatePlays(t *testing.T) {
+	stats := aggregatePlays(fixturePlays(1, 2), fixtureArtists, time.UTC, 10)
+
+	assert.Equal(t, 5, stats.Plays)
+	assert.Equal(t, int64(930000), stats.ListenedMs)
+	assert.InDelta(t, 0.2, stats.SkipRate, 0.0001)
+
+	assert.Equal(t, []StatsEntry{
+		{Id: "t1", Name: "One", Subtitle: "Band", Plays: 3, ListenedMs: 600000},
+		{Id: "t3", Name: "Three", Subtitle: "Solo", Plays: 1, ListenedMs: 300000},
+		{Id: "t2", Name: "Two", Subtitle: "Band, Singer", Plays: 1, ListenedMs: 30000},
+	}, stats.TopTracks)
+
+	// a3 is not known, its name is the artist names of its single artist track
+	assert.Equal(t, []StatsEntry{
+		{Id: "a1", Name: "Band", Plays: 4, ListenedMs: 630000},
+		{Id: "a3", Name: "Solo", Plays: 1, ListenedMs: 300000},
+		{Id: "a2", Name: "Singer", Plays: 1, ListenedMs: 30000},
+	}, stats.TopArtists)
+
+	// the skipped play of a1 and a2 counts once for indie
+	assert.Equal(t, []StatsEntry{
+		{Name: "indie", Plays: 4, ListenedMs: 630000},
+		{Name: "rock", Plays: 4, ListenedMs: 630000},
+		{Name: "pop", Plays: 1, ListenedMs: 30000},
+	}, stats.TopGenres)
+
+	byHour := make([]int64, 24)
+	byHour[8], byHour[20], byHour[21] = 400000, 330000, 200000
+	assert.Equal(t, byHour, stats.ListenedMsByHour)
+	assert.Equal(t, []int64{0, 200000, 230000, 0, 0, 0, 500000}, stats.ListenedMsByWeekday)
+}
+
+func TestAggregatePlaysInLocation(t *testing.T) {
+	// UTC+10, Tuesday 20:00 UTC is Wednesday 06:00 and Saturday 20:30 UTC is Sunday 06:30
+	stats := aggregatePlays(fixturePlays(1, 2), nil, time.FixedZone("AEST", 10*60*60), 2)
+
+	assert.Equal(t, int64(500000), stats.ListenedMsByWeekday[time.Sunday])
+	assert.Equal(t, int64(30000), stats.ListenedMsByWeekday[time.Wednesday])
+	assert.Equal(t, int64(330000), stats.ListenedMsByHour[6])
+	assert.Len(t, stats.TopTracks, 2)
+	assert.Empty(t, stats.TopGenres)
+	// without the artists, only the names of the artists of single artist tracks are known
+	assert.Equal(t, StatsEntry{Id: "a1", Name: "Band", Plays: 4, ListenedMs: 630000}, stats.TopArtists[0])
+	stats = aggregatePlays(fixturePlays(1, 2)[2:3], nil, time.UTC, 10)
+	assert.Equal(t, "a2", stats.TopArtists[1].Name)
+}
+
+func TestAggregateNoPlays(t *testing.T) {
+	stats := aggregatePlays(nil, nil, time.UTC, 10)
+
+	assert.Zero(t, stats.Plays)
+	assert.Zero(t, stats.SkipRate)
+	assert.NotNil(t, stats.TopTracks)
+	assert.Len(t, stats.ListenedMsByHour, 24)
+	assert.Len(t, stats.ListenedMsByWeekday, 7)
+}
+
+// newTestStatsService returns a stats service of the fixture plays of alice, the controller, and bob,
+// on a Spotify that knows the fixture artists.
+func newTestStatsService(t *testing.T) (*StatsService, *repositories.MemoryStore, *atomic.Int32) {
+	t.Helper()
+	ctx := context.Background()
+
+	store := repositories.NewMemoryStore()
+	saveTestController(t, store)
+	alice, err := store.Users().GetByUsername(ctx, "alice")
+	require.NoError(t, err)
+	bob, err := store.Users().Upsert(ctx, &models.User{Username: "bob", DisplayName: "Bob"})
+	require.NoError(t, err)
+	for _, play := range fixturePlays(alice.Id, bob.Id) {
+		_, err := store.Plays().Add(ctx, play)
+		require.NoError(t, err)
+	}
+
+	artistRequests := &atomic.Int32{}
+	spotifyService := newTestSpotifyService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/artists":
+			artistRequests.Add(1)
+			var artists []*SpotifyArtist
+			for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+				if artist, ok := fixtureArtists[id]; ok {
+					artists = append(artists, &artist)
+				} else {
+					artists = append(artists, nil)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]any{"artists": artists})
+		case "/v1/me/top/tracks":
+			assert.Equal(t, TOP_RANGE_SHORT, r.URL.Query().Get("time_range"))
+			w.Write([]byte(`{"items": [{"id": "t9", "name": "Elsewhere"}]}`))
+		case "/v1/me/top/artists":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	service := NewStatsService(store.Users(), store.Sessions(), store.Plays(), spotifyService)
+	service.location = time.UTC
+	service.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+	return service, store, artistRequests
+}
+
+func TestUserStats(t *testing.T) {
+	service, store, artistRequests := newTestStatsService(t)
+	ctx := context.Background()
+	alice, err := store.Users().GetByUsername(ctx, "alice")
+	require.NoError(t, err)
+
+	stats, err := service.UserStats(ctx, alice.Id, "access-token", time.Time{}, time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Plays)
+	assert.Equal(t, int64(430000), stats.ListenedMs)
+	assert.Equal(t, time.Date(2026, 9, 18, 12, 0, 0, 0, time.UTC), stats.From)
+	require.Len(t, stats.TopGenres, 3)
+	assert.Equal(t, "indie", stats.TopGenres[0].Name)
+
+	// Spotify's top artists failed, the rest is answered
+	require.Len(t, stats.SpotifyTopTracks, 1)
+	assert.Equal(t, "t9", stats.SpotifyTopTracks[0].Id)
+	assert.Empty(t, stats.SpotifyTopArtists)
+
+	// artists are looked up once
+	_, err = service.UserStats(ctx, alice.Id, "access-token", time.Time{}, time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), artistRequests.Load())
+
+	from := time.Date(2026, 10, 13, 12, 0, 0, 0, time.UTC)
+	stats, err = service.UserStats(ctx, alice.Id, "access-token", from, time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Plays)
+	assert.Equal(t, 1.0, stats.SkipRate)
+
+	_, err = service.UserStats(ctx, alice.Id, "access-token", from, from, 10)
+	assert.EqualError(t, err, pifyErrors.INVALID_HISTORY_RANGE)
+}
+
+func TestHouseholdStats(t *testing.T) {
+	service, _, _ := newTestStatsService(t)
+
+	stats, err := service.HouseholdStats(context.Background(), time.Time{}, time.Time{}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 5, stats.Plays)
+	require.Len(t, stats.TopTracks, 1)
+	assert.Equal(t, "t1", stats.TopTracks[0].Id)
+	require.Len(t, stats.TopGenres, 1)
+
+	require.Len(t, stats.Listeners, 2)
+	assert.Equal(t, "Bob", stats.Listeners[0].DisplayName)
+	assert.Equal(t, int64(500000), stats.Listeners[0].ListenedMs)
+	assert.Zero(t, stats.Listeners[0].SkipRate)
+	assert.Equal(t, 3, stats.Listeners[1].Plays)
+	assert.InDelta(t, 1.0/3, stats.Listeners[1].SkipRate, 0.0001)
+}
+
+func TestWeeklyDigest(t *testing.T) {
+	service, store, _ := newTestStatsService(t)
+	ctx := context.Background()
+
+	// the week before
+	_, err := store.Plays().Add(ctx, fixturePlay(1, "t4", "Four", "a1", "Band", 465000, 100, "2026-10-05T10:00:00Z"))
+	require.NoError(t, err)
+
+	digest, err := service.WeeklyDigest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 11, 12, 0, 0, 0, time.UTC), digest.From)
+	assert.Equal(t, 5, digest.Plays)
+	assert.Len(t, digest.TopTracks, 3)
+	assert.Equal(t, int64(465000), digest.PreviousListenedMs)
+
+	var card strings.Builder
+	require.NoError(t, RenderDigestCard(&card, digest))
+	assert.Contains(t, card.String(), "Oct 11 to Oct 18")
+	assert.Contains(t, card.String(), "15 min")
+	assert.Contains(t, card.String(), "&#43;100% on last week")
+	assert.Contains(t, card.String(), "<li>Band</li>")
+	assert.Contains(t, card.String(), "Bob 8 min, alice 7 min")
+}
+
+func TestRenderDigestCardEscapes(t *testing.T) {
+	digest := &WeeklyDigest{HouseholdStats: HouseholdStats{Stats: Stats{
+		Plays:     1,
+		TopTracks: []StatsEntry{{Name: "<script>alert(1)</script>"}},
+	}}}
+
+	var card strings.Builder
+	require.NoError(t, RenderDigestCard(&card, digest))
+	assert.NotContains(t, card.String(), "<script>")
+	assert.Contains(t, card.String(), "&lt;script&gt;")
+}
@@ -2,33 +2,25 @@ package services
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"time"
 
-	"github.com/edgejay/pify-player/api/internal/database"
 	"github.com/edgejay/pify-player/api/internal/database/models"
-	"github.com/uptrace/bun"
+	"github.com/edgejay/pify-player/api/internal/repositories"
 )
 
 type UserService struct {
-	db *database.SQLiteDB
+	users    repositories.UserRepository
+	sessions repositories.SessionRepository
 }
 
-func NewUserService(db *database.SQLiteDB) *UserService {
-	return &UserService{db}
+func NewUserService(users repositories.UserRepository, sessions repositories.SessionRepository) *UserService {
+	return &UserService{users, sessions}
 }
 
-func (s *UserService) GetUser(username string) (*models.User, error) {
-	user := &models.User{}
-
-	// Get user from database
-	err := s.db.Bun.NewSelect().
-		Model(user).
-		Where("username = ?", username).
-		Where("deleted_at IS NULL").
-		Scan(context.Background())
-
-	if err == sql.ErrNoRows {
+func (s *UserService) GetUser(ctx context.Context, username string) (*models.User, error) {
+	user, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, repositories.ErrNotFound) {
 		return nil, nil
 	}
 
@@ -39,86 +31,35 @@ func (s *UserService) GetUser(username string) (*models.User, error) {
 	return user, nil
 }
 
-func (s *UserService) SaveUser(spotifyUser *SpotifyUser) (*models.User, error) {
-	// check if user by username exists
-	user, err := s.GetUser(spotifyUser.Id)
-	if err != nil {
-		return nil, err
-	}
-
+func (s *UserService) SaveUser(ctx context.Context, spotifyUser *SpotifyUser) (*models.User, error) {
 	profileImageUrl := ""
 	if len(spotifyUser.Images) > 0 {
 		profileImageUrl = spotifyUser.Images[0].Url
 	}
 
-	// Update existing user record if found
-	if user != nil && user.Id > 0 {
-		_, err := s.db.Bun.NewUpdate().
-			Model((*models.User)(nil)).
-			Set("display_name = ?", spotifyUser.DisplayName).
-			Set("profile_image_url = ?", profileImageUrl).
-			Where("username = ?", spotifyUser.Id).
-			Exec(context.Background())
-
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// or else create new user
-		_, err := s.db.Bun.NewInsert().
-			Model(&models.User{
-				Username:        spotifyUser.Id,
-				DisplayName:     spotifyUser.DisplayName,
-				ProfileImageUrl: profileImageUrl,
-				DeletedAt:       nil,
-			}).
-			Exec(context.Background())
-
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	// Get user from database
-	user, err = s.GetUser(spotifyUser.Id)
-	if err != nil {
-		return nil, err
-	}
-
-	return user, nil
+	// create the user or update the existing record, restoring it if it was deleted
+	return s.users.Upsert(ctx, &models.User{
+		Username:        spotifyUser.Id,
+		DisplayName:     spotifyUser.DisplayName,
+		ProfileImageUrl: profileImageUrl,
+	})
 }
 
-func (s *UserService) SessionExists(sessionId string) (bool, error) {
-	// check if session exists
-	session := &models.UserSession{}
+func (s *UserService) SessionExists(ctx context.Context, sessionId string) (bool, error) {
+	_, err := s.sessions.Get(ctx, sessionId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false, nil
+	}
 
-	return s.db.Bun.NewSelect().
-		Model(session).
-		Where("uuid = ?", sessionId).
-		Where("deleted_at IS NULL").
-		Exists(context.Background())
+	return err == nil, err
 }
 
-func (s *UserService) GetSession(sessionId string) (*models.UserSession, error) {
-	// fetch session
-	session := &models.UserSession{}
-
-	// Get user from database
-	if err := s.db.Bun.NewSelect().
-		Model(session).
-		Relation("User", func(sq *bun.SelectQuery) *bun.SelectQuery {
-			return sq.Column("display_name", "profile_image_url")
-		}).
-		Where("user_session.uuid = ?", sessionId).
-		Where("user_session.deleted_at IS NULL").
-		Scan(context.Background()); err != nil {
-		return nil, err
-	}
-
-	return session, nil
+func (s *UserService) GetSession(ctx context.Context, sessionId string) (*models.UserSession, error) {
+	return s.sessions.Get(ctx, sessionId)
 }
 
 func (s *UserService) SaveSession(
+	ctx context.Context,
 	userId int64,
 	sessionId,
 	userAgent,
@@ -126,80 +67,50 @@ func (s *UserService) SaveSession(
 	refreshToken string,
 	accessTokenExpiresAt time.Time,
 ) (*models.UserSession, error) {
-	// check if session exists
-	exists, err := s.SessionExists(sessionId)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if !exists {
-		// create new session
-		_, err = s.db.Bun.NewInsert().
-			Model(&models.UserSession{
-				UserId:                userId,
-				Uuid:                  sessionId,
-				UserAgent:             userAgent,
-				AccessToken:           accessToken,
-				RefreshToken:          refreshToken,
-				AccessTokenExpiresAt:  accessTokenExpiresAt,
-				RefreshTokenExpiresAt: nil,
-				DeletedAt:             nil,
-			}).
-			Exec(context.Background())
-
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	// fetch session
-	return s.GetSession(sessionId)
+	// create the session, or log in again with an existing session id
+	return s.sessions.Upsert(ctx, &models.UserSession{
+		UserId:               userId,
+		Uuid:                 sessionId,
+		UserAgent:            userAgent,
+		AccessToken:          accessToken,
+		RefreshToken:         refreshToken,
+		AccessTokenExpiresAt: accessTokenExpiresAt,
+	})
 }
 
 func (s *UserService) UpdateSessionAccessToken(
+	ctx context.Context,
 	sessionId,
 	accessToken string,
 	accessTokenExpiresAt time.Time,
 ) (*models.UserSession, error) {
-	_, err := s.db.Bun.NewUpdate().
-		Model((*models.UserSession)(nil)).
-		Set("access_token = ?", accessToken).
-		Set("access_token_expires_at = ?", accessTokenExpiresAt).
-		Where("uuid = ?", sessionId).
-		Exec(context.Background())
-
-	if err != nil {
+	if err := s.sessions.UpdateAccessToken(ctx, sessionId, accessToken, accessTokenExpiresAt); err != nil {
 		return nil, err
 	}
 
 	// fetch session
-	return s.GetSession(sessionId)
+	return s.sessions.Get(ctx, sessionId)
 }
 
-func (s *UserService) SetSessionAsController(sessionId string) (*models.UserSession, error) {
-	_, err := s.db.Bun.NewUpdate().
-		Model((*models.UserSession)(nil)).
-		Set("is_controller = 1").
-		Where("uuid = ?", sessionId).
-		Exec(context.Background())
-
-	if err != nil {
+func (s *UserService) SetSessionAsController(ctx context.Context, sessionId string) (*models.UserSession, error) {
+	if err := s.sessions.SetController(ctx, sessionId); err != nil {
 		return nil, err
 	}
 
 	// fetch session
-	return s.GetSession(sessionId)
+	return s.sessions.Get(ctx, sessionId)
+}
+
+func (s *UserService) DeleteSession(ctx context.Context, sessionId string) error {
+	return s.sessions.Delete(ctx, sessionId)
+}
+
+// CountActiveSessions returns the number of sessions that have not been deleted.
+func (s *UserService) CountActiveSessions(ctx context.Context) (int, error) {
+	return s.sessions.CountActive(ctx)
 }
 
-func (s *UserService) DeleteSession(sessionId string) error {
-	_, err := s.db.Bun.NewDelete().
-		Model((*models.UserSession)(nil)).
-		Where("uuid = ?", sessionId).
-		Exec(context.Background())
-	return err
+// CountControllerSessions returns the number of sessions with controller privileges.
+func (s *UserService) CountControllerSessions(ctx context.Context) (int, error) {
+	return s.sessions.CountControllers(ctx)
 }
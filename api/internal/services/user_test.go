@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/edgejay/pify-player/api/internal/repositories"
+)
+
+func newTestUserService() *UserService {
+	store := repositories.NewMemoryStore()
+	return NewUserService(store.Users(), store.Sessions())
+}
+
+func TestGetUserNotFound(t *testing.T) {
+	user, err := newTestUserService().GetUser(context.Background(), "nobody")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+}
+
+func TestSaveUserUpserts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestUserService()
+
+	first, err := s.SaveUser(ctx, &SpotifyUser{Id: "alice", DisplayName: "Alice"})
+	require.NoError(t, err)
+
+	second, err := s.SaveUser(ctx, &SpotifyUser{Id: "alice", DisplayName: "Alice B"})
+	require.NoError(t, err)
+	assert.Equal(t, first.Id, second.Id)
+	assert.Equal(t, "Alice B", second.DisplayName)
+}
+
+func TestSaveSessionUpserts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestUserService()
+
+	user, err := s.SaveUser(ctx, &SpotifyUser{Id: "alice", DisplayName: "Alice"})
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	_, err = s.SaveSession(ctx, user.Id, "session", "ua", "first-token", "refresh", expiresAt)
+	require.NoError(t, err)
+
+	// logging in again with a deleted session restores it with the new tokens
+	require.NoError(t, s.DeleteSession(ctx, "session"))
+	session, err := s.SaveSession(ctx, user.Id, "session", "ua", "second-token", "refresh", expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, "second-token", session.AccessToken)
+
+	count, err := s.CountActiveSessions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi/transport"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+
+	pifyErrors "github.com/edgejay/pify-player/api/internal/errors"
+)
+
+type YoutubeService struct {
+	referer    string
+	httpClient *http.Client
+}
+
+// NewYoutubeService creates a service for the YouTube Data API. Requests are authenticated with apiKey
+// and sent with referer as Referer header, as required by API keys restricted to websites.
+func NewYoutubeService(apiKey, referer string, httpClient *http.Client) *YoutubeService {
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Timeout: time.Second * 30,
+		}
+	}
+
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// api key has to be added by the transport, as option.WithAPIKey is ignored when a http client is provided
+	client := *httpClient
+	client.Transport = &transport.APIKey{Key: apiKey, Transport: base}
+
+	return &YoutubeService{referer, &client}
+}
+
+// SearchVideoId returns the id of the first video matching query.
+func (s *YoutubeService) SearchVideoId(ctx context.Context, query string) (string, error) {
+	service, err := youtube.NewService(ctx, option.WithHTTPClient(s.httpClient))
+	if err != nil {
+		return "", err
+	}
+
+	call := service.Search.List([]string{"snippet"}).
+		Q(query).
+		Type("video").
+		MaxResults(1)
+
+	call.Header().Set("Referer", s.referer)
+
+	response, err := call.Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+
+	if len(response.Items) == 0 {
+		return "", errors.New(pifyErrors.NO_YOUTUBE_VIDEO_FOUND)
+	}
+
+	return response.Items[0].Id.VideoId, nil
+}
@@ -4,6 +4,9 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/edgejay/pify-player/api/internal/ratelimit"
 )
 
 func TestGetServerSettings(t *testing.T) {
@@ -15,22 +18,28 @@ func TestGetServerSettings(t *testing.T) {
 		{
 			name: "basic settings",
 			envVars: map[string]string{
-				"PORT":         "8080",
-				"CORS_ORIGINS": "http://localhost:3000,http://example.com",
-				"SSL_DOMAIN":   "example.com",
+				"SERVER_PORT":     "8080",
+				"CORS_ORIGINS":    "http://localhost:3000,http://example.com",
+				"SSL_DOMAIN":      "example.com",
+				"TLS_MODE":        "plain",
+				"TRUSTED_PROXIES": "172.16.0.0/12, 10.0.0.1/32,",
 			},
 			expected: ServerSettings{
-				Port:        "8080",
-				CorsOrigins: []string{"http://localhost:3000", "http://example.com"},
-				SslDomain:   "example.com",
+				Port:           "8080",
+				CorsOrigins:    []string{"http://localhost:3000", "http://example.com"},
+				SslDomain:      "example.com",
+				TlsMode:        "plain",
+				TrustedProxies: []string{"172.16.0.0/12", "10.0.0.1/32"},
 			},
 		},
 		{
 			name: "empty settings",
 			envVars: map[string]string{
-				"PORT":         "",
-				"CORS_ORIGINS": "",
-				"SSL_DOMAIN":   "",
+				"SERVER_PORT":     "",
+				"CORS_ORIGINS":    "",
+				"SSL_DOMAIN":      "",
+				"TLS_MODE":        "",
+				"TRUSTED_PROXIES": "",
 			},
 			expected: ServerSettings{
 				Port:        "",
@@ -60,3 +69,105 @@ func TestGetServerSettings(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		limit    string
+		expected ratelimit.Policy
+		wantErr  bool
+	}{
+		{limit: "60/1m", expected: ratelimit.Policy{Rate: 1, Burst: 60}},
+		{limit: "10/2s", expected: ratelimit.Policy{Rate: 5, Burst: 10}},
+		{limit: "off", expected: ratelimit.Policy{}},
+		{limit: "", wantErr: true},
+		{limit: "60", wantErr: true},
+		{limit: "0/1m", wantErr: true},
+		{limit: "60/0s", wantErr: true},
+		{limit: "sixty/1m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRateLimit(%q) error = %v, wantErr %v", tt.limit, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.expected {
+				t.Errorf("ParseRateLimit(%q) = %v, want %v", tt.limit, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetRateLimitSettings(t *testing.T) {
+	t.Setenv("RATE_LIMIT_AUTH", "5/1s")
+	t.Setenv("RATE_LIMIT_ADMIN", "off")
+	t.Setenv("RATE_LIMIT_DEVICE", "invalid")
+	t.Setenv("LOCKOUT_THRESHOLD", "3")
+	t.Setenv("LOCKOUT_DURATION", "30s")
+
+	got := GetRateLimitSettings()
+	if got.Groups["auth"] != (ratelimit.Policy{Rate: 5, Burst: 5}) {
+		t.Errorf("auth limit = %v", got.Groups["auth"])
+	}
+	if got.Groups["admin"].Enabled() {
+		t.Errorf("admin limit = %v, want disabled", got.Groups["admin"])
+	}
+	if got.Groups["device"] != (ratelimit.Policy{Rate: 1, Burst: 60}) {
+		t.Errorf("device limit = %v, want the default", got.Groups["device"])
+	}
+	expected := ratelimit.LockoutPolicy{Threshold: 3, Duration: 30 * time.Second, MaxDuration: DEFAULT_LOCKOUT_MAX_DURATION}
+	if got.Lockout != expected {
+		t.Errorf("lockout = %v, want %v", got.Lockout, expected)
+	}
+}
+
+func TestGetPlaybackPollInterval(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":        DEFAULT_PLAYBACK_POLL_INTERVAL,
+		"invalid": DEFAULT_PLAYBACK_POLL_INTERVAL,
+		"2s":      2 * time.Second,
+		"0":       0,
+		"off":     0,
+	}
+
+	for value, expected := range tests {
+		t.Setenv("PLAYBACK_POLL_INTERVAL", value)
+		if got := GetPlaybackPollInterval(); got != expected {
+			t.Errorf("GetPlaybackPollInterval() with %q = %v, want %v", value, got, expected)
+		}
+	}
+}
+
+func TestGetWatchdogInterval(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":        DEFAULT_WATCHDOG_INTERVAL,
+		"invalid": DEFAULT_WATCHDOG_INTERVAL,
+		"1m":      time.Minute,
+		"0":       0,
+		"off":     0,
+	}
+
+	for value, expected := range tests {
+		t.Setenv("WATCHDOG_INTERVAL", value)
+		if got := GetWatchdogInterval(); got != expected {
+			t.Errorf("GetWatchdogInterval() with %q = %v, want %v", value, got, expected)
+		}
+	}
+}
+
+func TestGetScrobbleSettings(t *testing.T) {
+	t.Setenv("SCROBBLE_API_URL", "")
+	t.Setenv("SCROBBLE_RETRY_INTERVAL", "invalid")
+	got := GetScrobbleSettings()
+	if got.ApiUrl != DEFAULT_SCROBBLE_API_URL || got.RetryInterval != DEFAULT_SCROBBLE_RETRY_INTERVAL {
+		t.Errorf("GetScrobbleSettings() = %+v, want the defaults", got)
+	}
+
+	t.Setenv("SCROBBLE_API_URL", "https://scrobble.example.com/2.0/")
+	t.Setenv("SCROBBLE_RETRY_INTERVAL", "5m")
+	got = GetScrobbleSettings()
+	if got.ApiUrl != "https://scrobble.example.com/2.0/" || got.RetryInterval != 5*time.Minute {
+		t.Errorf("GetScrobbleSettings() = %+v, want the api url and retry interval of the env", got)
+	}
+}
@@ -0,0 +1,53 @@
+package version
+
+import (
+	"runtime/debug"
+)
+
+// GitSHA is the git commit the binary was built from. It is set at build time via ldflags:
+//
+//	go build -ldflags "-X github.com/edgejay/pify-player/api/internal/version.GitSHA=$(git rev-parse --short HEAD)"
+var GitSHA = ""
+
+type BuildInfo struct {
+	GitSHA      string `json:"git_sha"`
+	GoVersion   string `json:"go_version"`
+	Module      string `json:"module"`
+	Version     string `json:"version"`
+	VcsRevision string `json:"vcs_revision"`
+	VcsTime     string `json:"vcs_time"`
+	VcsModified bool   `json:"vcs_modified"`
+}
+
+// GetBuildInfo combines the git SHA injected via ldflags with the build information embedded
+// into the binary by the Go toolchain.
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{GitSHA: GitSHA}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.GoVersion = buildInfo.GoVersion
+	info.Module = buildInfo.Main.Path
+	info.Version = buildInfo.Main.Version
+
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.VcsRevision = setting.Value
+		case "vcs.time":
+			info.VcsTime = setting.Value
+		case "vcs.modified":
+			info.VcsModified = setting.Value == "true"
+		}
+	}
+
+	// fall back to the revision stamped by the Go toolchain if ldflags were not provided
+	if info.GitSHA == "" {
+		info.GitSHA = info.VcsRevision
+	}
+
+	return info
+}
@@ -10,7 +10,8 @@ cd /home/workbench-rpi-admin/repos/pify-player && make start
 # Refer to Makefile for more details
 nohup host_handler > /home/workbench-rpi-admin/repos/pify-player/scripts/host_handler.log 2>&1 &
 
-until [ "`docker inspect -f {{.State.Running}} pify-player-api`"=="true" ]; do
+# wait until api is ready to serve requests (database, migrations, Spotify credentials and certs)
+until curl -fsk https://localhost:8080/readyz > /dev/null; do
     sleep 0.5;
 done;
 